@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// AccountPurgeInterval is how often accounts past their grace period are purged
+	AccountPurgeInterval = time.Hour
+	// accountDeletionRetryWindow is how long deletion events are re-published to services that have not confirmed
+	accountDeletionRetryWindow = 7 * 24 * time.Hour
+	accountExportTimeout       = 10 * time.Second
+)
+
+// AccountDeletion is published on NatsSubjectAccountDeleted when an account is purged.
+// Services delete the user's data and answer with an AccountDeletionDone; the event may arrive more than once.
+type AccountDeletion struct {
+	UserID      string    `json:"user_id"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// AccountDeletionDone is published on NatsSubjectAccountDeletionDone by a service that removed a user's data
+type AccountDeletionDone struct {
+	UserID  string `json:"user_id"`
+	Service string `json:"service"`
+}
+
+// AccountExportRequest asks a service for a user's data on NatsSubjectAccountExport.<service>
+type AccountExportRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// AccountExportReply carries a service's records of the user and the S3 keys of the files to include
+type AccountExportReply struct {
+	Service      string              `json:"service"`
+	Instructions json.RawMessage     `json:"instructions"`
+	Files        []AccountExportFile `json:"files"`
+	Error        string              `json:"error,omitempty"`
+}
+
+type AccountExportFile struct {
+	Path string `json:"path"` // Path inside the service's folder of the archive
+	Key  string `json:"key"`  // S3 object key
+}
+
+// AccountTombstone is the audit record left behind by a purged account. It holds no personal data
+// beyond a hash of the email, and records which services confirmed the deletion.
+type AccountTombstone struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID            string             `json:"user_id" bson:"user_id"`
+	EmailHash         string             `json:"email_hash" bson:"email_hash"`
+	RequestedAt       time.Time          `json:"requested_at" bson:"requested_at"`
+	DeletedAt         time.Time          `json:"deleted_at" bson:"deleted_at"`
+	CompletedServices []string           `json:"completed_services" bson:"completed_services,omitempty"`
+}
+
+func NewAccountTombstone(user *User) *AccountTombstone {
+	requestedAt := time.Now().UTC()
+	if user.DeletionRequestedAt != nil {
+		requestedAt = *user.DeletionRequestedAt
+	}
+	return &AccountTombstone{
+		UserID:      user.ID.Hex(),
+		EmailHash:   HashEmail(user.Email),
+		RequestedAt: requestedAt,
+		DeletedAt:   time.Now().UTC(),
+	}
+}
+
+// HashEmail returns the SHA256 hex digest of the normalized email
+func HashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,312 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// AccountHandler schedules account deletion, purges accounts past their grace period
+// and exports a user's data across services
+type AccountHandler struct {
+	users       *UserHandler
+	passkeyRepo IPasskeyRepository
+	apiKeys     *APIKeyHandler
+	tombstones  IAccountTombstoneRepository
+	store       IObjectStore
+	events      IEventPublisher
+	requester   IServiceRequester
+}
+
+func NewAccountHandler(users *UserHandler, passkeyRepo IPasskeyRepository, apiKeys *APIKeyHandler, tombstones IAccountTombstoneRepository, store IObjectStore, events IEventPublisher, requester IServiceRequester) *AccountHandler {
+	return &AccountHandler{
+		users:       users,
+		passkeyRepo: passkeyRepo,
+		apiKeys:     apiKeys,
+		tombstones:  tombstones,
+		store:       store,
+		events:      events,
+		requester:   requester,
+	}
+}
+
+// RequestDeletion schedules the account to be purged after the grace period and signs out every device.
+// The user confirms by typing their email address, and may cancel by signing in again before the deadline.
+func (h *AccountHandler) RequestDeletion(c *fiber.Ctx) error {
+	log.Info("RequestDeletion: Scheduling account deletion")
+
+	var input struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	user := h.users.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return profileUserNotFound(c)
+	}
+	if !strings.EqualFold(strings.TrimSpace(input.Confirm), user.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrDeletionConfirmMismatch,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	scheduledAt := time.Now().UTC().AddDate(0, 0, h.users.cfg.AccountDeletionGraceDays)
+	if err := h.users.userRepo.ScheduleDeletion(userId, &scheduledAt); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if err := h.users.revokeAllSessions(userId); err != nil {
+		log.Errorf("RequestDeletion: Failed to sign out user %s: %v", userId, err)
+	}
+
+	if err := h.users.mailer.Send(user.Email, user.Locale, MailAccountDeletion, AccountDeletionMail{
+		ScheduledAt: scheduledAt,
+	}); err != nil {
+		log.Errorf("RequestDeletion: Failed to email user %s: %v", userId, err)
+	}
+
+	log.Infof("RequestDeletion: Account %s scheduled for deletion at %s", userId, scheduledAt)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Account scheduled for deletion",
+		"errors":  nil,
+		"data":    fiber.Map{"deletion_scheduled_at": scheduledAt},
+	})
+}
+
+// CancelDeletion keeps an account that is scheduled for deletion
+func (h *AccountHandler) CancelDeletion(c *fiber.Ctx) error {
+	log.Info("CancelDeletion: Cancelling account deletion")
+
+	userId, _ := c.Locals("userId").(string)
+	user := h.users.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return profileUserNotFound(c)
+	}
+	if user.DeletionScheduledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrDeletionNotScheduled,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.users.userRepo.ScheduleDeletion(userId, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("CancelDeletion: Deletion of account %s cancelled", userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Account deletion cancelled",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// PurgeDueAccounts deletes the accounts whose grace period has ended and asks the other services
+// to delete their data. Services that have not confirmed an earlier purge are asked again.
+func (h *AccountHandler) PurgeDueAccounts() {
+	users, err := h.users.userRepo.FindDueForDeletion(time.Now().UTC())
+	if err != nil {
+		return
+	}
+	for i := range users {
+		if err := h.purgeAccount(&users[i]); err != nil {
+			log.Errorf("PurgeDueAccounts: Failed to purge account %s: %v", users[i].ID.Hex(), err)
+		}
+	}
+
+	pending, err := h.tombstones.FindIncompleteTombstones(h.users.cfg.AccountServices, time.Now().UTC().Add(-accountDeletionRetryWindow))
+	if err != nil {
+		return
+	}
+	for _, tombstone := range pending {
+		h.publishDeletion(tombstone.UserID, tombstone.RequestedAt)
+	}
+}
+
+// purgeAccount removes the user and everything the auth service holds for them. The tombstone is written
+// first, so a purge interrupted halfway is still recorded and the deletion event is re-sent.
+func (h *AccountHandler) purgeAccount(user *User) error {
+	userID := user.ID.Hex()
+	tombstone := NewAccountTombstone(user)
+	if err := h.tombstones.SaveTombstone(tombstone); err != nil {
+		return err
+	}
+	h.publishDeletion(userID, tombstone.RequestedAt)
+
+	if err := h.apiKeys.DeleteUserKeys(userID); err != nil {
+		return err
+	}
+	if err := h.passkeyRepo.DeletePasskeysByUserID(userID); err != nil {
+		return err
+	}
+	if err := h.users.sessionRepo.DeleteUserSessions(userID); err != nil {
+		return err
+	}
+	if user.AvatarKey != "" {
+		if err := h.store.Delete(user.AvatarKey); err != nil {
+			log.Warnf("purgeAccount: Failed to delete avatar of user %s: %v", userID, err)
+		}
+	}
+	if err := h.users.userRepo.DeleteUser(userID); err != nil {
+		return err
+	}
+
+	log.Infof("purgeAccount: Account %s purged", userID)
+	return nil
+}
+
+func (h *AccountHandler) publishDeletion(userID string, requestedAt time.Time) {
+	data, _ := json.Marshal(AccountDeletion{UserID: userID, RequestedAt: requestedAt})
+	if err := h.events.Publish(h.users.cfg.NatsSubjectAccountDeleted, data); err != nil {
+		log.Errorf("publishDeletion: Failed to publish deletion of %s: %v", userID, err)
+	}
+}
+
+// AccountDeletionDoneMessage records a service's confirmation that it deleted a user's data
+func (h *AccountHandler) AccountDeletionDoneMessage(data []byte) {
+	var done AccountDeletionDone
+	if err := json.Unmarshal(data, &done); err != nil || done.UserID == "" || done.Service == "" {
+		log.Warnf("AccountDeletionDoneMessage: Invalid message: %s", string(data))
+		return
+	}
+	if err := h.tombstones.MarkServiceDeleted(done.UserID, done.Service); err != nil {
+		return
+	}
+	log.Infof("AccountDeletionDoneMessage: %s deleted the data of %s", done.Service, done.UserID)
+}
+
+// ExportData returns a ZIP archive with the user's profile, devices, credentials and,
+// for every service, the instruction history and the output files that are still available
+func (h *AccountHandler) ExportData(c *fiber.Ctx) error {
+	log.Info("ExportData: Exporting account data")
+
+	userId, _ := c.Locals("userId").(string)
+	user := h.users.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return profileUserNotFound(c)
+	}
+
+	sessions, err := h.users.sessionRepo.GetUserSessions(userId)
+	if err != nil {
+		return exportFailed(c, fiber.StatusInternalServerError, ErrInternalServer)
+	}
+	passkeys, err := h.passkeyRepo.FindPasskeysByUserID(userId)
+	if err != nil {
+		return exportFailed(c, fiber.StatusInternalServerError, ErrInternalServer)
+	}
+	apiKeys, err := h.apiKeys.apiKeyRepo.FindAPIKeysByUserID(userId)
+	if err != nil {
+		return exportFailed(c, fiber.StatusInternalServerError, ErrInternalServer)
+	}
+
+	replies := make([]AccountExportReply, 0, len(h.users.cfg.AccountServices))
+	for _, service := range h.users.cfg.AccountServices {
+		reply, err := h.requestExport(service, userId)
+		if err != nil {
+			log.Errorf("ExportData: %s export failed for user %s: %v", service, userId, err)
+			return exportFailed(c, fiber.StatusServiceUnavailable, ErrExportUnavailable)
+		}
+		replies = append(replies, *reply)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	entries := map[string]interface{}{
+		"profile.json":  user,
+		"devices.json":  sessions,
+		"passkeys.json": passkeys,
+		"api_keys.json": apiKeys,
+	}
+	for name, value := range entries {
+		if err := writeJSONEntry(archive, name, value); err != nil {
+			return exportFailed(c, fiber.StatusInternalServerError, ErrInternalServer)
+		}
+	}
+	for _, reply := range replies {
+		if err := writeJSONEntry(archive, reply.Service+"/instructions.json", reply.Instructions); err != nil {
+			return exportFailed(c, fiber.StatusInternalServerError, ErrInternalServer)
+		}
+		for _, file := range reply.Files {
+			data := h.store.Get(file.Key)
+			if data == nil {
+				continue
+			}
+			w, err := archive.Create(path.Join(reply.Service, "files", path.Clean("/"+file.Path)))
+			if err != nil {
+				return exportFailed(c, fiber.StatusInternalServerError, ErrInternalServer)
+			}
+			if _, err := w.Write(data); err != nil {
+				return exportFailed(c, fiber.StatusInternalServerError, ErrInternalServer)
+			}
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return exportFailed(c, fiber.StatusInternalServerError, ErrInternalServer)
+	}
+
+	log.Infof("ExportData: Exported %d bytes for user %s", buf.Len(), userId)
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="instrlabs-export.zip"`)
+	return c.Send(buf.Bytes())
+}
+
+// requestExport asks a service for its records of the user over NATS
+func (h *AccountHandler) requestExport(service string, userID string) (*AccountExportReply, error) {
+	data, _ := json.Marshal(AccountExportRequest{UserID: userID})
+	msg, err := h.requester.Request(h.users.cfg.NatsSubjectAccountExport+"."+service, data, accountExportTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply AccountExportReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("%s", reply.Error)
+	}
+	reply.Service = service
+	return &reply, nil
+}
+
+func writeJSONEntry(archive *zip.Writer, name string, value interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func exportFailed(c *fiber.Ctx, status int, message string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"message": message,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryTombstones is an in-memory IAccountTombstoneRepository
+type memoryTombstones struct {
+	tombstones []AccountTombstone
+}
+
+func (m *memoryTombstones) SaveTombstone(tombstone *AccountTombstone) error {
+	for _, t := range m.tombstones {
+		if t.UserID == tombstone.UserID {
+			return nil
+		}
+	}
+	m.tombstones = append(m.tombstones, *tombstone)
+	return nil
+}
+
+func (m *memoryTombstones) MarkServiceDeleted(userID string, service string) error {
+	for i, t := range m.tombstones {
+		if t.UserID == userID && !containsString(t.CompletedServices, service) {
+			m.tombstones[i].CompletedServices = append(t.CompletedServices, service)
+		}
+	}
+	return nil
+}
+
+func (m *memoryTombstones) FindIncompleteTombstones(services []string, since time.Time) ([]AccountTombstone, error) {
+	pending := []AccountTombstone{}
+	for _, t := range m.tombstones {
+		if !t.DeletedAt.After(since) {
+			continue
+		}
+		for _, service := range services {
+			if !containsString(t.CompletedServices, service) {
+				pending = append(pending, t)
+				break
+			}
+		}
+	}
+	return pending, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeServices answers export requests with canned replies per subject
+type fakeServices struct {
+	replies map[string]AccountExportReply
+}
+
+func (f *fakeServices) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	reply, ok := f.replies[subject]
+	if !ok {
+		return nil, nats.ErrNoResponders
+	}
+	out, _ := json.Marshal(reply)
+	return &nats.Msg{Subject: subject, Data: out}, nil
+}
+
+type accountTestEnv struct {
+	app        *fiber.App
+	handler    *AccountHandler
+	users      *MockUserRepository
+	passkeys   *MockPasskeyRepository
+	apiKeys    *memoryAPIKeys
+	tombstones *memoryTombstones
+	store      *memoryObjectStore
+	events     *recordingPublisher
+	services   *fakeServices
+}
+
+func newAccountTestEnv(sessionRepo *MockSessionRepository, users ...*User) *accountTestEnv {
+	env := &accountTestEnv{
+		users:      profileUsers(users...),
+		passkeys:   NewMockPasskeyRepository(),
+		apiKeys:    &memoryAPIKeys{},
+		tombstones: &memoryTombstones{},
+		store:      &memoryObjectStore{objects: map[string][]byte{}},
+		events:     &recordingPublisher{},
+		services:   &fakeServices{replies: map[string]AccountExportReply{}},
+	}
+	env.users.ScheduleDeletionFunc = func(userID string, at *time.Time) error {
+		user := env.users.FindByIDFunc(userID)
+		user.DeletionScheduledAt = at
+		return nil
+	}
+
+	cfg := newMockConfig()
+	userHandler := NewUserHandler(cfg, env.users, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	apiKeyHandler := NewAPIKeyHandler(cfg, env.apiKeys, env.users, env.events)
+	env.handler = NewAccountHandler(userHandler, env.passkeys, apiKeyHandler, env.tombstones, env.store, env.events, env.services)
+
+	env.app = fiber.New()
+	env.app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	env.app.Get("/account/export", env.handler.ExportData)
+	env.app.Post("/account/delete", env.handler.RequestDeletion)
+	env.app.Post("/account/delete/cancel", env.handler.CancelDeletion)
+	return env
+}
+
+func TestRequestDeletion_SchedulesAndCancels(t *testing.T) {
+	user := NewUser("user@example.com")
+	signedOut := false
+	env := newAccountTestEnv(&MockSessionRepository{ClearAllUserSessionsFunc: func(userID string) error {
+		signedOut = userID == user.ID.Hex()
+		return nil
+	}}, user)
+
+	status, body := apiKeyRequest(t, env.app, fiber.MethodPost, "/account/delete", user.ID.Hex(), `{"confirm":"someone@example.com"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, ErrDeletionConfirmMismatch, body["message"])
+	assert.Nil(t, user.DeletionScheduledAt)
+
+	status, _ = apiKeyRequest(t, env.app, fiber.MethodPost, "/account/delete", user.ID.Hex(), `{"confirm":"User@Example.com"}`)
+	require.Equal(t, fiber.StatusAccepted, status)
+	require.NotNil(t, user.DeletionScheduledAt)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 14), *user.DeletionScheduledAt, time.Minute)
+	assert.True(t, signedOut)
+
+	status, _ = apiKeyRequest(t, env.app, fiber.MethodPost, "/account/delete/cancel", user.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Nil(t, user.DeletionScheduledAt)
+
+	status, body = apiKeyRequest(t, env.app, fiber.MethodPost, "/account/delete/cancel", user.ID.Hex(), "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, ErrDeletionNotScheduled, body["message"])
+}
+
+func TestPurgeDueAccounts_RemovesDataAndRetriesUntilConfirmed(t *testing.T) {
+	user := NewUser("user@example.com")
+	user.AvatarKey = "avatars/" + user.ID.Hex() + "/0123456789abcdef.jpg"
+	requestedAt := time.Now().UTC().AddDate(0, 0, -14)
+	user.DeletionRequestedAt = &requestedAt
+	keep := NewUser("keep@example.com")
+
+	var deletedSessions, deletedUsers []string
+	env := newAccountTestEnv(&MockSessionRepository{DeleteUserSessionsFunc: func(userID string) error {
+		deletedSessions = append(deletedSessions, userID)
+		return nil
+	}}, user, keep)
+	env.users.FindDueForDeletionFunc = func(now time.Time) ([]User, error) {
+		if containsString(deletedUsers, user.ID.Hex()) {
+			return []User{}, nil
+		}
+		return []User{*user}, nil
+	}
+	env.users.DeleteUserFunc = func(userID string) error {
+		deletedUsers = append(deletedUsers, userID)
+		return nil
+	}
+	env.store.objects[user.AvatarKey] = []byte("avatar")
+	env.apiKeys.keys = []APIKey{{UserID: user.ID.Hex(), KeyHash: "hash-1"}, {UserID: keep.ID.Hex(), KeyHash: "hash-2"}}
+	env.passkeys.passkeys = []PasskeyCredential{{UserID: user.ID.Hex()}, {UserID: keep.ID.Hex()}}
+
+	env.handler.PurgeDueAccounts()
+
+	assert.Equal(t, []string{user.ID.Hex()}, deletedUsers)
+	assert.Equal(t, []string{user.ID.Hex()}, deletedSessions)
+	assert.Empty(t, env.store.objects)
+	require.Len(t, env.apiKeys.keys, 1)
+	assert.Equal(t, keep.ID.Hex(), env.apiKeys.keys[0].UserID)
+	require.Len(t, env.passkeys.passkeys, 1)
+	assert.Equal(t, keep.ID.Hex(), env.passkeys.passkeys[0].UserID)
+	assert.Contains(t, env.events.subjects, "auth.api_keys.revoked")
+
+	require.Len(t, env.tombstones.tombstones, 1)
+	tombstone := env.tombstones.tombstones[0]
+	assert.Equal(t, user.ID.Hex(), tombstone.UserID)
+	assert.Equal(t, HashEmail("USER@example.com "), tombstone.EmailHash)
+	assert.Equal(t, requestedAt, tombstone.RequestedAt)
+
+	deletions := func() int {
+		count := 0
+		for _, subject := range env.events.subjects {
+			if subject == "accounts.deleted" {
+				count++
+			}
+		}
+		return count
+	}
+	// Published once for the purge and once more because no service has confirmed yet
+	assert.Equal(t, 2, deletions())
+
+	env.handler.AccountDeletionDoneMessage([]byte(`{"user_id":"` + user.ID.Hex() + `","service":"image"}`))
+	env.handler.AccountDeletionDoneMessage([]byte(`{"user_id":"` + user.ID.Hex() + `","service":"image"}`))
+	env.handler.PurgeDueAccounts()
+	assert.Equal(t, 3, deletions())
+	assert.Equal(t, []string{"image"}, env.tombstones.tombstones[0].CompletedServices)
+
+	env.handler.AccountDeletionDoneMessage([]byte(`{"user_id":"` + user.ID.Hex() + `","service":"pdf"}`))
+	env.handler.PurgeDueAccounts()
+	assert.Equal(t, 3, deletions())
+}
+
+func TestExportData_ZipsProfileAndServiceData(t *testing.T) {
+	user := NewUser("user@example.com")
+	env := newAccountTestEnv(&MockSessionRepository{GetUserSessionsFunc: func(userID string) ([]UserSession, error) {
+		return []UserSession{{UserID: userID, SessionID: "session-1", RefreshTokenHash: "secret-hash"}}, nil
+	}}, user)
+	env.apiKeys.keys = []APIKey{{UserID: user.ID.Hex(), Name: "ci", KeyHash: "secret-key-hash"}}
+	env.store.objects["images/out.png"] = []byte("png")
+	env.services.replies["accounts.export.image"] = AccountExportReply{
+		Instructions: json.RawMessage(`[{"id":"i1"}]`),
+		Files: []AccountExportFile{
+			{Path: "i1/out.png", Key: "images/out.png"},
+			{Path: "../../escape.png", Key: "images/out.png"},
+			{Path: "i1/gone.png", Key: "images/gone.png"},
+		},
+	}
+
+	// A service that does not answer fails the export instead of returning partial data
+	status, body := apiKeyRequest(t, env.app, fiber.MethodGet, "/account/export", user.ID.Hex(), "")
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+	assert.Equal(t, ErrExportUnavailable, body["message"])
+
+	env.services.replies["accounts.export.pdf"] = AccountExportReply{Instructions: json.RawMessage(`[]`)}
+
+	req := httptest.NewRequest(fiber.MethodGet, "/account/export", nil)
+	req.Header.Set("X-Test-User", user.ID.Hex())
+	resp, err := env.app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/zip", resp.Header.Get(fiber.HeaderContentType))
+
+	raw, _ := io.ReadAll(resp.Body)
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, _ := io.ReadAll(r)
+		files[f.Name] = string(content)
+	}
+
+	assert.ElementsMatch(t, []string{
+		"profile.json", "devices.json", "passkeys.json", "api_keys.json",
+		"image/instructions.json", "image/files/i1/out.png", "image/files/escape.png",
+		"pdf/instructions.json",
+	}, fileNames(files))
+	assert.Contains(t, files["profile.json"], "user@example.com")
+	assert.Contains(t, files["devices.json"], "session-1")
+	assert.NotContains(t, files["devices.json"], "secret-hash")
+	assert.NotContains(t, files["api_keys.json"], "secret-key-hash")
+	assert.Equal(t, "png", files["image/files/i1/out.png"])
+}
+
+func TestRequestExport_ServiceError(t *testing.T) {
+	user := NewUser("user@example.com")
+	env := newAccountTestEnv(&MockSessionRepository{}, user)
+	env.services.replies["accounts.export.image"] = AccountExportReply{Error: "failed to list instructions"}
+
+	_, err := env.handler.requestExport("image", user.ID.Hex())
+	assert.Equal(t, errors.New("failed to list instructions"), err)
+}
+
+func fileNames(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
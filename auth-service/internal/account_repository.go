@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	initx "github.com/instrlabs/shared/init"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccountTombstoneRepository handles database operations for the tombstones of purged accounts
+type AccountTombstoneRepository struct {
+	db         *initx.Mongo
+	collection *mongo.Collection
+}
+
+// NewAccountTombstoneRepository creates a new account tombstone repository instance
+func NewAccountTombstoneRepository(db *initx.Mongo) *AccountTombstoneRepository {
+	return &AccountTombstoneRepository{
+		db:         db,
+		collection: db.DB.Collection("account_tombstones"),
+	}
+}
+
+// SaveTombstone stores the tombstone unless one exists for the user, so a retried purge keeps the first record
+func (r *AccountTombstoneRepository) SaveTombstone(tombstone *AccountTombstone) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"user_id": tombstone.UserID},
+		bson.M{"$setOnInsert": bson.M{
+			"user_id":      tombstone.UserID,
+			"email_hash":   tombstone.EmailHash,
+			"requested_at": tombstone.RequestedAt,
+			"deleted_at":   tombstone.DeletedAt,
+		}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		log.Errorf("SaveTombstone: Failed to save tombstone for user %s: %v", tombstone.UserID, err)
+		return err
+	}
+	return nil
+}
+
+// MarkServiceDeleted records that a service confirmed deleting the user's data
+func (r *AccountTombstoneRepository) MarkServiceDeleted(userID string, service string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$addToSet": bson.M{"completed_services": service}})
+	if err != nil {
+		log.Errorf("MarkServiceDeleted: Failed to record %s for user %s: %v", service, userID, err)
+		return err
+	}
+	return nil
+}
+
+// FindIncompleteTombstones returns tombstones deleted after since that not every service has confirmed
+func (r *AccountTombstoneRepository) FindIncompleteTombstones(services []string, since time.Time) ([]AccountTombstone, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"deleted_at":         bson.M{"$gt": since},
+		"completed_services": bson.M{"$not": bson.M{"$all": services}},
+	}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		log.Errorf("FindIncompleteTombstones: Failed to find tombstones: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tombstones := []AccountTombstone{}
+	if err := cursor.All(ctx, &tombstones); err != nil {
+		log.Errorf("FindIncompleteTombstones: Failed to decode tombstones: %v", err)
+		return nil, err
+	}
+	return tombstones, nil
+}
@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+const (
+	adminDefaultPageSize = 20
+	adminMaxPageSize     = 100
+)
+
+// AdminHandler serves the user administration API. Routes must be guarded with RequireRole(RoleAdmin).
+type AdminHandler struct {
+	users   *UserHandler
+	apiKeys *APIKeyHandler
+}
+
+func NewAdminHandler(users *UserHandler, apiKeys *APIKeyHandler) *AdminHandler {
+	return &AdminHandler{users: users, apiKeys: apiKeys}
+}
+
+// target loads the user named by the :userId route parameter
+func (h *AdminHandler) target(c *fiber.Ctx) *User {
+	user := h.users.userRepo.FindByID(c.Params("userId"))
+	if user == nil || user.ID.IsZero() {
+		return nil
+	}
+	return user
+}
+
+func userNotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"message": ErrUserNotFound,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// ListUsers searches users by email or username, role and disabled state, one page at a time
+func (h *AdminHandler) ListUsers(c *fiber.Ctx) error {
+	log.Info("ListUsers: Searching users")
+
+	search := UserSearch{
+		Query: c.Query("q"),
+		Role:  c.Query("role"),
+		Page:  c.QueryInt("page", 1),
+		Limit: c.QueryInt("limit", adminDefaultPageSize),
+	}
+	if disabled, err := strconv.ParseBool(c.Query("disabled")); err == nil {
+		search.Disabled = &disabled
+	}
+	if search.Page < 1 {
+		search.Page = 1
+	}
+	if search.Limit < 1 || search.Limit > adminMaxPageSize {
+		search.Limit = adminDefaultPageSize
+	}
+
+	users, total, err := h.users.userRepo.SearchUsers(search)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Users retrieved successfully",
+		"errors":  nil,
+		"data": fiber.Map{
+			"users": users,
+			"total": total,
+			"page":  search.Page,
+			"limit": search.Limit,
+		},
+	})
+}
+
+// GetUser returns one user
+func (h *AdminHandler) GetUser(c *fiber.Ctx) error {
+	user := h.target(c)
+	if user == nil {
+		return userNotFound(c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User retrieved successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"user": user},
+	})
+}
+
+// SetUserRoles replaces a user's roles. Admins cannot drop their own admin role.
+func (h *AdminHandler) SetUserRoles(c *fiber.Ctx) error {
+	log.Info("SetUserRoles: Changing user roles")
+
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !validRoles(input.Roles) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRoles,
+			"errors":  nil,
+			"data": fiber.Map{
+				"allowed_roles": Roles,
+			},
+		})
+	}
+
+	user := h.target(c)
+	if user == nil {
+		return userNotFound(c)
+	}
+
+	adminId, _ := c.Locals("userId").(string)
+	updated := &User{Roles: input.Roles}
+	if user.ID.Hex() == adminId && !updated.HasRole(RoleAdmin) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrCannotModifySelf,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	previousRoles := user.RoleList()
+	if err := h.users.userRepo.SetRoles(user.ID.Hex(), input.Roles); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	h.users.audit(c, AuditRolesChanged, AuditResultSuccess, user.ID.Hex(), "", map[string]string{
+		"previous_roles": strings.Join(previousRoles, ","),
+		"roles":          strings.Join(input.Roles, ","),
+		"changed_by":     adminId,
+	})
+	log.Infof("SetUserRoles: Admin %s set roles of user %s to %v", adminId, user.ID.Hex(), input.Roles)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Roles updated successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"roles": input.Roles},
+	})
+}
+
+// DisableUser blocks a user from signing in and signs them out everywhere
+func (h *AdminHandler) DisableUser(c *fiber.Ctx) error {
+	log.Info("DisableUser: Disabling user")
+
+	user := h.target(c)
+	if user == nil {
+		return userNotFound(c)
+	}
+
+	adminId, _ := c.Locals("userId").(string)
+	if user.ID.Hex() == adminId {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrCannotModifySelf,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.users.userRepo.SetDisabled(user.ID.Hex(), true); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if err := h.users.revokeAllSessions(user.ID.Hex()); err != nil {
+		log.Errorf("DisableUser: Failed to clear sessions of user %s: %v", user.ID.Hex(), err)
+	}
+	h.apiKeys.EvictUserKeys(user.ID.Hex())
+
+	log.Infof("DisableUser: Admin %s disabled user %s", adminId, user.ID.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User disabled successfully",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// EnableUser lets a disabled user sign in again
+func (h *AdminHandler) EnableUser(c *fiber.Ctx) error {
+	log.Info("EnableUser: Enabling user")
+
+	user := h.target(c)
+	if user == nil {
+		return userNotFound(c)
+	}
+
+	if err := h.users.userRepo.SetDisabled(user.ID.Hex(), false); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	adminId, _ := c.Locals("userId").(string)
+	log.Infof("EnableUser: Admin %s enabled user %s", adminId, user.ID.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User enabled successfully",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// LogoutUser ends all sessions of a user. Access tokens already issued stay valid until they expire.
+func (h *AdminHandler) LogoutUser(c *fiber.Ctx) error {
+	log.Info("LogoutUser: Forcing user logout")
+
+	user := h.target(c)
+	if user == nil {
+		return userNotFound(c)
+	}
+
+	if err := h.users.revokeAllSessions(user.ID.Hex()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	adminId, _ := c.Locals("userId").(string)
+	log.Infof("LogoutUser: Admin %s logged out user %s from all devices", adminId, user.ID.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User logged out from all devices",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// ListSecurityEvents searches the audit trail of every user by user, type, result, IP and time range
+func (h *AdminHandler) ListSecurityEvents(c *fiber.Ctx) error {
+	log.Info("ListSecurityEvents: Searching security events")
+
+	search := parseAuditSearch(c)
+	search.UserID = c.Query("user_id")
+	search.IPAddress = c.Query("ip")
+
+	events, total, err := h.users.auditRepo.FindEvents(search)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Security events retrieved successfully",
+		"errors":  nil,
+		"data": fiber.Map{
+			"events": events,
+			"total":  total,
+			"page":   search.Page,
+			"limit":  search.Limit,
+		},
+	})
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryUserDirectory is a MockUserRepository over a fixed set of users
+func memoryUserDirectory(users ...*User) *MockUserRepository {
+	find := func(id string) *User {
+		for _, u := range users {
+			if u.ID.Hex() == id {
+				return u
+			}
+		}
+		return nil
+	}
+	return &MockUserRepository{
+		FindByIDFunc: find,
+		SetRolesFunc: func(userID string, roles []string) error {
+			find(userID).Roles = roles
+			return nil
+		},
+		SetDisabledFunc: func(userID string, disabled bool) error {
+			find(userID).Disabled = disabled
+			return nil
+		},
+	}
+}
+
+func newAdminTestApp(userRepo *MockUserRepository, sessionRepo *MockSessionRepository, events *recordingPublisher, apiKeys *memoryAPIKeys) *fiber.App {
+	users := NewUserHandler(newMockConfig(), userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	handler := NewAdminHandler(users, NewAPIKeyHandler(newMockConfig(), apiKeys, userRepo, events))
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	admin := app.Group("/admin", RequireRole(userRepo, RoleAdmin))
+	admin.Get("/users/:userId", handler.GetUser)
+	admin.Post("/users/:userId/roles", handler.SetUserRoles)
+	admin.Post("/users/:userId/disable", handler.DisableUser)
+	admin.Post("/users/:userId/logout", handler.LogoutUser)
+	return app
+}
+
+func newAdmin() *User {
+	admin := NewUser("admin@example.com")
+	admin.Roles = []string{RoleUser, RoleAdmin}
+	return admin
+}
+
+func TestRequireRole_OnlyAdmins(t *testing.T) {
+	admin := newAdmin()
+	member := NewUser("member@example.com")
+	legacy := NewUser("legacy@example.com")
+	legacy.Roles = nil
+	app := newAdminTestApp(memoryUserDirectory(admin, member, legacy), &MockSessionRepository{}, &recordingPublisher{}, &memoryAPIKeys{})
+
+	status, _ := apiKeyRequest(t, app, fiber.MethodGet, "/admin/users/"+member.ID.Hex(), member.ID.Hex(), "")
+	assert.Equal(t, fiber.StatusForbidden, status)
+	status, _ = apiKeyRequest(t, app, fiber.MethodGet, "/admin/users/"+member.ID.Hex(), legacy.ID.Hex(), "")
+	assert.Equal(t, fiber.StatusForbidden, status)
+	status, _ = apiKeyRequest(t, app, fiber.MethodGet, "/admin/users/"+member.ID.Hex(), "", "")
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	status, body := apiKeyRequest(t, app, fiber.MethodGet, "/admin/users/"+member.ID.Hex(), admin.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "member@example.com", body["data"].(map[string]interface{})["user"].(map[string]interface{})["email"])
+
+	// A disabled admin loses access at once
+	admin.Disabled = true
+	status, _ = apiKeyRequest(t, app, fiber.MethodGet, "/admin/users/"+member.ID.Hex(), admin.ID.Hex(), "")
+	assert.Equal(t, fiber.StatusForbidden, status)
+}
+
+func TestSetUserRoles(t *testing.T) {
+	admin := newAdmin()
+	member := NewUser("member@example.com")
+	app := newAdminTestApp(memoryUserDirectory(admin, member), &MockSessionRepository{}, &recordingPublisher{}, &memoryAPIKeys{})
+
+	status, _ := apiKeyRequest(t, app, fiber.MethodPost, "/admin/users/"+member.ID.Hex()+"/roles", admin.ID.Hex(), `{"roles":["user","root"]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/admin/users/"+member.ID.Hex()+"/roles", admin.ID.Hex(), `{"roles":["admin"]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/admin/users/"+member.ID.Hex()+"/roles", admin.ID.Hex(), `{"roles":["user","admin"]}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.True(t, member.HasRole(RoleAdmin))
+
+	// Admins cannot lock themselves out
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/admin/users/"+admin.ID.Hex()+"/roles", admin.ID.Hex(), `{"roles":["user"]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.True(t, admin.HasRole(RoleAdmin))
+}
+
+func TestDisableUser_EndsSessionsAndEvictsAPIKeys(t *testing.T) {
+	admin := newAdmin()
+	member := NewUser("member@example.com")
+	key, _, err := NewAPIKey(member.ID.Hex(), "ci", []string{ScopePdfsRead}, nil)
+	require.NoError(t, err)
+	cleared := ""
+	sessionRepo := &MockSessionRepository{ClearAllUserSessionsFunc: func(userID string) error {
+		cleared = userID
+		return nil
+	}}
+	events := &recordingPublisher{}
+	app := newAdminTestApp(memoryUserDirectory(admin, member), sessionRepo, events, &memoryAPIKeys{keys: []APIKey{*key}})
+
+	status, _ := apiKeyRequest(t, app, fiber.MethodPost, "/admin/users/"+admin.ID.Hex()+"/disable", admin.ID.Hex(), "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/admin/users/"+member.ID.Hex()+"/disable", admin.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.True(t, member.Disabled)
+	assert.Equal(t, member.ID.Hex(), cleared)
+	assert.Len(t, events.messages, 1)
+}
+
+func TestLogin_RejectsDisabledAccount(t *testing.T) {
+	user := userWithPin(t, "123456")
+	user.Disabled = true
+	app := newThrottleTestApp(newMockConfig(), memoryPinUsers(user))
+
+	status, body := postJSON(t, app, "/login", `{"email":"user@example.com","pin":"123456"}`)
+	assert.Equal(t, fiber.StatusForbidden, status)
+	assert.Equal(t, ErrAccountDisabled, body["message"])
+}
+
+func TestLogin_AccessTokenCarriesStoredRoles(t *testing.T) {
+	user := userWithPin(t, "123456")
+	user.Roles = []string{RoleUser, RoleAdmin}
+	handler := NewUserHandler(newMockConfig(), memoryPinUsers(user), &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	app.Post("/login", handler.Login)
+
+	status, body := postJSON(t, app, "/login", `{"email":"user@example.com","pin":"123456"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	token := body["data"].(map[string]interface{})["access_token"].(string)
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, handler.keys.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{RoleUser, RoleAdmin}, claims["roles"])
+}
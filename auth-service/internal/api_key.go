@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyPrefix marks API keys so the gateway can tell them apart from JWTs
+const APIKeyPrefix = "ilk_"
+
+// API key scopes, granting read (GET/HEAD) or write access to a service behind the gateway
+const (
+	ScopeImagesRead  = "images:read"
+	ScopeImagesWrite = "images:write"
+	ScopePdfsRead    = "pdfs:read"
+	ScopePdfsWrite   = "pdfs:write"
+)
+
+var APIKeyScopes = []string{ScopeImagesRead, ScopeImagesWrite, ScopePdfsRead, ScopePdfsWrite}
+
+// APIKey is a long-lived credential for scripts. Only its hash is stored; the key is shown once.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     string             `json:"-" bson:"user_id"`
+	OrgID      string             `json:"org_id,omitempty" bson:"org_id,omitempty"` // Set for keys shared by an organization
+	Name       string             `json:"name" bson:"name"`
+	Hint       string             `json:"hint" bson:"hint"` // First characters of the key, to recognise it in lists
+	KeyHash    string             `json:"-" bson:"key_hash"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt  *time.Time         `json:"expires_at" bson:"expires_at"`
+	LastUsedAt *time.Time         `json:"last_used_at" bson:"last_used_at"`
+}
+
+// APIKeyResolution is the reply to the gateway's resolve request. An empty UserID means the key is not valid.
+type APIKeyResolution struct {
+	UserID    string     `json:"user_id"`
+	OrgID     string     `json:"org_id,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKeyRevocation is published when a key is revoked so gateways drop it from their cache
+type APIKeyRevocation struct {
+	KeyHash string `json:"key_hash"`
+}
+
+// NewAPIKey generates a key for the user and returns it with its plaintext, which is never stored
+func NewAPIKey(userID, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	plaintext := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	return &APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		Hint:      plaintext[:len(APIKeyPrefix)+6],
+		KeyHash:   HashAPIKey(plaintext),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}, plaintext, nil
+}
+
+// HashAPIKey returns the hex SHA256 of an API key. Keys are random, so no salt or slow hash is needed.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsExpired reports whether the key has passed its expiry
+func (k *APIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && !time.Now().UTC().Before(*k.ExpiresAt)
+}
+
+// validScopes reports whether every scope is known and none is repeated
+func validScopes(scopes []string) bool {
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		known := false
+		for _, s := range APIKeyScopes {
+			if s == scope {
+				known = true
+				break
+			}
+		}
+		if !known || seen[scope] {
+			return false
+		}
+		seen[scope] = true
+	}
+	return true
+}
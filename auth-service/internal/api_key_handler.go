@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+type APIKeyHandler struct {
+	cfg        *Config
+	apiKeyRepo IAPIKeyRepository
+	userRepo   IUserRepository
+	events     IEventPublisher
+}
+
+func NewAPIKeyHandler(cfg *Config, apiKeyRepo IAPIKeyRepository, userRepo IUserRepository, events IEventPublisher) *APIKeyHandler {
+	return &APIKeyHandler{
+		cfg:        cfg,
+		apiKeyRepo: apiKeyRepo,
+		userRepo:   userRepo,
+		events:     events,
+	}
+}
+
+// CreateAPIKey issues a named, scoped, expiring key. The key is only returned in this response.
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	log.Info("CreateAPIKey: Creating API key")
+	return h.createAPIKey(c, "")
+}
+
+// createAPIKey issues a key for the authenticated user, shared with the organization when orgID is set
+func (h *APIKeyHandler) createAPIKey(c *fiber.Ctx, orgID string) error {
+
+	var input struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		log.Warnf("CreateAPIKey: Invalid request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrAPIKeyNameRequired,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if len(input.Scopes) == 0 || !validScopes(input.Scopes) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrAPIKeyInvalidScopes,
+			"errors":  nil,
+			"data": fiber.Map{
+				"allowed_scopes": APIKeyScopes,
+			},
+		})
+	}
+
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = h.cfg.APIKeyDefaultExpiryDays
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > h.cfg.APIKeyMaxExpiryDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrAPIKeyInvalidExpiry,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	expiresAt := time.Now().UTC().AddDate(0, 0, input.ExpiresInDays)
+
+	userId, _ := c.Locals("userId").(string)
+	key, plaintext, err := NewAPIKey(userId, input.Name, input.Scopes, &expiresAt)
+	if err != nil {
+		log.Errorf("CreateAPIKey: Failed to generate API key: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	key.OrgID = orgID
+
+	if err := h.apiKeyRepo.CreateAPIKey(key); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("CreateAPIKey: API key %s created for user %s", key.ID.Hex(), userId)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "API key created. Store it now, it will not be shown again.",
+		"errors":  nil,
+		"data": fiber.Map{
+			"api_key": key,
+			"key":     plaintext,
+		},
+	})
+}
+
+// GetAPIKeys lists the authenticated user's API keys without their secrets
+func (h *APIKeyHandler) GetAPIKeys(c *fiber.Ctx) error {
+	log.Info("GetAPIKeys: Retrieving user API keys")
+
+	userId, _ := c.Locals("userId").(string)
+	keys, err := h.apiKeyRepo.FindAPIKeysByUserID(userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	// Keys shared with an organization are listed by the organization
+	personal := keys[:0]
+	for _, key := range keys {
+		if key.OrgID == "" {
+			personal = append(personal, key)
+		}
+	}
+	keys = personal
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API keys retrieved successfully",
+		"errors":  nil,
+		"data": map[string]interface{}{
+			"api_keys": keys,
+		},
+	})
+}
+
+// RevokeAPIKey deletes one of the authenticated user's API keys and tells the gateways to forget it
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	log.Info("RevokeAPIKey: Revoking API key")
+
+	userId, _ := c.Locals("userId").(string)
+	keyId := c.Params("keyId")
+
+	key, err := h.apiKeyRepo.DeleteAPIKey(keyId, userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if key == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrAPIKeyNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	h.publishRevocation(key.KeyHash)
+
+	log.Infof("RevokeAPIKey: API key %s revoked for user %s", keyId, userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API key revoked successfully",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// EvictUserKeys makes gateways drop every cached key of the user, so they are resolved again
+func (h *APIKeyHandler) EvictUserKeys(userID string) {
+	keys, err := h.apiKeyRepo.FindAPIKeysByUserID(userID)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		h.publishRevocation(key.KeyHash)
+	}
+}
+
+// DeleteUserKeys removes every key of the user and tells the gateways to forget them
+func (h *APIKeyHandler) DeleteUserKeys(userID string) error {
+	h.EvictUserKeys(userID)
+	return h.apiKeyRepo.DeleteAPIKeysByUserID(userID)
+}
+
+func (h *APIKeyHandler) publishRevocation(keyHash string) {
+	data, _ := json.Marshal(APIKeyRevocation{KeyHash: keyHash})
+	if err := h.events.Publish(h.cfg.NatsSubjectAPIKeyRevoked, data); err != nil {
+		log.Errorf("RevokeAPIKey: Failed to publish revocation: %v", err)
+	}
+}
+
+// ResolveAPIKeyMessage answers a gateway resolve request. The request carries the key's hash,
+// so the key itself never travels past the gateway.
+func (h *APIKeyHandler) ResolveAPIKeyMessage(data []byte) []byte {
+	resolution := APIKeyResolution{}
+
+	key, err := h.apiKeyRepo.FindAPIKeyByHash(string(data))
+	switch {
+	case err != nil:
+		log.Errorf("ResolveAPIKeyMessage: Failed to find API key: %v", err)
+	case key == nil:
+		log.Warn("ResolveAPIKeyMessage: Unknown API key")
+	case key.IsExpired():
+		log.Warnf("ResolveAPIKeyMessage: API key %s expired", key.ID.Hex())
+	case h.userDisabled(key.UserID):
+		log.Warnf("ResolveAPIKeyMessage: API key %s belongs to a disabled account", key.ID.Hex())
+	default:
+		resolution = APIKeyResolution{UserID: key.UserID, OrgID: key.OrgID, Scopes: key.Scopes, ExpiresAt: key.ExpiresAt}
+		_ = h.apiKeyRepo.TouchAPIKey(key.ID)
+	}
+
+	reply, _ := json.Marshal(resolution)
+	return reply
+}
+
+func (h *APIKeyHandler) userDisabled(userID string) bool {
+	user := h.userRepo.FindByID(userID)
+	return user == nil || user.Disabled
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryAPIKeys is an in-memory IAPIKeyRepository
+type memoryAPIKeys struct {
+	keys []APIKey
+}
+
+func (m *memoryAPIKeys) CreateAPIKey(key *APIKey) error {
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+func (m *memoryAPIKeys) FindAPIKeysByUserID(userID string) ([]APIKey, error) {
+	keys := []APIKey{}
+	for _, k := range m.keys {
+		if k.UserID == userID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryAPIKeys) FindAPIKeyByHash(keyHash string) (*APIKey, error) {
+	for i := range m.keys {
+		if m.keys[i].KeyHash == keyHash {
+			copied := m.keys[i]
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryAPIKeys) TouchAPIKey(id primitive.ObjectID) error {
+	for i := range m.keys {
+		if m.keys[i].ID == id {
+			now := time.Now().UTC()
+			m.keys[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryAPIKeys) DeleteAPIKey(id string, userID string) (*APIKey, error) {
+	for i, k := range m.keys {
+		if k.ID.Hex() == id && k.UserID == userID {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryAPIKeys) DeleteAPIKeysByUserID(userID string) error {
+	kept := m.keys[:0]
+	for _, k := range m.keys {
+		if k.UserID != userID {
+			kept = append(kept, k)
+		}
+	}
+	m.keys = kept
+	return nil
+}
+
+func (m *memoryAPIKeys) FindAPIKeysByOrgID(orgID string) ([]APIKey, error) {
+	keys := []APIKey{}
+	for _, k := range m.keys {
+		if k.OrgID == orgID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryAPIKeys) DeleteOrgAPIKey(id string, orgID string) (*APIKey, error) {
+	for i, k := range m.keys {
+		if k.ID.Hex() == id && k.OrgID == orgID {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordingPublisher captures published events
+type recordingPublisher struct {
+	subjects []string
+	messages [][]byte
+}
+
+func (p *recordingPublisher) Publish(subject string, data []byte) error {
+	p.subjects = append(p.subjects, subject)
+	p.messages = append(p.messages, data)
+	return nil
+}
+
+func newAPIKeyTestApp(repo *memoryAPIKeys, events *recordingPublisher) (*fiber.App, *APIKeyHandler) {
+	cfg := newMockConfig()
+	userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User {
+		user := NewUser(id + "@example.com")
+		user.Disabled = id == "disabled-user"
+		return user
+	}}
+	handler := NewAPIKeyHandler(cfg, repo, userRepo, events)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	app.Get("/api-keys", handler.GetAPIKeys)
+	app.Post("/api-keys", handler.CreateAPIKey)
+	app.Post("/api-keys/:keyId/revoke", handler.RevokeAPIKey)
+	return app, handler
+}
+
+func apiKeyRequest(t *testing.T, app *fiber.App, method, path, user, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", user)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	var out map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func resolve(t *testing.T, handler *APIKeyHandler, key string) APIKeyResolution {
+	t.Helper()
+	var resolution APIKeyResolution
+	require.NoError(t, json.Unmarshal(handler.ResolveAPIKeyMessage([]byte(HashAPIKey(key))), &resolution))
+	return resolution
+}
+
+func TestCreateAPIKey_StoresHashAndShowsKeyOnce(t *testing.T) {
+	repo := &memoryAPIKeys{}
+	app, handler := newAPIKeyTestApp(repo, &recordingPublisher{})
+
+	status, body := apiKeyRequest(t, app, fiber.MethodPost, "/api-keys", "user-1", `{"name":"ci","scopes":["pdfs:read","pdfs:write"],"expires_in_days":30}`)
+	require.Equal(t, fiber.StatusCreated, status)
+
+	data := body["data"].(map[string]interface{})
+	plaintext := data["key"].(string)
+	assert.True(t, strings.HasPrefix(plaintext, APIKeyPrefix))
+	require.Len(t, repo.keys, 1)
+	assert.Equal(t, HashAPIKey(plaintext), repo.keys[0].KeyHash)
+	assert.NotContains(t, data["api_key"], "key_hash")
+
+	// Listing never shows the key again
+	status, body = apiKeyRequest(t, app, fiber.MethodGet, "/api-keys", "user-1", "")
+	require.Equal(t, fiber.StatusOK, status)
+	listed := body["data"].(map[string]interface{})["api_keys"].([]interface{})
+	require.Len(t, listed, 1)
+	raw, _ := json.Marshal(listed[0])
+	assert.NotContains(t, string(raw), plaintext)
+
+	resolution := resolve(t, handler, plaintext)
+	assert.Equal(t, "user-1", resolution.UserID)
+	assert.Equal(t, []string{ScopePdfsRead, ScopePdfsWrite}, resolution.Scopes)
+	assert.NotNil(t, repo.keys[0].LastUsedAt)
+}
+
+func TestCreateAPIKey_Validation(t *testing.T) {
+	app, _ := newAPIKeyTestApp(&memoryAPIKeys{}, &recordingPublisher{})
+
+	cases := map[string]string{
+		"missing name":    `{"scopes":["pdfs:read"]}`,
+		"no scopes":       `{"name":"ci","scopes":[]}`,
+		"unknown scope":   `{"name":"ci","scopes":["admin"]}`,
+		"duplicate scope": `{"name":"ci","scopes":["pdfs:read","pdfs:read"]}`,
+		"too long":        `{"name":"ci","scopes":["pdfs:read"],"expires_in_days":5000}`,
+	}
+	for name, body := range cases {
+		status, _ := apiKeyRequest(t, app, fiber.MethodPost, "/api-keys", "user-1", body)
+		assert.Equal(t, fiber.StatusBadRequest, status, name)
+	}
+}
+
+func TestRevokeAPIKey_PublishesRevocation(t *testing.T) {
+	repo := &memoryAPIKeys{}
+	events := &recordingPublisher{}
+	app, handler := newAPIKeyTestApp(repo, events)
+
+	_, body := apiKeyRequest(t, app, fiber.MethodPost, "/api-keys", "user-1", `{"name":"ci","scopes":["images:read"]}`)
+	data := body["data"].(map[string]interface{})
+	plaintext := data["key"].(string)
+	keyID := data["api_key"].(map[string]interface{})["id"].(string)
+
+	// Another user cannot revoke it
+	status, _ := apiKeyRequest(t, app, fiber.MethodPost, "/api-keys/"+keyID+"/revoke", "user-2", "")
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/api-keys/"+keyID+"/revoke", "user-1", "")
+	require.Equal(t, fiber.StatusOK, status)
+
+	require.Len(t, events.messages, 1)
+	assert.Equal(t, "auth.api_keys.revoked", events.subjects[0])
+	var revocation APIKeyRevocation
+	require.NoError(t, json.Unmarshal(events.messages[0], &revocation))
+	assert.Equal(t, HashAPIKey(plaintext), revocation.KeyHash)
+
+	assert.Empty(t, resolve(t, handler, plaintext).UserID)
+}
+
+func TestResolveAPIKey_RejectsExpiredAndUnknownKeys(t *testing.T) {
+	expired := time.Now().UTC().Add(-time.Minute)
+	key, plaintext, err := NewAPIKey("user-1", "old", []string{ScopeImagesRead}, &expired)
+	require.NoError(t, err)
+	repo := &memoryAPIKeys{keys: []APIKey{*key}}
+	_, handler := newAPIKeyTestApp(repo, &recordingPublisher{})
+
+	assert.Empty(t, resolve(t, handler, plaintext).UserID)
+	assert.Empty(t, resolve(t, handler, APIKeyPrefix+"unknown").UserID)
+}
+
+func TestResolveAPIKey_RejectsKeysOfDisabledAccounts(t *testing.T) {
+	key, plaintext, err := NewAPIKey("disabled-user", "ci", []string{ScopeImagesRead}, nil)
+	require.NoError(t, err)
+	_, handler := newAPIKeyTestApp(&memoryAPIKeys{keys: []APIKey{*key}}, &recordingPublisher{})
+
+	assert.Empty(t, resolve(t, handler, plaintext).UserID)
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	initx "github.com/instrlabs/shared/init"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyRepository handles database operations for API keys
+type APIKeyRepository struct {
+	db         *initx.Mongo
+	collection *mongo.Collection
+}
+
+// NewAPIKeyRepository creates a new API key repository instance
+func NewAPIKeyRepository(db *initx.Mongo) *APIKeyRepository {
+	return &APIKeyRepository{
+		db:         db,
+		collection: db.DB.Collection("api_keys"),
+	}
+}
+
+// CreateAPIKey stores a new API key
+func (r *APIKeyRepository) CreateAPIKey(key *APIKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, key)
+	if err != nil {
+		log.Errorf("CreateAPIKey: Failed to create API key: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindAPIKeysByUserID returns all API keys of a user, newest first
+func (r *APIKeyRepository) FindAPIKeysByUserID(userID string) ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		log.Errorf("FindAPIKeysByUserID: Failed to find API keys: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		log.Errorf("FindAPIKeysByUserID: Failed to decode API keys: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// FindAPIKeyByHash returns the key with the given hash, or nil
+func (r *APIKeyRepository) FindAPIKeyByHash(keyHash string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var key APIKey
+	err := r.collection.FindOne(ctx, bson.M{"key_hash": keyHash}).Decode(&key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		log.Errorf("FindAPIKeyByHash: Failed to find API key: %v", err)
+		return nil, err
+	}
+	return &key, nil
+}
+
+// TouchAPIKey records that the key was just used
+func (r *APIKeyRepository) TouchAPIKey(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": time.Now().UTC()}})
+	if err != nil {
+		log.Errorf("TouchAPIKey: Failed to update API key %s: %v", id.Hex(), err)
+		return err
+	}
+	return nil
+}
+
+// DeleteAPIKey removes a key owned by the user and returns it, or nil if it does not exist
+func (r *APIKeyRepository) DeleteAPIKey(id string, userID string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	var key APIKey
+	err = r.collection.FindOneAndDelete(ctx, bson.M{"_id": objectID, "user_id": userID}).Decode(&key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		log.Errorf("DeleteAPIKey: Failed to delete API key %s: %v", id, err)
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindAPIKeysByOrgID returns the shared API keys of an organization, newest first
+func (r *APIKeyRepository) FindAPIKeysByOrgID(orgID string) ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"org_id": orgID}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		log.Errorf("FindAPIKeysByOrgID: Failed to find API keys: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		log.Errorf("FindAPIKeysByOrgID: Failed to decode API keys: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// DeleteOrgAPIKey removes a key of the organization and returns it, or nil if it does not exist
+func (r *APIKeyRepository) DeleteOrgAPIKey(id string, orgID string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	var key APIKey
+	err = r.collection.FindOneAndDelete(ctx, bson.M{"_id": objectID, "org_id": orgID}).Decode(&key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		log.Errorf("DeleteOrgAPIKey: Failed to delete API key %s: %v", id, err)
+		return nil, err
+	}
+	return &key, nil
+}
+
+// DeleteAPIKeysByUserID removes every API key of the user
+func (r *APIKeyRepository) DeleteAPIKeysByUserID(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		log.Errorf("DeleteAPIKeysByUserID: Failed to delete API keys of user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	initx "github.com/instrlabs/shared/init"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Attempt store backends, selected by ATTEMPT_STORE
+const (
+	AttemptStoreMongo  = "mongo"
+	AttemptStoreMemory = "memory"
+)
+
+// AttemptRecord counts attempts for a throttle key such as "login:email:a@b.c"
+type AttemptRecord struct {
+	Key         string    `bson:"key"`
+	Count       int       `bson:"count"`
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"` // The record is forgotten after this, unless locked longer
+}
+
+// MongoAttemptStore keeps attempt counters in Mongo so limits hold across instances
+type MongoAttemptStore struct {
+	db         *initx.Mongo
+	collection *mongo.Collection
+}
+
+// NewMongoAttemptStore creates a new Mongo attempt store instance
+func NewMongoAttemptStore(db *initx.Mongo) *MongoAttemptStore {
+	s := &MongoAttemptStore{
+		db:         db,
+		collection: db.DB.Collection("login_attempts"),
+	}
+	s.ensureIndexes()
+	return s
+}
+
+// ensureIndexes keeps one record per key and lets Mongo drop records once they expire
+func (s *MongoAttemptStore) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Errorf("ensureIndexes: Failed to create login attempt indexes: %v", err)
+	}
+}
+
+// GetAttempts returns the live record for key, or nil
+func (s *MongoAttemptStore) GetAttempts(key string) (*AttemptRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var record AttemptRecord
+	err := s.collection.FindOne(ctx, bson.M{"key": key, "expires_at": bson.M{"$gt": time.Now().UTC()}}).Decode(&record)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		log.Errorf("GetAttempts: Failed to find attempts: %v", err)
+		return nil, err
+	}
+	return &record, nil
+}
+
+// IncrementAttempts adds an attempt to key and keeps the record for window after it
+func (s *MongoAttemptStore) IncrementAttempts(key string, window time.Duration) (*AttemptRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"key": key, "expires_at": bson.M{"$lte": now}}); err != nil {
+		log.Errorf("IncrementAttempts: Failed to delete expired attempts: %v", err)
+		return nil, err
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"count": 1},
+		"$max": bson.M{"expires_at": now.Add(window)},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var record AttemptRecord
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&record)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent attempt created the record first; the retry updates it
+		err = s.collection.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&record)
+	}
+	if err != nil {
+		log.Errorf("IncrementAttempts: Failed to increment attempts: %v", err)
+		return nil, err
+	}
+	return &record, nil
+}
+
+// LockAttempts blocks key until the given time
+func (s *MongoAttemptStore) LockAttempts(key string, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"locked_until": until},
+		"$max": bson.M{"expires_at": until},
+	}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"key": key}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		log.Errorf("LockAttempts: Failed to lock %s: %v", key, err)
+		return err
+	}
+	return nil
+}
+
+// ResetAttempts forgets key
+func (s *MongoAttemptStore) ResetAttempts(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"key": key})
+	if err != nil {
+		log.Errorf("ResetAttempts: Failed to reset %s: %v", key, err)
+		return err
+	}
+	return nil
+}
+
+// MemoryAttemptStore keeps attempt counters in process, for tests and single-instance setups
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	records map[string]*AttemptRecord
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{records: map[string]*AttemptRecord{}}
+}
+
+// live returns the unexpired record for key; the caller holds mu
+func (s *MemoryAttemptStore) live(key string) *AttemptRecord {
+	record, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	if !record.ExpiresAt.After(time.Now().UTC()) {
+		delete(s.records, key)
+		return nil
+	}
+	return record
+}
+
+func (s *MemoryAttemptStore) GetAttempts(key string) (*AttemptRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.live(key)
+	if record == nil {
+		return nil, nil
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (s *MemoryAttemptStore) IncrementAttempts(key string, window time.Duration) (*AttemptRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.live(key)
+	if record == nil {
+		record = &AttemptRecord{Key: key}
+		s.records[key] = record
+	}
+	record.Count++
+	if expires := time.Now().UTC().Add(window); expires.After(record.ExpiresAt) {
+		record.ExpiresAt = expires
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (s *MemoryAttemptStore) LockAttempts(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.live(key)
+	if record == nil {
+		record = &AttemptRecord{Key: key}
+		s.records[key] = record
+	}
+	record.LockedUntil = until
+	if until.After(record.ExpiresAt) {
+		record.ExpiresAt = until
+	}
+	return nil
+}
+
+func (s *MemoryAttemptStore) ResetAttempts(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
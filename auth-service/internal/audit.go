@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit event types
+const (
+	AuditLoginSuccess      = "login.success"
+	AuditLoginFailure      = "login.failure"
+	AuditPinSent           = "pin.sent"
+	AuditTokenRefreshed    = "token.refreshed"
+	AuditSuspiciousRefresh = "token.suspicious_refresh"
+	AuditStepUp            = "token.step_up"
+	AuditDeviceRevoked     = "device.revoked"
+	AuditNewDevice         = "device.new"
+	AuditLogoutAll         = "device.logout_all"
+	AuditSessionExpired    = "session.expired"
+	AuditIdentityLinked    = "identity.linked"
+	AuditIdentityUnlinked  = "identity.unlinked"
+	AuditRolesChanged      = "roles.changed"
+	AuditOrgCreated        = "org.created"
+	AuditOrgDeleted        = "org.deleted"
+	AuditOrgInvited        = "org.member_invited"
+	AuditOrgJoined         = "org.member_joined"
+	AuditOrgRoleChanged    = "org.role_changed"
+	AuditOrgMemberRemoved  = "org.member_removed"
+	AuditOrgSwitched       = "org.switched"
+	AuditClientCreated     = "oauth2.client_created"
+	AuditClientDeleted     = "oauth2.client_deleted"
+	AuditOAuthConsent      = "oauth2.consent"
+	AuditOAuthTokenIssued  = "oauth2.token_issued"
+	AuditOAuthRevoked      = "oauth2.revoked"
+)
+
+// Audit result codes
+const (
+	AuditResultSuccess            = "success"
+	AuditResultInvalidCredentials = "invalid_credentials"
+	AuditResultInvalidCode        = "invalid_code"
+	AuditResultAccountDisabled    = "account_disabled"
+	AuditResultThrottled          = "throttled"
+	AuditResultDeviceMismatch     = "device_mismatch"
+	AuditResultTokenReuse         = "token_reuse"
+	AuditResultIdle               = "idle"
+	AuditResultDenied             = "denied"
+)
+
+const (
+	auditDefaultPageSize = 50
+	auditMaxPageSize     = 200
+)
+
+// AuditEvent is one entry of the security audit trail. Entries expire after AUDIT_RETENTION_DAYS.
+type AuditEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"user_id,omitempty" bson:"user_id,omitempty"` // Empty for failures against unknown accounts
+	Type      string             `json:"type" bson:"type"`
+	Result    string             `json:"result" bson:"result"`
+	IPAddress string             `json:"ip_address" bson:"ip_address"`
+	UserAgent string             `json:"user_agent" bson:"user_agent"`
+	SessionID string             `json:"session_id,omitempty" bson:"session_id,omitempty"`
+	Details   map[string]string  `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AuditSearch filters the audit trail. Zero values match everything.
+type AuditSearch struct {
+	UserID    string
+	Type      string
+	Result    string
+	IPAddress string
+	Since     *time.Time
+	Until     *time.Time
+	Page      int
+	Limit     int
+}
+
+// Normalize clamps the page and page size
+func (s *AuditSearch) Normalize() {
+	if s.Page < 1 {
+		s.Page = 1
+	}
+	if s.Limit < 1 || s.Limit > auditMaxPageSize {
+		s.Limit = auditDefaultPageSize
+	}
+}
+
+// parseAuditSearch reads the filters shared by the user and admin endpoints from the query string
+func parseAuditSearch(c *fiber.Ctx) AuditSearch {
+	search := AuditSearch{
+		Type:   c.Query("type"),
+		Result: c.Query("result"),
+		Page:   c.QueryInt("page", 1),
+		Limit:  c.QueryInt("limit", auditDefaultPageSize),
+	}
+	if since, err := time.Parse(time.RFC3339, c.Query("since")); err == nil {
+		search.Since = &since
+	}
+	if until, err := time.Parse(time.RFC3339, c.Query("until")); err == nil {
+		search.Until = &until
+	}
+	search.Normalize()
+	return search
+}
+
+// audit records a security event for the request. Failing to write the trail never fails the request.
+func (h *UserHandler) audit(c *fiber.Ctx, eventType string, result string, userID string, sessionID string, details map[string]string) {
+	ipAddress, _ := c.Locals("userIP").(string)
+	if ipAddress == "" {
+		ipAddress = c.IP()
+	}
+	userAgent, _ := c.Locals("userAgent").(string)
+	if userAgent == "" {
+		userAgent = c.Get(fiber.HeaderUserAgent)
+	}
+	if sessionID == "" {
+		sessionID, _ = c.Locals("sessionId").(string)
+	}
+
+	event := &AuditEvent{
+		UserID:    userID,
+		Type:      eventType,
+		Result:    result,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		SessionID: sessionID,
+		Details:   details,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := h.auditRepo.RecordEvent(event); err != nil {
+		log.Errorf("audit: Failed to record %s event for user %s: %v", eventType, userID, err)
+	}
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	initx "github.com/instrlabs/shared/init"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const auditTTLIndexName = "created_at_ttl"
+
+// AuditRepository handles database operations for the security audit trail
+type AuditRepository struct {
+	db         *initx.Mongo
+	collection *mongo.Collection
+}
+
+// NewAuditRepository creates a new audit repository instance and makes sure events expire after retention
+func NewAuditRepository(db *initx.Mongo, retention time.Duration) *AuditRepository {
+	r := &AuditRepository{
+		db:         db,
+		collection: db.DB.Collection("audit_events"),
+	}
+	r.ensureIndexes(retention)
+	return r
+}
+
+// ensureIndexes creates the TTL index, or updates its expiry when the retention setting changed
+func (r *AuditRepository) ensureIndexes(retention time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	seconds := int32(retention / time.Second)
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetName(auditTTLIndexName).SetExpireAfterSeconds(seconds),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err == nil {
+		return
+	}
+
+	err = r.db.DB.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: r.collection.Name()},
+		{Key: "index", Value: bson.M{"name": auditTTLIndexName, "expireAfterSeconds": seconds}},
+	}).Err()
+	if err != nil {
+		log.Errorf("ensureIndexes: Failed to set audit retention: %v", err)
+	}
+}
+
+// RecordEvent stores an audit event
+func (r *AuditRepository) RecordEvent(event *AuditEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.InsertOne(ctx, event)
+	if err != nil {
+		log.Errorf("RecordEvent: Failed to insert audit event: %v", err)
+		return err
+	}
+	event.ID, _ = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindEvents returns one page of matching events, newest first, and the total number of matches
+func (r *AuditRepository) FindEvents(search AuditSearch) ([]AuditEvent, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if search.UserID != "" {
+		filter["user_id"] = search.UserID
+	}
+	if search.Type != "" {
+		filter["type"] = search.Type
+	}
+	if search.Result != "" {
+		filter["result"] = search.Result
+	}
+	if search.IPAddress != "" {
+		filter["ip_address"] = search.IPAddress
+	}
+	if search.Since != nil || search.Until != nil {
+		createdAt := bson.M{}
+		if search.Since != nil {
+			createdAt["$gte"] = *search.Since
+		}
+		if search.Until != nil {
+			createdAt["$lt"] = *search.Until
+		}
+		filter["created_at"] = createdAt
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Errorf("FindEvents: Failed to count audit events: %v", err)
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((search.Page - 1) * search.Limit)).
+		SetLimit(int64(search.Limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Errorf("FindEvents: Failed to find audit events: %v", err)
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		log.Errorf("FindEvents: Failed to decode audit events: %v", err)
+		return nil, 0, err
+	}
+	return events, total, nil
+}
@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryAuditLog is an in-memory IAuditRepository
+type memoryAuditLog struct {
+	events []AuditEvent
+}
+
+func (m *memoryAuditLog) RecordEvent(event *AuditEvent) error {
+	event.ID = primitive.NewObjectID()
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *memoryAuditLog) FindEvents(search AuditSearch) ([]AuditEvent, int64, error) {
+	matches := []AuditEvent{}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		e := m.events[i]
+		if (search.UserID == "" || e.UserID == search.UserID) &&
+			(search.Type == "" || e.Type == search.Type) &&
+			(search.Result == "" || e.Result == search.Result) &&
+			(search.IPAddress == "" || e.IPAddress == search.IPAddress) {
+			matches = append(matches, e)
+		}
+	}
+	total := int64(len(matches))
+	start := (search.Page - 1) * search.Limit
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + search.Limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+	return matches[start:end], total, nil
+}
+
+// types lists the type and result of each recorded event
+func (m *memoryAuditLog) types() []string {
+	out := make([]string, 0, len(m.events))
+	for _, e := range m.events {
+		out = append(out, e.Type+":"+e.Result)
+	}
+	return out
+}
+
+func TestLogin_AuditsFailuresAndSuccess(t *testing.T) {
+	user := NewUser("user@example.com")
+	user.RegisteredAt = &user.CreatedAt
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	pinHash := string(hash)
+	user.PinHash = &pinHash
+
+	userRepo := &MockUserRepository{FindByEmailFunc: func(email string) *User {
+		if email == user.Email {
+			return user
+		}
+		return nil
+	}}
+	sessionRepo := &MockSessionRepository{
+		CreateSessionFunc: func(userID string, ipAddress string, userAgent string) (*UserSession, error) {
+			return &UserSession{ID: primitive.NewObjectID(), UserID: userID, SessionID: "s1"}, nil
+		},
+	}
+	auditLog := &memoryAuditLog{}
+	handler := NewUserHandler(newMockConfig(), userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	app.Post("/login", handler.Login)
+
+	status, _ := postJSON(t, app, "/login", `{"email":"nobody@example.com","pin":"123456"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = postJSON(t, app, "/login", `{"email":"user@example.com","pin":"000000"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	req := httptest.NewRequest(fiber.MethodPost, "/login", strings.NewReader(`{"email":"user@example.com","pin":"123456"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "audit-test")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	require.Equal(t, []string{
+		"login.failure:invalid_credentials",
+		"login.failure:invalid_credentials",
+		"login.success:success",
+	}, auditLog.types())
+
+	unknown, wrongPin, success := auditLog.events[0], auditLog.events[1], auditLog.events[2]
+	assert.Empty(t, unknown.UserID)
+	assert.Equal(t, "nobody@example.com", unknown.Details["email"])
+	assert.Equal(t, user.ID.Hex(), wrongPin.UserID)
+	assert.Equal(t, user.ID.Hex(), success.UserID)
+	assert.Equal(t, "s1", success.SessionID)
+	assert.Equal(t, "pin", success.Details["method"])
+	assert.Equal(t, "audit-test", success.UserAgent)
+	assert.NotEmpty(t, success.IPAddress)
+}
+
+func TestRefreshToken_AuditsRefreshAndSuspiciousUse(t *testing.T) {
+	user := NewUser("user@example.com")
+	// No middleware sets the device locals in tests, so requests hash an empty IP and User-Agent
+	session := &UserSession{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), SessionID: "s1", IsActive: true,
+		RefreshTokenHash: HashRefreshToken("first"), DeviceHash: GenerateDeviceHash("", "")}
+	sessionRepo := memorySessions(session)
+	auditLog := &memoryAuditLog{}
+	userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User { return user }}
+	handler := NewUserHandler(newMockConfig(), userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	app.Post("/refresh", handler.RefreshToken)
+
+	status, second := refresh(t, app, "first")
+	require.Equal(t, fiber.StatusOK, status)
+	status, _ = refresh(t, app, "first")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// A token presented from another device than the one the session is bound to
+	session.IsActive = true
+	session.DeviceHash = GenerateDeviceHash("203.0.113.7", "other-browser")
+	status, _ = refresh(t, app, second)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	assert.Equal(t, []string{
+		"token.refreshed:success",
+		"token.suspicious_refresh:token_reuse",
+		"token.suspicious_refresh:device_mismatch",
+	}, auditLog.types())
+	for _, e := range auditLog.events {
+		assert.Equal(t, user.ID.Hex(), e.UserID)
+		assert.Equal(t, "s1", e.SessionID)
+	}
+}
+
+func TestSecurityEvents_UserSeesOwnAdminFilters(t *testing.T) {
+	admin := newAdmin()
+	member := NewUser("member@example.com")
+	auditLog := &memoryAuditLog{events: []AuditEvent{
+		{UserID: member.ID.Hex(), Type: AuditLoginSuccess, Result: AuditResultSuccess, IPAddress: "198.51.100.1"},
+		{UserID: admin.ID.Hex(), Type: AuditLoginSuccess, Result: AuditResultSuccess, IPAddress: "198.51.100.2"},
+		{UserID: member.ID.Hex(), Type: AuditLoginFailure, Result: AuditResultInvalidCredentials, IPAddress: "203.0.113.9"},
+	}}
+	userRepo := memoryUserDirectory(admin, member)
+	users := NewUserHandler(newMockConfig(), userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, &recordingPublisher{}, newMockMailer())
+	adminHandler := NewAdminHandler(users, NewAPIKeyHandler(newMockConfig(), &memoryAPIKeys{}, userRepo, &recordingPublisher{}))
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	app.Get("/security/events", users.GetSecurityEvents)
+	adminRoutes := app.Group("/admin", RequireRole(userRepo, RoleAdmin))
+	adminRoutes.Get("/security/events", adminHandler.ListSecurityEvents)
+	adminRoutes.Post("/users/:userId/roles", adminHandler.SetUserRoles)
+
+	status, body := apiKeyRequest(t, app, fiber.MethodGet, "/security/events?user_id="+admin.ID.Hex(), member.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	data := body["data"].(map[string]interface{})
+	assert.Equal(t, float64(2), data["total"])
+	for _, e := range data["events"].([]interface{}) {
+		assert.Equal(t, member.ID.Hex(), e.(map[string]interface{})["user_id"])
+	}
+
+	status, _ = apiKeyRequest(t, app, fiber.MethodGet, "/admin/security/events", member.ID.Hex(), "")
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	status, body = apiKeyRequest(t, app, fiber.MethodGet, "/admin/security/events?ip=203.0.113.9", admin.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	data = body["data"].(map[string]interface{})
+	require.Equal(t, float64(1), data["total"])
+	assert.Equal(t, AuditLoginFailure, data["events"].([]interface{})[0].(map[string]interface{})["type"])
+
+	// Role changes are audited against the target user
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/admin/users/"+member.ID.Hex()+"/roles", admin.ID.Hex(), `{"roles":["user","admin"]}`)
+	require.Equal(t, fiber.StatusOK, status)
+	last := auditLog.events[len(auditLog.events)-1]
+	assert.Equal(t, AuditRolesChanged, last.Type)
+	assert.Equal(t, member.ID.Hex(), last.UserID)
+	assert.Equal(t, "user", last.Details["previous_roles"])
+	assert.Equal(t, "user,admin", last.Details["roles"])
+	assert.Equal(t, admin.ID.Hex(), last.Details["changed_by"])
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"net"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Session binding policies, selected with SESSION_BINDING_POLICY
+const (
+	BindingPolicyStrict    = "strict"
+	BindingPolicyUserAgent = "user_agent"
+	BindingPolicySubnet    = "subnet"
+	BindingPolicyOff       = "off"
+)
+
+const (
+	defaultBindingIPv4Prefix = 24
+	defaultBindingIPv6Prefix = 48
+)
+
+// BindingPolicy decides whether a refresh comes from the device its session is bound to
+type BindingPolicy interface {
+	Name() string
+	Matches(session *UserSession, ipAddress string, userAgent string) bool
+}
+
+// NewBindingPolicy returns the policy configured for the environment.
+// An unknown name falls back to strict, so a typo never turns binding off.
+func NewBindingPolicy(cfg *Config) BindingPolicy {
+	switch cfg.SessionBindingPolicy {
+	case BindingPolicyStrict, "":
+		return strictBinding{}
+	case BindingPolicyUserAgent:
+		return userAgentBinding{}
+	case BindingPolicySubnet:
+		policy := subnetBinding{ipv4Bits: cfg.SessionBindingIPv4Prefix, ipv6Bits: cfg.SessionBindingIPv6Prefix}
+		// An out of range prefix has no mask, and comparing nil masked addresses would match any network
+		if policy.ipv4Bits < 1 || policy.ipv4Bits > 32 {
+			policy.ipv4Bits = defaultBindingIPv4Prefix
+		}
+		if policy.ipv6Bits < 1 || policy.ipv6Bits > 128 {
+			policy.ipv6Bits = defaultBindingIPv6Prefix
+		}
+		return policy
+	case BindingPolicyOff:
+		return offBinding{}
+	default:
+		log.Warnf("NewBindingPolicy: Unknown session binding policy %q, using %s", cfg.SessionBindingPolicy, BindingPolicyStrict)
+		return strictBinding{}
+	}
+}
+
+// strictBinding requires the same IP and User-Agent the session was created with
+type strictBinding struct{}
+
+func (strictBinding) Name() string { return BindingPolicyStrict }
+
+func (strictBinding) Matches(session *UserSession, ipAddress string, userAgent string) bool {
+	return session.DeviceHash == GenerateDeviceHash(ipAddress, userAgent)
+}
+
+// userAgentBinding requires the same User-Agent and lets the IP change freely
+type userAgentBinding struct{}
+
+func (userAgentBinding) Name() string { return BindingPolicyUserAgent }
+
+func (userAgentBinding) Matches(session *UserSession, ipAddress string, userAgent string) bool {
+	return session.UserAgent == userAgent
+}
+
+// subnetBinding requires the same User-Agent and an IP in the same network as the session's,
+// which tolerates address changes within a carrier or NAT pool
+type subnetBinding struct {
+	ipv4Bits int
+	ipv6Bits int
+}
+
+func (subnetBinding) Name() string { return BindingPolicySubnet }
+
+func (p subnetBinding) Matches(session *UserSession, ipAddress string, userAgent string) bool {
+	return session.UserAgent == userAgent && p.sameNetwork(session.IPAddress, ipAddress)
+}
+
+func (p subnetBinding) sameNetwork(a string, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+
+	if v4A, v4B := ipA.To4(), ipB.To4(); v4A != nil || v4B != nil {
+		if v4A == nil || v4B == nil {
+			return false
+		}
+		mask := net.CIDRMask(p.ipv4Bits, 32)
+		return v4A.Mask(mask).Equal(v4B.Mask(mask))
+	}
+	mask := net.CIDRMask(p.ipv6Bits, 128)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
+
+// offBinding accepts a refresh from any device; the refresh token alone identifies the session
+type offBinding struct{}
+
+func (offBinding) Name() string { return BindingPolicyOff }
+
+func (offBinding) Matches(session *UserSession, ipAddress string, userAgent string) bool {
+	return true
+}
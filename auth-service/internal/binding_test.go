@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBindingPolicies(t *testing.T) {
+	const (
+		ua      = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) Mobile/15E148 Safari/604.1"
+		otherUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0.0.0 Safari/537.36"
+	)
+	session := func(ip string) *UserSession {
+		return &UserSession{IPAddress: ip, UserAgent: ua, DeviceHash: GenerateDeviceHash(ip, ua)}
+	}
+
+	cases := []struct {
+		name      string
+		policy    string
+		sessionIP string
+		ip        string
+		userAgent string
+		want      bool
+	}{
+		{"strict same device", BindingPolicyStrict, "198.51.100.10", "198.51.100.10", ua, true},
+		{"strict new IP", BindingPolicyStrict, "198.51.100.10", "198.51.100.11", ua, false},
+		{"strict new user agent", BindingPolicyStrict, "198.51.100.10", "198.51.100.10", otherUA, false},
+		{"unknown policy is strict", "lenient", "198.51.100.10", "203.0.113.5", ua, false},
+		{"empty policy is strict", "", "198.51.100.10", "198.51.100.10", ua, true},
+
+		{"user agent ignores IP", BindingPolicyUserAgent, "198.51.100.10", "203.0.113.5", ua, true},
+		{"user agent new user agent", BindingPolicyUserAgent, "198.51.100.10", "198.51.100.10", otherUA, false},
+
+		{"subnet same /24", BindingPolicySubnet, "198.51.100.10", "198.51.100.200", ua, true},
+		{"subnet other /24", BindingPolicySubnet, "198.51.100.10", "198.51.101.10", ua, false},
+		{"subnet new user agent", BindingPolicySubnet, "198.51.100.10", "198.51.100.10", otherUA, false},
+		{"subnet same /48", BindingPolicySubnet, "2001:db8:1:1::1", "2001:db8:1:ffff::2", ua, true},
+		{"subnet other /48", BindingPolicySubnet, "2001:db8:1::1", "2001:db8:2::1", ua, false},
+		{"subnet IPv4 to IPv6", BindingPolicySubnet, "198.51.100.10", "2001:db8:1::1", ua, false},
+		{"subnet IPv4-mapped IPv6", BindingPolicySubnet, "198.51.100.10", "::ffff:198.51.100.99", ua, true},
+		{"subnet unparsable IPs compared as is", BindingPolicySubnet, "unknown", "unknown", ua, true},
+		{"subnet unparsable IP changed", BindingPolicySubnet, "unknown", "198.51.100.10", ua, false},
+
+		{"off accepts any device", BindingPolicyOff, "198.51.100.10", "203.0.113.5", otherUA, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newMockConfig()
+			cfg.SessionBindingPolicy = tc.policy
+			cfg.SessionBindingIPv4Prefix = 24
+			cfg.SessionBindingIPv6Prefix = 48
+			policy := NewBindingPolicy(cfg)
+			assert.Equal(t, tc.want, policy.Matches(session(tc.sessionIP), tc.ip, tc.userAgent))
+		})
+	}
+}
+
+func TestBindingPolicies_InvalidPrefixFallsBack(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.SessionBindingPolicy = BindingPolicySubnet
+	cfg.SessionBindingIPv4Prefix = 0
+	cfg.SessionBindingIPv6Prefix = 200
+	policy := NewBindingPolicy(cfg)
+
+	session := &UserSession{IPAddress: "198.51.100.10", UserAgent: "ua"}
+	assert.True(t, policy.Matches(session, "198.51.100.20", "ua"))
+	assert.False(t, policy.Matches(session, "203.0.113.20", "ua"))
+	assert.False(t, policy.Matches(&UserSession{IPAddress: "2001:db8:1::1", UserAgent: "ua"}, "2001:db8:2::1", "ua"))
+}
+
+func TestRefreshToken_BindingStepUp(t *testing.T) {
+	user := NewUser("user@example.com")
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	pinHash := string(hash)
+	user.PinHash = &pinHash
+
+	cases := []struct {
+		name       string
+		stepUp     bool
+		wantStatus int
+		wantActive bool
+	}{
+		{"step-up keeps the session", true, fiber.StatusUnauthorized, true},
+		{"hard failure revokes the session", false, fiber.StatusUnauthorized, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			session := &UserSession{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), SessionID: "s1", IsActive: true,
+				RefreshTokenHash: HashRefreshToken("first"), IPAddress: "198.51.100.10", UserAgent: "phone",
+				DeviceHash: GenerateDeviceHash("198.51.100.10", "phone")}
+			sessionRepo := memorySessions(session)
+			sessionRepo.RebindSessionFunc = func(sessionID string, ipAddress string, userAgent string) error {
+				session.IPAddress, session.UserAgent = ipAddress, userAgent
+				session.DeviceHash = GenerateDeviceHash(ipAddress, userAgent)
+				return nil
+			}
+			cfg := newMockConfig()
+			cfg.SessionBindingStepUp = tc.stepUp
+			userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User { return user }}
+			auditLog := &memoryAuditLog{}
+			handler := NewUserHandler(cfg, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, &recordingPublisher{}, newMockMailer())
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("userIP", "203.0.113.5")
+				c.Locals("userAgent", "phone")
+				return c.Next()
+			})
+			app.Post("/refresh", handler.RefreshToken)
+			app.Post("/refresh/step-up", handler.StepUpRefresh)
+
+			status, body := postJSON(t, app, "/refresh", `{"refresh_token":"first"}`)
+			require.Equal(t, tc.wantStatus, status)
+			assert.Equal(t, tc.wantActive, session.IsActive)
+			last := auditLog.events[len(auditLog.events)-1]
+			assert.Equal(t, AuditSuspiciousRefresh+":"+AuditResultDeviceMismatch, last.Type+":"+last.Result)
+			assert.Equal(t, BindingPolicyStrict, last.Details["policy"])
+
+			if !tc.stepUp {
+				status, _ = postJSON(t, app, "/refresh/step-up", `{"refresh_token":"first","pin":"123456"}`)
+				assert.Equal(t, fiber.StatusForbidden, status)
+				return
+			}
+			assert.Equal(t, true, body["data"].(map[string]interface{})["step_up_required"])
+
+			status, _ = postJSON(t, app, "/refresh/step-up", `{"refresh_token":"first","pin":"000000"}`)
+			assert.Equal(t, fiber.StatusBadRequest, status)
+
+			status, body = postJSON(t, app, "/refresh/step-up", `{"refresh_token":"first","pin":"123456"}`)
+			require.Equal(t, fiber.StatusOK, status)
+			assert.Equal(t, "203.0.113.5", session.IPAddress)
+			next := body["data"].(map[string]interface{})["refresh_token"].(string)
+			assert.Equal(t, HashRefreshToken(next), session.RefreshTokenHash)
+
+			// The session is now bound to this device, so plain refreshes work again
+			status, _ = postJSON(t, app, "/refresh", `{"refresh_token":"`+next+`"}`)
+			assert.Equal(t, fiber.StatusOK, status)
+
+			assert.Contains(t, auditLog.types(), AuditStepUp+":"+AuditResultInvalidCredentials)
+			assert.Contains(t, auditLog.types(), AuditStepUp+":"+AuditResultSuccess)
+		})
+	}
+}
+
+func TestStepUpRefresh_RequiresMFACode(t *testing.T) {
+	user := newMFAUser()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	pinHash := string(hash)
+	user.PinHash = &pinHash
+
+	session := &UserSession{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), SessionID: "s1", IsActive: true,
+		RefreshTokenHash: HashRefreshToken("first"), IPAddress: "198.51.100.10", UserAgent: "phone",
+		DeviceHash: GenerateDeviceHash("198.51.100.10", "phone")}
+	sessionRepo := memorySessions(session)
+	rebound := false
+	sessionRepo.RebindSessionFunc = func(sessionID string, ipAddress string, userAgent string) error {
+		rebound = true
+		return nil
+	}
+	userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User { return user }}
+	cfg := newMockConfig()
+	cfg.SessionBindingStepUp = true
+	auditLog := &memoryAuditLog{}
+	handler := NewUserHandler(cfg, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	app.Post("/refresh/step-up", handler.StepUpRefresh)
+
+	status, _ := postJSON(t, app, "/refresh/step-up", `{"refresh_token":"first","pin":"123456"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "a PIN alone does not step up an MFA user")
+
+	status, _ = postJSON(t, app, "/refresh/step-up", `{"refresh_token":"first","pin":"123456","code":"000000"}`)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.False(t, rebound)
+	assert.Contains(t, auditLog.types(), AuditStepUp+":"+AuditResultInvalidCode)
+
+	code, _ := totpCode(rfcTOTPSecret, time.Now().Unix()/totpPeriod)
+	status, _ = postJSON(t, app, "/refresh/step-up", `{"refresh_token":"first","pin":"123456","code":"`+code+`"}`)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.True(t, rebound)
+}
@@ -1,29 +1,115 @@
 package internal
 
 import (
+	"fmt"
+	"strings"
+
 	initx "github.com/instrlabs/shared/init"
 	"github.com/joho/godotenv"
 )
 
+// minJWTSecretLength is the shortest JWT_SECRET accepted, 256 bits for the HS256 keys derived from it
+const minJWTSecretLength = 32
+
 type Config struct {
-	Environment        string
-	Port               string
-	MongoURI           string
-	MongoDB            string
-	JWTSecret          string
-	TokenExpiryHours   int
-	RefreshExpiryHours int
-	SMTPHost           string
-	SMTPPort           string
-	SMTPUsername       string
-	SMTPPassword       string
-	EmailFrom          string
-	GoogleClientID     string
-	GoogleClientSecret string
-	GoogleRedirectUrl  string
-	ApiUrl             string
-	WebUrl             string
-	PinEnabled         bool
+	Environment           string
+	Port                  string
+	MongoURI              string
+	MongoDB               string
+	JWTSecret             string
+	JWTSigningAlgorithm   string
+	JWTKeyRotationHours   int
+	TokenExpiryHours      int
+	RefreshExpiryHours    int
+	SMTPHost              string
+	SMTPPort              string
+	SMTPUsername          string
+	SMTPPassword          string
+	EmailFrom             string
+	GoogleClientID        string
+	GoogleClientSecret    string
+	GoogleRedirectUrl     string
+	GoogleAuthURL         string
+	GoogleTokenURL        string
+	GoogleUserInfoURL     string
+	GitHubClientID        string
+	GitHubClientSecret    string
+	MicrosoftClientID     string
+	MicrosoftClientSecret string
+	MicrosoftTenant       string
+	OAuthProvidersFile    string
+	ApiUrl                string
+	WebUrl                string
+	PinEnabled            bool
+	MFAIssuer             string
+	MFATokenExpiryMins    int
+	WebAuthnRPID          string
+	WebAuthnRPName        string
+	WebAuthnOrigins       []string
+
+	LoginMaxFailuresPerEmail int
+	LoginMaxFailuresPerIP    int
+	LockoutBaseSeconds       int
+	LockoutMaxSeconds        int
+	PinMaxAttempts           int
+	MFAMaxFailures           int
+	PinResendCooldownSeconds int
+	SendPinMaxPerEmail       int
+	SendPinMaxPerIP          int
+	AttemptWindowMinutes     int
+	AttemptStore             string
+
+	APIKeyDefaultExpiryDays  int
+	APIKeyMaxExpiryDays      int
+	NatsURI                  string
+	NatsSubjectAPIKeyResolve string
+	NatsSubjectAPIKeyRevoked string
+
+	NatsSubjectNotificationsSSE string
+
+	AdminEmails []string
+
+	S3Endpoint     string
+	S3Region       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3Bucket       string
+	S3UseSSL       bool
+	AvatarMaxBytes int
+
+	AccountDeletionGraceDays       int
+	AccountServices                []string
+	NatsSubjectAccountDeleted      string
+	NatsSubjectAccountDeletionDone string
+	NatsSubjectAccountExport       string
+
+	AuditRetentionDays int
+
+	SessionBindingPolicy     string
+	SessionBindingIPv4Prefix int
+	SessionBindingIPv6Prefix int
+	SessionBindingStepUp     bool
+
+	SessionIdleTimeoutHours       int
+	SessionMaxLifetimeDays        int
+	NatsSubjectSessionRevoked     string
+	NatsSubjectSessionRevocations string
+	NatsSubjectSessionActivity    string
+
+	MagicLinkExpiryMinutes int
+
+	OrgInvitationExpiryDays int
+
+	ServiceClients         map[string]string
+	ServiceTokenTTLMinutes int
+	TrustedServices        []string
+
+	MailTransport        string
+	MailOutboxDir        string
+	MailDefaultLocale    string
+	MailQueueSize        int
+	MailMaxAttempts      int
+	MailRetryBaseSeconds int
 }
 
 func LoadConfig() *Config {
@@ -36,9 +122,11 @@ func LoadConfig() *Config {
 		MongoURI: initx.GetEnv("MONGO_URI", ""),
 		MongoDB:  initx.GetEnv("MONGO_DB", ""),
 
-		JWTSecret:          initx.GetEnv("JWT_SECRET", ""),
-		TokenExpiryHours:   initx.GetEnvInt("TOKEN_EXPIRY_HOURS", 1),
-		RefreshExpiryHours: initx.GetEnvInt("REFRESH_EXPIRY_HOURS", 720),
+		JWTSecret:           initx.GetEnv("JWT_SECRET", ""),
+		JWTSigningAlgorithm: initx.GetEnv("JWT_SIGNING_ALGORITHM", SigningAlgRS256),
+		JWTKeyRotationHours: initx.GetEnvInt("JWT_KEY_ROTATION_HOURS", 720),
+		TokenExpiryHours:    initx.GetEnvInt("TOKEN_EXPIRY_HOURS", 1),
+		RefreshExpiryHours:  initx.GetEnvInt("REFRESH_EXPIRY_HOURS", 720),
 
 		SMTPHost:     initx.GetEnv("SMTP_HOST", ""),
 		SMTPPort:     initx.GetEnv("SMTP_PORT", ""),
@@ -49,10 +137,125 @@ func LoadConfig() *Config {
 		GoogleClientID:     initx.GetEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: initx.GetEnv("GOOGLE_CLIENT_SECRET", ""),
 		GoogleRedirectUrl:  initx.GetEnv("GOOGLE_REDIRECT_URL", ""),
+		GoogleAuthURL:      initx.GetEnv("GOOGLE_AUTH_URL", "https://accounts.google.com/o/oauth2/auth"),
+		GoogleTokenURL:     initx.GetEnv("GOOGLE_TOKEN_URL", "https://oauth2.googleapis.com/token"),
+		GoogleUserInfoURL:  initx.GetEnv("GOOGLE_USERINFO_URL", "https://www.googleapis.com/oauth2/v2/userinfo"),
+
+		GitHubClientID:     initx.GetEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: initx.GetEnv("GITHUB_CLIENT_SECRET", ""),
+
+		MicrosoftClientID:     initx.GetEnv("MICROSOFT_CLIENT_ID", ""),
+		MicrosoftClientSecret: initx.GetEnv("MICROSOFT_CLIENT_SECRET", ""),
+		MicrosoftTenant:       initx.GetEnv("MICROSOFT_TENANT", "common"),
+
+		OAuthProvidersFile: initx.GetEnv("OAUTH_PROVIDERS_FILE", ""),
 
 		ApiUrl: initx.GetEnv("API_URL", ""),
 		WebUrl: initx.GetEnv("WEB_URL", ""),
 
 		PinEnabled: initx.GetEnvBool("PIN_ENABLED", false),
+
+		MFAIssuer:          initx.GetEnv("MFA_ISSUER", "Instrlabs"),
+		MFATokenExpiryMins: initx.GetEnvInt("MFA_TOKEN_EXPIRY_MINUTES", 5),
+
+		WebAuthnRPID:    initx.GetEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:  initx.GetEnv("WEBAUTHN_RP_NAME", "Instrlabs"),
+		WebAuthnOrigins: splitList(initx.GetEnv("WEBAUTHN_ORIGINS", initx.GetEnv("WEB_URL", ""))),
+
+		LoginMaxFailuresPerEmail: initx.GetEnvInt("LOGIN_MAX_FAILURES_PER_EMAIL", 5),
+		LoginMaxFailuresPerIP:    initx.GetEnvInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+		LockoutBaseSeconds:       initx.GetEnvInt("LOCKOUT_BASE_SECONDS", 60),
+		LockoutMaxSeconds:        initx.GetEnvInt("LOCKOUT_MAX_SECONDS", 3600),
+		PinMaxAttempts:           initx.GetEnvInt("PIN_MAX_ATTEMPTS", 5),
+		MFAMaxFailures:           initx.GetEnvInt("MFA_MAX_FAILURES", 5),
+		PinResendCooldownSeconds: initx.GetEnvInt("PIN_RESEND_COOLDOWN_SECONDS", 60),
+		SendPinMaxPerEmail:       initx.GetEnvInt("SEND_PIN_MAX_PER_EMAIL", 5),
+		SendPinMaxPerIP:          initx.GetEnvInt("SEND_PIN_MAX_PER_IP", 10),
+		AttemptWindowMinutes:     initx.GetEnvInt("ATTEMPT_WINDOW_MINUTES", 60),
+		AttemptStore:             initx.GetEnv("ATTEMPT_STORE", AttemptStoreMongo),
+
+		APIKeyDefaultExpiryDays:  initx.GetEnvInt("API_KEY_DEFAULT_EXPIRY_DAYS", 90),
+		APIKeyMaxExpiryDays:      initx.GetEnvInt("API_KEY_MAX_EXPIRY_DAYS", 365),
+		NatsURI:                  initx.GetEnv("NATS_URI", "nats://localhost:4222"),
+		NatsSubjectAPIKeyResolve: initx.GetEnv("NATS_SUBJECT_API_KEY_RESOLVE", "auth.api_keys.resolve"),
+		NatsSubjectAPIKeyRevoked: initx.GetEnv("NATS_SUBJECT_API_KEY_REVOKED", "auth.api_keys.revoked"),
+
+		NatsSubjectNotificationsSSE: initx.GetEnv("NATS_SUBJECT_NOTIFICATIONS_SSE", "notifications.sse"),
+
+		AdminEmails: splitList(initx.GetEnv("ADMIN_EMAILS", "")),
+
+		S3Endpoint:     initx.GetEnv("S3_ENDPOINT", "localhost:9000"),
+		S3Region:       initx.GetEnv("S3_REGION", "us-east-1"),
+		S3AccessKey:    initx.GetEnv("S3_ACCESS_KEY", "minioadmin"),
+		S3SecretKey:    initx.GetEnv("S3_SECRET_KEY", "minioadmin"),
+		S3Bucket:       initx.GetEnv("S3_BUCKET", "instrlabs-apps"),
+		S3UseSSL:       initx.GetEnvBool("S3_USE_SSL", false),
+		AvatarMaxBytes: initx.GetEnvInt("AVATAR_MAX_BYTES", 2*1024*1024),
+
+		AccountDeletionGraceDays:       initx.GetEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 14),
+		AccountServices:                splitList(initx.GetEnv("ACCOUNT_SERVICES", "image,pdf")),
+		NatsSubjectAccountDeleted:      initx.GetEnv("NATS_SUBJECT_ACCOUNT_DELETED", "accounts.deleted"),
+		NatsSubjectAccountDeletionDone: initx.GetEnv("NATS_SUBJECT_ACCOUNT_DELETION_DONE", "accounts.deletion.completed"),
+		NatsSubjectAccountExport:       initx.GetEnv("NATS_SUBJECT_ACCOUNT_EXPORT", "accounts.export"),
+
+		AuditRetentionDays: initx.GetEnvInt("AUDIT_RETENTION_DAYS", 90),
+
+		SessionBindingPolicy:     initx.GetEnv("SESSION_BINDING_POLICY", BindingPolicyStrict),
+		SessionBindingIPv4Prefix: initx.GetEnvInt("SESSION_BINDING_IPV4_PREFIX", defaultBindingIPv4Prefix),
+		SessionBindingIPv6Prefix: initx.GetEnvInt("SESSION_BINDING_IPV6_PREFIX", defaultBindingIPv6Prefix),
+		SessionBindingStepUp:     initx.GetEnvBool("SESSION_BINDING_STEP_UP", true),
+
+		SessionIdleTimeoutHours:       initx.GetEnvInt("SESSION_IDLE_TIMEOUT_HOURS", 168),
+		SessionMaxLifetimeDays:        initx.GetEnvInt("SESSION_MAX_LIFETIME_DAYS", 30),
+		NatsSubjectSessionRevoked:     initx.GetEnv("NATS_SUBJECT_SESSION_REVOKED", "auth.sessions.revoked"),
+		NatsSubjectSessionRevocations: initx.GetEnv("NATS_SUBJECT_SESSION_REVOCATIONS", "auth.sessions.revocations"),
+		NatsSubjectSessionActivity:    initx.GetEnv("NATS_SUBJECT_SESSION_ACTIVITY", "auth.sessions.activity"),
+
+		MagicLinkExpiryMinutes: initx.GetEnvInt("MAGIC_LINK_EXPIRY_MINUTES", 10),
+
+		OrgInvitationExpiryDays: initx.GetEnvInt("ORG_INVITATION_EXPIRY_DAYS", 7),
+
+		ServiceClients:         parseServiceClients(initx.GetEnv("SERVICE_CLIENTS", "")),
+		ServiceTokenTTLMinutes: initx.GetEnvInt("SERVICE_TOKEN_TTL_MINUTES", 5),
+		TrustedServices:        splitList(initx.GetEnv("TRUSTED_SERVICES", "gateway-service")),
+
+		MailTransport:        initx.GetEnv("MAIL_TRANSPORT", MailTransportSMTP),
+		MailOutboxDir:        initx.GetEnv("MAIL_OUTBOX_DIR", "outbox"),
+		MailDefaultLocale:    initx.GetEnv("MAIL_DEFAULT_LOCALE", "en"),
+		MailQueueSize:        initx.GetEnvInt("MAIL_QUEUE_SIZE", 1000),
+		MailMaxAttempts:      initx.GetEnvInt("MAIL_MAX_ATTEMPTS", 5),
+		MailRetryBaseSeconds: initx.GetEnvInt("MAIL_RETRY_BASE_SECONDS", 5),
+	}
+}
+
+// CheckJWTSecret rejects a JWT_SECRET too short to key the MFA and magic link tokens. With an empty
+// secret anyone could sign those tokens, so the service refuses to start.
+func CheckJWTSecret(secret string) error {
+	if len(secret) < minJWTSecretLength {
+		return fmt.Errorf("JWT_SECRET must be at least %d characters, got %d", minJWTSecretLength, len(secret))
+	}
+	return nil
+}
+
+// splitList parses a comma separated env value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseServiceClients parses SERVICE_CLIENTS, a comma separated list of name=secret pairs
+func parseServiceClients(value string) map[string]string {
+	clients := map[string]string{}
+	for _, item := range splitList(value) {
+		name, secret, ok := strings.Cut(item, "=")
+		if name, secret = strings.TrimSpace(name), strings.TrimSpace(secret); ok && name != "" && secret != "" {
+			clients[name] = secret
+		}
 	}
+	return clients
 }
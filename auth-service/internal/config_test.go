@@ -0,0 +1,15 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckJWTSecret(t *testing.T) {
+	assert.Error(t, CheckJWTSecret(""))
+	assert.Error(t, CheckJWTSecret("short-secret"))
+	assert.NoError(t, CheckJWTSecret(strings.Repeat("s", minJWTSecretLength)))
+	assert.NoError(t, CheckJWTSecret(newMockConfig().JWTSecret))
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Device types reported for a session
+const (
+	DeviceTypeDesktop = "desktop"
+	DeviceTypeMobile  = "mobile"
+	DeviceTypeTablet  = "tablet"
+	DeviceTypeUnknown = "unknown"
+)
+
+// NotificationNewDevice is the type of the real-time notification sent on a sign-in from a new device
+const NotificationNewDevice = "security.new_device"
+
+// DeviceNameMaxLength bounds the name a user can give one of their sessions
+const DeviceNameMaxLength = 64
+
+// DeviceInfo describes the device of a session, as far as its User-Agent tells
+type DeviceInfo struct {
+	Browser string `json:"browser" bson:"browser"`
+	OS      string `json:"os" bson:"os"`
+	Type    string `json:"type" bson:"type"`
+}
+
+// Label returns a short human readable description such as "Firefox on Windows"
+func (d DeviceInfo) Label() string {
+	browser, os := d.Browser, d.OS
+	if browser == "" {
+		browser = "Unknown browser"
+	}
+	if os == "" {
+		return browser
+	}
+	return browser + " on " + os
+}
+
+// NewDeviceNotification is published to the notification service when a user signs in from a new device
+type NewDeviceNotification struct {
+	UserID    string     `json:"user_id"`
+	Type      string     `json:"type"`
+	SessionID string     `json:"session_id"`
+	Device    DeviceInfo `json:"device"`
+	IPAddress string     `json:"ip_address"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ParseUserAgent extracts the browser, operating system and device type from a User-Agent header.
+// Order matters: most browsers also name the engines they are compatible with.
+func ParseUserAgent(userAgent string) DeviceInfo {
+	if userAgent == "" {
+		return DeviceInfo{Type: DeviceTypeUnknown}
+	}
+
+	info := DeviceInfo{Type: DeviceTypeDesktop}
+	switch {
+	case strings.Contains(userAgent, "Edg/"), strings.Contains(userAgent, "EdgA/"), strings.Contains(userAgent, "EdgiOS/"):
+		info.Browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"), strings.Contains(userAgent, "Opera"):
+		info.Browser = "Opera"
+	case strings.Contains(userAgent, "SamsungBrowser/"):
+		info.Browser = "Samsung Internet"
+	case strings.Contains(userAgent, "Firefox/"), strings.Contains(userAgent, "FxiOS/"):
+		info.Browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"), strings.Contains(userAgent, "CriOS/"):
+		info.Browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		info.Browser = "Safari"
+	}
+
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPod"):
+		info.OS, info.Type = "iOS", DeviceTypeMobile
+	case strings.Contains(userAgent, "iPad"):
+		info.OS, info.Type = "iPadOS", DeviceTypeTablet
+	case strings.Contains(userAgent, "Android"):
+		info.OS, info.Type = "Android", DeviceTypeTablet
+		if strings.Contains(userAgent, "Mobile") {
+			info.Type = DeviceTypeMobile
+		}
+	case strings.Contains(userAgent, "Windows"):
+		info.OS = "Windows"
+	case strings.Contains(userAgent, "CrOS"):
+		info.OS = "ChromeOS"
+	case strings.Contains(userAgent, "Macintosh"), strings.Contains(userAgent, "Mac OS X"):
+		info.OS = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		info.OS = "Linux"
+	}
+
+	if info.Browser == "" && info.OS == "" {
+		info.Type = DeviceTypeUnknown
+	}
+	return info
+}
+
+// GenerateDeviceRevokeToken creates the token of a "this wasn't me" link
+func GenerateDeviceRevokeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashDeviceRevokeToken returns the SHA256 hex digest under which a revoke token is stored
+func HashDeviceRevokeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	uaChromeWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	uaSafariIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		userAgent string
+		want      DeviceInfo
+	}{
+		{uaChromeWindows, DeviceInfo{Browser: "Chrome", OS: "Windows", Type: DeviceTypeDesktop}},
+		{uaSafariIPhone, DeviceInfo{Browser: "Safari", OS: "iOS", Type: DeviceTypeMobile}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			DeviceInfo{Browser: "Edge", OS: "macOS", Type: DeviceTypeDesktop}},
+		{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			DeviceInfo{Browser: "Firefox", OS: "Linux", Type: DeviceTypeDesktop}},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			DeviceInfo{Browser: "Chrome", OS: "Android", Type: DeviceTypeMobile}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			DeviceInfo{Browser: "Chrome", OS: "Android", Type: DeviceTypeTablet}},
+		{"curl/8.4.0", DeviceInfo{Type: DeviceTypeUnknown}},
+		{"", DeviceInfo{Type: DeviceTypeUnknown}},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, ParseUserAgent(tc.userAgent), tc.userAgent)
+	}
+	assert.Equal(t, "Chrome on Windows", ParseUserAgent(uaChromeWindows).Label())
+}
+
+func TestGetDevices_MarksCurrentSessionAndParsesDevice(t *testing.T) {
+	sessionRepo := &MockSessionRepository{GetUserSessionsFunc: func(userID string) ([]UserSession, error) {
+		return []UserSession{
+			{SessionID: "s1", UserID: userID, UserAgent: uaChromeWindows, Name: "Work laptop"},
+			{SessionID: "s2", UserID: userID, UserAgent: uaSafariIPhone, Device: ParseUserAgent(uaSafariIPhone)},
+		}, nil
+	}}
+	keys := newMockKeyManager()
+	handler := NewUserHandler(newMockConfig(), &MockUserRepository{}, sessionRepo, keys, NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	SetupServiceIdentity(app, keys.Keyfunc, []string{"gateway-service"})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("x-user-id")))
+		return c.Next()
+	})
+	app.Get("/devices", handler.GetDevices)
+
+	// The gateway forwards the session of the access token
+	req := httptest.NewRequest(fiber.MethodGet, "/devices", nil)
+	req.Header.Set("x-user-id", "user-1")
+	req.Header.Set("x-session-id", "s2")
+	req.Header.Set(ServiceTokenHeader, serviceToken(t, keys, "gateway-service"))
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	devices := body["data"].(map[string]interface{})["devices"].([]interface{})
+	require.Len(t, devices, 2)
+
+	first, second := devices[0].(map[string]interface{}), devices[1].(map[string]interface{})
+	assert.Equal(t, false, first["current"])
+	assert.Equal(t, "Work laptop", first["name"])
+	assert.Equal(t, "Chrome", first["device"].(map[string]interface{})["browser"])
+	assert.NotContains(t, first, "user_agent")
+	assert.Equal(t, true, second["current"])
+	assert.Equal(t, DeviceTypeMobile, second["device"].(map[string]interface{})["type"])
+}
+
+func TestRenameDevice(t *testing.T) {
+	names := map[string]string{"s1": ""}
+	sessionRepo := &MockSessionRepository{RenameSessionFunc: func(sessionID string, userID string, name string) (bool, error) {
+		if _, ok := names[sessionID]; !ok || userID != "user-1" {
+			return false, nil
+		}
+		names[sessionID] = name
+		return true, nil
+	}}
+	handler := NewUserHandler(newMockConfig(), &MockUserRepository{}, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	app.Post("/devices/:sessionId/rename", handler.RenameDevice)
+
+	status, _ := apiKeyRequest(t, app, fiber.MethodPost, "/devices/s1/rename", "user-1", `{"name":"  Home PC  "}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "Home PC", names["s1"])
+
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/devices/s1/rename", "user-1", `{"name":"`+strings.Repeat("x", DeviceNameMaxLength+1)+`"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/devices/s1/rename", "user-2", `{"name":"Mine now"}`)
+	assert.Equal(t, fiber.StatusNotFound, status)
+	assert.Equal(t, "Home PC", names["s1"])
+}
+
+func TestLogin_NewDeviceAlertsAndRevokeLink(t *testing.T) {
+	user := NewUser("user@example.com")
+	user.RegisteredAt = &user.CreatedAt
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	pinHash := string(hash)
+	user.PinHash = &pinHash
+	userRepo := &MockUserRepository{FindByEmailFunc: func(email string) *User { return user }}
+
+	knownDevice := GenerateDeviceHash("198.51.100.1", uaChromeWindows)
+	sessions := map[string]*UserSession{}
+	sessionRepo := &MockSessionRepository{
+		IsNewDeviceFunc: func(userID string, deviceHash string) (bool, error) {
+			return deviceHash != knownDevice, nil
+		},
+		CreateSessionFunc: func(userID string, ipAddress string, userAgent string) (*UserSession, error) {
+			session := &UserSession{ID: primitive.NewObjectID(), UserID: userID, SessionID: GenerateSessionID(),
+				IPAddress: ipAddress, Device: ParseUserAgent(userAgent), IsActive: true}
+			sessions[session.SessionID] = session
+			return session, nil
+		},
+		SetSessionRevokeTokenFunc: func(sessionID string, tokenHash string) error {
+			sessions[sessionID].RevokeTokenHash = tokenHash
+			return nil
+		},
+		RevokeSessionByTokenFunc: func(tokenHash string) (*UserSession, error) {
+			for _, session := range sessions {
+				if session.RevokeTokenHash == tokenHash {
+					revoked := *session
+					session.IsActive, session.RevokeTokenHash = false, ""
+					return &revoked, nil
+				}
+			}
+			return nil, nil
+		},
+	}
+	events := &recordingPublisher{}
+	auditLog := &memoryAuditLog{}
+	handler := NewUserHandler(newMockConfig(), userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, events, newMockMailer())
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userIP", strings.Clone(c.Get("X-Test-IP")))
+		c.Locals("userAgent", strings.Clone(c.Get(fiber.HeaderUserAgent)))
+		return c.Next()
+	})
+	app.Post("/login", handler.Login)
+	app.Post("/devices/revoke-unrecognized", handler.RevokeUnrecognizedDevice)
+
+	login := func(ip string, userAgent string) {
+		req := httptest.NewRequest(fiber.MethodPost, "/login", strings.NewReader(`{"email":"user@example.com","pin":"123456"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-IP", ip)
+		req.Header.Set(fiber.HeaderUserAgent, userAgent)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+
+	login("198.51.100.1", uaChromeWindows)
+	assert.Empty(t, events.messages)
+
+	login("203.0.113.50", uaSafariIPhone)
+	require.Len(t, events.messages, 1)
+	assert.Equal(t, "notifications.sse", events.subjects[0])
+	var notification NewDeviceNotification
+	require.NoError(t, json.Unmarshal(events.messages[0], &notification))
+	assert.Equal(t, user.ID.Hex(), notification.UserID)
+	assert.Equal(t, NotificationNewDevice, notification.Type)
+	assert.Equal(t, "203.0.113.50", notification.IPAddress)
+	assert.Equal(t, "iOS", notification.Device.OS)
+
+	alerted := sessions[notification.SessionID]
+	require.NotEmpty(t, alerted.RevokeTokenHash)
+	assert.Contains(t, auditLog.types(), AuditNewDevice+":"+AuditResultSuccess)
+
+	// The link carries the plaintext token; only its hash is stored, so stand in for the emailed token
+	token, err := GenerateDeviceRevokeToken()
+	require.NoError(t, err)
+	alerted.RevokeTokenHash = HashDeviceRevokeToken(token)
+
+	status, _ := postJSON(t, app, "/devices/revoke-unrecognized", `{"token":"`+token+`"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.False(t, alerted.IsActive)
+	last := auditLog.events[len(auditLog.events)-1]
+	assert.Equal(t, AuditDeviceRevoked, last.Type)
+	assert.Equal(t, user.ID.Hex(), last.UserID)
+	assert.Equal(t, notification.SessionID, last.Details["revoked_session_id"])
+
+	status, _ = postJSON(t, app, "/devices/revoke-unrecognized", `{"token":"`+token+`"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
@@ -9,12 +9,98 @@ const (
 	// Authentication errors
 	ErrInvalidCredentials = "Invalid email or pin"
 	ErrInvalidToken       = "Invalid token"
+	ErrInvalidOAuthState  = "Invalid or expired OAuth state"
+	ErrTooManyAttempts    = "Too many attempts. Please try again later."
+	ErrAccountDisabled    = "This account has been disabled"
+	ErrForbidden          = "You do not have permission to perform this action"
+	ErrInvalidMagicLink   = "Invalid, expired or already used sign-in link"
+	ErrMagicLinkDevice    = "This sign-in link was requested on another device. Use the code from the email instead."
 
 	// Validation errors
 	ErrEmailRequired        = "Email is required"
 	ErrPasswordRequired     = "Pin is required"
+	ErrInvalidLoginMethod   = "Login method must be pin or magic_link"
 	ErrRefreshTokenRequired = "Refresh token is required"
 
 	// User errors
 	ErrUserNotFound = "User not found"
+
+	// Profile errors
+	ErrInvalidUsername    = "Username must be 3 to 30 lowercase letters, digits, dots, dashes or underscores"
+	ErrUsernameTaken      = "Username is already taken"
+	ErrInvalidDisplayName = "Display name must be at most 64 characters"
+	ErrInvalidLocale      = "Locale must be a language tag such as en or pt-BR"
+	ErrInvalidTimezone    = "Timezone must be an IANA time zone such as Europe/Berlin"
+	ErrAvatarRequired     = "Avatar file is required"
+	ErrAvatarTooLarge     = "Avatar file is too large"
+	ErrAvatarInvalid      = "Avatar must be a JPEG, PNG or GIF image"
+	ErrInvalidEmail       = "Email address is invalid"
+	ErrEmailUnchanged     = "New email address is the same as the current one"
+	ErrEmailTaken         = "Email address is already in use"
+	ErrInvalidEmailChange = "Invalid or expired email change link"
+
+	// MFA errors
+	ErrMFACodeRequired   = "MFA code is required"
+	ErrInvalidMFACode    = "Invalid MFA code"
+	ErrInvalidMFAToken   = "Invalid or expired MFA token"
+	ErrMFAAlreadyEnabled = "MFA is already enabled"
+	ErrMFANotEnabled     = "MFA is not enabled"
+	ErrMFASetupRequired  = "MFA setup has not been started"
+
+	// Passkey errors
+	ErrPasskeyCeremonyInvalid = "Passkey ceremony not found or expired"
+	ErrPasskeyInvalid         = "Passkey verification failed"
+	ErrPasskeyNotFound        = "Passkey not found"
+
+	// OAuth provider errors
+	ErrOAuthProviderNotFound = "OAuth provider not found"
+	ErrOAuthEmailNotVerified = "The provider did not return a verified email address"
+	ErrIdentityAlreadyLinked = "A provider account is already linked for this provider"
+	ErrIdentityNotLinked     = "No account is linked for this provider"
+
+	// Admin errors
+	ErrInvalidRoles     = "Roles must be known and include the user role"
+	ErrCannotModifySelf = "Admins cannot remove their own admin role or disable their own account"
+
+	// API key errors
+	ErrAPIKeyNameRequired  = "API key name is required"
+	ErrAPIKeyInvalidScopes = "At least one scope is required and every scope must be allowed"
+	ErrAPIKeyInvalidExpiry = "API key expiry is out of range"
+	ErrAPIKeyNotFound      = "API key not found"
+
+	// Account errors
+	ErrDeletionConfirmMismatch = "Confirmation must match the account email"
+	ErrDeletionNotScheduled    = "Account deletion is not scheduled"
+	ErrExportUnavailable       = "Data export is temporarily unavailable"
+
+	// Device errors
+	ErrDeviceNameTooLong  = "Device name must be at most 64 characters"
+	ErrInvalidRevokeToken = "Invalid or already used sign-out link"
+	ErrStepUpRequired     = "This session was started on another device. Verify with a PIN to continue."
+	ErrStepUpDisabled     = "Step-up verification is disabled"
+	ErrSessionIdle        = "Session expired after a period of inactivity. Please sign in again."
+
+	// Organization errors
+	ErrInvalidOrgName          = "Organization name is required and must be at most 64 characters"
+	ErrInvalidOrgRole          = "Role must be owner, admin or member"
+	ErrOrgNotFound             = "Organization not found"
+	ErrOrgRoleTooLow           = "Your role in this organization does not allow this"
+	ErrOrgLastOwner            = "An organization must keep at least one owner"
+	ErrOrgMemberNotFound       = "Member not found"
+	ErrAlreadyOrgMember        = "This user is already a member of the organization"
+	ErrInvitationNotFound      = "Invitation not found"
+	ErrInvalidInvitation       = "Invalid or expired invitation"
+	ErrInvitationEmailMismatch = "This invitation was sent to another email address"
+
+	// OAuth client errors
+	ErrInvalidClientName       = "Client name is required and must be at most 64 characters"
+	ErrInvalidClientType       = "Client type must be confidential or public"
+	ErrInvalidRedirectURIs     = "Between 1 and 10 redirect URIs are required, each https or http on a loopback address"
+	ErrInvalidClientScopes     = "At least one scope is required and every scope must be allowed"
+	ErrClientNotFound          = "OAuth client not found"
+	ErrInvalidRedirectURI      = "Redirect URI is not registered for this client"
+	ErrUnsupportedResponseType = "Only the code response type is supported"
+	ErrPKCERequired            = "A code challenge with the S256 method is required"
+	ErrInvalidScope            = "Requested scopes must be allowed for this client"
+	ErrAuthorizationNotFound   = "Authorization not found"
 )
@@ -1,6 +1,11 @@
 package internal
 
-import "time"
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type IUserRepository interface {
 	Create(user *User) *User
@@ -11,21 +16,158 @@ type IUserRepository interface {
 	ClearRefreshToken(userID string) error
 	SetPinWithExpiry(email string, hashedPin string) error
 	ClearPin(userID string) error
+	SetMagicLink(userID string, link *MagicLink) error
+	FindByMagicLink(tokenHash string) *User
+	ConsumeMagicLink(userID string, tokenHash string) bool
 	SetRegisteredAt(userID string) error
-	UpdateGoogleID(userID string, googleID string) error
-	FindByGoogleID(googleID string) *User
+	FindByIdentity(provider string, subject string) *User
+	LinkIdentity(userID string, identity LinkedIdentity) error
+	UnlinkIdentity(userID string, provider string) (bool, error)
 	FindByRefreshToken(token string) *User
+	SetMFASecret(userID string, secret string) error
+	EnableMFA(userID string, step int64, recoveryCodeHashes []string) error
+	DisableMFA(userID string) error
+	UpdateMFALastStep(userID string, step int64) error
+	SetRecoveryCodes(userID string, recoveryCodeHashes []string) error
+	ConsumeRecoveryCode(userID string, codeHash string) bool
+	SearchUsers(search UserSearch) ([]User, int64, error)
+	SetRoles(userID string, roles []string) error
+	GrantRoleByEmail(email string, role string) error
+	SetDisabled(userID string, disabled bool) error
+	FindByUsername(username string) *User
+	// UpdateProfile returns ErrUsernameExists when the username belongs to another user
+	UpdateProfile(userID string, update ProfileUpdate) error
+	SetAvatar(userID string, key string, url string) error
+	SetEmailChange(userID string, change *EmailChange) error
+	FindByEmailChangeToken(tokenHash string) *User
+	ChangeEmail(userID string, email string) error
+	ScheduleDeletion(userID string, at *time.Time) error
+	FindDueForDeletion(now time.Time) ([]User, error)
+	DeleteUser(userID string) error
 }
 
 type ISessionRepository interface {
 	CreateSession(userID string, ipAddress string, userAgent string) (*UserSession, error)
+	CreateClientSession(userID string, clientID string, scopes []string, ipAddress string, userAgent string) (*UserSession, error)
 	FindSessionByRefreshToken(token string) (*UserSession, error)
 	FindSessionByID(sessionID string, userID string) (*UserSession, error)
-	ValidateSession(sessionID string, userID string, deviceHash string) bool
+	RebindSession(sessionID string, ipAddress string, userAgent string) error
 	UpdateSessionActivity(sessionID string) error
 	DeactivateSession(sessionID string) error
 	GetUserSessions(userID string) ([]UserSession, error)
 	ClearExpiredSessions(userID string) error
 	ClearAllUserSessions(userID string) error
 	UpdateSessionRefreshToken(sessionID string, refreshToken string) error
+	RotateSessionRefreshToken(sessionID string, currentRefreshToken string, newRefreshToken string) (bool, error)
+	FindSessionByPreviousRefreshToken(token string) (*UserSession, error)
+	SaveOAuthState(state *OAuthState) error
+	TakeOAuthState(state string) (*OAuthState, error)
+	DeleteUserSessions(userID string) error
+	IsNewDevice(userID string, deviceHash string) (bool, error)
+	RenameSession(sessionID string, userID string, name string) (bool, error)
+	SetSessionRevokeToken(sessionID string, tokenHash string) error
+	RevokeSessionByToken(tokenHash string) (*UserSession, error)
+	FindIdleSessions(cutoff time.Time) ([]UserSession, error)
+	FindRevokedSessions(since time.Time) ([]UserSession, error)
+	SetSessionOrg(sessionID string, orgID string, role string) error
+	UpdateSessionOrgRole(userID string, orgID string, role string) error
+	ClearSessionOrg(orgID string) error
+	FindOrgSessions(orgID string, userID string) ([]UserSession, error)
+	FindClientSessions(clientID string) ([]UserSession, error)
+}
+
+type IOrganizationRepository interface {
+	CreateOrganization(org *Organization, owner *OrgMember) error
+	FindOrganization(orgID string) *Organization
+	FindOrganizations(orgIDs []string) ([]Organization, error)
+	RenameOrganization(orgID string, name string) error
+	DeleteOrganization(orgID string) error
+	FindMembership(orgID string, userID string) *OrgMember
+	FindMembershipsByUserID(userID string) ([]OrgMember, error)
+	FindMembers(orgID string) ([]OrgMember, error)
+	AddMember(member *OrgMember) error
+	SetMemberRole(orgID string, userID string, role string) error
+	RemoveMember(orgID string, userID string) error
+	CountOwners(orgID string) (int64, error)
+	CreateInvitation(invitation *OrgInvitation) error
+	FindInvitations(orgID string) ([]OrgInvitation, error)
+	FindInvitationByToken(tokenHash string) *OrgInvitation
+	DeleteInvitation(orgID string, invitationID string) (bool, error)
+}
+
+type IOAuthClientRepository interface {
+	CreateClient(client *OAuthClient) error
+	FindClient(clientID string) *OAuthClient
+	FindClientsByUserID(userID string) ([]OAuthClient, error)
+	DeleteClient(clientID string, userID string) (bool, error)
+	CreateAuthorizationCode(code *AuthorizationCode) error
+	UseAuthorizationCode(codeHash string) (*AuthorizationCode, error)
+	SetAuthorizationCodeSession(codeHash string, sessionID string) error
+}
+
+type IPasskeyRepository interface {
+	CreatePasskey(passkey *PasskeyCredential) error
+	FindPasskeysByUserID(userID string) ([]PasskeyCredential, error)
+	UpdatePasskeyUsage(credentialID []byte, signCount uint32, backupState bool) error
+	DeletePasskey(id string, userID string) (bool, error)
+	DeletePasskeysByUserID(userID string) error
+	SaveCeremony(ceremony *PasskeyCeremony) error
+	TakeCeremony(ceremonyID string, kind string) (*PasskeyCeremony, error)
+}
+
+type ISigningKeyRepository interface {
+	CreateSigningKey(key *SigningKey) error
+	FindSigningKeys(now time.Time) ([]SigningKey, error)
+	DeleteExpiredSigningKeys(now time.Time) error
+}
+
+type IAPIKeyRepository interface {
+	CreateAPIKey(key *APIKey) error
+	FindAPIKeysByUserID(userID string) ([]APIKey, error)
+	FindAPIKeyByHash(keyHash string) (*APIKey, error)
+	TouchAPIKey(id primitive.ObjectID) error
+	DeleteAPIKey(id string, userID string) (*APIKey, error)
+	DeleteAPIKeysByUserID(userID string) error
+	FindAPIKeysByOrgID(orgID string) ([]APIKey, error)
+	DeleteOrgAPIKey(id string, orgID string) (*APIKey, error)
+}
+
+// IEventPublisher publishes messages to other services; *nats.Conn satisfies it
+type IEventPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// IServiceRequester sends a request to another service and waits for its reply; *nats.Conn satisfies it
+type IServiceRequester interface {
+	Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error)
+}
+
+type IAuditRepository interface {
+	RecordEvent(event *AuditEvent) error
+	FindEvents(search AuditSearch) ([]AuditEvent, int64, error)
+}
+
+type IAccountTombstoneRepository interface {
+	SaveTombstone(tombstone *AccountTombstone) error
+	MarkServiceDeleted(userID string, service string) error
+	FindIncompleteTombstones(services []string, since time.Time) ([]AccountTombstone, error)
+}
+
+// IMailTransport delivers a rendered email
+type IMailTransport interface {
+	Send(msg *MailMessage) error
+}
+
+type IAttemptStore interface {
+	GetAttempts(key string) (*AttemptRecord, error)
+	IncrementAttempts(key string, window time.Duration) (*AttemptRecord, error)
+	LockAttempts(key string, until time.Time) error
+	ResetAttempts(key string) error
+}
+
+// IObjectStore stores binary objects such as avatars; *initx.S3 satisfies it
+type IObjectStore interface {
+	Put(name string, data []byte) error
+	Get(name string) []byte
+	Delete(name string) error
 }
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// keyPublishAhead is how long a new key is in the JWKS before it signs, so cached JWKS copies already know it
+	keyPublishAhead = time.Hour
+	// KeyRotationCheckInterval is how often instances reload keys and rotate when due
+	KeyRotationCheckInterval = 10 * time.Minute
+	// jwksMaxAge is the Cache-Control max-age of the JWKS response
+	jwksMaxAge = 5 * time.Minute
+)
+
+type loadedKey struct {
+	SigningKey
+	signer crypto.Signer
+	jwk    JWK
+}
+
+// KeyManager signs access tokens with the current key and publishes every non-expired key as a JWKS
+type KeyManager struct {
+	cfg  *Config
+	repo ISigningKeyRepository
+
+	mu   sync.RWMutex
+	keys []loadedKey
+}
+
+// NewKeyManager loads the stored keys, creating the first one if none exist
+func NewKeyManager(cfg *Config, repo ISigningKeyRepository) (*KeyManager, error) {
+	if cfg.JWTSigningAlgorithm != SigningAlgRS256 && cfg.JWTSigningAlgorithm != SigningAlgEdDSA {
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q", cfg.JWTSigningAlgorithm)
+	}
+
+	m := &KeyManager{cfg: cfg, repo: repo}
+	if err := m.Rotate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Rotate reloads the keys and creates the next one when the newest key retires within keyPublishAhead.
+// Retired keys stay published for the access token lifetime so tokens they signed remain verifiable.
+func (m *KeyManager) Rotate() error {
+	now := time.Now().UTC()
+	if err := m.repo.DeleteExpiredSigningKeys(now); err != nil {
+		return err
+	}
+
+	stored, err := m.repo.FindSigningKeys(now)
+	if err != nil {
+		return err
+	}
+
+	var newest *SigningKey
+	for i := range stored {
+		if newest == nil || stored[i].RetiresAt.After(newest.RetiresAt) {
+			newest = &stored[i]
+		}
+	}
+
+	if newest == nil || newest.RetiresAt.Before(now.Add(keyPublishAhead)) {
+		activatesAt := now
+		if newest != nil && newest.RetiresAt.After(now) {
+			activatesAt = newest.RetiresAt
+		}
+
+		lifetime := time.Duration(m.cfg.JWTKeyRotationHours) * time.Hour
+		overlap := time.Duration(m.cfg.TokenExpiryHours)*time.Hour + keyPublishAhead
+		key, err := NewSigningKey(m.cfg.JWTSigningAlgorithm, activatesAt, lifetime, overlap)
+		if err != nil {
+			return err
+		}
+		if err := m.repo.CreateSigningKey(key); err != nil {
+			return err
+		}
+		log.Infof("Rotate: Created %s signing key %s active from %s", key.Algorithm, key.KID, key.ActivatesAt.Format(time.RFC3339))
+		stored = append(stored, *key)
+	}
+
+	loaded := make([]loadedKey, 0, len(stored))
+	for _, key := range stored {
+		signer, err := key.Signer()
+		if err != nil {
+			log.Errorf("Rotate: Skipping unreadable signing key %s: %v", key.KID, err)
+			continue
+		}
+		jwk, err := PublicJWK(key.KID, key.Algorithm, signer.Public())
+		if err != nil {
+			log.Errorf("Rotate: Skipping signing key %s: %v", key.KID, err)
+			continue
+		}
+		loaded = append(loaded, loadedKey{SigningKey: key, signer: signer, jwk: jwk})
+	}
+
+	m.mu.Lock()
+	m.keys = loaded
+	m.mu.Unlock()
+	return nil
+}
+
+// current returns the most recently activated key that may sign at now
+func (m *KeyManager) current(now time.Time) *loadedKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var current *loadedKey
+	for i := range m.keys {
+		k := &m.keys[i]
+		if k.ActivatesAt.After(now) || !k.RetiresAt.After(now) {
+			continue
+		}
+		if current == nil || k.ActivatesAt.After(current.ActivatesAt) {
+			current = k
+		}
+	}
+	return current
+}
+
+// Sign signs the claims with the current key and sets its kid header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	now := time.Now().UTC()
+	key := m.current(now)
+	if key == nil {
+		// The scheduled rotation has not caught up, e.g. after a long pause
+		if err := m.Rotate(); err != nil {
+			return "", err
+		}
+		if key = m.current(now); key == nil {
+			return "", errors.New("no active signing key")
+		}
+	}
+
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.signer)
+}
+
+// Keyfunc resolves the public key for a token signed by this service
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.keys {
+		if k.KID == kid {
+			if token.Method.Alg() != k.Algorithm {
+				return nil, fmt.Errorf("algorithm %s does not match key %s", token.Method.Alg(), kid)
+			}
+			return k.signer.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKS serves the public keys verifiers use to check access tokens
+func (m *KeyManager) JWKS(c *fiber.Ctx) error {
+	m.mu.RLock()
+	keys := make([]JWK, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, k.jwk)
+	}
+	m.mu.RUnlock()
+
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"keys": keys})
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockSigningKeyRepository keeps signing keys in memory
+type MockSigningKeyRepository struct {
+	Keys []SigningKey
+}
+
+func (m *MockSigningKeyRepository) CreateSigningKey(key *SigningKey) error {
+	m.Keys = append(m.Keys, *key)
+	return nil
+}
+
+func (m *MockSigningKeyRepository) FindSigningKeys(now time.Time) ([]SigningKey, error) {
+	keys := []SigningKey{}
+	for _, k := range m.Keys {
+		if k.ExpiresAt.After(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MockSigningKeyRepository) DeleteExpiredSigningKeys(now time.Time) error {
+	keys, _ := m.FindSigningKeys(now)
+	m.Keys = keys
+	return nil
+}
+
+func newMockKeyManager() *KeyManager {
+	keys, err := NewKeyManager(newMockConfig(), &MockSigningKeyRepository{})
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+func fetchJWKS(t *testing.T, keys *KeyManager) []JWK {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/.well-known/jwks.json", keys.JWKS)
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/.well-known/jwks.json", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get(fiber.HeaderCacheControl), "max-age=")
+
+	var body struct {
+		Keys []JWK `json:"keys"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return body.Keys
+}
+
+func TestKeyManager_SignsWithKidVerifiableFromJWKS(t *testing.T) {
+	for _, alg := range []string{SigningAlgRS256, SigningAlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			cfg := newMockConfig()
+			cfg.JWTSigningAlgorithm = alg
+			keys, err := NewKeyManager(cfg, &MockSigningKeyRepository{})
+			require.NoError(t, err)
+
+			signed, err := keys.Sign(jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(time.Hour).Unix()})
+			require.NoError(t, err)
+
+			token, err := jwt.Parse(signed, keys.Keyfunc, jwt.WithValidMethods([]string{alg}))
+			require.NoError(t, err)
+			assert.True(t, token.Valid)
+
+			jwks := fetchJWKS(t, keys)
+			require.Len(t, jwks, 1)
+			assert.Equal(t, token.Header["kid"], jwks[0].KID)
+			assert.Equal(t, alg, jwks[0].Alg)
+			assert.Equal(t, "sig", jwks[0].Use)
+		})
+	}
+}
+
+func TestKeyManager_JWKSVerifiesEdDSAToken(t *testing.T) {
+	keys := newMockKeyManager()
+	signed, err := keys.Sign(jwt.MapClaims{"user_id": "u1"})
+	require.NoError(t, err)
+
+	jwks := fetchJWKS(t, keys)
+	require.Len(t, jwks, 1)
+	x, err := base64.RawURLEncoding.DecodeString(jwks[0].X)
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+		return ed25519.PublicKey(x), nil
+	}, jwt.WithValidMethods([]string{SigningAlgEdDSA}))
+	assert.NoError(t, err)
+}
+
+func TestKeyManager_RotationPublishesAheadAndKeepsRetiredKeys(t *testing.T) {
+	cfg := newMockConfig()
+	repo := &MockSigningKeyRepository{}
+	keys, err := NewKeyManager(cfg, repo)
+	require.NoError(t, err)
+	require.Len(t, repo.Keys, 1)
+
+	first := repo.Keys[0]
+	oldToken, err := keys.Sign(jwt.MapClaims{"user_id": "u1"})
+	require.NoError(t, err)
+
+	// Nothing to do while the current key is far from retiring
+	require.NoError(t, keys.Rotate())
+	assert.Len(t, repo.Keys, 1)
+
+	// Close to retirement the next key is published but does not sign yet
+	now := time.Now().UTC()
+	repo.Keys[0].RetiresAt = now.Add(30 * time.Minute)
+	require.NoError(t, keys.Rotate())
+	require.Len(t, repo.Keys, 2)
+	next := repo.Keys[1]
+	assert.Equal(t, repo.Keys[0].RetiresAt, next.ActivatesAt)
+	assert.Len(t, fetchJWKS(t, keys), 2)
+
+	signed, err := keys.Sign(jwt.MapClaims{"user_id": "u1"})
+	require.NoError(t, err)
+	token, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, first.KID, token.Header["kid"])
+
+	// Once the first key retires the next key signs, and old tokens still verify
+	repo.Keys[0].RetiresAt = now.Add(-time.Minute)
+	repo.Keys[1].ActivatesAt = now.Add(-time.Minute)
+	require.NoError(t, keys.Rotate())
+
+	signed, err = keys.Sign(jwt.MapClaims{"user_id": "u1"})
+	require.NoError(t, err)
+	token, _, err = jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, next.KID, token.Header["kid"])
+
+	_, err = jwt.Parse(oldToken, keys.Keyfunc)
+	assert.NoError(t, err)
+
+	// After the overlap the retired key is dropped
+	repo.Keys[0].ExpiresAt = now.Add(-time.Second)
+	require.NoError(t, keys.Rotate())
+	assert.Len(t, fetchJWKS(t, keys), 1)
+	_, err = jwt.Parse(oldToken, keys.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestKeyManager_RejectsAlgorithmMismatch(t *testing.T) {
+	keys := newMockKeyManager()
+	signed, err := keys.Sign(jwt.MapClaims{"user_id": "u1"})
+	require.NoError(t, err)
+	token, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(t, err)
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": "attacker"})
+	forged.Header["kid"] = token.Header["kid"]
+	forgedString, err := forged.SignedString([]byte("guess"))
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(forgedString, keys.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestNewKeyManager_RejectsUnknownAlgorithm(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.JWTSigningAlgorithm = "HS256"
+	_, err := NewKeyManager(cfg, &MockSigningKeyRepository{})
+	assert.Error(t, err)
+}
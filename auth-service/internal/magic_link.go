@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Sign-in methods selectable on /send-pin
+const (
+	LoginMethodPin       = "pin"
+	LoginMethodMagicLink = "magic_link"
+)
+
+const magicLinkPurpose = "magic_link"
+
+// MagicLink is a pending emailed sign-in link. Only the hash of its ID is stored, together with
+// the device that asked for it; the link only signs in from that device.
+type MagicLink struct {
+	TokenHash   string    `bson:"token_hash"`
+	Fingerprint string    `bson:"fingerprint"`
+	IPAddress   string    `bson:"ip_address"`
+	UserAgent   string    `bson:"user_agent"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// magicLinkClaims is what a verified magic link token carries
+type magicLinkClaims struct {
+	UserID      string
+	LinkID      string
+	Fingerprint string
+}
+
+// HashMagicLinkID returns the SHA256 hex digest under which a magic link is stored
+func HashMagicLinkID(linkID string) string {
+	sum := sha256.Sum256([]byte(linkID))
+	return hex.EncodeToString(sum[:])
+}
+
+// magicLinkKey derives a signing key distinct from the MFA token key,
+// so neither token can pass as the other
+func (h *UserHandler) magicLinkKey() []byte {
+	return []byte(magicLinkPurpose + ":" + h.cfg.JWTSecret)
+}
+
+func (h *UserHandler) magicLinkTTL() time.Duration {
+	return time.Duration(h.cfg.MagicLinkExpiryMinutes) * time.Minute
+}
+
+// newMagicLink creates a link bound to the requesting device and returns it with its signed token
+func (h *UserHandler) newMagicLink(userID string, ipAddress string, userAgent string) (*MagicLink, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	linkID := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now().UTC()
+	link := &MagicLink{
+		TokenHash:   HashMagicLinkID(linkID),
+		Fingerprint: GenerateDeviceHash(ipAddress, userAgent),
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		ExpiresAt:   now.Add(h.magicLinkTTL()),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"purpose": magicLinkPurpose,
+		"jti":     linkID,
+		"fp":      link.Fingerprint,
+		"iat":     now.Unix(),
+		"exp":     link.ExpiresAt.Unix(),
+	})
+	signed, err := token.SignedString(h.magicLinkKey())
+	if err != nil {
+		return nil, "", err
+	}
+	return link, signed, nil
+}
+
+// parseMagicLink verifies the signature and expiry of a magic link token
+func (h *UserHandler) parseMagicLink(tokenString string) (*magicLinkClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return h.magicLinkKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	if purpose, _ := claims["purpose"].(string); purpose != magicLinkPurpose {
+		return nil, errors.New("unexpected token purpose")
+	}
+	parsed := &magicLinkClaims{}
+	parsed.UserID, _ = claims["user_id"].(string)
+	parsed.LinkID, _ = claims["jti"].(string)
+	parsed.Fingerprint, _ = claims["fp"].(string)
+	if parsed.UserID == "" || parsed.LinkID == "" || parsed.Fingerprint == "" {
+		return nil, errors.New("missing magic link claims")
+	}
+	return parsed, nil
+}
+
+// magicLinkURL is the web page behind an emailed sign-in link
+func (h *UserHandler) magicLinkURL(token string) string {
+	return h.cfg.WebUrl + "/login/magic?token=" + url.QueryEscape(token)
+}
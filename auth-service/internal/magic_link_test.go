@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryMagicLinkUsers adds the magic link bookkeeping of UserRepository to memoryPinUsers
+func memoryMagicLinkUsers(user *User) *MockUserRepository {
+	repo := memoryPinUsers(user)
+	clearPin := repo.ClearPinFunc
+	repo.ClearPinFunc = func(userID string) error {
+		user.MagicLink = nil
+		return clearPin(userID)
+	}
+	repo.SetMagicLinkFunc = func(userID string, link *MagicLink) error {
+		user.MagicLink = link
+		return nil
+	}
+	repo.FindByMagicLinkFunc = func(tokenHash string) *User {
+		if user.MagicLink == nil || user.MagicLink.TokenHash != tokenHash {
+			return nil
+		}
+		copied := *user
+		return &copied
+	}
+	repo.ConsumeMagicLinkFunc = func(userID string, tokenHash string) bool {
+		if user.MagicLink == nil || user.MagicLink.TokenHash != tokenHash {
+			return false
+		}
+		user.MagicLink, user.PinHash, user.PinExpires = nil, nil, nil
+		return true
+	}
+	return repo
+}
+
+func newMagicLinkTestApp(userRepo *MockUserRepository, auditLog *memoryAuditLog) (*fiber.App, *UserHandler) {
+	handler := NewUserHandler(newMockConfig(), userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userIP", strings.Clone(c.Get("X-Test-IP")))
+		c.Locals("userAgent", strings.Clone(c.Get(fiber.HeaderUserAgent)))
+		return c.Next()
+	})
+	app.Post("/login", handler.Login)
+	app.Post("/login/magic-link", handler.LoginMagicLink)
+	app.Post("/send-pin", handler.SendPin)
+	return app, handler
+}
+
+func postFromDevice(t *testing.T, app *fiber.App, path string, body string, ip string, userAgent string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-IP", ip)
+	req.Header.Set(fiber.HeaderUserAgent, userAgent)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]interface{}
+	_ = json.Unmarshal(raw, &out)
+	return resp.StatusCode, out
+}
+
+func TestSendPin_MagicLinkBindsRequestingDevice(t *testing.T) {
+	user := NewUser("user@example.com")
+	auditLog := &memoryAuditLog{}
+	app, _ := newMagicLinkTestApp(memoryMagicLinkUsers(user), auditLog)
+
+	status, _ := postFromDevice(t, app, "/send-pin", `{"email":"user@example.com","method":"magic_link"}`, "198.51.100.1", uaChromeWindows)
+	require.Equal(t, fiber.StatusOK, status)
+	require.NotNil(t, user.MagicLink)
+	assert.NotNil(t, user.PinHash, "the PIN is the fallback code")
+	assert.Equal(t, GenerateDeviceHash("198.51.100.1", uaChromeWindows), user.MagicLink.Fingerprint)
+	assert.Equal(t, LoginMethodMagicLink, auditLog.events[len(auditLog.events)-1].Details["method"])
+
+	status, body := postFromDevice(t, app, "/send-pin", `{"email":"other@example.com","method":"sms"}`, "198.51.100.1", uaChromeWindows)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, ErrInvalidLoginMethod, body["message"])
+}
+
+func TestLoginMagicLink(t *testing.T) {
+	user := userWithPin(t, "123456")
+	auditLog := &memoryAuditLog{}
+	app, handler := newMagicLinkTestApp(memoryMagicLinkUsers(user), auditLog)
+
+	// The emailed token is only known to the mail, so issue one the way SendPin does
+	link, token, err := handler.newMagicLink(user.ID.Hex(), "198.51.100.1", uaChromeWindows)
+	require.NoError(t, err)
+	user.MagicLink = link
+
+	status, _ := postFromDevice(t, app, "/login/magic-link", `{"token":"`+token+`x"}`, "198.51.100.1", uaChromeWindows)
+	assert.Equal(t, fiber.StatusBadRequest, status, "a tampered signature is rejected")
+
+	status, body := postFromDevice(t, app, "/login/magic-link", `{"token":"`+token+`"}`, "203.0.113.9", uaSafariIPhone)
+	require.Equal(t, fiber.StatusForbidden, status)
+	assert.Equal(t, true, body["data"].(map[string]interface{})["use_code"])
+	require.NotNil(t, user.MagicLink, "opening the link elsewhere does not use it up")
+	assert.Contains(t, auditLog.types(), AuditLoginFailure+":"+AuditResultDeviceMismatch)
+
+	status, body = postFromDevice(t, app, "/login/magic-link", `{"token":"`+token+`"}`, "198.51.100.1", uaChromeWindows)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.NotEmpty(t, body["data"].(map[string]interface{})["access_token"])
+	assert.Nil(t, user.MagicLink)
+	assert.Nil(t, user.PinHash, "the fallback code is used up with the link")
+	last := auditLog.events[len(auditLog.events)-1]
+	assert.Equal(t, AuditLoginSuccess, last.Type)
+	assert.Equal(t, LoginMethodMagicLink, last.Details["method"])
+
+	status, _ = postFromDevice(t, app, "/login/magic-link", `{"token":"`+token+`"}`, "198.51.100.1", uaChromeWindows)
+	assert.Equal(t, fiber.StatusBadRequest, status, "a link signs in once")
+}
+
+func TestLogin_FallbackCodeUsesUpMagicLink(t *testing.T) {
+	user := userWithPin(t, "123456")
+	app, handler := newMagicLinkTestApp(memoryMagicLinkUsers(user), &memoryAuditLog{})
+	link, token, err := handler.newMagicLink(user.ID.Hex(), "198.51.100.1", uaChromeWindows)
+	require.NoError(t, err)
+	user.MagicLink = link
+
+	status, _ := postFromDevice(t, app, "/login", `{"email":"user@example.com","pin":"123456"}`, "203.0.113.9", uaSafariIPhone)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Nil(t, user.MagicLink)
+
+	status, _ = postFromDevice(t, app, "/login/magic-link", `{"token":"`+token+`"}`, "198.51.100.1", uaChromeWindows)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
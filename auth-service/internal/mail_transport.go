@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mail transports, selected with MAIL_TRANSPORT
+const (
+	MailTransportSMTP   = "smtp"
+	MailTransportOutbox = "outbox"
+	MailTransportMemory = "memory"
+)
+
+// MailMessage is a rendered email ready for delivery
+type MailMessage struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// NewMailTransport returns the transport configured for the environment
+func NewMailTransport(cfg *Config) (IMailTransport, error) {
+	switch cfg.MailTransport {
+	case MailTransportSMTP, "":
+		return &SMTPTransport{
+			host:     cfg.SMTPHost,
+			port:     cfg.SMTPPort,
+			username: cfg.SMTPUsername,
+			password: cfg.SMTPPassword,
+			from:     cfg.EmailFrom,
+		}, nil
+	case MailTransportOutbox:
+		return NewOutboxTransport(cfg.MailOutboxDir, cfg.EmailFrom)
+	case MailTransportMemory:
+		return &MemoryTransport{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.MailTransport)
+	}
+}
+
+// SMTPTransport delivers mail through an SMTP relay, authenticating when a username is set
+type SMTPTransport struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func (t *SMTPTransport) Send(msg *MailMessage) error {
+	data, err := encodeMail(t.from, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if t.username != "" {
+		auth = smtp.PlainAuth("", t.username, t.password, t.host)
+	}
+	return smtp.SendMail(net.JoinHostPort(t.host, t.port), auth, envelopeAddress(t.from), []string{msg.To}, data)
+}
+
+// OutboxTransport writes every message as an .eml file into a maildir, for development
+type OutboxTransport struct {
+	dir  string
+	from string
+}
+
+// NewOutboxTransport creates the maildir at dir if needed
+func NewOutboxTransport(dir string, from string) (*OutboxTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &OutboxTransport{dir: dir, from: from}, nil
+}
+
+// Send writes the message to tmp and moves it to new, so readers never see a partial file
+func (t *OutboxTransport) Send(msg *MailMessage) error {
+	data, err := encodeMail(t.from, msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.%s.auth-service.eml", time.Now().UnixNano(), randomHex(8))
+	tmp := filepath.Join(t.dir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.dir, "new", name))
+}
+
+// MemoryTransport keeps sent messages in memory, for tests
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+func (t *MemoryTransport) Send(msg *MailMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, *msg)
+	return nil
+}
+
+// Messages returns the messages sent so far
+func (t *MemoryTransport) Messages() []MailMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]MailMessage(nil), t.messages...)
+}
+
+// encodeMail builds a multipart/alternative message with a plain text and an HTML part
+func encodeMail(from string, msg *MailMessage) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "From: %s\r\n", from)
+	fmt.Fprintf(&out, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&out, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&out, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	fmt.Fprintf(&out, "Message-ID: <%s@%s>\r\n", randomHex(16), mailDomain(from))
+	out.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&out, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// envelopeAddress returns the bare address of a From header such as "Instrlabs <no-reply@instrlabs.com>"
+func envelopeAddress(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+func mailDomain(from string) string {
+	address := envelopeAddress(from)
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
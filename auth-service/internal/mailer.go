@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Email message types. Each has a <type>.txt (subject and text body) and a <type>.html template
+// per locale under templates/email.
+const (
+	MailPin                = "pin"
+	MailMagicLink          = "magic_link"
+	MailNewDevice          = "new_device"
+	MailSessionRevoked     = "session_revoked"
+	MailEmailChangeApprove = "email_change_approve"
+	MailEmailChangeConfirm = "email_change_confirm"
+	MailEmailChanged       = "email_changed"
+	MailAccountDeletion    = "account_deletion"
+	MailOrgInvitation      = "org_invitation"
+)
+
+var mailTypes = []string{
+	MailPin, MailMagicLink, MailNewDevice, MailSessionRevoked,
+	MailEmailChangeApprove, MailEmailChangeConfirm, MailEmailChanged, MailAccountDeletion,
+	MailOrgInvitation,
+}
+
+// mailFallbackLocale has a template for every message type
+const mailFallbackLocale = "en"
+
+var ErrMailQueueFull = errors.New("mail queue is full")
+
+//go:embed templates/email
+var mailTemplateFS embed.FS
+
+// Template data of each message type
+type (
+	PinMail struct {
+		Pin            string
+		ExpiresMinutes int
+	}
+	MagicLinkMail struct {
+		URL               string
+		Pin               string
+		ExpiresMinutes    int
+		PinExpiresMinutes int
+	}
+	NewDeviceMail struct {
+		Device    string
+		IPAddress string
+		Time      time.Time
+		RevokeURL string
+	}
+	SessionRevokedMail struct {
+		StartedAt time.Time
+		IPAddress string
+	}
+	EmailChangeApproveMail struct {
+		NewEmail string
+		URL      string
+	}
+	EmailChangeConfirmMail struct {
+		URL string
+	}
+	EmailChangedMail struct {
+		NewEmail string
+	}
+	AccountDeletionMail struct {
+		ScheduledAt time.Time
+	}
+	OrgInvitationMail struct {
+		OrgName     string
+		InvitedBy   string
+		Role        string
+		URL         string
+		ExpiresDays int
+	}
+)
+
+type mailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type mailJob struct {
+	msg     *MailMessage
+	kind    string
+	attempt int
+}
+
+// Mailer renders localized emails and delivers them from a queue, so a slow or failing mail
+// server never fails the request that sent the email. Failed deliveries are retried with
+// exponential backoff, up to MAIL_MAX_ATTEMPTS.
+type Mailer struct {
+	cfg       *Config
+	transport IMailTransport
+	templates map[string]map[string]*mailTemplate
+	queue     chan mailJob
+}
+
+// NewMailer loads the embedded templates. Every message type must have an English template.
+func NewMailer(cfg *Config, transport IMailTransport) (*Mailer, error) {
+	templates, err := loadMailTemplates(mailTemplateFS, "templates/email")
+	if err != nil {
+		return nil, err
+	}
+	for _, kind := range mailTypes {
+		if templates[mailFallbackLocale][kind] == nil {
+			return nil, fmt.Errorf("missing %s template %s", mailFallbackLocale, kind)
+		}
+	}
+
+	size := cfg.MailQueueSize
+	if size < 1 {
+		size = 1
+	}
+	return &Mailer{
+		cfg:       cfg,
+		transport: transport,
+		templates: templates,
+		queue:     make(chan mailJob, size),
+	}, nil
+}
+
+func loadMailTemplates(fsys fs.FS, root string) (map[string]map[string]*mailTemplate, error) {
+	layout, err := htmltemplate.ParseFS(fsys, root+"/layout.html")
+	if err != nil {
+		return nil, err
+	}
+
+	locales, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	templates := map[string]map[string]*mailTemplate{}
+	for _, locale := range locales {
+		if !locale.IsDir() {
+			continue
+		}
+		dir := root + "/" + locale.Name()
+		byKind := map[string]*mailTemplate{}
+		for _, kind := range mailTypes {
+			text, err := texttemplate.ParseFS(fsys, dir+"/"+kind+".txt")
+			if err != nil {
+				continue
+			}
+			html, err := htmltemplate.Must(layout.Clone()).ParseFS(fsys, dir+"/"+kind+".html")
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s.html: %w", dir, kind, err)
+			}
+			byKind[kind] = &mailTemplate{text: text, html: html}
+		}
+		templates[strings.ToLower(locale.Name())] = byKind
+	}
+	return templates, nil
+}
+
+// template picks the template of a message type for a locale such as "pt-BR": the exact locale,
+// then its language, then the configured default and English
+func (m *Mailer) template(locale string, kind string) *mailTemplate {
+	locale = strings.ToLower(locale)
+	language, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range []string{locale, language, strings.ToLower(m.cfg.MailDefaultLocale), mailFallbackLocale} {
+		if t := m.templates[candidate][kind]; t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// Render builds the message of a type in the recipient's locale
+func (m *Mailer) Render(to string, locale string, kind string, data interface{}) (*MailMessage, error) {
+	t := m.template(locale, kind)
+	if t == nil {
+		return nil, fmt.Errorf("unknown mail type %q", kind)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := t.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return nil, err
+	}
+	if err := t.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, err
+	}
+	return &MailMessage{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+// Send renders a message and queues it for delivery. It only fails if the message cannot be
+// rendered or the queue is full; delivery errors are retried and logged.
+func (m *Mailer) Send(to string, locale string, kind string, data interface{}) error {
+	msg, err := m.Render(to, locale, kind, data)
+	if err != nil {
+		log.Errorf("Mailer: Failed to render %s email: %v", kind, err)
+		return err
+	}
+	if !m.enqueue(mailJob{msg: msg, kind: kind, attempt: 1}) {
+		log.Errorf("Mailer: Queue full, dropping %s email", kind)
+		return ErrMailQueueFull
+	}
+	return nil
+}
+
+func (m *Mailer) enqueue(job mailJob) bool {
+	select {
+	case m.queue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run delivers queued messages until the process exits
+func (m *Mailer) Run() {
+	for job := range m.queue {
+		m.deliver(job)
+	}
+}
+
+func (m *Mailer) deliver(job mailJob) {
+	err := m.transport.Send(job.msg)
+	if err == nil {
+		return
+	}
+	if job.attempt >= m.cfg.MailMaxAttempts {
+		log.Errorf("Mailer: Giving up on %s email after %d attempts: %v", job.kind, job.attempt, err)
+		return
+	}
+
+	backoff := m.retryBackoff(job.attempt)
+	log.Warnf("Mailer: Failed to send %s email (attempt %d), retrying in %s: %v", job.kind, job.attempt, backoff, err)
+	job.attempt++
+	time.AfterFunc(backoff, func() {
+		if !m.enqueue(job) {
+			log.Errorf("Mailer: Queue full, dropping retry of %s email", job.kind)
+		}
+	})
+}
+
+// retryBackoff doubles the wait after each failed attempt
+func (m *Mailer) retryBackoff(attempt int) time.Duration {
+	return time.Duration(m.cfg.MailRetryBaseSeconds) * time.Second << (attempt - 1)
+}
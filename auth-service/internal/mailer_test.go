@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyTransport fails the first sends, then delivers to a MemoryTransport
+type flakyTransport struct {
+	MemoryTransport
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (t *flakyTransport) Send(msg *MailMessage) error {
+	t.mu.Lock()
+	t.attempts++
+	fail := t.attempts <= t.failures
+	t.mu.Unlock()
+	if fail {
+		return errors.New("421 service not available")
+	}
+	return t.MemoryTransport.Send(msg)
+}
+
+func (t *flakyTransport) Attempts() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.attempts
+}
+
+func TestMailer_RenderLocale(t *testing.T) {
+	mailer, err := NewMailer(newMockConfig(), &MemoryTransport{})
+	require.NoError(t, err)
+	data := PinMail{Pin: "123456", ExpiresMinutes: PinExpiryMinutes}
+
+	msg, err := mailer.Render("user@example.com", "", MailPin, data)
+	require.NoError(t, err)
+	assert.Equal(t, "Your login PIN", msg.Subject)
+	assert.Contains(t, msg.Text, "123456")
+	assert.Contains(t, msg.HTML, "<!DOCTYPE html>")
+	assert.Contains(t, msg.HTML, "123456")
+
+	msg, err = mailer.Render("user@example.com", "pt-BR", MailPin, data)
+	require.NoError(t, err)
+	assert.Equal(t, "Seu PIN de acesso", msg.Subject, "a regional locale falls back to its language")
+
+	msg, err = mailer.Render("user@example.com", "ja", MailPin, data)
+	require.NoError(t, err)
+	assert.Equal(t, "Your login PIN", msg.Subject, "an unknown locale falls back to the default")
+
+	_, err = mailer.Render("user@example.com", "en", "unknown", data)
+	assert.Error(t, err)
+}
+
+func TestMailer_RenderEscapesHTML(t *testing.T) {
+	mailer, err := NewMailer(newMockConfig(), &MemoryTransport{})
+	require.NoError(t, err)
+
+	msg, err := mailer.Render("user@example.com", "en", MailEmailChanged, EmailChangedMail{NewEmail: "<script>x</script>@example.com"})
+	require.NoError(t, err)
+	assert.NotContains(t, msg.HTML, "<script>")
+	assert.Contains(t, msg.Text, "<script>x</script>@example.com")
+}
+
+func TestMailer_RetriesTransientFailures(t *testing.T) {
+	transport := &flakyTransport{failures: 2}
+	mailer, err := NewMailer(newMockConfig(), transport)
+	require.NoError(t, err)
+	go mailer.Run()
+
+	require.NoError(t, mailer.Send("user@example.com", "en", MailPin, PinMail{Pin: "123456", ExpiresMinutes: PinExpiryMinutes}))
+	require.Eventually(t, func() bool { return len(transport.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3, transport.Attempts())
+}
+
+func TestMailer_GivesUpAfterMaxAttempts(t *testing.T) {
+	transport := &flakyTransport{failures: 10}
+	mailer, err := NewMailer(newMockConfig(), transport)
+	require.NoError(t, err)
+	go mailer.Run()
+
+	require.NoError(t, mailer.Send("user@example.com", "en", MailPin, PinMail{Pin: "123456", ExpiresMinutes: PinExpiryMinutes}))
+	require.Eventually(t, func() bool { return transport.Attempts() == 3 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 3, transport.Attempts())
+	assert.Empty(t, transport.Messages())
+}
+
+func TestMailer_RetryBackoff(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.MailRetryBaseSeconds = 5
+	mailer := &Mailer{cfg: cfg}
+
+	assert.Equal(t, 5*time.Second, mailer.retryBackoff(1))
+	assert.Equal(t, 10*time.Second, mailer.retryBackoff(2))
+	assert.Equal(t, 40*time.Second, mailer.retryBackoff(4))
+}
+
+func TestOutboxTransport(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewOutboxTransport(dir, "Instrlabs <no-reply@instrlabs.com>")
+	require.NoError(t, err)
+
+	require.NoError(t, transport.Send(&MailMessage{To: "user@example.com", Subject: "Olá", Text: "PIN 123456\n", HTML: "<p>PIN 123456</p>"}))
+
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0].Name(), ".eml"))
+
+	raw, err := os.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	require.NoError(t, err)
+	eml := string(raw)
+	assert.Contains(t, eml, "To: user@example.com\r\n")
+	assert.Contains(t, eml, "Subject: =?utf-8?q?Ol=C3=A1?=\r\n")
+	assert.Contains(t, eml, "Message-ID: <")
+	assert.Contains(t, eml, "@instrlabs.com>")
+	assert.Contains(t, eml, "multipart/alternative")
+	assert.Contains(t, eml, "text/plain; charset=utf-8")
+	assert.Contains(t, eml, "text/html; charset=utf-8")
+
+	tmp, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmp)
+}
+
+func TestNewMailTransport(t *testing.T) {
+	cfg := newMockConfig()
+	transport, err := NewMailTransport(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryTransport{}, transport)
+
+	cfg.MailTransport = MailTransportSMTP
+	transport, err = NewMailTransport(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &SMTPTransport{}, transport)
+
+	cfg.MailTransport = "pigeon"
+	_, err = NewMailTransport(cfg)
+	assert.Error(t, err)
+}
+
+func TestSendPin_SucceedsWhenMailServerIsDown(t *testing.T) {
+	cfg := newMockConfig()
+	transport := &flakyTransport{failures: 1}
+	mailer, err := NewMailer(cfg, transport)
+	require.NoError(t, err)
+	go mailer.Run()
+
+	user := NewUser("user@example.com")
+	user.Locale = "pt-BR"
+	handler := NewUserHandler(cfg, memoryPinUsers(user), &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, mailer)
+	app := fiber.New()
+	app.Post("/send-pin", handler.SendPin)
+
+	status, _ := postJSON(t, app, "/send-pin", `{"email":"user@example.com"}`)
+	assert.Equal(t, fiber.StatusOK, status)
+
+	require.Eventually(t, func() bool { return len(transport.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+	msg := transport.Messages()[0]
+	assert.Equal(t, "user@example.com", msg.To)
+	assert.Equal(t, "Seu PIN de acesso", msg.Subject)
+}
@@ -0,0 +1,501 @@
+package internal
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mfaPendingPurpose = "mfa_pending"
+	// mfaTokenCookie hands the mfa_pending token of a social login to the frontend, keeping it out of the redirect URL
+	mfaTokenCookie = "mfa_token"
+)
+
+type mfaCodeInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// mfaTokenKey derives a signing key distinct from the access token key,
+// so an mfa_pending token can never pass as an access token
+func (h *UserHandler) mfaTokenKey() []byte {
+	return []byte(mfaPendingPurpose + ":" + h.cfg.JWTSecret)
+}
+
+func (h *UserHandler) mfaTokenLifetime() time.Duration {
+	return time.Duration(h.cfg.MFATokenExpiryMins) * time.Minute
+}
+
+// generateMFAToken issues a short-lived token proving the first login factor succeeded.
+// Its jti lets VerifyMFA accept it once.
+func (h *UserHandler) generateMFAToken(userID string) (string, error) {
+	now := time.Now().UTC()
+	expirationTime := now.Add(h.mfaTokenLifetime())
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"purpose": mfaPendingPurpose,
+		"jti":     GenerateSessionID(),
+		"iat":     now.Unix(),
+		"exp":     expirationTime.Unix(),
+	})
+	return token.SignedString(h.mfaTokenKey())
+}
+
+// parseMFAToken validates an mfa_pending token and returns its user ID and token ID
+func (h *UserHandler) parseMFAToken(tokenString string) (string, string, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return h.mfaTokenKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", "", err
+	}
+
+	if purpose, _ := claims["purpose"].(string); purpose != mfaPendingPurpose {
+		return "", "", errors.New("unexpected token purpose")
+	}
+	userID, _ := claims["user_id"].(string)
+	if userID == "" {
+		return "", "", errors.New("missing user_id claim")
+	}
+	tokenID, _ := claims["jti"].(string)
+	if tokenID == "" {
+		return "", "", errors.New("missing jti claim")
+	}
+	return userID, tokenID, nil
+}
+
+// setMFACookie stores an mfa_pending token in a short-lived HttpOnly cookie for /mfa/verify to read
+func (h *UserHandler) setMFACookie(c *fiber.Ctx, mfaToken string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     mfaTokenCookie,
+		Value:    mfaToken,
+		Path:     "/",
+		Expires:  time.Now().UTC().Add(h.mfaTokenLifetime()),
+		HTTPOnly: true,
+		Secure:   h.cfg.Environment != "development" && h.cfg.Environment != "test",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// respondMFARequired answers a successful first factor with an mfa_pending token instead of session tokens
+func (h *UserHandler) respondMFARequired(c *fiber.Ctx, userID string) error {
+	mfaToken, err := h.generateMFAToken(userID)
+	if err != nil {
+		log.Errorf("respondMFARequired: Failed to generate MFA token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("respondMFARequired: MFA verification required for user %s", userID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "MFA verification required",
+		"errors":  nil,
+		"data": fiber.Map{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   h.cfg.MFATokenExpiryMins * 60,
+		},
+	})
+}
+
+// checkMFA verifies a TOTP code or, when allowed, a single-use recovery code for a user with MFA configured
+func (h *UserHandler) checkMFA(user *User, input mfaCodeInput, allowRecovery bool) bool {
+	if user.MFASecret == nil || *user.MFASecret == "" {
+		return false
+	}
+
+	if input.Code != "" {
+		step, ok := ValidateTOTP(*user.MFASecret, input.Code, time.Now().UTC(), user.MFALastStep)
+		if !ok {
+			return false
+		}
+		if err := h.userRepo.UpdateMFALastStep(user.ID.Hex(), step); err != nil {
+			log.Warnf("checkMFA: Rejected TOTP code for user %s: %v", user.ID.Hex(), err)
+			return false
+		}
+		return true
+	}
+
+	if allowRecovery && input.RecoveryCode != "" && user.HasRecoveryCode(input.RecoveryCode) {
+		return h.userRepo.ConsumeRecoveryCode(user.ID.Hex(), HashRecoveryCode(input.RecoveryCode))
+	}
+
+	return false
+}
+
+// VerifyMFA completes a login that returned an mfa_pending token, taken from the body or, after a social
+// login, the mfa_token cookie. Failed codes count against the user and the IP, and a token signs in once.
+func (h *UserHandler) VerifyMFA(c *fiber.Ctx) error {
+	log.Info("VerifyMFA: Processing MFA verification request")
+
+	var input struct {
+		MFAToken string `json:"mfa_token"`
+		mfaCodeInput
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		log.Warnf("VerifyMFA: Invalid request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if input.Code == "" && input.RecoveryCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrMFACodeRequired,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if input.MFAToken == "" {
+		input.MFAToken = c.Cookies(mfaTokenCookie)
+	}
+	userID, tokenID, err := h.parseMFAToken(input.MFAToken)
+	if err != nil {
+		log.Warnf("VerifyMFA: Invalid MFA token: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrInvalidMFAToken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	userKey := throttleMFAUser + userID
+	ipKey := throttleMFAIP + c.IP()
+	if wait := h.throttle.Wait(userKey, ipKey); wait > 0 {
+		log.Warnf("VerifyMFA: Too many failed codes for user %s or IP %s", userID, c.IP())
+		h.audit(c, AuditLoginFailure, AuditResultThrottled, userID, "", map[string]string{"method": "mfa"})
+		return tooManyAttempts(c, wait)
+	}
+
+	user := h.userRepo.FindByID(userID)
+	if user == nil || user.ID.IsZero() || !user.MFAEnabled {
+		log.Warnf("VerifyMFA: User %s not found or MFA not enabled", userID)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrInvalidMFAToken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if user.Disabled {
+		log.Warnf("VerifyMFA: Disabled account %s", userID)
+		h.audit(c, AuditLoginFailure, AuditResultAccountDisabled, userID, "", map[string]string{"method": "mfa"})
+		return accountDisabled(c)
+	}
+
+	if !h.checkMFA(user, input.mfaCodeInput, true) {
+		log.Infof("VerifyMFA: Invalid MFA code for user %s", userID)
+		h.throttle.Hit(userKey, h.cfg.MFAMaxFailures)
+		h.throttle.Hit(ipKey, h.cfg.LoginMaxFailuresPerIP)
+		h.audit(c, AuditLoginFailure, AuditResultInvalidCode, userID, "", map[string]string{"method": "mfa"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrInvalidMFACode,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if !h.throttle.Use(throttleMFAToken+tokenID, h.mfaTokenLifetime()) {
+		log.Warnf("VerifyMFA: MFA token of user %s was already used", userID)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrInvalidMFAToken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	c.ClearCookie(mfaTokenCookie)
+	h.throttle.Reset(userKey)
+
+	accessToken, refreshToken, err := h.createSessionTokens(c, user, "mfa")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("VerifyMFA: User logged in successfully: %s", user.Email)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Login successful",
+		"errors":  nil,
+		"data": fiber.Map{
+			"access_token":  accessToken,
+			"refresh_token": refreshToken,
+			"token_type":    "Bearer",
+			"expires_in":    h.cfg.TokenExpiryHours * 3600,
+		},
+	})
+}
+
+// SetupMFA starts TOTP enrollment by generating a secret that becomes active once verified
+func (h *UserHandler) SetupMFA(c *fiber.Ctx) error {
+	log.Info("SetupMFA: Starting MFA enrollment")
+
+	userId, _ := c.Locals("userId").(string)
+	user := h.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrUserNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if user.MFAEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": ErrMFAAlreadyEnabled,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		log.Errorf("SetupMFA: Failed to generate secret: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.userRepo.SetMFASecret(userId, secret); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	uri := TOTPURI(h.cfg.MFAIssuer, user.Email, secret)
+
+	log.Infof("SetupMFA: MFA enrollment started for user %s", userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "MFA enrollment started",
+		"errors":  nil,
+		"data": fiber.Map{
+			"secret":      secret,
+			"otpauth_uri": uri,
+			"qr_payload":  uri,
+		},
+	})
+}
+
+// EnableMFA confirms enrollment with a code from the authenticator app and issues recovery codes
+func (h *UserHandler) EnableMFA(c *fiber.Ctx) error {
+	log.Info("EnableMFA: Verifying MFA enrollment")
+
+	var input mfaCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if input.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrMFACodeRequired,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	user := h.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrUserNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if user.MFAEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": ErrMFAAlreadyEnabled,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if user.MFASecret == nil || *user.MFASecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrMFASetupRequired,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	step, ok := ValidateTOTP(*user.MFASecret, input.Code, time.Now().UTC(), 0)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidMFACode,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		log.Errorf("EnableMFA: Failed to generate recovery codes: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.userRepo.EnableMFA(userId, step, hashes); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("EnableMFA: MFA enabled for user %s", userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "MFA enabled",
+		"errors":  nil,
+		"data": fiber.Map{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableMFA turns MFA off after a fresh TOTP or recovery code check
+func (h *UserHandler) DisableMFA(c *fiber.Ctx) error {
+	log.Info("DisableMFA: Processing MFA disable request")
+
+	user, status, message := h.mfaUserWithFreshCheck(c, true)
+	if user == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"message": message,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.userRepo.DisableMFA(user.ID.Hex()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("DisableMFA: MFA disabled for user %s", user.ID.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "MFA disabled",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after a fresh TOTP check
+func (h *UserHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	log.Info("RegenerateRecoveryCodes: Processing recovery code regeneration")
+
+	user, status, message := h.mfaUserWithFreshCheck(c, false)
+	if user == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"message": message,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		log.Errorf("RegenerateRecoveryCodes: Failed to generate recovery codes: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.userRepo.SetRecoveryCodes(user.ID.Hex(), hashes); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("RegenerateRecoveryCodes: Recovery codes regenerated for user %s", user.ID.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Recovery codes regenerated",
+		"errors":  nil,
+		"data": fiber.Map{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// mfaUserWithFreshCheck loads the authenticated user and requires a valid MFA code in the request body.
+// On failure the returned user is nil together with the status and message to respond with.
+func (h *UserHandler) mfaUserWithFreshCheck(c *fiber.Ctx, allowRecovery bool) (*User, int, string) {
+	var input mfaCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return nil, fiber.StatusBadRequest, ErrInvalidRequestBody
+	}
+
+	if input.Code == "" && (!allowRecovery || input.RecoveryCode == "") {
+		return nil, fiber.StatusBadRequest, ErrMFACodeRequired
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	user := h.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return nil, fiber.StatusUnauthorized, ErrUserNotFound
+	}
+
+	if !user.MFAEnabled {
+		return nil, fiber.StatusBadRequest, ErrMFANotEnabled
+	}
+
+	if ok, wait := h.checkMFAThrottled(c, user, input, allowRecovery); wait > 0 {
+		log.Warnf("mfaUserWithFreshCheck: Too many failed codes for user %s or IP %s", userId, c.IP())
+		setRetryAfter(c, wait)
+		return nil, fiber.StatusTooManyRequests, ErrTooManyAttempts
+	} else if !ok {
+		log.Infof("mfaUserWithFreshCheck: Invalid MFA code for user %s", userId)
+		return nil, fiber.StatusUnauthorized, ErrInvalidMFACode
+	}
+
+	return user, fiber.StatusOK, ""
+}
+
+// checkMFAThrottled is checkMFA under the limits of VerifyMFA: failed codes count against the user and
+// the IP, and while either is locked out no code is checked and the wait is returned instead.
+func (h *UserHandler) checkMFAThrottled(c *fiber.Ctx, user *User, input mfaCodeInput, allowRecovery bool) (bool, time.Duration) {
+	userKey := throttleMFAUser + user.ID.Hex()
+	ipKey := throttleMFAIP + c.IP()
+	if wait := h.throttle.Wait(userKey, ipKey); wait > 0 {
+		return false, wait
+	}
+	if !h.checkMFA(user, input, allowRecovery) {
+		h.throttle.Hit(userKey, h.cfg.MFAMaxFailures)
+		h.throttle.Hit(ipKey, h.cfg.LoginMaxFailuresPerIP)
+		return false, 0
+	}
+	h.throttle.Reset(userKey)
+	return true, 0
+}
@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newMFAUser() *User {
+	secret := rfcTOTPSecret
+	user := NewUser("mfa@example.com")
+	user.MFAEnabled = true
+	user.MFASecret = &secret
+	return user
+}
+
+func postJSON(t *testing.T, app *fiber.App, path string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]interface{}
+	_ = json.Unmarshal(raw, &out)
+	return resp.StatusCode, out
+}
+
+func TestMFAToken_RoundTrip(t *testing.T) {
+	handler := NewUserHandler(newMockConfig(), &MockUserRepository{}, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	token, err := handler.generateMFAToken("user-123")
+	assert.NoError(t, err)
+
+	userID, tokenID, err := handler.parseMFAToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-123", userID)
+	assert.NotEmpty(t, tokenID)
+}
+
+func TestMFAToken_NotAnAccessToken(t *testing.T) {
+	config := newMockConfig()
+	handler := NewUserHandler(config, &MockUserRepository{}, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	token, _ := handler.generateMFAToken("user-123")
+	_, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.JWTSecret), nil
+	})
+	assert.Error(t, err)
+
+	accessToken, _ := handler.generateAccessToken("user-123", []string{"user"}, &UserSession{SessionID: "session-id"})
+	_, _, err = handler.parseMFAToken(accessToken)
+	assert.Error(t, err)
+}
+
+func TestLogin_MFAEnabledReturnsPendingToken(t *testing.T) {
+	user := newMFAUser()
+	user.RegisteredAt = &user.CreatedAt
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	pinHash := string(hash)
+	user.PinHash = &pinHash
+
+	sessionCreated := false
+	userRepo := &MockUserRepository{FindByEmailFunc: func(email string) *User { return user }}
+	sessionRepo := &MockSessionRepository{
+		CreateSessionFunc: func(userID string, ipAddress string, userAgent string) (*UserSession, error) {
+			sessionCreated = true
+			return &UserSession{ID: primitive.NewObjectID(), SessionID: "s"}, nil
+		},
+	}
+	handler := NewUserHandler(newMockConfig(), userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	app := fiber.New()
+	app.Post("/login", handler.Login)
+
+	status, body := postJSON(t, app, "/login", `{"email":"mfa@example.com","pin":"123456"}`)
+	assert.Equal(t, fiber.StatusOK, status)
+	data := body["data"].(map[string]interface{})
+	assert.Equal(t, true, data["mfa_required"])
+	assert.NotEmpty(t, data["mfa_token"])
+	assert.Nil(t, data["access_token"])
+	assert.False(t, sessionCreated)
+}
+
+func TestVerifyMFA_IssuesTokens(t *testing.T) {
+	user := newMFAUser()
+	userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User { return user }}
+	handler := NewUserHandler(newMockConfig(), userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	app := fiber.New()
+	app.Post("/mfa/verify", handler.VerifyMFA)
+
+	mfaToken, _ := handler.generateMFAToken(user.ID.Hex())
+	code, _ := totpCode(rfcTOTPSecret, time.Now().Unix()/totpPeriod)
+
+	status, _ := postJSON(t, app, "/mfa/verify", `{"mfa_token":"`+mfaToken+`","code":"0000000"}`)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	status, body := postJSON(t, app, "/mfa/verify", `{"mfa_token":"`+mfaToken+`","code":"`+code+`"}`)
+	assert.Equal(t, fiber.StatusOK, status)
+	data := body["data"].(map[string]interface{})
+	assert.NotEmpty(t, data["access_token"])
+	assert.NotEmpty(t, data["refresh_token"])
+
+	status, _ = postJSON(t, app, "/mfa/verify", `{"mfa_token":"bogus","code":"`+code+`"}`)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestVerifyMFA_TokenIsSingleUse(t *testing.T) {
+	user := newMFAUser()
+	codes, hashes, _ := GenerateRecoveryCodes()
+	user.MFARecoveryCodes = hashes
+	userRepo := &MockUserRepository{
+		FindByIDFunc:            func(id string) *User { return user },
+		ConsumeRecoveryCodeFunc: func(userID string, codeHash string) bool { return true },
+	}
+	handler := NewUserHandler(newMockConfig(), userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	app := fiber.New()
+	app.Post("/mfa/verify", handler.VerifyMFA)
+
+	mfaToken, _ := handler.generateMFAToken(user.ID.Hex())
+	status, _ := postJSON(t, app, "/mfa/verify", `{"mfa_token":"`+mfaToken+`","recovery_code":"`+codes[0]+`"}`)
+	assert.Equal(t, fiber.StatusOK, status)
+
+	status, body := postJSON(t, app, "/mfa/verify", `{"mfa_token":"`+mfaToken+`","recovery_code":"`+codes[1]+`"}`)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, ErrInvalidMFAToken, body["message"])
+}
+
+func TestVerifyMFA_ThrottlesFailedCodes(t *testing.T) {
+	user := newMFAUser()
+	userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User { return user }}
+	cfg := newMockConfig()
+	auditLog := &memoryAuditLog{}
+	handler := NewUserHandler(cfg, userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, &recordingPublisher{}, newMockMailer())
+
+	app := fiber.New()
+	app.Post("/mfa/verify", handler.VerifyMFA)
+
+	mfaToken, _ := handler.generateMFAToken(user.ID.Hex())
+	for i := 0; i < cfg.MFAMaxFailures; i++ {
+		status, _ := postJSON(t, app, "/mfa/verify", `{"mfa_token":"`+mfaToken+`","code":"000000"}`)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	}
+
+	// Locked: even the right code is refused, for a new mfa_token of the same user too
+	code, _ := totpCode(rfcTOTPSecret, time.Now().Unix()/totpPeriod)
+	mfaToken, _ = handler.generateMFAToken(user.ID.Hex())
+	status, _ := postJSON(t, app, "/mfa/verify", `{"mfa_token":"`+mfaToken+`","code":"`+code+`"}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	assert.Contains(t, auditLog.types(), AuditLoginFailure+":"+AuditResultThrottled)
+}
+
+func TestVerifyMFA_RecoveryCode(t *testing.T) {
+	user := newMFAUser()
+	codes, hashes, _ := GenerateRecoveryCodes()
+	user.MFARecoveryCodes = hashes
+
+	consumed := ""
+	userRepo := &MockUserRepository{
+		FindByIDFunc: func(id string) *User { return user },
+		ConsumeRecoveryCodeFunc: func(userID string, codeHash string) bool {
+			consumed = codeHash
+			return true
+		},
+	}
+	handler := NewUserHandler(newMockConfig(), userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	app := fiber.New()
+	app.Post("/mfa/verify", handler.VerifyMFA)
+
+	mfaToken, _ := handler.generateMFAToken(user.ID.Hex())
+	status, _ := postJSON(t, app, "/mfa/verify", `{"mfa_token":"`+mfaToken+`","recovery_code":"`+codes[2]+`"}`)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, hashes[2], consumed)
+}
+
+func TestDisableMFA_RequiresFreshCode(t *testing.T) {
+	user := newMFAUser()
+	disabled := false
+	userRepo := &MockUserRepository{
+		FindByIDFunc: func(id string) *User { return user },
+		DisableMFAFunc: func(userID string) error {
+			disabled = true
+			return nil
+		},
+	}
+	handler := NewUserHandler(newMockConfig(), userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", user.ID.Hex())
+		return c.Next()
+	})
+	app.Post("/mfa/disable", handler.DisableMFA)
+
+	status, _ := postJSON(t, app, "/mfa/disable", `{}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, _ = postJSON(t, app, "/mfa/disable", `{"code":"111111"}`)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.False(t, disabled)
+
+	code, _ := totpCode(rfcTOTPSecret, time.Now().Unix()/totpPeriod)
+	status, _ = postJSON(t, app, "/mfa/disable", `{"code":"`+code+`"}`)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.True(t, disabled)
+}
+
+func TestDisableMFA_ThrottlesFailedCodes(t *testing.T) {
+	user := newMFAUser()
+	disabled := false
+	userRepo := &MockUserRepository{
+		FindByIDFunc: func(id string) *User { return user },
+		DisableMFAFunc: func(userID string) error {
+			disabled = true
+			return nil
+		},
+	}
+	cfg := newMockConfig()
+	handler := NewUserHandler(cfg, userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", user.ID.Hex())
+		return c.Next()
+	})
+	app.Post("/mfa/disable", handler.DisableMFA)
+	app.Post("/mfa/recovery-codes", handler.RegenerateRecoveryCodes)
+
+	for i := 0; i < cfg.MFAMaxFailures; i++ {
+		status, _ := postJSON(t, app, "/mfa/disable", `{"code":"000000"}`)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	}
+
+	// Locked: even the right code is refused, on every endpoint that asks for one
+	code, _ := totpCode(rfcTOTPSecret, time.Now().Unix()/totpPeriod)
+	status, _ := postJSON(t, app, "/mfa/disable", `{"code":"`+code+`"}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	status, _ = postJSON(t, app, "/mfa/recovery-codes", `{"code":"`+code+`"}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	assert.False(t, disabled)
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/oauth2"
+)
+
+// OAuth client types. Confidential clients keep a secret on their server; public clients such as
+// mobile or single-page apps cannot, and rely on PKCE alone.
+const (
+	OAuthClientConfidential = "confidential"
+	OAuthClientPublic       = "public"
+)
+
+// OAuth error codes of RFC 6749, returned to clients in the "error" field
+const (
+	OAuthErrInvalidRequest          = "invalid_request"
+	OAuthErrInvalidClient           = "invalid_client"
+	OAuthErrInvalidGrant            = "invalid_grant"
+	OAuthErrUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrInvalidScope            = "invalid_scope"
+	OAuthErrAccessDenied            = "access_denied"
+	OAuthErrServerError             = "server_error"
+)
+
+const (
+	oauthClientIDPrefix      = "ilc_"
+	oauthClientSecretPrefix  = "ics_"
+	oauthClientNameMaxLength = 64
+	oauthMaxRedirectURIs     = 10
+	authorizationCodeTTL     = 10 * time.Minute
+	pkceVerifierMinLength    = 43
+	pkceVerifierMaxLength    = 128
+)
+
+// OAuthClient is a third-party application registered by a user. Only the hash of its secret is stored.
+type OAuthClient struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ClientID     string             `json:"client_id" bson:"client_id"`
+	SecretHash   string             `json:"-" bson:"secret_hash,omitempty"` // Empty for public clients
+	Name         string             `json:"name" bson:"name"`
+	Type         string             `json:"type" bson:"type"`
+	RedirectURIs []string           `json:"redirect_uris" bson:"redirect_uris"`
+	Scopes       []string           `json:"scopes" bson:"scopes"` // Scopes the client may ask users for
+	UserID       string             `json:"-" bson:"user_id"`     // User who registered the client
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AuthorizationCode is issued when a user approves a client and exchanged once for tokens
+type AuthorizationCode struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	CodeHash      string             `bson:"code_hash"`
+	ClientID      string             `bson:"client_id"`
+	UserID        string             `bson:"user_id"`
+	RedirectURI   string             `bson:"redirect_uri"`
+	Scopes        []string           `bson:"scopes"`
+	CodeChallenge string             `bson:"code_challenge"`       // S256 PKCE challenge
+	SessionID     string             `bson:"session_id,omitempty"` // Session the code was exchanged for
+	Used          bool               `bson:"used"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	ExpiresAt     time.Time          `bson:"expires_at"`
+}
+
+// OAuthAuthorization is a client the user granted access, as listed to them
+type OAuthAuthorization struct {
+	SessionID      string    `json:"session_id"`
+	ClientID       string    `json:"client_id"`
+	ClientName     string    `json:"client_name"`
+	Scopes         []string  `json:"scopes"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+}
+
+// NewOAuthClient registers a client for the user and returns it with its secret, which is never stored.
+// Public clients get no secret.
+func NewOAuthClient(userID, name, clientType string, redirectURIs, scopes []string) (*OAuthClient, string, error) {
+	clientID, err := generateOAuthToken(oauthClientIDPrefix, 16)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &OAuthClient{
+		ID:           primitive.NewObjectID(),
+		ClientID:     clientID,
+		Name:         name,
+		Type:         clientType,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		UserID:       userID,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if clientType == OAuthClientPublic {
+		return client, "", nil
+	}
+
+	secret, err := generateOAuthToken(oauthClientSecretPrefix, 32)
+	if err != nil {
+		return nil, "", err
+	}
+	client.SecretHash = HashOAuthToken(secret)
+	return client, secret, nil
+}
+
+// NewAuthorizationCode issues a code for the user's approval of the client and returns it with its plaintext
+func NewAuthorizationCode(client *OAuthClient, userID, redirectURI string, scopes []string, codeChallenge string) (*AuthorizationCode, string, error) {
+	code, err := generateOAuthToken("", 32)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	return &AuthorizationCode{
+		ID:            primitive.NewObjectID(),
+		CodeHash:      HashOAuthToken(code),
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scopes:        scopes,
+		CodeChallenge: codeChallenge,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(authorizationCodeTTL),
+	}, code, nil
+}
+
+func generateOAuthToken(prefix string, size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashOAuthToken returns the hex SHA256 of a client secret or authorization code
+func HashOAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySecret reports whether the secret is the client's. Public clients have none to verify.
+func (c *OAuthClient) VerifySecret(secret string) bool {
+	if c.Type == OAuthClientPublic {
+		return secret == ""
+	}
+	return subtle.ConstantTimeCompare([]byte(HashOAuthToken(secret)), []byte(c.SecretHash)) == 1
+}
+
+// AllowsRedirectURI reports whether the URI exactly matches one the client registered
+func (c *OAuthClient) AllowsRedirectURI(redirectURI string) bool {
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScopes reports whether the client registered every one of the scopes
+func (c *OAuthClient) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		allowed := false
+		for _, s := range c.Scopes {
+			if s == scope {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// IsExpired reports whether the code has passed its expiry
+func (a *AuthorizationCode) IsExpired() bool {
+	return !time.Now().UTC().Before(a.ExpiresAt)
+}
+
+// VerifyPKCE reports whether the verifier matches the code's S256 challenge (RFC 7636)
+func (a *AuthorizationCode) VerifyPKCE(verifier string) bool {
+	if len(verifier) < pkceVerifierMinLength || len(verifier) > pkceVerifierMaxLength {
+		return false
+	}
+	challenge := oauth2.S256ChallengeFromVerifier(verifier)
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(a.CodeChallenge)) == 1
+}
+
+// validRedirectURI accepts absolute https URIs without a fragment. Plain http is allowed on
+// loopback addresses only, for native apps and local development.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		if u.Hostname() == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(u.Hostname())
+		return ip != nil && ip.IsLoopback()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	initx "github.com/instrlabs/shared/init"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OAuthClientRepository handles database operations for OAuth clients and their authorization codes
+type OAuthClientRepository struct {
+	db      *initx.Mongo
+	clients *mongo.Collection
+	codes   *mongo.Collection
+}
+
+// NewOAuthClientRepository creates a new OAuth client repository instance
+func NewOAuthClientRepository(db *initx.Mongo) *OAuthClientRepository {
+	r := &OAuthClientRepository{
+		db:      db,
+		clients: db.DB.Collection("oauth_clients"),
+		codes:   db.DB.Collection("oauth_authorization_codes"),
+	}
+	r.ensureIndexes()
+	return r
+}
+
+// ensureIndexes makes client IDs and codes unique and drops expired codes
+func (r *OAuthClientRepository) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.clients.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "client_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Errorf("ensureIndexes: Failed to create OAuth client indexes: %v", err)
+	}
+	_, err = r.codes.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Errorf("ensureIndexes: Failed to create authorization code indexes: %v", err)
+	}
+}
+
+// CreateClient stores a new OAuth client
+func (r *OAuthClientRepository) CreateClient(client *OAuthClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.clients.InsertOne(ctx, client); err != nil {
+		log.Errorf("CreateClient: Failed to create OAuth client: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindClient returns the client with the client ID, or nil if there is none
+func (r *OAuthClientRepository) FindClient(clientID string) *OAuthClient {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var client OAuthClient
+	if err := r.clients.FindOne(ctx, bson.M{"client_id": clientID}).Decode(&client); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Errorf("FindClient: Failed to find OAuth client: %v", err)
+		}
+		return nil
+	}
+	return &client
+}
+
+// FindClientsByUserID returns the clients a user registered, newest first
+func (r *OAuthClientRepository) FindClientsByUserID(userID string) ([]OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.clients.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		log.Errorf("FindClientsByUserID: Failed to find OAuth clients: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	clients := []OAuthClient{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		log.Errorf("FindClientsByUserID: Failed to decode OAuth clients: %v", err)
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteClient removes a client the user registered and reports whether it existed
+func (r *OAuthClientRepository) DeleteClient(clientID string, userID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.clients.DeleteOne(ctx, bson.M{"client_id": clientID, "user_id": userID})
+	if err != nil {
+		log.Errorf("DeleteClient: Failed to delete OAuth client %s: %v", clientID, err)
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
+
+// CreateAuthorizationCode stores a new authorization code
+func (r *OAuthClientRepository) CreateAuthorizationCode(code *AuthorizationCode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.codes.InsertOne(ctx, code); err != nil {
+		log.Errorf("CreateAuthorizationCode: Failed to create authorization code: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UseAuthorizationCode marks the code used and returns it as it was before, or nil if there is none.
+// A returned code that is already used was presented before.
+func (r *OAuthClientRepository) UseAuthorizationCode(codeHash string) (*AuthorizationCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var code AuthorizationCode
+	err := r.codes.FindOneAndUpdate(ctx, bson.M{"code_hash": codeHash}, bson.M{"$set": bson.M{"used": true}}).Decode(&code)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		log.Errorf("UseAuthorizationCode: Failed to use authorization code: %v", err)
+		return nil, err
+	}
+	return &code, nil
+}
+
+// SetAuthorizationCodeSession records the session a code was exchanged for, so a replay can revoke it
+func (r *OAuthClientRepository) SetAuthorizationCodeSession(codeHash string, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.codes.UpdateOne(ctx, bson.M{"code_hash": codeHash}, bson.M{"$set": bson.M{"session_id": sessionID}})
+	if err != nil {
+		log.Errorf("SetAuthorizationCodeSession: Failed to update authorization code: %v", err)
+		return err
+	}
+	return nil
+}
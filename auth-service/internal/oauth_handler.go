@@ -0,0 +1,380 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+)
+
+// OAuthHandler serves social login and identity linking for every registered provider.
+// Sessions are issued through the same path as PIN and passkey logins.
+type OAuthHandler struct {
+	users     *UserHandler
+	providers *OAuthRegistry
+}
+
+func NewOAuthHandler(users *UserHandler, providers *OAuthRegistry) *OAuthHandler {
+	return &OAuthHandler{
+		users:     users,
+		providers: providers,
+	}
+}
+
+// PublicPaths lists the login and callback routes of every enabled provider
+func (h *OAuthHandler) PublicPaths() []string {
+	var paths []string
+	for _, name := range h.providers.Names() {
+		paths = append(paths, "/oauth/"+name, "/oauth/"+name+"/callback")
+	}
+	return paths
+}
+
+// provider resolves the :provider route param. The legacy /google routes have no param and fall back to Google.
+func (h *OAuthHandler) provider(c *fiber.Ctx) *OAuthProvider {
+	p, ok := h.providers.Get(c.Params("provider", OAuthProviderGoogle))
+	if !ok {
+		return nil
+	}
+	return p
+}
+
+// startFlow stores the state and PKCE verifier, binds them to the browser with a cookie
+// and returns the provider's authorization URL
+func (h *OAuthHandler) startFlow(c *fiber.Ctx, provider *OAuthProvider, userID string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.AuthCodeURL(c.Context(), state, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if err := h.users.sessionRepo.SaveOAuthState(&OAuthState{
+		State:        state,
+		CodeVerifier: verifier,
+		Provider:     provider.cfg.Name,
+		UserID:       userID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(oauthStateTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	// Bind the flow to this browser; SameSite=Lax still sends it on the top-level redirect back from the provider
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/",
+		Expires:  now.Add(oauthStateTTL),
+		HTTPOnly: true,
+		Secure:   h.users.cfg.Environment != "development" && h.users.cfg.Environment != "test",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return authURL, nil
+}
+
+func (h *OAuthHandler) Login(c *fiber.Ctx) error {
+	provider := h.provider(c)
+	if provider == nil {
+		log.Infof("OAuthLogin: Unknown provider %s", c.Params("provider"))
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrOAuthProviderNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("OAuthLogin: Initiating %s OAuth login", provider.cfg.Name)
+
+	redirectUrl, err := h.startFlow(c, provider, "")
+	if err != nil {
+		log.Errorf("OAuthLogin: Failed to start %s flow: %v", provider.cfg.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("OAuthLogin: Redirecting to %s OAuth URL: %s", provider.cfg.Name, redirectUrl)
+	return c.Redirect(redirectUrl)
+}
+
+func (h *OAuthHandler) Callback(c *fiber.Ctx) error {
+	provider := h.provider(c)
+	if provider == nil {
+		log.Infof("OAuthCallback: Unknown provider %s", c.Params("provider"))
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrOAuthProviderNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("OAuthCallback: Processing %s OAuth callback", provider.cfg.Name)
+
+	// The state must match the cookie set when the flow started and can only be used once
+	state := c.Query("state")
+	cookieState := c.Cookies(oauthStateCookie)
+	c.ClearCookie(oauthStateCookie)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		log.Warn("OAuthCallback: OAuth state does not match state cookie")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidOAuthState,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	oauthState, err := h.users.sessionRepo.TakeOAuthState(state)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if oauthState == nil || oauthState.Provider != provider.cfg.Name {
+		log.Warn("OAuthCallback: OAuth state unknown, expired, replayed or for another provider")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidOAuthState,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		log.Info("OAuthCallback: Missing authorization code")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidToken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	identity, err := provider.Exchange(c.Context(), code, oauthState.CodeVerifier)
+	if err != nil {
+		log.Errorf("OAuthCallback: Failed to get %s identity: %v", provider.cfg.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	linked := LinkedIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: time.Now().UTC(),
+	}
+
+	if oauthState.UserID != "" {
+		return h.finishLink(c, oauthState.UserID, linked)
+	}
+
+	user := h.users.userRepo.FindByIdentity(identity.Provider, identity.Subject)
+	if user != nil && !user.ID.IsZero() {
+		// Google accounts linked through the old google_id field move to the identities list
+		if user.Identity(identity.Provider) == nil {
+			if err := h.users.userRepo.LinkIdentity(user.ID.Hex(), linked); err != nil {
+				log.Errorf("OAuthCallback: Failed to migrate %s identity: %v", identity.Provider, err)
+			}
+		}
+	} else {
+		// Signing in by email would let anyone who controls an unverified provider address take over the account
+		if identity.Email == "" || !identity.EmailVerified {
+			log.Warnf("OAuthCallback: %s did not return a verified email", identity.Provider)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": ErrOAuthEmailNotVerified,
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+
+		user = h.users.userRepo.FindByEmail(identity.Email)
+		if user == nil || user.ID.IsZero() {
+			user = h.users.userRepo.Create(NewOAuthUser(identity.Email, linked))
+			if user == nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"message": ErrInternalServer,
+					"errors":  nil,
+					"data":    nil,
+				})
+			}
+		} else if err := h.users.userRepo.LinkIdentity(user.ID.Hex(), linked); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": ErrInternalServer,
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+	}
+
+	if user.Disabled {
+		log.Warnf("OAuthCallback: Disabled account: %s", user.Email)
+		h.users.audit(c, AuditLoginFailure, AuditResultAccountDisabled, user.ID.Hex(), "", map[string]string{"method": identity.Provider})
+		return accountDisabled(c)
+	}
+
+	if user.MFAEnabled {
+		mfaToken, err := h.users.generateMFAToken(user.ID.Hex())
+		if err != nil {
+			log.Errorf("OAuthCallback: Failed to generate MFA token: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": ErrInternalServer,
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+
+		// The token goes in a cookie rather than the URL, where it would reach browser history and Referer headers
+		h.users.setMFACookie(c, mfaToken)
+		redirectURL := fmt.Sprintf("%s?mfa_required=true&expires_in=%s",
+			h.users.cfg.WebUrl,
+			strconv.Itoa(h.users.cfg.MFATokenExpiryMins*60),
+		)
+		log.Infof("OAuthCallback: MFA verification required for: %s", user.Email)
+		return c.Redirect(redirectURL, fiber.StatusFound)
+	}
+
+	accessToken, refreshToken, err := h.users.createSessionTokens(c, user, identity.Provider)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	expiresIn := h.users.cfg.TokenExpiryHours * 3600
+	redirectURL := fmt.Sprintf("%s?access_token=%s&refresh_token=%s&token_type=Bearer&expires_in=%s",
+		h.users.cfg.WebUrl,
+		url.QueryEscape(accessToken),
+		url.QueryEscape(refreshToken),
+		strconv.Itoa(expiresIn),
+	)
+
+	log.Infof("OAuthCallback: User logged in successfully with %s: %s", identity.Provider, user.Email)
+	return c.Redirect(redirectURL, fiber.StatusFound)
+}
+
+// finishLink attaches the identity to the user who started the link flow and sends them back to the web app
+func (h *OAuthHandler) finishLink(c *fiber.Ctx, userID string, identity LinkedIdentity) error {
+	owner := h.users.userRepo.FindByIdentity(identity.Provider, identity.Subject)
+	if owner != nil && !owner.ID.IsZero() {
+		if owner.ID.Hex() == userID {
+			return c.Redirect(h.users.cfg.WebUrl+"?linked="+url.QueryEscape(identity.Provider), fiber.StatusFound)
+		}
+		log.Warnf("finishLink: %s identity already belongs to another user", identity.Provider)
+		return c.Redirect(h.users.cfg.WebUrl+"?link_error=identity_in_use", fiber.StatusFound)
+	}
+
+	if err := h.users.userRepo.LinkIdentity(userID, identity); err != nil {
+		log.Errorf("finishLink: Failed to link %s identity: %v", identity.Provider, err)
+		return c.Redirect(h.users.cfg.WebUrl+"?link_error=link_failed", fiber.StatusFound)
+	}
+
+	h.users.audit(c, AuditIdentityLinked, AuditResultSuccess, userID, "", map[string]string{"provider": identity.Provider})
+	log.Infof("finishLink: Linked %s identity for user %s", identity.Provider, userID)
+	return c.Redirect(h.users.cfg.WebUrl+"?linked="+url.QueryEscape(identity.Provider), fiber.StatusFound)
+}
+
+// LinkIdentity starts a flow that links a provider account to the signed in user.
+// The client navigates to the returned URL; the callback redirects back to the web app.
+func (h *OAuthHandler) LinkIdentity(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	provider := h.provider(c)
+	if provider == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrOAuthProviderNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	user := h.users.userRepo.FindByID(userID)
+	if user == nil || user.ID.IsZero() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrUserNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if user.Identity(provider.cfg.Name) != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": ErrIdentityAlreadyLinked,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	authURL, err := h.startFlow(c, provider, userID)
+	if err != nil {
+		log.Errorf("LinkIdentity: Failed to start %s flow: %v", provider.cfg.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Continue at the provider to link your account",
+		"errors":  nil,
+		"data": fiber.Map{
+			"authorization_url": authURL,
+		},
+	})
+}
+
+// UnlinkIdentity removes a linked provider account from the signed in user
+func (h *OAuthHandler) UnlinkIdentity(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	provider := c.Params("provider")
+
+	removed, err := h.users.userRepo.UnlinkIdentity(userID, provider)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !removed {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrIdentityNotLinked,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	h.users.audit(c, AuditIdentityUnlinked, AuditResultSuccess, userID, "", map[string]string{"provider": provider})
+	log.Infof("UnlinkIdentity: Unlinked %s identity for user %s", provider, userID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Provider unlinked successfully",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
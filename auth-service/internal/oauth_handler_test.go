@@ -0,0 +1,460 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider stands in for a provider's OIDC discovery, token and userinfo endpoints and checks the PKCE verifier
+type fakeProvider struct {
+	server    *httptest.Server
+	challenge string
+	exchanges int
+	userInfo  map[string]interface{}
+	emails    []map[string]interface{}
+}
+
+func newFakeProvider(t *testing.T, userInfo map[string]interface{}) *fakeProvider {
+	t.Helper()
+	f := &fakeProvider{userInfo: userInfo}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.server.URL,
+			"authorization_endpoint": f.server.URL + "/auth",
+			"token_endpoint":         f.server.URL + "/token",
+			"userinfo_endpoint":      f.server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		f.exchanges++
+		_, _ = w.Write([]byte(`{"access_token":"fake-access","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fake-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.userInfo)
+	})
+	mux.HandleFunc("/userinfo/emails", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fake-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.emails)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// memoryUsers is a MockUserRepository backed by a slice so identity links persist between requests
+func memoryUsers(users ...*User) *MockUserRepository {
+	find := func(match func(u *User) bool) *User {
+		for _, u := range users {
+			if match(u) {
+				return u
+			}
+		}
+		return nil
+	}
+	return &MockUserRepository{
+		FindByIDFunc: func(id string) *User {
+			return find(func(u *User) bool { return u.ID.Hex() == id })
+		},
+		FindByEmailFunc: func(email string) *User {
+			return find(func(u *User) bool { return u.Email == email })
+		},
+		FindByIdentityFunc: func(provider string, subject string) *User {
+			return find(func(u *User) bool {
+				identity := u.Identity(provider)
+				return identity != nil && identity.Subject == subject
+			})
+		},
+		CreateFunc: func(user *User) *User {
+			users = append(users, user)
+			return user
+		},
+		LinkIdentityFunc: func(userID string, identity LinkedIdentity) error {
+			u := find(func(u *User) bool { return u.ID.Hex() == userID })
+			u.Identities = append(u.Identities, identity)
+			return nil
+		},
+		UnlinkIdentityFunc: func(userID string, provider string) (bool, error) {
+			u := find(func(u *User) bool { return u.ID.Hex() == userID })
+			for i, identity := range u.Identities {
+				if identity.Provider == provider {
+					u.Identities = append(u.Identities[:i], u.Identities[i+1:]...)
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}
+}
+
+func memoryOAuthStates() *MockSessionRepository {
+	states := map[string]*OAuthState{}
+	return &MockSessionRepository{
+		SaveOAuthStateFunc: func(state *OAuthState) error {
+			states[state.State] = state
+			return nil
+		},
+		TakeOAuthStateFunc: func(state string) (*OAuthState, error) {
+			s, ok := states[state]
+			if !ok {
+				return nil, nil
+			}
+			delete(states, state)
+			return s, nil
+		},
+	}
+}
+
+func newOAuthTestApp(t *testing.T, cfg *Config, userRepo *MockUserRepository) *fiber.App {
+	t.Helper()
+	providers, err := NewOAuthRegistry(cfg)
+	require.NoError(t, err)
+
+	users := NewUserHandler(cfg, userRepo, memoryOAuthStates(), newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	handler := NewOAuthHandler(users, providers)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	app.Get("/oauth/:provider", handler.Login)
+	app.Get("/oauth/:provider/callback", handler.Callback)
+	app.Get("/google", handler.Login)
+	app.Get("/google/callback", handler.Callback)
+	app.Post("/profile/identities/:provider/link", handler.LinkIdentity)
+	app.Post("/profile/identities/:provider/unlink", handler.UnlinkIdentity)
+	app.Post("/mfa/verify", users.VerifyMFA)
+	return app
+}
+
+func googleTestConfig(provider *fakeProvider) *Config {
+	cfg := newMockConfig()
+	cfg.GoogleAuthURL = provider.server.URL + "/auth"
+	cfg.GoogleTokenURL = provider.server.URL + "/token"
+	cfg.GoogleUserInfoURL = provider.server.URL + "/userinfo"
+	return cfg
+}
+
+// oidcTestConfig registers a generic OIDC provider named "acme" through a providers file
+func oidcTestConfig(t *testing.T, provider *fakeProvider) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "providers.json")
+	data, _ := json.Marshal([]OAuthProviderConfig{{
+		Name:     "acme",
+		Type:     OAuthProviderOIDC,
+		ClientID: "acme-client",
+		Issuer:   provider.server.URL,
+	}})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	cfg := newMockConfig()
+	cfg.GoogleClientID = ""
+	cfg.OAuthProvidersFile = path
+	return cfg
+}
+
+// followAuthRedirect checks the provider URL and returns the state and state cookie
+func followAuthRedirect(t *testing.T, location string, provider *fakeProvider, cookies []*http.Cookie) (string, *http.Cookie) {
+	t.Helper()
+	authURL, err := url.Parse(location)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location, provider.server.URL+"/auth"))
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	provider.challenge = authURL.Query().Get("code_challenge")
+	require.NotEmpty(t, provider.challenge)
+
+	var cookie *http.Cookie
+	for _, c := range cookies {
+		if c.Name == oauthStateCookie {
+			cookie = c
+		}
+	}
+	require.NotNil(t, cookie)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, authURL.Query().Get("state"), cookie.Value)
+	return cookie.Value, cookie
+}
+
+// startOAuthLogin returns the state and state cookie issued by the login route
+func startOAuthLogin(t *testing.T, app *fiber.App, path string, provider *fakeProvider) (string, *http.Cookie) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	return followAuthRedirect(t, resp.Header.Get("Location"), provider, resp.Cookies())
+}
+
+func oauthCallback(t *testing.T, app *fiber.App, path string, query string, cookie *http.Cookie) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, path+"?"+query, nil)
+	if cookie != nil {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestOAuthCallback_StateAndPKCE(t *testing.T) {
+	google := newFakeProvider(t, map[string]interface{}{"id": "google-123", "email": "oauth@example.com", "verified_email": true})
+	app := newOAuthTestApp(t, googleTestConfig(google), memoryUsers())
+
+	state, cookie := startOAuthLogin(t, app, "/oauth/google", google)
+	query := "code=good-code&state=" + url.QueryEscape(state)
+
+	resp := oauthCallback(t, app, "/oauth/google/callback", query, cookie)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Location"), "access_token=")
+	assert.Equal(t, 1, google.exchanges)
+
+	// Replaying the same callback is rejected before reaching the provider
+	resp = oauthCallback(t, app, "/oauth/google/callback", query, cookie)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, 1, google.exchanges)
+}
+
+func TestOAuthCallback_RejectsStateWithoutMatchingCookie(t *testing.T) {
+	google := newFakeProvider(t, map[string]interface{}{"id": "google-123", "email": "oauth@example.com", "verified_email": true})
+	app := newOAuthTestApp(t, googleTestConfig(google), memoryUsers())
+
+	state, cookie := startOAuthLogin(t, app, "/google", google)
+	query := "code=good-code&state=" + url.QueryEscape(state)
+
+	resp := oauthCallback(t, app, "/google/callback", query, nil)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	resp = oauthCallback(t, app, "/google/callback", query, &http.Cookie{Name: cookie.Name, Value: "attacker-state"})
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	resp = oauthCallback(t, app, "/google/callback", "code=good-code&state=unknown", &http.Cookie{Name: cookie.Name, Value: "unknown"})
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, 0, google.exchanges)
+}
+
+func TestOAuthCallback_RejectsWrongVerifier(t *testing.T) {
+	google := newFakeProvider(t, map[string]interface{}{"id": "google-123", "email": "oauth@example.com", "verified_email": true})
+	app := newOAuthTestApp(t, googleTestConfig(google), memoryUsers())
+
+	state, cookie := startOAuthLogin(t, app, "/google", google)
+	google.challenge = "challenge-from-another-flow"
+
+	resp := oauthCallback(t, app, "/google/callback", "code=good-code&state="+url.QueryEscape(state), cookie)
+	assert.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, 0, google.exchanges)
+}
+
+func TestOAuthLogin_UnknownProvider(t *testing.T) {
+	app := newOAuthTestApp(t, newMockConfig(), memoryUsers())
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/oauth/github", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestOAuthCallback_OIDCDiscoveryLinksExistingUserByVerifiedEmail(t *testing.T) {
+	acme := newFakeProvider(t, map[string]interface{}{"sub": "acme-7", "email": "Existing@Example.com", "email_verified": true})
+	existing := NewUser("existing@example.com")
+	users := memoryUsers(existing)
+	app := newOAuthTestApp(t, oidcTestConfig(t, acme), users)
+
+	state, cookie := startOAuthLogin(t, app, "/oauth/acme", acme)
+	resp := oauthCallback(t, app, "/oauth/acme/callback", "code=good-code&state="+url.QueryEscape(state), cookie)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Location"), "access_token=")
+
+	require.Len(t, existing.Identities, 1)
+	assert.Equal(t, "acme", existing.Identities[0].Provider)
+	assert.Equal(t, "acme-7", existing.Identities[0].Subject)
+}
+
+func TestOAuthCallback_MFATokenInCookie(t *testing.T) {
+	acme := newFakeProvider(t, map[string]interface{}{"sub": "acme-9", "email": "mfa@example.com", "email_verified": true})
+	app := newOAuthTestApp(t, oidcTestConfig(t, acme), memoryUsers(newMFAUser()))
+
+	state, cookie := startOAuthLogin(t, app, "/oauth/acme", acme)
+	resp := oauthCallback(t, app, "/oauth/acme/callback", "code=good-code&state="+url.QueryEscape(state), cookie)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	location := resp.Header.Get("Location")
+	assert.Contains(t, location, "mfa_required=true")
+	assert.NotContains(t, location, "mfa_token")
+	assert.NotContains(t, location, "access_token")
+
+	var mfaCookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == mfaTokenCookie {
+			mfaCookie = c
+		}
+	}
+	require.NotNil(t, mfaCookie)
+	assert.True(t, mfaCookie.HttpOnly)
+
+	code, _ := totpCode(rfcTOTPSecret, time.Now().Unix()/totpPeriod)
+	req := httptest.NewRequest(fiber.MethodPost, "/mfa/verify", strings.NewReader(`{"code":"`+code+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: mfaCookie.Name, Value: mfaCookie.Value})
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestOAuthCallback_RejectsUnverifiedEmail(t *testing.T) {
+	acme := newFakeProvider(t, map[string]interface{}{"sub": "acme-8", "email": "victim@example.com", "email_verified": false})
+	victim := NewUser("victim@example.com")
+	app := newOAuthTestApp(t, oidcTestConfig(t, acme), memoryUsers(victim))
+
+	state, cookie := startOAuthLogin(t, app, "/oauth/acme", acme)
+	resp := oauthCallback(t, app, "/oauth/acme/callback", "code=good-code&state="+url.QueryEscape(state), cookie)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	assert.Empty(t, victim.Identities)
+}
+
+func TestOAuthCallback_GitHubCreatesUserFromPrimaryEmail(t *testing.T) {
+	github := newFakeProvider(t, map[string]interface{}{"id": 4242, "login": "octo"})
+	github.emails = []map[string]interface{}{
+		{"email": "old@example.com", "primary": false, "verified": true},
+		{"email": "octo@example.com", "primary": true, "verified": true},
+	}
+	cfg := newMockConfig()
+	cfg.GoogleClientID = ""
+	path := filepath.Join(t.TempDir(), "providers.json")
+	data, _ := json.Marshal([]OAuthProviderConfig{{
+		Name:        "github-enterprise",
+		Type:        OAuthProviderGitHub,
+		ClientID:    "ghe-client",
+		AuthURL:     github.server.URL + "/auth",
+		TokenURL:    github.server.URL + "/token",
+		UserInfoURL: github.server.URL + "/userinfo",
+	}})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	cfg.OAuthProvidersFile = path
+
+	var created *User
+	users := memoryUsers()
+	create := users.CreateFunc
+	users.CreateFunc = func(user *User) *User {
+		created = user
+		return create(user)
+	}
+	app := newOAuthTestApp(t, cfg, users)
+
+	state, cookie := startOAuthLogin(t, app, "/oauth/github-enterprise", github)
+	resp := oauthCallback(t, app, "/oauth/github-enterprise/callback", "code=good-code&state="+url.QueryEscape(state), cookie)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+
+	require.NotNil(t, created)
+	assert.Equal(t, "octo@example.com", created.Email)
+	require.NotNil(t, created.Identity("github-enterprise"))
+	assert.Equal(t, "4242", created.Identity("github-enterprise").Subject)
+}
+
+func TestLinkIdentity_LinksAndUnlinks(t *testing.T) {
+	acme := newFakeProvider(t, map[string]interface{}{"sub": "acme-9", "email": "other@example.com"})
+	user := NewUser("me@example.com")
+	app := newOAuthTestApp(t, oidcTestConfig(t, acme), memoryUsers(user))
+
+	req := httptest.NewRequest(fiber.MethodPost, "/profile/identities/acme/link", nil)
+	req.Header.Set("X-Test-User", user.ID.Hex())
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Data struct {
+			AuthorizationURL string `json:"authorization_url"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	state, cookie := followAuthRedirect(t, body.Data.AuthorizationURL, acme, resp.Cookies())
+
+	// Linking does not require a verified email since the user is already signed in
+	resp = oauthCallback(t, app, "/oauth/acme/callback", "code=good-code&state="+url.QueryEscape(state), cookie)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Location"), "linked=acme")
+	require.NotNil(t, user.Identity("acme"))
+	assert.Equal(t, "other@example.com", user.Identity("acme").Email)
+
+	req = httptest.NewRequest(fiber.MethodPost, "/profile/identities/acme/link", nil)
+	req.Header.Set("X-Test-User", user.ID.Hex())
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+
+	req = httptest.NewRequest(fiber.MethodPost, "/profile/identities/acme/unlink", nil)
+	req.Header.Set("X-Test-User", user.ID.Hex())
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Nil(t, user.Identity("acme"))
+
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestLinkIdentity_RejectsIdentityOfAnotherUser(t *testing.T) {
+	acme := newFakeProvider(t, map[string]interface{}{"sub": "acme-10", "email": "owner@example.com", "email_verified": true})
+	owner := NewOAuthUser("owner@example.com", LinkedIdentity{Provider: "acme", Subject: "acme-10"})
+	user := NewUser("me@example.com")
+	app := newOAuthTestApp(t, oidcTestConfig(t, acme), memoryUsers(owner, user))
+
+	req := httptest.NewRequest(fiber.MethodPost, "/profile/identities/acme/link", nil)
+	req.Header.Set("X-Test-User", user.ID.Hex())
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Data struct {
+			AuthorizationURL string `json:"authorization_url"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	state, cookie := followAuthRedirect(t, body.Data.AuthorizationURL, acme, resp.Cookies())
+
+	resp = oauthCallback(t, app, "/oauth/acme/callback", "code=good-code&state="+url.QueryEscape(state), cookie)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Location"), "link_error=identity_in_use")
+	assert.Empty(t, user.Identities)
+}
+
+func TestNewOAuthRegistry_RejectsInvalidProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "providers.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name":"acme","type":"oidc","client_id":"x"}]`), 0o600))
+
+	cfg := newMockConfig()
+	cfg.OAuthProvidersFile = path
+	_, err := NewOAuthRegistry(cfg)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name":"acme","type":"saml","client_id":"x"}]`), 0o600))
+	_, err = NewOAuthRegistry(cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,324 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Supported provider types
+const (
+	OAuthProviderGoogle    = "google"
+	OAuthProviderGitHub    = "github"
+	OAuthProviderMicrosoft = "microsoft"
+	OAuthProviderOIDC      = "oidc"
+)
+
+// OAuthProviderConfig describes one social login provider. Built-in providers are configured
+// from env; any number of providers, including generic OIDC issuers, can be added with a JSON file.
+type OAuthProviderConfig struct {
+	Name         string   `json:"name"`          // Route name, /oauth/:provider
+	Type         string   `json:"type"`          // google, github, microsoft or oidc
+	ClientID     string   `json:"client_id"`     // OAuth client ID
+	ClientSecret string   `json:"client_secret"` // OAuth client secret
+	RedirectURL  string   `json:"redirect_url"`  // Defaults to {API_URL}/auth/oauth/{name}/callback
+	Scopes       []string `json:"scopes"`        // Defaults depend on the type
+	Issuer       string   `json:"issuer"`        // OIDC issuer, endpoints are discovered from it
+	AuthURL      string   `json:"auth_url"`      // Overrides the type's or discovered endpoint
+	TokenURL     string   `json:"token_url"`     // Overrides the type's or discovered endpoint
+	UserInfoURL  string   `json:"userinfo_url"`  // Overrides the type's or discovered endpoint
+}
+
+// ExternalIdentity is the account a provider vouches for after a successful login
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// OAuthProvider resolves endpoints for a configured provider and fetches the user's identity
+type OAuthProvider struct {
+	cfg    OAuthProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	resolved *oauth2.Config
+	userInfo string
+}
+
+// OAuthRegistry holds the enabled providers by name
+type OAuthRegistry struct {
+	providers map[string]*OAuthProvider
+}
+
+// NewOAuthRegistry registers the built-in providers that have a client ID plus those in OAuthProvidersFile
+func NewOAuthRegistry(cfg *Config) (*OAuthRegistry, error) {
+	configs := []OAuthProviderConfig{
+		{
+			Name:         OAuthProviderGoogle,
+			Type:         OAuthProviderGoogle,
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  cfg.GoogleRedirectUrl,
+			AuthURL:      cfg.GoogleAuthURL,
+			TokenURL:     cfg.GoogleTokenURL,
+			UserInfoURL:  cfg.GoogleUserInfoURL,
+		},
+		{
+			Name:         OAuthProviderGitHub,
+			Type:         OAuthProviderGitHub,
+			ClientID:     cfg.GitHubClientID,
+			ClientSecret: cfg.GitHubClientSecret,
+		},
+		{
+			Name:         OAuthProviderMicrosoft,
+			Type:         OAuthProviderMicrosoft,
+			ClientID:     cfg.MicrosoftClientID,
+			ClientSecret: cfg.MicrosoftClientSecret,
+			Issuer:       "https://login.microsoftonline.com/" + cfg.MicrosoftTenant + "/v2.0",
+		},
+	}
+
+	if cfg.OAuthProvidersFile != "" {
+		data, err := os.ReadFile(cfg.OAuthProvidersFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OAuth providers file: %w", err)
+		}
+		var fromFile []OAuthProviderConfig
+		if err := json.Unmarshal(data, &fromFile); err != nil {
+			return nil, fmt.Errorf("failed to parse OAuth providers file: %w", err)
+		}
+		configs = append(configs, fromFile...)
+	}
+
+	registry := &OAuthRegistry{providers: map[string]*OAuthProvider{}}
+	for _, pc := range configs {
+		if pc.ClientID == "" {
+			continue
+		}
+		if pc.Name == "" {
+			return nil, errors.New("OAuth provider name is required")
+		}
+		switch pc.Type {
+		case OAuthProviderGoogle, OAuthProviderGitHub:
+		case OAuthProviderMicrosoft, OAuthProviderOIDC:
+			if pc.Issuer == "" && (pc.AuthURL == "" || pc.TokenURL == "" || pc.UserInfoURL == "") {
+				return nil, fmt.Errorf("OAuth provider %s needs an issuer or explicit endpoints", pc.Name)
+			}
+		default:
+			return nil, fmt.Errorf("OAuth provider %s has unknown type %q", pc.Name, pc.Type)
+		}
+		if pc.RedirectURL == "" {
+			pc.RedirectURL = cfg.ApiUrl + "/auth/oauth/" + pc.Name + "/callback"
+		}
+		registry.providers[pc.Name] = &OAuthProvider{cfg: pc, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+
+	return registry, nil
+}
+
+// Get returns the provider registered under name
+func (r *OAuthRegistry) Get(name string) (*OAuthProvider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names lists the enabled providers in alphabetical order
+func (r *OAuthRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// config returns the oauth2 configuration, running OIDC discovery on first use
+func (p *OAuthProvider) config(ctx context.Context) (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resolved != nil {
+		return p.resolved, nil
+	}
+
+	authURL, tokenURL, userInfo := p.cfg.AuthURL, p.cfg.TokenURL, p.cfg.UserInfoURL
+	scopes := p.cfg.Scopes
+
+	switch p.cfg.Type {
+	case OAuthProviderGoogle:
+		if len(scopes) == 0 {
+			scopes = []string{
+				"https://www.googleapis.com/auth/userinfo.email",
+				"https://www.googleapis.com/auth/userinfo.profile",
+			}
+		}
+	case OAuthProviderGitHub:
+		authURL = defaultString(authURL, "https://github.com/login/oauth/authorize")
+		tokenURL = defaultString(tokenURL, "https://github.com/login/oauth/access_token")
+		userInfo = defaultString(userInfo, "https://api.github.com/user")
+		if len(scopes) == 0 {
+			scopes = []string{"read:user", "user:email"}
+		}
+	default:
+		if authURL == "" || tokenURL == "" || userInfo == "" {
+			discovered, err := p.discover(ctx)
+			if err != nil {
+				return nil, err
+			}
+			authURL = defaultString(authURL, discovered.AuthorizationEndpoint)
+			tokenURL = defaultString(tokenURL, discovered.TokenEndpoint)
+			userInfo = defaultString(userInfo, discovered.UserInfoEndpoint)
+		}
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+	}
+
+	p.resolved = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       scopes,
+		Endpoint:     oauth2.Endpoint{AuthURL: authURL, TokenURL: tokenURL},
+	}
+	p.userInfo = userInfo
+	return p.resolved, nil
+}
+
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+func (p *OAuthProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	url := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	var doc oidcDiscovery
+	if err := p.getJSON(ctx, p.client, url, &doc); err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %s failed: %w", p.cfg.Name, err)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserInfoEndpoint == "" {
+		return nil, fmt.Errorf("OIDC discovery for %s returned incomplete metadata", p.cfg.Name)
+	}
+	return &doc, nil
+}
+
+// AuthCodeURL builds the provider's consent URL with state and a PKCE S256 challenge
+func (p *OAuthProvider) AuthCodeURL(ctx context.Context, state, verifier string) (string, error) {
+	conf, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the authorization code and fetches the identity of the user who signed in
+func (p *OAuthProvider) Exchange(ctx context.Context, code, verifier string) (*ExternalIdentity, error) {
+	conf, err := p.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	client := conf.Client(ctx, token)
+
+	identity := &ExternalIdentity{Provider: p.cfg.Name}
+	switch p.cfg.Type {
+	case OAuthProviderGoogle:
+		var info struct {
+			ID            string `json:"id"`
+			Email         string `json:"email"`
+			VerifiedEmail bool   `json:"verified_email"`
+		}
+		if err := p.getJSON(ctx, client, p.userInfo, &info); err != nil {
+			return nil, err
+		}
+		identity.Subject, identity.Email, identity.EmailVerified = info.ID, info.Email, info.VerifiedEmail
+	case OAuthProviderGitHub:
+		var info struct {
+			ID int64 `json:"id"`
+		}
+		if err := p.getJSON(ctx, client, p.userInfo, &info); err != nil {
+			return nil, err
+		}
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+		if err := p.getJSON(ctx, client, p.userInfo+"/emails", &emails); err != nil {
+			return nil, err
+		}
+		identity.Subject = strconv.FormatInt(info.ID, 10)
+		for _, e := range emails {
+			if e.Primary {
+				identity.Email, identity.EmailVerified = e.Email, e.Verified
+			}
+		}
+	default:
+		var info struct {
+			Sub           string      `json:"sub"`
+			Email         string      `json:"email"`
+			EmailVerified interface{} `json:"email_verified"`
+		}
+		if err := p.getJSON(ctx, client, p.userInfo, &info); err != nil {
+			return nil, err
+		}
+		// Some issuers send email_verified as the string "true"
+		verified := info.EmailVerified == true || info.EmailVerified == "true"
+		identity.Subject, identity.Email, identity.EmailVerified = info.Sub, info.Email, verified
+	}
+
+	if identity.Subject == "" || identity.Subject == "0" {
+		return nil, errors.New("provider did not return a user ID")
+	}
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+	return identity, nil
+}
+
+func (p *OAuthProvider) getJSON(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func defaultString(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
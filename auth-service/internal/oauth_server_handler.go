@@ -0,0 +1,684 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OAuthServerHandler lets third-party applications act for users without handling their PINs. Users
+// register clients, approve them on a consent screen fed by /oauth2/authorize, and the client exchanges
+// the authorization code for scoped tokens at /oauth2/token (RFC 6749 with PKCE, RFC 7636).
+//
+// Every grant is a session of the user bound to the client, so refresh token rotation, reuse
+// detection, idle expiry and revocation work as they do for sign-ins.
+type OAuthServerHandler struct {
+	users   *UserHandler
+	clients IOAuthClientRepository
+}
+
+func NewOAuthServerHandler(users *UserHandler, clients IOAuthClientRepository) *OAuthServerHandler {
+	return &OAuthServerHandler{
+		users:   users,
+		clients: clients,
+	}
+}
+
+// PublicPaths lists the routes clients call with their own credentials instead of a user's token
+func (h *OAuthServerHandler) PublicPaths() []string {
+	return []string{"/oauth2/token", "/oauth2/revoke", "/oauth2/introspect"}
+}
+
+// authorizationRequest holds the parameters of RFC 6749 section 4.1.1, sent as query parameters to
+// show the consent screen and as JSON when the user decides
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type" query:"response_type"`
+	ClientID            string `json:"client_id" query:"client_id"`
+	RedirectURI         string `json:"redirect_uri" query:"redirect_uri"`
+	Scope               string `json:"scope" query:"scope"`
+	State               string `json:"state" query:"state"`
+	CodeChallenge       string `json:"code_challenge" query:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" query:"code_challenge_method"`
+	Approve             bool   `json:"approve" query:"-"`
+}
+
+// oauthError responds to a client with an error in the format of RFC 6749 section 5.2
+func oauthError(c *fiber.Ctx, status int, code string, description string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(fiber.Map{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// redirectWith adds the parameters to the query of a redirect URI
+func redirectWith(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// checkAuthorization validates an authorization request and returns the client with the requested
+// scopes. On failure it responds and returns a nil client. Once the redirect URI is known to be the
+// client's, errors carry the redirect that reports them to the client.
+func (h *OAuthServerHandler) checkAuthorization(c *fiber.Ctx, req *authorizationRequest) (*OAuthClient, []string, error) {
+	client := h.clients.FindClient(req.ClientID)
+	if client == nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrClientNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRedirectURI,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	reject := func(message string, code string) error {
+		params := url.Values{"error": {code}, "error_description": {message}}
+		if req.State != "" {
+			params.Set("state", req.State)
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": message,
+			"errors":  nil,
+			"data":    fiber.Map{"redirect_to": redirectWith(req.RedirectURI, params)},
+		})
+	}
+	if req.ResponseType != "code" {
+		return nil, nil, reject(ErrUnsupportedResponseType, OAuthErrUnsupportedResponseType)
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, nil, reject(ErrPKCERequired, OAuthErrInvalidRequest)
+	}
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 || !validScopes(scopes) || !client.AllowsScopes(scopes) {
+		return nil, nil, reject(ErrInvalidScope, OAuthErrInvalidScope)
+	}
+	return client, scopes, nil
+}
+
+// GetAuthorization validates an authorization request and returns what the consent screen shows
+func (h *OAuthServerHandler) GetAuthorization(c *fiber.Ctx) error {
+	var req authorizationRequest
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	client, scopes, err := h.checkAuthorization(c, &req)
+	if client == nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Authorization request is valid",
+		"errors":  nil,
+		"data": fiber.Map{
+			"client":       fiber.Map{"client_id": client.ClientID, "name": client.Name},
+			"scopes":       scopes,
+			"redirect_uri": req.RedirectURI,
+			"state":        req.State,
+		},
+	})
+}
+
+// Authorize records the user's decision on the consent screen. An approval issues an authorization
+// code; either way the response tells the frontend where to send the user back to.
+func (h *OAuthServerHandler) Authorize(c *fiber.Ctx) error {
+	var req authorizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	client, scopes, err := h.checkAuthorization(c, &req)
+	if client == nil {
+		return err
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	details := map[string]string{"client_id": client.ClientID, "scopes": strings.Join(scopes, ",")}
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !req.Approve {
+		h.users.audit(c, AuditOAuthConsent, AuditResultDenied, userId, "", details)
+		params.Set("error", OAuthErrAccessDenied)
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Authorization denied",
+			"errors":  nil,
+			"data":    fiber.Map{"redirect_to": redirectWith(req.RedirectURI, params)},
+		})
+	}
+
+	grant, code, err := NewAuthorizationCode(client, userId, req.RedirectURI, scopes, req.CodeChallenge)
+	if err != nil || h.clients.CreateAuthorizationCode(grant) != nil {
+		log.Errorf("Authorize: Failed to issue authorization code: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.users.audit(c, AuditOAuthConsent, AuditResultSuccess, userId, "", details)
+
+	log.Infof("Authorize: User %s authorized client %s", userId, client.ClientID)
+	params.Set("code", code)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Authorization granted",
+		"errors":  nil,
+		"data":    fiber.Map{"redirect_to": redirectWith(req.RedirectURI, params)},
+	})
+}
+
+// clientAuth reads the client credentials from HTTP Basic authentication or the client_id and
+// client_secret form fields (RFC 6749 section 2.3.1). Public clients send their client_id only.
+func clientAuth(c *fiber.Ctx) (string, string, bool) {
+	clientID, secret := c.FormValue("client_id"), c.FormValue("client_secret")
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Basic ") {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+		if err != nil {
+			return "", "", false
+		}
+		id, sec, ok := strings.Cut(string(raw), ":")
+		if !ok {
+			return "", "", false
+		}
+		clientID, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(sec)
+	}
+	return clientID, secret, clientID != ""
+}
+
+// authenticateClient identifies the calling OAuth client. Returns nil if authentication fails.
+func (h *OAuthServerHandler) authenticateClient(c *fiber.Ctx) *OAuthClient {
+	clientID, secret, ok := clientAuth(c)
+	if !ok {
+		return nil
+	}
+
+	client := h.clients.FindClient(clientID)
+	if client == nil || !client.VerifySecret(secret) {
+		log.Warnf("authenticateClient: Authentication failed for client %s", clientID)
+		return nil
+	}
+	return client
+}
+
+func invalidClient(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth2"`)
+	return oauthError(c, fiber.StatusUnauthorized, OAuthErrInvalidClient, "Client authentication failed")
+}
+
+// Token issues tokens to a client for an authorization code or a refresh token, and to internal
+// services for their client credentials
+func (h *OAuthServerHandler) Token(c *fiber.Ctx) error {
+	if c.FormValue("grant_type") == "client_credentials" {
+		return h.clientCredentials(c)
+	}
+
+	client := h.authenticateClient(c)
+	if client == nil {
+		return invalidClient(c)
+	}
+
+	switch c.FormValue("grant_type") {
+	case "authorization_code":
+		return h.exchangeCode(c, client)
+	case "refresh_token":
+		return h.refreshGrant(c, client)
+	default:
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrUnsupportedGrantType, "grant_type must be authorization_code, refresh_token or client_credentials")
+	}
+}
+
+// exchangeCode redeems an authorization code for the session it grants. A code presented a second
+// time was intercepted by someone, so the session issued for it is revoked (RFC 6749 section 4.1.2).
+func (h *OAuthServerHandler) exchangeCode(c *fiber.Ctx, client *OAuthClient) error {
+	code := c.FormValue("code")
+	if code == "" {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidRequest, "code is required")
+	}
+
+	grant, err := h.clients.UseAuthorizationCode(HashOAuthToken(code))
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, OAuthErrServerError, ErrInternalServer)
+	}
+	if grant == nil {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "Authorization code is invalid")
+	}
+	if grant.Used {
+		log.Warnf("SECURITY: Authorization code of client %s for user %s used twice", grant.ClientID, grant.UserID)
+		if grant.SessionID != "" {
+			if err := h.users.revokeSession(grant.SessionID); err != nil {
+				log.Errorf("exchangeCode: Failed to revoke session %s: %v", grant.SessionID, err)
+			}
+		}
+		h.users.audit(c, AuditOAuthRevoked, AuditResultTokenReuse, grant.UserID, grant.SessionID, map[string]string{"client_id": grant.ClientID})
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "Authorization code is invalid")
+	}
+	if grant.ClientID != client.ClientID || grant.IsExpired() || grant.RedirectURI != c.FormValue("redirect_uri") {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "Authorization code is invalid")
+	}
+	if !grant.VerifyPKCE(c.FormValue("code_verifier")) {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "code_verifier does not match the code challenge")
+	}
+
+	user := h.users.userRepo.FindByID(grant.UserID)
+	if user == nil || user.ID.IsZero() || user.Disabled {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "Authorization code is invalid")
+	}
+
+	// The session is bound to the client's server, the way a sign-in is bound to the user's device
+	userIP, _ := c.Locals("userIP").(string)
+	userAgent, _ := c.Locals("userAgent").(string)
+	session, err := h.users.sessionRepo.CreateClientSession(grant.UserID, client.ClientID, grant.Scopes, userIP, userAgent)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, OAuthErrServerError, ErrInternalServer)
+	}
+	accessToken, err := h.users.generateAccessToken(grant.UserID, user.RoleList(), session)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, OAuthErrServerError, ErrInternalServer)
+	}
+	refreshToken, err := h.users.generateRefreshToken()
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, OAuthErrServerError, ErrInternalServer)
+	}
+	if err := h.users.sessionRepo.UpdateSessionRefreshToken(session.SessionID, refreshToken); err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, OAuthErrServerError, ErrInternalServer)
+	}
+	_ = h.clients.SetAuthorizationCodeSession(grant.CodeHash, session.SessionID)
+
+	h.users.audit(c, AuditOAuthTokenIssued, AuditResultSuccess, grant.UserID, session.SessionID, map[string]string{"client_id": client.ClientID})
+	log.Infof("exchangeCode: Issued tokens to client %s for user %s", client.ClientID, grant.UserID)
+	return h.tokenResponse(c, accessToken, refreshToken, session.Scopes)
+}
+
+// refreshGrant rotates the refresh token of one of the client's sessions
+func (h *OAuthServerHandler) refreshGrant(c *fiber.Ctx, client *OAuthClient) error {
+	refreshToken := c.FormValue("refresh_token")
+	if refreshToken == "" {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidRequest, "refresh_token is required")
+	}
+
+	session, err := h.users.sessionRepo.FindSessionByRefreshToken(refreshToken)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, OAuthErrServerError, ErrInternalServer)
+	}
+	if session == nil {
+		h.users.detectRefreshTokenReuse(c, refreshToken)
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "Refresh token is invalid")
+	}
+	if session.ClientID != client.ClientID {
+		log.Warnf("refreshGrant: Client %s presented a refresh token of session %s", client.ClientID, session.SessionID)
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "Refresh token is invalid")
+	}
+	if h.users.expireIdleSession(c, session) {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, ErrSessionIdle)
+	}
+
+	user := h.users.userRepo.FindByID(session.UserID)
+	if user == nil || user.ID.IsZero() {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "Refresh token is invalid")
+	}
+	if user.Disabled {
+		_ = h.users.revokeSession(session.SessionID)
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, ErrAccountDisabled)
+	}
+
+	accessToken, newRefreshToken, err := h.users.rotateSession(c, user, session, refreshToken)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, OAuthErrServerError, ErrInternalServer)
+	}
+	if newRefreshToken == "" {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidGrant, "Refresh token is invalid")
+	}
+
+	h.users.audit(c, AuditTokenRefreshed, AuditResultSuccess, session.UserID, session.SessionID, map[string]string{"client_id": client.ClientID})
+	return h.tokenResponse(c, accessToken, newRefreshToken, session.Scopes)
+}
+
+// tokenResponse sends a successful token response (RFC 6749 section 5.1)
+func (h *OAuthServerHandler) tokenResponse(c *fiber.Ctx, accessToken, refreshToken string, scopes []string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    h.users.cfg.TokenExpiryHours * 3600,
+		"refresh_token": refreshToken,
+		"scope":         strings.Join(scopes, " "),
+	})
+}
+
+// resolveToken finds the active session a refresh token or access token belongs to, or nil.
+// Access tokens are returned with their claims.
+func (h *OAuthServerHandler) resolveToken(token string) (*UserSession, jwt.MapClaims) {
+	if session, err := h.users.sessionRepo.FindSessionByRefreshToken(token); err == nil && session != nil {
+		return session, nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, h.users.keys.Keyfunc, jwt.WithExpirationRequired()); err != nil {
+		return nil, nil
+	}
+	sessionID, _ := claims["session_id"].(string)
+	userID, _ := claims["user_id"].(string)
+	session, err := h.users.sessionRepo.FindSessionByID(sessionID, userID)
+	if err != nil || session == nil || !session.IsActive {
+		return nil, nil
+	}
+	return session, claims
+}
+
+// Revoke revokes the grant behind a refresh or access token of the calling client (RFC 7009).
+// Unknown tokens are not an error, so the client learns nothing about tokens that are not its own.
+func (h *OAuthServerHandler) Revoke(c *fiber.Ctx) error {
+	client := h.authenticateClient(c)
+	if client == nil {
+		return invalidClient(c)
+	}
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidRequest, "token is required")
+	}
+
+	if session, _ := h.resolveToken(token); session != nil && session.ClientID == client.ClientID {
+		if err := h.users.revokeSession(session.SessionID); err != nil {
+			return oauthError(c, fiber.StatusServiceUnavailable, OAuthErrServerError, ErrInternalServer)
+		}
+		h.users.audit(c, AuditOAuthRevoked, AuditResultSuccess, session.UserID, session.SessionID, map[string]string{"client_id": client.ClientID})
+		log.Infof("Revoke: Client %s revoked session %s", client.ClientID, session.SessionID)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Introspect tells a confidential client whether one of its tokens is active, and what it grants
+// (RFC 7662). Tokens of other clients are reported inactive.
+func (h *OAuthServerHandler) Introspect(c *fiber.Ctx) error {
+	client := h.authenticateClient(c)
+	if client == nil || client.Type != OAuthClientConfidential {
+		return invalidClient(c)
+	}
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, fiber.StatusBadRequest, OAuthErrInvalidRequest, "token is required")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	session, claims := h.resolveToken(token)
+	if session == nil || session.ClientID != client.ClientID || !time.Now().UTC().Before(session.ExpiresAt) {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"active": false})
+	}
+
+	response := fiber.Map{
+		"active":    true,
+		"scope":     strings.Join(session.Scopes, " "),
+		"client_id": session.ClientID,
+		"sub":       session.UserID,
+		"exp":       session.ExpiresAt.Unix(),
+		"iat":       session.CreatedAt.Unix(),
+	}
+	if claims != nil {
+		response["token_type"] = "Bearer"
+		response["exp"] = claims["exp"]
+		response["iat"] = claims["iat"]
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// CreateClient registers an OAuth client for the authenticated user. The secret of a confidential
+// client is returned once and never again.
+func (h *OAuthServerHandler) CreateClient(c *fiber.Ctx) error {
+	log.Info("CreateClient: Registering OAuth client")
+
+	var input struct {
+		Name         string   `json:"name"`
+		Type         string   `json:"type"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	name := strings.TrimSpace(input.Name)
+	message := ""
+	switch {
+	case name == "" || utf8.RuneCountInString(name) > oauthClientNameMaxLength:
+		message = ErrInvalidClientName
+	case input.Type != OAuthClientConfidential && input.Type != OAuthClientPublic:
+		message = ErrInvalidClientType
+	case len(input.RedirectURIs) == 0 || len(input.RedirectURIs) > oauthMaxRedirectURIs:
+		message = ErrInvalidRedirectURIs
+	case len(input.Scopes) == 0 || !validScopes(input.Scopes):
+		message = ErrInvalidClientScopes
+	}
+	for _, uri := range input.RedirectURIs {
+		if message == "" && !validRedirectURI(uri) {
+			message = ErrInvalidRedirectURIs
+		}
+	}
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": message,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	client, secret, err := NewOAuthClient(userId, name, input.Type, input.RedirectURIs, input.Scopes)
+	if err != nil || h.clients.CreateClient(client) != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.users.audit(c, AuditClientCreated, AuditResultSuccess, userId, "", map[string]string{"client_id": client.ClientID})
+
+	data := fiber.Map{"client": client}
+	if secret != "" {
+		data["client_secret"] = secret
+	}
+	log.Infof("CreateClient: Client %s registered by user %s", client.ClientID, userId)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "OAuth client registered",
+		"errors":  nil,
+		"data":    data,
+	})
+}
+
+// GetClients lists the OAuth clients the authenticated user registered
+func (h *OAuthServerHandler) GetClients(c *fiber.Ctx) error {
+	userId, _ := c.Locals("userId").(string)
+	clients, err := h.clients.FindClientsByUserID(userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "OAuth clients retrieved successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"clients": clients},
+	})
+}
+
+// DeleteClient removes an OAuth client of the authenticated user and signs it out of every user's account
+func (h *OAuthServerHandler) DeleteClient(c *fiber.Ctx) error {
+	userId, _ := c.Locals("userId").(string)
+	clientID := c.Params("clientId")
+
+	deleted, err := h.clients.DeleteClient(clientID, userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrClientNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.revokeClientSessions(clientID)
+	h.users.audit(c, AuditClientDeleted, AuditResultSuccess, userId, "", map[string]string{"client_id": clientID})
+
+	log.Infof("DeleteClient: Client %s deleted by user %s", clientID, userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "OAuth client deleted",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// revokeClientSessions revokes every grant to the client
+func (h *OAuthServerHandler) revokeClientSessions(clientID string) {
+	sessions, err := h.users.sessionRepo.FindClientSessions(clientID)
+	if err != nil {
+		return
+	}
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		if err := h.users.sessionRepo.DeactivateSession(session.SessionID); err != nil {
+			log.Errorf("revokeClientSessions: Failed to revoke session %s: %v", session.SessionID, err)
+			continue
+		}
+		sessionIDs = append(sessionIDs, session.SessionID)
+	}
+	h.users.publishRevocations(sessionIDs)
+}
+
+// GetAuthorizations lists the clients the authenticated user granted access to their account
+func (h *OAuthServerHandler) GetAuthorizations(c *fiber.Ctx) error {
+	userId, _ := c.Locals("userId").(string)
+	sessions, err := h.users.sessionRepo.GetUserSessions(userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	names := map[string]string{}
+	authorizations := []OAuthAuthorization{}
+	for _, session := range sessions {
+		if session.ClientID == "" {
+			continue
+		}
+		name, ok := names[session.ClientID]
+		if !ok {
+			if client := h.clients.FindClient(session.ClientID); client != nil {
+				name = client.Name
+			}
+			names[session.ClientID] = name
+		}
+		authorizations = append(authorizations, OAuthAuthorization{
+			SessionID:      session.SessionID,
+			ClientID:       session.ClientID,
+			ClientName:     name,
+			Scopes:         session.Scopes,
+			CreatedAt:      session.CreatedAt,
+			LastActivityAt: session.LastActivityAt,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Authorizations retrieved successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"authorizations": authorizations},
+	})
+}
+
+// RevokeAuthorization withdraws a client's access to the authenticated user's account
+func (h *OAuthServerHandler) RevokeAuthorization(c *fiber.Ctx) error {
+	userId, _ := c.Locals("userId").(string)
+	session, err := h.users.sessionRepo.FindSessionByID(c.Params("sessionId"), userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if session == nil || session.ClientID == "" || !session.IsActive {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrAuthorizationNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.users.revokeSession(session.SessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.users.audit(c, AuditOAuthRevoked, AuditResultSuccess, userId, session.SessionID, map[string]string{"client_id": session.ClientID})
+
+	log.Infof("RevokeAuthorization: User %s revoked client %s", userId, session.ClientID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Authorization revoked",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// AccountDeletedMessage removes the clients a purged user registered, signing them out everywhere
+func (h *OAuthServerHandler) AccountDeletedMessage(data []byte) {
+	var event AccountDeletion
+	if err := json.Unmarshal(data, &event); err != nil || event.UserID == "" {
+		log.Errorf("AccountDeletedMessage: Invalid account deletion event: %v", err)
+		return
+	}
+
+	clients, err := h.clients.FindClientsByUserID(event.UserID)
+	if err != nil {
+		return
+	}
+	for _, client := range clients {
+		if deleted, err := h.clients.DeleteClient(client.ClientID, event.UserID); err == nil && deleted {
+			h.revokeClientSessions(client.ClientID)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// memoryOAuthClients is an in-memory IOAuthClientRepository
+type memoryOAuthClients struct {
+	clients []*OAuthClient
+	codes   []*AuthorizationCode
+}
+
+func (m *memoryOAuthClients) CreateClient(client *OAuthClient) error {
+	m.clients = append(m.clients, client)
+	return nil
+}
+
+func (m *memoryOAuthClients) FindClient(clientID string) *OAuthClient {
+	for _, client := range m.clients {
+		if client.ClientID == clientID {
+			return client
+		}
+	}
+	return nil
+}
+
+func (m *memoryOAuthClients) FindClientsByUserID(userID string) ([]OAuthClient, error) {
+	out := []OAuthClient{}
+	for _, client := range m.clients {
+		if client.UserID == userID {
+			out = append(out, *client)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryOAuthClients) DeleteClient(clientID string, userID string) (bool, error) {
+	for i, client := range m.clients {
+		if client.ClientID == clientID && client.UserID == userID {
+			m.clients = append(m.clients[:i], m.clients[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryOAuthClients) CreateAuthorizationCode(code *AuthorizationCode) error {
+	m.codes = append(m.codes, code)
+	return nil
+}
+
+func (m *memoryOAuthClients) UseAuthorizationCode(codeHash string) (*AuthorizationCode, error) {
+	for _, code := range m.codes {
+		if code.CodeHash == codeHash {
+			before := *code
+			code.Used = true
+			return &before, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryOAuthClients) SetAuthorizationCodeSession(codeHash string, sessionID string) error {
+	for _, code := range m.codes {
+		if code.CodeHash == codeHash {
+			code.SessionID = sessionID
+		}
+	}
+	return nil
+}
+
+// memorySessionStore backs a MockSessionRepository holding several sessions
+func memorySessionStore() (*MockSessionRepository, *[]*UserSession) {
+	sessions := []*UserSession{}
+	find := func(match func(s *UserSession) bool) *UserSession {
+		for _, s := range sessions {
+			if match(s) {
+				copied := *s
+				return &copied
+			}
+		}
+		return nil
+	}
+	update := func(sessionID string, apply func(s *UserSession)) {
+		for _, s := range sessions {
+			if s.SessionID == sessionID {
+				apply(s)
+			}
+		}
+	}
+	list := func(match func(s *UserSession) bool) []UserSession {
+		out := []UserSession{}
+		for _, s := range sessions {
+			if s.IsActive && match(s) {
+				out = append(out, *s)
+			}
+		}
+		return out
+	}
+
+	repo := &MockSessionRepository{
+		CreateClientSessionFunc: func(userID string, clientID string, scopes []string, ipAddress string, userAgent string) (*UserSession, error) {
+			now := time.Now().UTC()
+			session := &UserSession{SessionID: GenerateSessionID(), UserID: userID, ClientID: clientID, Scopes: scopes,
+				IsActive: true, CreatedAt: now, LastActivityAt: now, ExpiresAt: now.Add(24 * time.Hour)}
+			sessions = append(sessions, session)
+			copied := *session
+			return &copied, nil
+		},
+		UpdateSessionRefreshTokenFunc: func(sessionID string, refreshToken string) error {
+			update(sessionID, func(s *UserSession) { s.RefreshTokenHash = HashRefreshToken(refreshToken) })
+			return nil
+		},
+		FindSessionByRefreshTokenFunc: func(token string) (*UserSession, error) {
+			return find(func(s *UserSession) bool { return s.IsActive && s.RefreshTokenHash == HashRefreshToken(token) }), nil
+		},
+		FindSessionByPreviousRefreshTokenFunc: func(token string) (*UserSession, error) {
+			return find(func(s *UserSession) bool {
+				for _, h := range s.PreviousTokenHashes {
+					if h == HashRefreshToken(token) {
+						return true
+					}
+				}
+				return false
+			}), nil
+		},
+		RotateSessionRefreshTokenFunc: func(sessionID string, current string, next string) (bool, error) {
+			rotated := false
+			update(sessionID, func(s *UserSession) {
+				if s.IsActive && s.RefreshTokenHash == HashRefreshToken(current) {
+					s.PreviousTokenHashes = append(s.PreviousTokenHashes, s.RefreshTokenHash)
+					s.RefreshTokenHash = HashRefreshToken(next)
+					rotated = true
+				}
+			})
+			return rotated, nil
+		},
+		DeactivateSessionFunc: func(sessionID string) error {
+			update(sessionID, func(s *UserSession) { s.IsActive = false })
+			return nil
+		},
+		FindSessionByIDFunc: func(sessionID string, userID string) (*UserSession, error) {
+			return find(func(s *UserSession) bool { return s.SessionID == sessionID && s.UserID == userID }), nil
+		},
+		GetUserSessionsFunc: func(userID string) ([]UserSession, error) {
+			return list(func(s *UserSession) bool { return s.UserID == userID }), nil
+		},
+		FindClientSessionsFunc: func(clientID string) ([]UserSession, error) {
+			return list(func(s *UserSession) bool { return s.ClientID == clientID }), nil
+		},
+	}
+	return repo, &sessions
+}
+
+type oauthTestEnv struct {
+	app      *fiber.App
+	handler  *OAuthServerHandler
+	clients  *memoryOAuthClients
+	sessions *[]*UserSession
+	auditLog *memoryAuditLog
+	user     *User
+}
+
+func newOAuthTestEnv(t *testing.T) *oauthTestEnv {
+	t.Helper()
+	user := NewUser("user@example.com")
+	sessionRepo, sessions := memorySessionStore()
+	auditLog := &memoryAuditLog{}
+	users := NewUserHandler(newMockConfig(), memoryUserDirectory(user), sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, &recordingPublisher{}, newMockMailer())
+	clients := &memoryOAuthClients{}
+	handler := NewOAuthServerHandler(users, clients)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	app.Post("/refresh", users.RefreshToken)
+	app.Get("/devices", users.GetDevices)
+	app.Get("/oauth2/authorize", handler.GetAuthorization)
+	app.Post("/oauth2/authorize", handler.Authorize)
+	app.Post("/oauth2/token", handler.Token)
+	app.Post("/oauth2/revoke", handler.Revoke)
+	app.Post("/oauth2/introspect", handler.Introspect)
+	app.Get("/oauth2/clients", handler.GetClients)
+	app.Post("/oauth2/clients", handler.CreateClient)
+	app.Post("/oauth2/clients/:clientId/delete", handler.DeleteClient)
+	app.Get("/oauth2/authorizations", handler.GetAuthorizations)
+	app.Post("/oauth2/authorizations/:sessionId/revoke", handler.RevokeAuthorization)
+
+	return &oauthTestEnv{app: app, handler: handler, clients: clients, sessions: sessions, auditLog: auditLog, user: user}
+}
+
+// register creates a client of the given type and returns its ID and secret
+func (e *oauthTestEnv) register(t *testing.T, clientType string) (string, string) {
+	t.Helper()
+	status, body := apiKeyRequest(t, e.app, fiber.MethodPost, "/oauth2/clients", e.user.ID.Hex(),
+		`{"name":"Partner","type":"`+clientType+`","redirect_uris":["https://partner.example/callback"],"scopes":["images:read","images:write"]}`)
+	require.Equal(t, fiber.StatusCreated, status)
+	data := body["data"].(map[string]interface{})
+	secret, _ := data["client_secret"].(string)
+	return data["client"].(map[string]interface{})["client_id"].(string), secret
+}
+
+// authorize approves the client for the user and returns the authorization code
+func (e *oauthTestEnv) authorize(t *testing.T, clientID string, verifier string) string {
+	t.Helper()
+	status, body := apiKeyRequest(t, e.app, fiber.MethodPost, "/oauth2/authorize", e.user.ID.Hex(), `{
+		"response_type":"code","client_id":"`+clientID+`","redirect_uri":"https://partner.example/callback",
+		"scope":"images:read","state":"xyz","code_challenge":"`+oauth2.S256ChallengeFromVerifier(verifier)+`",
+		"code_challenge_method":"S256","approve":true}`)
+	require.Equal(t, fiber.StatusOK, status)
+	redirect, err := url.Parse(body["data"].(map[string]interface{})["redirect_to"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", redirect.Query().Get("state"))
+	return redirect.Query().Get("code")
+}
+
+func formRequest(t *testing.T, app *fiber.App, path string, form url.Values, clientID, secret string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(clientID+":"+secret)))
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	var out map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func (e *oauthTestEnv) exchange(t *testing.T, clientID, secret, code, verifier string) (int, map[string]interface{}) {
+	t.Helper()
+	return formRequest(t, e.app, "/oauth2/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {"https://partner.example/callback"},
+		"code_verifier": {verifier},
+	}, clientID, secret)
+}
+
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func TestOAuthServer_AuthorizationCodeFlow(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	clientID, secret := env.register(t, OAuthClientConfidential)
+	require.NotEmpty(t, secret)
+
+	// The consent screen shows the client and the scopes it asks for
+	status, body := apiKeyRequest(t, env.app, fiber.MethodGet, "/oauth2/authorize?response_type=code&client_id="+clientID+
+		"&redirect_uri="+url.QueryEscape("https://partner.example/callback")+"&scope=images:read&code_challenge=abc&code_challenge_method=S256",
+		env.user.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	consent := body["data"].(map[string]interface{})
+	assert.Equal(t, "Partner", consent["client"].(map[string]interface{})["name"])
+	assert.Equal(t, []interface{}{"images:read"}, consent["scopes"])
+
+	code := env.authorize(t, clientID, testVerifier)
+	status, tokens := env.exchange(t, clientID, secret, code, testVerifier)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "Bearer", tokens["token_type"])
+	assert.Equal(t, "images:read", tokens["scope"])
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokens["access_token"].(string), claims, env.handler.users.keys.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, clientID, claims["client_id"])
+	assert.Equal(t, "images:read", claims["scope"])
+	assert.Empty(t, claims["roles"])
+
+	// Client refresh tokens are refreshed by the client, not at /refresh
+	status, _ = postJSON(t, env.app, "/refresh", `{"refresh_token":"`+tokens["refresh_token"].(string)+`"}`)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, refreshed := formRequest(t, env.app, "/oauth2/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens["refresh_token"].(string)},
+	}, clientID, secret)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.NotEqual(t, tokens["refresh_token"], refreshed["refresh_token"])
+
+	// The grant is listed as an authorized app, not as a device
+	status, body = apiKeyRequest(t, env.app, fiber.MethodGet, "/oauth2/authorizations", env.user.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	authorizations := body["data"].(map[string]interface{})["authorizations"].([]interface{})
+	require.Len(t, authorizations, 1)
+	assert.Equal(t, "Partner", authorizations[0].(map[string]interface{})["client_name"])
+	status, body = apiKeyRequest(t, env.app, fiber.MethodGet, "/devices", env.user.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Empty(t, body["data"].(map[string]interface{})["devices"])
+
+	// Replaying the code revokes the session it was exchanged for
+	status, replay := env.exchange(t, clientID, secret, code, testVerifier)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, OAuthErrInvalidGrant, replay["error"])
+	assert.False(t, (*env.sessions)[0].IsActive)
+
+	assert.Equal(t, []string{
+		"oauth2.client_created:success",
+		"oauth2.consent:success",
+		"oauth2.token_issued:success",
+		"token.refreshed:success",
+		"oauth2.revoked:token_reuse",
+	}, env.auditLog.types())
+}
+
+func TestOAuthServer_RejectsInvalidExchanges(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	clientID, secret := env.register(t, OAuthClientConfidential)
+	otherID, otherSecret := env.register(t, OAuthClientConfidential)
+
+	status, body := env.exchange(t, clientID, "wrong", env.authorize(t, clientID, testVerifier), testVerifier)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, OAuthErrInvalidClient, body["error"])
+
+	status, body = env.exchange(t, clientID, secret, env.authorize(t, clientID, testVerifier), strings.Repeat("x", 43))
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, OAuthErrInvalidGrant, body["error"])
+
+	status, body = env.exchange(t, otherID, otherSecret, env.authorize(t, clientID, testVerifier), testVerifier)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, OAuthErrInvalidGrant, body["error"])
+
+	status, body = formRequest(t, env.app, "/oauth2/token", url.Values{"grant_type": {"password"}}, clientID, secret)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, OAuthErrUnsupportedGrantType, body["error"])
+	assert.Empty(t, *env.sessions)
+}
+
+func TestOAuthServer_AuthorizationRequestValidation(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	clientID, _ := env.register(t, OAuthClientPublic)
+	authorize := func(params string) (int, map[string]interface{}) {
+		return apiKeyRequest(t, env.app, fiber.MethodGet, "/oauth2/authorize?client_id="+clientID+"&"+params, env.user.ID.Hex(), "")
+	}
+	callback := "redirect_uri=" + url.QueryEscape("https://partner.example/callback")
+
+	// An unregistered redirect URI is never redirected to
+	status, body := authorize("response_type=code&redirect_uri=https://evil.example/&scope=images:read&code_challenge=abc&code_challenge_method=S256")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, ErrInvalidRedirectURI, body["message"])
+	assert.Nil(t, body["data"])
+
+	for params, code := range map[string]string{
+		"response_type=token&scope=images:read&code_challenge=abc&code_challenge_method=S256": OAuthErrUnsupportedResponseType,
+		"response_type=code&scope=images:read&code_challenge=abc&code_challenge_method=plain": OAuthErrInvalidRequest,
+		"response_type=code&scope=images:read":                                                OAuthErrInvalidRequest,
+		"response_type=code&scope=pdfs:read&code_challenge=abc&code_challenge_method=S256":    OAuthErrInvalidScope,
+	} {
+		status, body := authorize(callback + "&state=s1&" + params)
+		assert.Equal(t, fiber.StatusBadRequest, status, params)
+		redirect, err := url.Parse(body["data"].(map[string]interface{})["redirect_to"].(string))
+		require.NoError(t, err)
+		assert.Equal(t, code, redirect.Query().Get("error"), params)
+		assert.Equal(t, "s1", redirect.Query().Get("state"), params)
+	}
+
+	// Denying consent sends the user back with access_denied
+	status, body = apiKeyRequest(t, env.app, fiber.MethodPost, "/oauth2/authorize", env.user.ID.Hex(), `{
+		"response_type":"code","client_id":"`+clientID+`","redirect_uri":"https://partner.example/callback",
+		"scope":"images:read","code_challenge":"abc","code_challenge_method":"S256","approve":false}`)
+	require.Equal(t, fiber.StatusOK, status)
+	redirect, err := url.Parse(body["data"].(map[string]interface{})["redirect_to"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, OAuthErrAccessDenied, redirect.Query().Get("error"))
+	assert.Empty(t, redirect.Query().Get("code"))
+}
+
+func TestOAuthServer_RevokeAndIntrospect(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	clientID, secret := env.register(t, OAuthClientConfidential)
+	publicID, _ := env.register(t, OAuthClientPublic)
+
+	// Public clients authenticate with their client ID only
+	status, publicTokens := env.exchange(t, publicID, "", env.authorize(t, publicID, testVerifier), testVerifier)
+	require.Equal(t, fiber.StatusOK, status)
+	status, _ = formRequest(t, env.app, "/oauth2/introspect", url.Values{"token": {publicTokens["access_token"].(string)}}, publicID, "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	status, tokens := env.exchange(t, clientID, secret, env.authorize(t, clientID, testVerifier), testVerifier)
+	require.Equal(t, fiber.StatusOK, status)
+	introspect := func(token string) map[string]interface{} {
+		status, body := formRequest(t, env.app, "/oauth2/introspect", url.Values{"token": {token}}, clientID, secret)
+		require.Equal(t, fiber.StatusOK, status)
+		return body
+	}
+
+	active := introspect(tokens["access_token"].(string))
+	assert.Equal(t, true, active["active"])
+	assert.Equal(t, "images:read", active["scope"])
+	assert.Equal(t, env.user.ID.Hex(), active["sub"])
+	assert.Equal(t, "Bearer", active["token_type"])
+	assert.Equal(t, true, introspect(tokens["refresh_token"].(string))["active"])
+	// Tokens of other clients are not disclosed
+	assert.Equal(t, map[string]interface{}{"active": false}, introspect(publicTokens["access_token"].(string)))
+
+	status, _ = formRequest(t, env.app, "/oauth2/revoke", url.Values{"token": {tokens["access_token"].(string)}}, clientID, secret)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, false, introspect(tokens["refresh_token"].(string))["active"])
+
+	// Unknown tokens are accepted without revealing anything
+	status, _ = formRequest(t, env.app, "/oauth2/revoke", url.Values{"token": {"unknown"}}, clientID, secret)
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestOAuthServer_DeleteClientRevokesGrants(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	clientID, secret := env.register(t, OAuthClientConfidential)
+	status, _ := env.exchange(t, clientID, secret, env.authorize(t, clientID, testVerifier), testVerifier)
+	require.Equal(t, fiber.StatusOK, status)
+
+	status, _ = apiKeyRequest(t, env.app, fiber.MethodPost, "/oauth2/clients/"+clientID+"/delete", "someone-else", "")
+	assert.Equal(t, fiber.StatusNotFound, status)
+	assert.True(t, (*env.sessions)[0].IsActive)
+
+	status, _ = apiKeyRequest(t, env.app, fiber.MethodPost, "/oauth2/clients/"+clientID+"/delete", env.user.ID.Hex(), "")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.False(t, (*env.sessions)[0].IsActive)
+	assert.Empty(t, env.clients.clients)
+}
+
+func TestOAuthServer_CreateClientValidation(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	for input, message := range map[string]string{
+		`{"name":"","type":"public","redirect_uris":["https://a.example/cb"],"scopes":["images:read"]}`:         ErrInvalidClientName,
+		`{"name":"App","type":"native","redirect_uris":["https://a.example/cb"],"scopes":["images:read"]}`:      ErrInvalidClientType,
+		`{"name":"App","type":"public","redirect_uris":["http://a.example/cb"],"scopes":["images:read"]}`:       ErrInvalidRedirectURIs,
+		`{"name":"App","type":"public","redirect_uris":["https://a.example/cb#frag"],"scopes":["images:read"]}`: ErrInvalidRedirectURIs,
+		`{"name":"App","type":"public","redirect_uris":["https://a.example/cb"],"scopes":["auth:write"]}`:       ErrInvalidClientScopes,
+		`{"name":"App","type":"public","redirect_uris":["https://a.example/cb"],"scopes":[]}`:                   ErrInvalidClientScopes,
+	} {
+		status, body := apiKeyRequest(t, env.app, fiber.MethodPost, "/oauth2/clients", env.user.ID.Hex(), input)
+		assert.Equal(t, fiber.StatusBadRequest, status, input)
+		assert.Equal(t, message, body["message"], input)
+	}
+
+	status, body := apiKeyRequest(t, env.app, fiber.MethodPost, "/oauth2/clients", env.user.ID.Hex(),
+		`{"name":"CLI","type":"public","redirect_uris":["http://127.0.0.1:8765/cb"],"scopes":["pdfs:read"]}`)
+	require.Equal(t, fiber.StatusCreated, status)
+	assert.NotContains(t, body["data"], "client_secret")
+}
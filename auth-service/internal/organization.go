@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Organization member roles, from most to least privileged
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var OrgRoles = []string{OrgRoleOwner, OrgRoleAdmin, OrgRoleMember}
+
+const orgNameMaxLength = 64
+
+// Organization is a shared workspace. Its members share processing history, outputs and API keys.
+type Organization struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	CreatedBy string             `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// OrgMember is the membership of a user in an organization
+type OrgMember struct {
+	ID       primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	OrgID    string             `json:"org_id" bson:"org_id"`
+	UserID   string             `json:"user_id" bson:"user_id"`
+	Role     string             `json:"role" bson:"role"`
+	JoinedAt time.Time          `json:"joined_at" bson:"joined_at"`
+}
+
+// OrgInvitation invites an email address to join an organization. Only the hash of its token is stored.
+type OrgInvitation struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OrgID     string             `json:"org_id" bson:"org_id"`
+	Email     string             `json:"email" bson:"email"`
+	Role      string             `json:"role" bson:"role"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	InvitedBy string             `json:"invited_by" bson:"invited_by"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+// OrgMembership is an organization as listed to one of its members
+type OrgMembership struct {
+	Organization
+	Role   string `json:"role"`
+	Active bool   `json:"active"`
+}
+
+// OrgMemberInfo is a member as listed to the other members
+type OrgMemberInfo struct {
+	UserID      string    `json:"user_id"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"display_name"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+// ValidOrgRole reports whether role is a known organization role
+func ValidOrgRole(role string) bool {
+	for _, known := range OrgRoles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+// orgRoleRank orders roles so that a higher rank grants more
+func orgRoleRank(role string) int {
+	switch role {
+	case OrgRoleOwner:
+		return 3
+	case OrgRoleAdmin:
+		return 2
+	case OrgRoleMember:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// HasOrgRole reports whether role grants at least the permissions of required
+func HasOrgRole(role string, required string) bool {
+	return orgRoleRank(role) >= orgRoleRank(required)
+}
+
+// NewOrgInvitation creates an invitation and returns it with its token, which is only emailed
+func NewOrgInvitation(orgID, email, role, invitedBy string, ttl time.Duration) (*OrgInvitation, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	return &OrgInvitation{
+		ID:        primitive.NewObjectID(),
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		TokenHash: HashOrgInvitationToken(token),
+		InvitedBy: invitedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, token, nil
+}
+
+// HashOrgInvitationToken returns the SHA256 hex digest under which an invitation token is stored
+func HashOrgInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsExpired reports whether the invitation can no longer be accepted
+func (i *OrgInvitation) IsExpired() bool {
+	return !time.Now().UTC().Before(i.ExpiresAt)
+}
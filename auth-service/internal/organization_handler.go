@@ -0,0 +1,905 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrganizationHandler manages organizations, their members and invitations, and switches the
+// organization a session acts in. Access tokens carry the active organization as org_id and org_role.
+type OrganizationHandler struct {
+	users   *UserHandler
+	orgRepo IOrganizationRepository
+	apiKeys *APIKeyHandler
+}
+
+func NewOrganizationHandler(users *UserHandler, orgRepo IOrganizationRepository, apiKeys *APIKeyHandler) *OrganizationHandler {
+	return &OrganizationHandler{
+		users:   users,
+		orgRepo: orgRepo,
+		apiKeys: apiKeys,
+	}
+}
+
+func orgNotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"message": ErrOrgNotFound,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+func orgRoleTooLow(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message": ErrOrgRoleTooLow,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// membership returns the authenticated user's membership in the organization of the request path,
+// or nil if they are not a member. Non-members are told the organization does not exist.
+func (h *OrganizationHandler) membership(c *fiber.Ctx) *OrgMember {
+	userId, _ := c.Locals("userId").(string)
+	return h.orgRepo.FindMembership(c.Params("orgId"), userId)
+}
+
+func normalizeOrgName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, name != "" && utf8.RuneCountInString(name) <= orgNameMaxLength
+}
+
+// CreateOrganization creates an organization owned by the authenticated user
+func (h *OrganizationHandler) CreateOrganization(c *fiber.Ctx) error {
+	log.Info("CreateOrganization: Creating organization")
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	name, ok := normalizeOrgName(input.Name)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidOrgName,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	now := time.Now().UTC()
+	org := &Organization{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		CreatedBy: userId,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	owner := &OrgMember{OrgID: org.ID.Hex(), UserID: userId, Role: OrgRoleOwner, JoinedAt: now}
+	if err := h.orgRepo.CreateOrganization(org, owner); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.users.audit(c, AuditOrgCreated, AuditResultSuccess, userId, "", map[string]string{"org_id": org.ID.Hex()})
+
+	log.Infof("CreateOrganization: Organization %s created by user %s", org.ID.Hex(), userId)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Organization created",
+		"errors":  nil,
+		"data":    fiber.Map{"organization": OrgMembership{Organization: *org, Role: OrgRoleOwner}},
+	})
+}
+
+// GetOrganizations lists the organizations of the authenticated user with their role, marking the
+// one the current session acts in
+func (h *OrganizationHandler) GetOrganizations(c *fiber.Ctx) error {
+	userId, _ := c.Locals("userId").(string)
+	sessionId, _ := c.Locals("sessionId").(string)
+
+	members, err := h.orgRepo.FindMembershipsByUserID(userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	roles := map[string]string{}
+	orgIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		roles[member.OrgID] = member.Role
+		orgIDs = append(orgIDs, member.OrgID)
+	}
+	orgs, err := h.orgRepo.FindOrganizations(orgIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	activeOrgID := ""
+	if session, _ := h.users.sessionRepo.FindSessionByID(sessionId, userId); session != nil {
+		activeOrgID = session.ActiveOrgID
+	}
+	memberships := make([]OrgMembership, 0, len(orgs))
+	for _, org := range orgs {
+		memberships = append(memberships, OrgMembership{
+			Organization: org,
+			Role:         roles[org.ID.Hex()],
+			Active:       org.ID.Hex() == activeOrgID,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Organizations retrieved successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"organizations": memberships},
+	})
+}
+
+// GetOrganization returns an organization with its members
+func (h *OrganizationHandler) GetOrganization(c *fiber.Ctx) error {
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+	org := h.orgRepo.FindOrganization(member.OrgID)
+	if org == nil {
+		return orgNotFound(c)
+	}
+	members, err := h.orgRepo.FindMembers(member.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	infos := make([]OrgMemberInfo, 0, len(members))
+	for _, m := range members {
+		info := OrgMemberInfo{UserID: m.UserID, Role: m.Role, JoinedAt: m.JoinedAt}
+		if user := h.users.userRepo.FindByID(m.UserID); user != nil && !user.ID.IsZero() {
+			info.Email = user.Email
+			info.DisplayName = user.DisplayName
+		}
+		infos = append(infos, info)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Organization retrieved successfully",
+		"errors":  nil,
+		"data": fiber.Map{
+			"organization": OrgMembership{Organization: *org, Role: member.Role},
+			"members":      infos,
+		},
+	})
+}
+
+// RenameOrganization changes the name of an organization. Admins and owners only.
+func (h *OrganizationHandler) RenameOrganization(c *fiber.Ctx) error {
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+	if !HasOrgRole(member.Role, OrgRoleAdmin) {
+		return orgRoleTooLow(c)
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	name, ok := normalizeOrgName(input.Name)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidOrgName,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.orgRepo.RenameOrganization(member.OrgID, name); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Organization renamed",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// DeleteOrganization deletes an organization, its memberships, invitations and shared API keys.
+// Sessions that acted in it are revoked. Owners only.
+func (h *OrganizationHandler) DeleteOrganization(c *fiber.Ctx) error {
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+	if !HasOrgRole(member.Role, OrgRoleOwner) {
+		return orgRoleTooLow(c)
+	}
+
+	h.deleteOrgKeys(member.OrgID, "")
+	h.revokeOrgSessions(member.OrgID, "")
+	if err := h.users.sessionRepo.ClearSessionOrg(member.OrgID); err != nil {
+		log.Errorf("DeleteOrganization: Failed to switch sessions out of %s: %v", member.OrgID, err)
+	}
+	if err := h.orgRepo.DeleteOrganization(member.OrgID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.users.audit(c, AuditOrgDeleted, AuditResultSuccess, member.UserID, "", map[string]string{"org_id": member.OrgID})
+
+	log.Infof("DeleteOrganization: Organization %s deleted by user %s", member.OrgID, member.UserID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Organization deleted",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// GetInvitations lists the pending invitations of an organization. Admins and owners only.
+func (h *OrganizationHandler) GetInvitations(c *fiber.Ctx) error {
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+	if !HasOrgRole(member.Role, OrgRoleAdmin) {
+		return orgRoleTooLow(c)
+	}
+
+	invitations, err := h.orgRepo.FindInvitations(member.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Invitations retrieved successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"invitations": invitations},
+	})
+}
+
+// InviteMember emails an invitation to join the organization. Admins invite admins and members;
+// only owners invite owners.
+func (h *OrganizationHandler) InviteMember(c *fiber.Ctx) error {
+	log.Info("InviteMember: Inviting organization member")
+
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+	if !HasOrgRole(member.Role, OrgRoleAdmin) {
+		return orgRoleTooLow(c)
+	}
+
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	if !emailPattern.MatchString(email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidEmail,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if input.Role == "" {
+		input.Role = OrgRoleMember
+	}
+	if !ValidOrgRole(input.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidOrgRole,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !HasOrgRole(member.Role, input.Role) {
+		return orgRoleTooLow(c)
+	}
+
+	invitee := h.users.userRepo.FindByEmail(email)
+	if invitee != nil && !invitee.ID.IsZero() && h.orgRepo.FindMembership(member.OrgID, invitee.ID.Hex()) != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": ErrAlreadyOrgMember,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	org := h.orgRepo.FindOrganization(member.OrgID)
+	if org == nil {
+		return orgNotFound(c)
+	}
+
+	ttl := time.Duration(h.users.cfg.OrgInvitationExpiryDays) * 24 * time.Hour
+	invitation, token, err := NewOrgInvitation(member.OrgID, email, input.Role, member.UserID, ttl)
+	if err == nil {
+		err = h.orgRepo.CreateInvitation(invitation)
+	}
+	if err != nil {
+		log.Errorf("InviteMember: Failed to create invitation: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	inviterName, locale := "", ""
+	if inviter := h.users.userRepo.FindByID(member.UserID); inviter != nil {
+		inviterName = inviter.DisplayName
+		if inviterName == "" {
+			inviterName = inviter.Email
+		}
+	}
+	if invitee != nil {
+		locale = invitee.Locale
+	}
+	if err := h.users.mailer.Send(email, locale, MailOrgInvitation, OrgInvitationMail{
+		OrgName:     org.Name,
+		InvitedBy:   inviterName,
+		Role:        input.Role,
+		URL:         h.invitationURL(token),
+		ExpiresDays: h.users.cfg.OrgInvitationExpiryDays,
+	}); err != nil {
+		log.Errorf("InviteMember: Failed to email invitation %s: %v", invitation.ID.Hex(), err)
+	}
+	h.users.audit(c, AuditOrgInvited, AuditResultSuccess, member.UserID, "", map[string]string{
+		"org_id": member.OrgID,
+		"email":  email,
+		"role":   input.Role,
+	})
+
+	log.Infof("InviteMember: Invitation %s sent for organization %s", invitation.ID.Hex(), member.OrgID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Invitation sent",
+		"errors":  nil,
+		"data":    fiber.Map{"invitation": invitation},
+	})
+}
+
+// invitationURL is the web page behind an emailed invitation
+func (h *OrganizationHandler) invitationURL(token string) string {
+	return h.users.cfg.WebUrl + "/orgs/join?token=" + url.QueryEscape(token)
+}
+
+// RevokeInvitation cancels a pending invitation. Admins and owners only.
+func (h *OrganizationHandler) RevokeInvitation(c *fiber.Ctx) error {
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+	if !HasOrgRole(member.Role, OrgRoleAdmin) {
+		return orgRoleTooLow(c)
+	}
+
+	deleted, err := h.orgRepo.DeleteInvitation(member.OrgID, c.Params("invitationId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrInvitationNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Invitation revoked",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// AcceptInvitation adds the authenticated user to the organization of an invitation sent to their
+// email address. An invitation is used once.
+func (h *OrganizationHandler) AcceptInvitation(c *fiber.Ctx) error {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	invitation := h.orgRepo.FindInvitationByToken(HashOrgInvitationToken(input.Token))
+	if invitation == nil || invitation.IsExpired() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidInvitation,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	user := h.users.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return profileUserNotFound(c)
+	}
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": ErrInvitationEmailMismatch,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	org := h.orgRepo.FindOrganization(invitation.OrgID)
+	deleted, err := h.orgRepo.DeleteInvitation(invitation.OrgID, invitation.ID.Hex())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !deleted || org == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidInvitation,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	err = h.orgRepo.AddMember(&OrgMember{
+		OrgID:    invitation.OrgID,
+		UserID:   userId,
+		Role:     invitation.Role,
+		JoinedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	member := h.orgRepo.FindMembership(invitation.OrgID, userId)
+	if member == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.users.audit(c, AuditOrgJoined, AuditResultSuccess, userId, "", map[string]string{
+		"org_id": invitation.OrgID,
+		"role":   member.Role,
+	})
+
+	log.Infof("AcceptInvitation: User %s joined organization %s", userId, invitation.OrgID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Invitation accepted",
+		"errors":  nil,
+		"data":    fiber.Map{"organization": OrgMembership{Organization: *org, Role: member.Role}},
+	})
+}
+
+// targetMember loads the member named in the request path for an admin or owner acting on them.
+// Acting on an owner, or making someone an owner, takes an owner.
+func (h *OrganizationHandler) targetMember(c *fiber.Ctx, actor *OrgMember, newRole string) (*OrgMember, error) {
+	target := h.orgRepo.FindMembership(actor.OrgID, c.Params("userId"))
+	if target == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrOrgMemberNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !HasOrgRole(actor.Role, OrgRoleAdmin) || !HasOrgRole(actor.Role, target.Role) || !HasOrgRole(actor.Role, newRole) {
+		return nil, orgRoleTooLow(c)
+	}
+	return target, nil
+}
+
+// keepsOwner reports whether the organization still has an owner once target stops being one
+func (h *OrganizationHandler) keepsOwner(target *OrgMember, newRole string) (bool, error) {
+	if target.Role != OrgRoleOwner || newRole == OrgRoleOwner {
+		return true, nil
+	}
+	owners, err := h.orgRepo.CountOwners(target.OrgID)
+	return owners > 1, err
+}
+
+// SetMemberRole changes the role of a member. Sessions of the member acting in the organization
+// get the new role with their next access token.
+func (h *OrganizationHandler) SetMemberRole(c *fiber.Ctx) error {
+	actor := h.membership(c)
+	if actor == nil {
+		return orgNotFound(c)
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !ValidOrgRole(input.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidOrgRole,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	target, errResponse := h.targetMember(c, actor, input.Role)
+	if target == nil {
+		return errResponse
+	}
+	if ok, err := h.keepsOwner(target, input.Role); err != nil || !ok {
+		return lastOwner(c, err)
+	}
+
+	if err := h.orgRepo.SetMemberRole(target.OrgID, target.UserID, input.Role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	// Access tokens already issued keep the previous role, so a demoted member is signed out of the
+	// sessions that acted in the organization. A promotion applies from the next refresh.
+	if orgRoleRank(input.Role) < orgRoleRank(target.Role) {
+		h.revokeOrgSessions(target.OrgID, target.UserID)
+	} else if err := h.users.sessionRepo.UpdateSessionOrgRole(target.UserID, target.OrgID, input.Role); err != nil {
+		log.Errorf("SetMemberRole: Failed to update sessions of user %s: %v", target.UserID, err)
+	}
+	h.users.audit(c, AuditOrgRoleChanged, AuditResultSuccess, actor.UserID, "", map[string]string{
+		"org_id":   target.OrgID,
+		"member":   target.UserID,
+		"previous": target.Role,
+		"role":     input.Role,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Member role updated",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+func lastOwner(c *fiber.Ctx, err error) error {
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"message": ErrOrgLastOwner,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// RemoveMember removes a member from the organization, or lets a member leave it. The API keys
+// the member shared with the organization and their sessions that acted in it are revoked.
+func (h *OrganizationHandler) RemoveMember(c *fiber.Ctx) error {
+	actor := h.membership(c)
+	if actor == nil {
+		return orgNotFound(c)
+	}
+
+	target := actor
+	if c.Params("userId") != actor.UserID {
+		var errResponse error
+		if target, errResponse = h.targetMember(c, actor, ""); target == nil {
+			return errResponse
+		}
+	}
+	if ok, err := h.keepsOwner(target, ""); err != nil || !ok {
+		return lastOwner(c, err)
+	}
+
+	if err := h.removeMember(target); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.users.audit(c, AuditOrgMemberRemoved, AuditResultSuccess, actor.UserID, "", map[string]string{
+		"org_id": target.OrgID,
+		"member": target.UserID,
+	})
+
+	log.Infof("RemoveMember: User %s removed from organization %s", target.UserID, target.OrgID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Member removed",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+func (h *OrganizationHandler) removeMember(member *OrgMember) error {
+	if err := h.orgRepo.RemoveMember(member.OrgID, member.UserID); err != nil {
+		return err
+	}
+	h.deleteOrgKeys(member.OrgID, member.UserID)
+	h.revokeOrgSessions(member.OrgID, member.UserID)
+	return nil
+}
+
+// revokeOrgSessions signs out the sessions that acted in the organization, only those of userID when
+// it is set. Their access tokens carry the organization's claims until they expire, so the revocation
+// is broadcast for the gateway to reject them at once.
+func (h *OrganizationHandler) revokeOrgSessions(orgID string, userID string) {
+	sessions, err := h.users.sessionRepo.FindOrgSessions(orgID, userID)
+	if err != nil {
+		return
+	}
+
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		if err := h.users.sessionRepo.DeactivateSession(session.SessionID); err != nil {
+			log.Errorf("revokeOrgSessions: Failed to revoke session %s: %v", session.SessionID, err)
+			continue
+		}
+		sessionIDs = append(sessionIDs, session.SessionID)
+	}
+	h.users.publishRevocations(sessionIDs)
+}
+
+// deleteOrgKeys revokes the organization's API keys, only those created by userID when it is set
+func (h *OrganizationHandler) deleteOrgKeys(orgID string, userID string) {
+	keys, err := h.apiKeys.apiKeyRepo.FindAPIKeysByOrgID(orgID)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if userID != "" && key.UserID != userID {
+			continue
+		}
+		if deleted, err := h.apiKeys.apiKeyRepo.DeleteOrgAPIKey(key.ID.Hex(), orgID); err == nil && deleted != nil {
+			h.apiKeys.publishRevocation(deleted.KeyHash)
+		}
+	}
+}
+
+// SwitchOrganization makes the current session act in an organization, or in the personal
+// workspace when org_id is empty, and returns an access token carrying it. Refreshed access
+// tokens keep the organization.
+func (h *OrganizationHandler) SwitchOrganization(c *fiber.Ctx) error {
+	var input struct {
+		OrgID string `json:"org_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	sessionId, _ := c.Locals("sessionId").(string)
+	role := ""
+	if input.OrgID != "" {
+		member := h.orgRepo.FindMembership(input.OrgID, userId)
+		if member == nil {
+			return orgNotFound(c)
+		}
+		role = member.Role
+	}
+
+	user := h.users.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return profileUserNotFound(c)
+	}
+	session, err := h.users.sessionRepo.FindSessionByID(sessionId, userId)
+	if err != nil || session == nil || !session.IsActive {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrInvalidToken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if err := h.users.sessionRepo.SetSessionOrg(sessionId, input.OrgID, role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	session.ActiveOrgID, session.ActiveOrgRole = input.OrgID, role
+
+	accessToken, err := h.users.generateAccessToken(userId, user.RoleList(), session)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.users.audit(c, AuditOrgSwitched, AuditResultSuccess, userId, sessionId, map[string]string{"org_id": input.OrgID})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Organization switched",
+		"errors":  nil,
+		"data": fiber.Map{
+			"access_token": accessToken,
+			"org_id":       input.OrgID,
+			"org_role":     role,
+		},
+	})
+}
+
+// GetOrgAPIKeys lists the API keys shared by an organization
+func (h *OrganizationHandler) GetOrgAPIKeys(c *fiber.Ctx) error {
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+
+	keys, err := h.apiKeys.apiKeyRepo.FindAPIKeysByOrgID(member.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API keys retrieved successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"api_keys": keys},
+	})
+}
+
+// CreateOrgAPIKey issues an API key acting in the organization. Admins and owners only.
+func (h *OrganizationHandler) CreateOrgAPIKey(c *fiber.Ctx) error {
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+	if !HasOrgRole(member.Role, OrgRoleAdmin) {
+		return orgRoleTooLow(c)
+	}
+	return h.apiKeys.createAPIKey(c, member.OrgID)
+}
+
+// RevokeOrgAPIKey deletes an API key of the organization. Admins and owners only.
+func (h *OrganizationHandler) RevokeOrgAPIKey(c *fiber.Ctx) error {
+	member := h.membership(c)
+	if member == nil {
+		return orgNotFound(c)
+	}
+	if !HasOrgRole(member.Role, OrgRoleAdmin) {
+		return orgRoleTooLow(c)
+	}
+
+	key, err := h.apiKeys.apiKeyRepo.DeleteOrgAPIKey(c.Params("keyId"), member.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if key == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrAPIKeyNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.apiKeys.publishRevocation(key.KeyHash)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API key revoked successfully",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// AccountDeletedMessage removes a purged user from their organizations. When they were the last
+// owner, the longest-standing admin, or else member, takes over; an organization left without
+// members is deleted.
+func (h *OrganizationHandler) AccountDeletedMessage(data []byte) {
+	var event AccountDeletion
+	if err := json.Unmarshal(data, &event); err != nil || event.UserID == "" {
+		log.Errorf("AccountDeletedMessage: Invalid account deletion event: %v", err)
+		return
+	}
+
+	memberships, err := h.orgRepo.FindMembershipsByUserID(event.UserID)
+	if err != nil {
+		return
+	}
+	for i := range memberships {
+		membership := &memberships[i]
+		if err := h.removeMember(membership); err != nil {
+			continue
+		}
+		if membership.Role == OrgRoleOwner {
+			h.handOver(membership.OrgID)
+		}
+	}
+}
+
+// handOver makes sure an organization whose owner left still has one
+func (h *OrganizationHandler) handOver(orgID string) {
+	if owners, err := h.orgRepo.CountOwners(orgID); err != nil || owners > 0 {
+		return
+	}
+	members, err := h.orgRepo.FindMembers(orgID)
+	if err != nil {
+		return
+	}
+	if len(members) == 0 {
+		if err := h.orgRepo.DeleteOrganization(orgID); err == nil {
+			h.deleteOrgKeys(orgID, "")
+			h.revokeOrgSessions(orgID, "")
+			_ = h.users.sessionRepo.ClearSessionOrg(orgID)
+		}
+		return
+	}
+
+	successor := members[0]
+	for _, m := range members {
+		if m.Role == OrgRoleAdmin {
+			successor = m
+			break
+		}
+	}
+	if err := h.orgRepo.SetMemberRole(orgID, successor.UserID, OrgRoleOwner); err == nil {
+		_ = h.users.sessionRepo.UpdateSessionOrgRole(successor.UserID, orgID, OrgRoleOwner)
+		log.Infof("handOver: User %s now owns organization %s", successor.UserID, orgID)
+	}
+}
@@ -0,0 +1,557 @@
+package internal
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryOrgs is an in-memory IOrganizationRepository
+type memoryOrgs struct {
+	orgs        []Organization
+	members     []OrgMember
+	invitations []OrgInvitation
+}
+
+func (m *memoryOrgs) CreateOrganization(org *Organization, owner *OrgMember) error {
+	m.orgs = append(m.orgs, *org)
+	return m.AddMember(owner)
+}
+
+func (m *memoryOrgs) FindOrganization(orgID string) *Organization {
+	for i := range m.orgs {
+		if m.orgs[i].ID.Hex() == orgID {
+			org := m.orgs[i]
+			return &org
+		}
+	}
+	return nil
+}
+
+func (m *memoryOrgs) FindOrganizations(orgIDs []string) ([]Organization, error) {
+	out := []Organization{}
+	for _, id := range orgIDs {
+		if org := m.FindOrganization(id); org != nil {
+			out = append(out, *org)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryOrgs) RenameOrganization(orgID string, name string) error {
+	for i := range m.orgs {
+		if m.orgs[i].ID.Hex() == orgID {
+			m.orgs[i].Name = name
+		}
+	}
+	return nil
+}
+
+func (m *memoryOrgs) DeleteOrganization(orgID string) error {
+	orgs := m.orgs[:0]
+	for _, org := range m.orgs {
+		if org.ID.Hex() != orgID {
+			orgs = append(orgs, org)
+		}
+	}
+	m.orgs = orgs
+	members := m.members[:0]
+	for _, member := range m.members {
+		if member.OrgID != orgID {
+			members = append(members, member)
+		}
+	}
+	m.members = members
+	return nil
+}
+
+func (m *memoryOrgs) FindMembership(orgID string, userID string) *OrgMember {
+	for i := range m.members {
+		if m.members[i].OrgID == orgID && m.members[i].UserID == userID {
+			member := m.members[i]
+			return &member
+		}
+	}
+	return nil
+}
+
+func (m *memoryOrgs) FindMembershipsByUserID(userID string) ([]OrgMember, error) {
+	out := []OrgMember{}
+	for _, member := range m.members {
+		if member.UserID == userID {
+			out = append(out, member)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryOrgs) FindMembers(orgID string) ([]OrgMember, error) {
+	out := []OrgMember{}
+	for _, member := range m.members {
+		if member.OrgID == orgID {
+			out = append(out, member)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryOrgs) AddMember(member *OrgMember) error {
+	if m.FindMembership(member.OrgID, member.UserID) == nil {
+		m.members = append(m.members, *member)
+	}
+	return nil
+}
+
+func (m *memoryOrgs) SetMemberRole(orgID string, userID string, role string) error {
+	for i := range m.members {
+		if m.members[i].OrgID == orgID && m.members[i].UserID == userID {
+			m.members[i].Role = role
+		}
+	}
+	return nil
+}
+
+func (m *memoryOrgs) RemoveMember(orgID string, userID string) error {
+	members := m.members[:0]
+	for _, member := range m.members {
+		if member.OrgID != orgID || member.UserID != userID {
+			members = append(members, member)
+		}
+	}
+	m.members = members
+	return nil
+}
+
+func (m *memoryOrgs) CountOwners(orgID string) (int64, error) {
+	var owners int64
+	for _, member := range m.members {
+		if member.OrgID == orgID && member.Role == OrgRoleOwner {
+			owners++
+		}
+	}
+	return owners, nil
+}
+
+func (m *memoryOrgs) CreateInvitation(invitation *OrgInvitation) error {
+	m.invitations = append(m.invitations, *invitation)
+	return nil
+}
+
+func (m *memoryOrgs) FindInvitations(orgID string) ([]OrgInvitation, error) {
+	out := []OrgInvitation{}
+	for _, invitation := range m.invitations {
+		if invitation.OrgID == orgID && !invitation.IsExpired() {
+			out = append(out, invitation)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryOrgs) FindInvitationByToken(tokenHash string) *OrgInvitation {
+	for i := range m.invitations {
+		if m.invitations[i].TokenHash == tokenHash {
+			invitation := m.invitations[i]
+			return &invitation
+		}
+	}
+	return nil
+}
+
+func (m *memoryOrgs) DeleteInvitation(orgID string, invitationID string) (bool, error) {
+	for i, invitation := range m.invitations {
+		if invitation.OrgID == orgID && invitation.ID.Hex() == invitationID {
+			m.invitations = append(m.invitations[:i], m.invitations[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type orgTestEnv struct {
+	app       *fiber.App
+	handler   *OrganizationHandler
+	orgs      *memoryOrgs
+	keys      *memoryAPIKeys
+	users     map[string]*User
+	sessions  map[string]*UserSession
+	transport *MemoryTransport
+	audit     *memoryAuditLog
+	events    *recordingPublisher
+}
+
+// newOrgTestEnv serves the organization routes for the given users. Requests act as the
+// X-Test-User header, in a session named after the user.
+func newOrgTestEnv(t *testing.T, emails ...string) *orgTestEnv {
+	t.Helper()
+	env := &orgTestEnv{
+		orgs:      &memoryOrgs{},
+		keys:      &memoryAPIKeys{},
+		users:     map[string]*User{},
+		sessions:  map[string]*UserSession{},
+		transport: &MemoryTransport{},
+		audit:     &memoryAuditLog{},
+		events:    &recordingPublisher{},
+	}
+	for _, email := range emails {
+		user := NewUser(email)
+		env.users[user.ID.Hex()] = user
+		env.sessions[user.ID.Hex()] = &UserSession{UserID: user.ID.Hex(), SessionID: user.ID.Hex(), IsActive: true}
+	}
+
+	userRepo := &MockUserRepository{
+		FindByIDFunc: func(id string) *User { return env.users[id] },
+		FindByEmailFunc: func(email string) *User {
+			for _, user := range env.users {
+				if user.Email == email {
+					return user
+				}
+			}
+			return nil
+		},
+	}
+	sessionRepo := &MockSessionRepository{
+		FindSessionByIDFunc: func(sessionID string, userID string) (*UserSession, error) {
+			if session := env.sessions[userID]; session != nil && session.SessionID == sessionID {
+				copied := *session
+				return &copied, nil
+			}
+			return nil, nil
+		},
+		SetSessionOrgFunc: func(sessionID string, orgID string, role string) error {
+			for _, session := range env.sessions {
+				if session.SessionID == sessionID {
+					session.ActiveOrgID, session.ActiveOrgRole = orgID, role
+					if orgID != "" {
+						session.OrgIDs = append(session.OrgIDs, orgID)
+					}
+				}
+			}
+			return nil
+		},
+		UpdateSessionOrgRoleFunc: func(userID string, orgID string, role string) error {
+			if session := env.sessions[userID]; session != nil && session.ActiveOrgID == orgID {
+				if role == "" {
+					orgID = ""
+				}
+				session.ActiveOrgID, session.ActiveOrgRole = orgID, role
+			}
+			return nil
+		},
+		FindOrgSessionsFunc: func(orgID string, userID string) ([]UserSession, error) {
+			var sessions []UserSession
+			for _, session := range env.sessions {
+				if session.IsActive && slices.Contains(session.OrgIDs, orgID) && (userID == "" || session.UserID == userID) {
+					sessions = append(sessions, *session)
+				}
+			}
+			return sessions, nil
+		},
+		DeactivateSessionFunc: func(sessionID string) error {
+			for _, session := range env.sessions {
+				if session.SessionID == sessionID {
+					session.IsActive = false
+				}
+			}
+			return nil
+		},
+		ClearSessionOrgFunc: func(orgID string) error {
+			for _, session := range env.sessions {
+				if session.ActiveOrgID == orgID {
+					session.ActiveOrgID, session.ActiveOrgRole = "", ""
+				}
+			}
+			return nil
+		},
+	}
+
+	cfg := newMockConfig()
+	mailer, err := NewMailer(cfg, env.transport)
+	require.NoError(t, err)
+	go mailer.Run()
+	keys := newMockKeyManager()
+	users := NewUserHandler(cfg, userRepo, sessionRepo, keys, NewMemoryAttemptStore(), env.audit, env.events, mailer)
+	apiKeys := NewAPIKeyHandler(cfg, env.keys, userRepo, &recordingPublisher{})
+	env.handler = NewOrganizationHandler(users, env.orgs, apiKeys)
+
+	// Requests arrive as the gateway forwards them: each test user's session ID is their user ID
+	gatewayToken := serviceToken(t, keys, "gateway-service")
+	env.app = fiber.New()
+	env.app.Use(func(c *fiber.Ctx) error {
+		if user := c.Get("X-Test-User"); user != "" {
+			c.Request().Header.Set("x-user-id", user)
+			c.Request().Header.Set("x-session-id", user)
+			c.Request().Header.Set(ServiceTokenHeader, gatewayToken)
+		}
+		return c.Next()
+	})
+	SetupServiceIdentity(env.app, keys.Keyfunc, []string{"gateway-service"})
+	// Stands in for initx.SetupAuthenticated
+	env.app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("x-user-id")))
+		return c.Next()
+	})
+	env.app.Get("/orgs", env.handler.GetOrganizations)
+	env.app.Post("/orgs", env.handler.CreateOrganization)
+	env.app.Post("/orgs/switch", env.handler.SwitchOrganization)
+	env.app.Post("/orgs/invitations/accept", env.handler.AcceptInvitation)
+	env.app.Get("/orgs/:orgId", env.handler.GetOrganization)
+	env.app.Post("/orgs/:orgId/delete", env.handler.DeleteOrganization)
+	env.app.Post("/orgs/:orgId/invitations", env.handler.InviteMember)
+	env.app.Post("/orgs/:orgId/members/:userId/role", env.handler.SetMemberRole)
+	env.app.Post("/orgs/:orgId/members/:userId/remove", env.handler.RemoveMember)
+	env.app.Post("/orgs/:orgId/api-keys", env.handler.CreateOrgAPIKey)
+	return env
+}
+
+func (env *orgTestEnv) userID(email string) string {
+	for id, user := range env.users {
+		if user.Email == email {
+			return id
+		}
+	}
+	return ""
+}
+
+func (env *orgTestEnv) request(t *testing.T, method, path, email, body string) (int, map[string]interface{}) {
+	t.Helper()
+	return apiKeyRequest(t, env.app, method, path, env.userID(email), body)
+}
+
+// createOrg creates an organization owned by email and returns its ID
+func (env *orgTestEnv) createOrg(t *testing.T, email string) string {
+	t.Helper()
+	status, body := env.request(t, fiber.MethodPost, "/orgs", email, `{"name":" Acme "}`)
+	require.Equal(t, fiber.StatusCreated, status)
+	org := body["data"].(map[string]interface{})["organization"].(map[string]interface{})
+	assert.Equal(t, "Acme", org["name"])
+	assert.Equal(t, OrgRoleOwner, org["role"])
+	return org["id"].(string)
+}
+
+var invitationTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_%-]+)`)
+
+// invite invites email to the organization as role and returns the emailed token
+func (env *orgTestEnv) invite(t *testing.T, orgID, inviter, email, role string) string {
+	t.Helper()
+	sent := len(env.transport.Messages())
+	status, _ := env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/invitations", inviter, `{"email":"`+email+`","role":"`+role+`"}`)
+	require.Equal(t, fiber.StatusCreated, status)
+
+	require.Eventually(t, func() bool { return len(env.transport.Messages()) > sent }, time.Second, 10*time.Millisecond)
+	msg := env.transport.Messages()[sent]
+	assert.Equal(t, email, msg.To)
+	match := invitationTokenPattern.FindStringSubmatch(msg.Text)
+	require.NotNil(t, match)
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
+
+func (env *orgTestEnv) join(t *testing.T, orgID, inviter, email, role string) {
+	t.Helper()
+	token := env.invite(t, orgID, inviter, email, role)
+	status, _ := env.request(t, fiber.MethodPost, "/orgs/invitations/accept", email, `{"token":"`+token+`"}`)
+	require.Equal(t, fiber.StatusOK, status)
+}
+
+func TestOrganization_InviteAndAccept(t *testing.T) {
+	env := newOrgTestEnv(t, "owner@example.com", "bob@example.com", "eve@example.com")
+	orgID := env.createOrg(t, "owner@example.com")
+
+	token := env.invite(t, orgID, "owner@example.com", "bob@example.com", "")
+	assert.Len(t, env.orgs.invitations, 1)
+	assert.NotEqual(t, token, env.orgs.invitations[0].TokenHash, "only the token hash is stored")
+
+	// The invitation only works for the address it was sent to
+	status, body := env.request(t, fiber.MethodPost, "/orgs/invitations/accept", "eve@example.com", `{"token":"`+token+`"}`)
+	assert.Equal(t, fiber.StatusForbidden, status)
+	assert.Equal(t, ErrInvitationEmailMismatch, body["message"])
+
+	status, body = env.request(t, fiber.MethodPost, "/orgs/invitations/accept", "bob@example.com", `{"token":"`+token+`"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, OrgRoleMember, body["data"].(map[string]interface{})["organization"].(map[string]interface{})["role"])
+
+	// and only once
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/invitations/accept", "bob@example.com", `{"token":"`+token+`"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, body = env.request(t, fiber.MethodGet, "/orgs/"+orgID, "bob@example.com", "")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Len(t, body["data"].(map[string]interface{})["members"], 2)
+
+	// Outsiders cannot tell the organization exists
+	status, _ = env.request(t, fiber.MethodGet, "/orgs/"+orgID, "eve@example.com", "")
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	assert.Equal(t, []string{
+		"org.created:success",
+		"org.member_invited:success",
+		"org.member_joined:success",
+	}, env.audit.types())
+}
+
+func TestOrganization_InviteRequiresRole(t *testing.T) {
+	env := newOrgTestEnv(t, "owner@example.com", "admin@example.com", "bob@example.com")
+	orgID := env.createOrg(t, "owner@example.com")
+	env.join(t, orgID, "owner@example.com", "admin@example.com", OrgRoleAdmin)
+	env.join(t, orgID, "owner@example.com", "bob@example.com", OrgRoleMember)
+
+	status, _ := env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/invitations", "bob@example.com", `{"email":"new@example.com"}`)
+	assert.Equal(t, fiber.StatusForbidden, status, "members cannot invite")
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/invitations", "admin@example.com", `{"email":"new@example.com","role":"owner"}`)
+	assert.Equal(t, fiber.StatusForbidden, status, "admins cannot invite owners")
+
+	status, body := env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/invitations", "admin@example.com", `{"email":"bob@example.com"}`)
+	assert.Equal(t, fiber.StatusConflict, status)
+	assert.Equal(t, ErrAlreadyOrgMember, body["message"])
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/invitations", "admin@example.com", `{"email":"new@example.com","role":"guest"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
+
+func TestOrganization_KeepsLastOwner(t *testing.T) {
+	env := newOrgTestEnv(t, "owner@example.com", "admin@example.com")
+	orgID := env.createOrg(t, "owner@example.com")
+	env.join(t, orgID, "owner@example.com", "admin@example.com", OrgRoleAdmin)
+	owner := env.userID("owner@example.com")
+	admin := env.userID("admin@example.com")
+
+	status, body := env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/members/"+owner+"/role", "owner@example.com", `{"role":"member"}`)
+	assert.Equal(t, fiber.StatusConflict, status)
+	assert.Equal(t, ErrOrgLastOwner, body["message"])
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/members/"+owner+"/remove", "owner@example.com", "")
+	assert.Equal(t, fiber.StatusConflict, status, "the last owner cannot leave")
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/members/"+owner+"/remove", "admin@example.com", "")
+	assert.Equal(t, fiber.StatusForbidden, status, "admins cannot remove owners")
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/members/"+admin+"/role", "owner@example.com", `{"role":"owner"}`)
+	require.Equal(t, fiber.StatusOK, status)
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/members/"+owner+"/remove", "owner@example.com", "")
+	assert.Equal(t, fiber.StatusOK, status, "an owner can leave once another owner remains")
+	assert.Nil(t, env.orgs.FindMembership(orgID, owner))
+}
+
+func TestOrganization_SwitchPutsOrgInAccessToken(t *testing.T) {
+	env := newOrgTestEnv(t, "owner@example.com", "eve@example.com")
+	orgID := env.createOrg(t, "owner@example.com")
+	owner := env.userID("owner@example.com")
+
+	status, _ := env.request(t, fiber.MethodPost, "/orgs/switch", "eve@example.com", `{"org_id":"`+orgID+`"}`)
+	assert.Equal(t, fiber.StatusNotFound, status, "non-members cannot switch into an organization")
+
+	status, body := env.request(t, fiber.MethodPost, "/orgs/switch", "owner@example.com", `{"org_id":"`+orgID+`"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(body["data"].(map[string]interface{})["access_token"].(string), claims, env.handler.users.keys.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, orgID, claims["org_id"])
+	assert.Equal(t, OrgRoleOwner, claims["org_role"])
+	assert.Equal(t, orgID, env.sessions[owner].ActiveOrgID, "refreshed tokens keep the organization")
+
+	_, body = env.request(t, fiber.MethodGet, "/orgs", "owner@example.com", "")
+	orgs := body["data"].(map[string]interface{})["organizations"].([]interface{})
+	require.Len(t, orgs, 1)
+	assert.Equal(t, true, orgs[0].(map[string]interface{})["active"])
+
+	status, body = env.request(t, fiber.MethodPost, "/orgs/switch", "owner@example.com", `{"org_id":""}`)
+	require.Equal(t, fiber.StatusOK, status)
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(body["data"].(map[string]interface{})["access_token"].(string), claims, env.handler.users.keys.Keyfunc)
+	require.NoError(t, err)
+	assert.NotContains(t, claims, "org_id")
+}
+
+func TestOrganization_RemoveMemberRevokesTheirKeysAndSessions(t *testing.T) {
+	env := newOrgTestEnv(t, "owner@example.com", "admin@example.com")
+	orgID := env.createOrg(t, "owner@example.com")
+	env.join(t, orgID, "owner@example.com", "admin@example.com", OrgRoleAdmin)
+	admin := env.userID("admin@example.com")
+
+	status, _ := env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/api-keys", "admin@example.com", `{"name":"ci","scopes":["images:read"]}`)
+	require.Equal(t, fiber.StatusCreated, status)
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/api-keys", "owner@example.com", `{"name":"deploy","scopes":["images:read"]}`)
+	require.Equal(t, fiber.StatusCreated, status)
+	require.Len(t, env.keys.keys, 2)
+	assert.Equal(t, orgID, env.keys.keys[0].OrgID)
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/switch", "admin@example.com", `{"org_id":"`+orgID+`"}`)
+	require.Equal(t, fiber.StatusOK, status)
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/members/"+admin+"/remove", "owner@example.com", "")
+	require.Equal(t, fiber.StatusOK, status)
+	require.Len(t, env.keys.keys, 1)
+	assert.Equal(t, "deploy", env.keys.keys[0].Name)
+
+	// Their access tokens still carry the organization, so the session is revoked for the gateway to reject them
+	assert.False(t, env.sessions[admin].IsActive)
+	revoked := revocationsOf(t, env.events)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, admin, revoked[0].SessionID)
+	assert.True(t, env.sessions[env.userID("owner@example.com")].IsActive)
+}
+
+func TestOrganization_DemotionRevokesSessionsInTheOrganization(t *testing.T) {
+	env := newOrgTestEnv(t, "owner@example.com", "admin@example.com", "member@example.com")
+	orgID := env.createOrg(t, "owner@example.com")
+	env.join(t, orgID, "owner@example.com", "admin@example.com", OrgRoleAdmin)
+	env.join(t, orgID, "owner@example.com", "member@example.com", OrgRoleMember)
+	admin, member := env.userID("admin@example.com"), env.userID("member@example.com")
+	for _, email := range []string{"admin@example.com", "member@example.com"} {
+		status, _ := env.request(t, fiber.MethodPost, "/orgs/switch", email, `{"org_id":"`+orgID+`"}`)
+		require.Equal(t, fiber.StatusOK, status)
+	}
+
+	status, _ := env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/members/"+member+"/role", "owner@example.com", `{"role":"admin"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.True(t, env.sessions[member].IsActive, "a promotion applies from the next refresh")
+	assert.Equal(t, OrgRoleAdmin, env.sessions[member].ActiveOrgRole)
+
+	status, _ = env.request(t, fiber.MethodPost, "/orgs/"+orgID+"/members/"+admin+"/role", "owner@example.com", `{"role":"member"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.False(t, env.sessions[admin].IsActive)
+	revoked := revocationsOf(t, env.events)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, admin, revoked[0].SessionID)
+}
+
+func TestOrganization_AccountDeletionHandsOverOwnership(t *testing.T) {
+	env := newOrgTestEnv(t, "owner@example.com", "admin@example.com", "solo@example.com")
+	orgID := env.createOrg(t, "owner@example.com")
+	env.join(t, orgID, "owner@example.com", "admin@example.com", OrgRoleAdmin)
+	soloOrgID := env.createOrg(t, "solo@example.com")
+
+	env.handler.AccountDeletedMessage([]byte(`{"user_id":"` + env.userID("owner@example.com") + `"}`))
+	member := env.orgs.FindMembership(orgID, env.userID("admin@example.com"))
+	require.NotNil(t, member)
+	assert.Equal(t, OrgRoleOwner, member.Role)
+
+	env.handler.AccountDeletedMessage([]byte(`{"user_id":"` + env.userID("solo@example.com") + `"}`))
+	assert.Nil(t, env.orgs.FindOrganization(soloOrgID), "an organization left without members is deleted")
+	assert.NotNil(t, env.orgs.FindOrganization(orgID))
+}
+
+func TestOrgRoles(t *testing.T) {
+	assert.True(t, HasOrgRole(OrgRoleOwner, OrgRoleAdmin))
+	assert.True(t, HasOrgRole(OrgRoleAdmin, OrgRoleAdmin))
+	assert.False(t, HasOrgRole(OrgRoleMember, OrgRoleAdmin))
+	assert.False(t, HasOrgRole("", OrgRoleMember))
+	assert.False(t, ValidOrgRole("guest"))
+
+	invitation, token, err := NewOrgInvitation(primitive.NewObjectID().Hex(), "bob@example.com", OrgRoleMember, "owner", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, HashOrgInvitationToken(token), invitation.TokenHash)
+	assert.False(t, invitation.IsExpired())
+}
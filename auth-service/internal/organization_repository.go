@@ -0,0 +1,335 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	initx "github.com/instrlabs/shared/init"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrganizationRepository handles database operations for organizations, their members and invitations
+type OrganizationRepository struct {
+	db          *initx.Mongo
+	orgs        *mongo.Collection
+	members     *mongo.Collection
+	invitations *mongo.Collection
+}
+
+// NewOrganizationRepository creates a new organization repository instance
+func NewOrganizationRepository(db *initx.Mongo) *OrganizationRepository {
+	r := &OrganizationRepository{
+		db:          db,
+		orgs:        db.DB.Collection("organizations"),
+		members:     db.DB.Collection("organization_members"),
+		invitations: db.DB.Collection("organization_invitations"),
+	}
+	r.ensureIndexes()
+	return r
+}
+
+// ensureIndexes makes a user a member of an organization at most once and drops expired invitations
+func (r *OrganizationRepository) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.members.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Errorf("ensureIndexes: Failed to create organization member indexes: %v", err)
+	}
+	_, err = r.invitations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Errorf("ensureIndexes: Failed to create organization invitation indexes: %v", err)
+	}
+}
+
+// CreateOrganization stores a new organization with its first owner
+func (r *OrganizationRepository) CreateOrganization(org *Organization, owner *OrgMember) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.orgs.InsertOne(ctx, org); err != nil {
+		log.Errorf("CreateOrganization: Failed to create organization: %v", err)
+		return err
+	}
+	if _, err := r.members.InsertOne(ctx, owner); err != nil {
+		log.Errorf("CreateOrganization: Failed to add owner to organization %s: %v", org.ID.Hex(), err)
+		return err
+	}
+	return nil
+}
+
+// FindOrganization returns the organization, or nil if it does not exist
+func (r *OrganizationRepository) FindOrganization(orgID string) *Organization {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil
+	}
+
+	var org Organization
+	if err := r.orgs.FindOne(ctx, bson.M{"_id": objectID}).Decode(&org); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Errorf("FindOrganization: Failed to find organization %s: %v", orgID, err)
+		}
+		return nil
+	}
+	return &org
+}
+
+// FindOrganizations returns the organizations with the given IDs
+func (r *OrganizationRepository) FindOrganizations(orgIDs []string) ([]Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectIDs := make([]primitive.ObjectID, 0, len(orgIDs))
+	for _, id := range orgIDs {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+
+	cursor, err := r.orgs.Find(ctx, bson.M{"_id": bson.M{"$in": objectIDs}}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		log.Errorf("FindOrganizations: Failed to find organizations: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	orgs := []Organization{}
+	if err := cursor.All(ctx, &orgs); err != nil {
+		log.Errorf("FindOrganizations: Failed to decode organizations: %v", err)
+		return nil, err
+	}
+	return orgs, nil
+}
+
+// RenameOrganization changes the name of an organization
+func (r *OrganizationRepository) RenameOrganization(orgID string, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.orgs.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{"name": name, "updated_at": time.Now().UTC()},
+	})
+	if err != nil {
+		log.Errorf("RenameOrganization: Failed to rename organization %s: %v", orgID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteOrganization removes an organization with its members and invitations
+func (r *OrganizationRepository) DeleteOrganization(orgID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.members.DeleteMany(ctx, bson.M{"org_id": orgID}); err != nil {
+		log.Errorf("DeleteOrganization: Failed to delete members of organization %s: %v", orgID, err)
+		return err
+	}
+	if _, err := r.invitations.DeleteMany(ctx, bson.M{"org_id": orgID}); err != nil {
+		log.Errorf("DeleteOrganization: Failed to delete invitations of organization %s: %v", orgID, err)
+		return err
+	}
+	if _, err := r.orgs.DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+		log.Errorf("DeleteOrganization: Failed to delete organization %s: %v", orgID, err)
+		return err
+	}
+	return nil
+}
+
+// FindMembership returns the membership of a user in an organization, or nil if they are not a member
+func (r *OrganizationRepository) FindMembership(orgID string, userID string) *OrgMember {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var member OrgMember
+	if err := r.members.FindOne(ctx, bson.M{"org_id": orgID, "user_id": userID}).Decode(&member); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Errorf("FindMembership: Failed to find membership of user %s in %s: %v", userID, orgID, err)
+		}
+		return nil
+	}
+	return &member
+}
+
+// FindMembershipsByUserID returns every membership of a user
+func (r *OrganizationRepository) FindMembershipsByUserID(userID string) ([]OrgMember, error) {
+	return r.findMembers(bson.M{"user_id": userID})
+}
+
+// FindMembers returns the members of an organization, oldest first
+func (r *OrganizationRepository) FindMembers(orgID string) ([]OrgMember, error) {
+	return r.findMembers(bson.M{"org_id": orgID})
+}
+
+func (r *OrganizationRepository) findMembers(filter bson.M) ([]OrgMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.members.Find(ctx, filter, options.Find().SetSort(bson.M{"joined_at": 1}))
+	if err != nil {
+		log.Errorf("findMembers: Failed to find organization members: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	members := []OrgMember{}
+	if err := cursor.All(ctx, &members); err != nil {
+		log.Errorf("findMembers: Failed to decode organization members: %v", err)
+		return nil, err
+	}
+	return members, nil
+}
+
+// AddMember adds a user to an organization, keeping their role if they already are a member
+func (r *OrganizationRepository) AddMember(member *OrgMember) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.members.UpdateOne(ctx,
+		bson.M{"org_id": member.OrgID, "user_id": member.UserID},
+		bson.M{"$setOnInsert": bson.M{
+			"org_id":    member.OrgID,
+			"user_id":   member.UserID,
+			"role":      member.Role,
+			"joined_at": member.JoinedAt,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Errorf("AddMember: Failed to add user %s to organization %s: %v", member.UserID, member.OrgID, err)
+		return err
+	}
+	return nil
+}
+
+// SetMemberRole changes the role of a member
+func (r *OrganizationRepository) SetMemberRole(orgID string, userID string, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.members.UpdateOne(ctx, bson.M{"org_id": orgID, "user_id": userID}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		log.Errorf("SetMemberRole: Failed to set role of user %s in %s: %v", userID, orgID, err)
+		return err
+	}
+	return nil
+}
+
+// RemoveMember removes a user from an organization
+func (r *OrganizationRepository) RemoveMember(orgID string, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.members.DeleteOne(ctx, bson.M{"org_id": orgID, "user_id": userID})
+	if err != nil {
+		log.Errorf("RemoveMember: Failed to remove user %s from %s: %v", userID, orgID, err)
+		return err
+	}
+	return nil
+}
+
+// CountOwners returns how many owners an organization has
+func (r *OrganizationRepository) CountOwners(orgID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := r.members.CountDocuments(ctx, bson.M{"org_id": orgID, "role": OrgRoleOwner})
+	if err != nil {
+		log.Errorf("CountOwners: Failed to count owners of %s: %v", orgID, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// CreateInvitation stores a new invitation
+func (r *OrganizationRepository) CreateInvitation(invitation *OrgInvitation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.invitations.InsertOne(ctx, invitation); err != nil {
+		log.Errorf("CreateInvitation: Failed to create invitation: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindInvitations returns the pending invitations of an organization, newest first
+func (r *OrganizationRepository) FindInvitations(orgID string) ([]OrgInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"org_id": orgID, "expires_at": bson.M{"$gt": time.Now().UTC()}}
+	cursor, err := r.invitations.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		log.Errorf("FindInvitations: Failed to find invitations of %s: %v", orgID, err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invitations := []OrgInvitation{}
+	if err := cursor.All(ctx, &invitations); err != nil {
+		log.Errorf("FindInvitations: Failed to decode invitations: %v", err)
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// FindInvitationByToken returns the invitation with the token hash, or nil if there is none
+func (r *OrganizationRepository) FindInvitationByToken(tokenHash string) *OrgInvitation {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var invitation OrgInvitation
+	if err := r.invitations.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&invitation); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Errorf("FindInvitationByToken: Failed to find invitation: %v", err)
+		}
+		return nil
+	}
+	return &invitation
+}
+
+// DeleteInvitation removes an invitation of an organization and reports whether it existed.
+// Accepting an invitation deletes it, so only one request can use it.
+func (r *OrganizationRepository) DeleteInvitation(orgID string, invitationID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(invitationID)
+	if err != nil {
+		return false, nil
+	}
+
+	result, err := r.invitations.DeleteOne(ctx, bson.M{"_id": objectID, "org_id": orgID})
+	if err != nil {
+		log.Errorf("DeleteInvitation: Failed to delete invitation %s: %v", invitationID, err)
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
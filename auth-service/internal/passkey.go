@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Passkey ceremony kinds
+const (
+	PasskeyCeremonyRegistration = "registration"
+	PasskeyCeremonyLogin        = "login"
+)
+
+// PasskeyCredential is a WebAuthn credential registered by a user
+type PasskeyCredential struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID          string             `json:"-" bson:"user_id"`
+	Name            string             `json:"name" bson:"name"`
+	CredentialID    []byte             `json:"-" bson:"credential_id"`
+	PublicKey       []byte             `json:"-" bson:"public_key"`
+	AttestationType string             `json:"-" bson:"attestation_type"`
+	Transports      []string           `json:"transports" bson:"transports"`
+	AAGUID          []byte             `json:"-" bson:"aaguid"`
+	SignCount       uint32             `json:"-" bson:"sign_count"`
+	UserVerified    bool               `json:"-" bson:"user_verified"`
+	BackupEligible  bool               `json:"backup_eligible" bson:"backup_eligible"`
+	BackupState     bool               `json:"backup_state" bson:"backup_state"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt      *time.Time         `json:"last_used_at" bson:"last_used_at"`
+}
+
+// PasskeyCeremony holds the server side state between the begin and finish steps of a ceremony
+type PasskeyCeremony struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty"`
+	CeremonyID string               `bson:"ceremony_id"`
+	Kind       string               `bson:"kind"`
+	UserID     string               `bson:"user_id"`
+	Session    webauthn.SessionData `bson:"session"`
+	ExpiresAt  time.Time            `bson:"expires_at"`
+}
+
+func NewPasskeyCredential(userID, name string, cred *webauthn.Credential) *PasskeyCredential {
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+
+	return &PasskeyCredential{
+		ID:              primitive.NewObjectID(),
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      transports,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		UserVerified:    cred.Flags.UserVerified,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now().UTC(),
+	}
+}
+
+// WebAuthnCredential converts the stored credential back into the form the WebAuthn library verifies against
+func (p *PasskeyCredential) WebAuthnCredential() webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(p.Transports))
+	for _, t := range p.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(t))
+	}
+
+	return webauthn.Credential{
+		ID:              p.CredentialID,
+		PublicKey:       p.PublicKey,
+		AttestationType: p.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserVerified:   p.UserVerified,
+			BackupEligible: p.BackupEligible,
+			BackupState:    p.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    p.AAGUID,
+			SignCount: p.SignCount,
+		},
+	}
+}
+
+// passkeyUser adapts a User and its passkeys to the webauthn.User interface.
+// The user handle is the 12 byte ObjectID, so discoverable logins can look the user up directly.
+type passkeyUser struct {
+	user     *User
+	passkeys []PasskeyCredential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	id := u.user.ID
+	return id[:]
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.Username != "" {
+		return u.user.Username
+	}
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(u.passkeys))
+	for i := range u.passkeys {
+		creds = append(creds, u.passkeys[i].WebAuthnCredential())
+	}
+	return creds
+}
+
+func (u *passkeyUser) WebAuthnIcon() string {
+	return ""
+}
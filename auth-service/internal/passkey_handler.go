@@ -0,0 +1,411 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const passkeyCeremonyTTL = 5 * time.Minute
+
+// PasskeyHandler serves WebAuthn registration and passwordless login.
+// Sessions are issued through the same path as PIN and Google logins.
+type PasskeyHandler struct {
+	users       *UserHandler
+	passkeyRepo IPasskeyRepository
+	webAuthn    *webauthn.WebAuthn
+}
+
+func NewPasskeyHandler(users *UserHandler, passkeyRepo IPasskeyRepository) (*PasskeyHandler, error) {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          users.cfg.WebAuthnRPID,
+		RPDisplayName: users.cfg.WebAuthnRPName,
+		RPOrigins:     users.cfg.WebAuthnOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyHandler{
+		users:       users,
+		passkeyRepo: passkeyRepo,
+		webAuthn:    w,
+	}, nil
+}
+
+// saveCeremony persists ceremony state and returns the ID the client sends back on finish
+func (h *PasskeyHandler) saveCeremony(kind string, userID string, session *webauthn.SessionData) (string, error) {
+	ceremony := &PasskeyCeremony{
+		ID:         primitive.NewObjectID(),
+		CeremonyID: GenerateSessionID(),
+		Kind:       kind,
+		UserID:     userID,
+		Session:    *session,
+		ExpiresAt:  time.Now().UTC().Add(passkeyCeremonyTTL),
+	}
+	if err := h.passkeyRepo.SaveCeremony(ceremony); err != nil {
+		return "", err
+	}
+	return ceremony.CeremonyID, nil
+}
+
+// BeginRegistration returns credential creation options for the authenticated user
+func (h *PasskeyHandler) BeginRegistration(c *fiber.Ctx) error {
+	log.Info("BeginRegistration: Starting passkey registration")
+
+	userId, _ := c.Locals("userId").(string)
+	user := h.users.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrUserNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	passkeys, err := h.passkeyRepo.FindPasskeysByUserID(userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	pu := &passkeyUser{user: user, passkeys: passkeys}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(passkeys))
+	for _, cred := range pu.WebAuthnCredentials() {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+
+	options, session, err := h.webAuthn.BeginRegistration(pu, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		log.Errorf("BeginRegistration: Failed to begin registration: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	ceremonyID, err := h.saveCeremony(PasskeyCeremonyRegistration, userId, session)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkey registration started",
+		"errors":  nil,
+		"data": fiber.Map{
+			"ceremony_id": ceremonyID,
+			"options":     options,
+		},
+	})
+}
+
+// FinishRegistration verifies the authenticator's attestation and stores the new passkey
+func (h *PasskeyHandler) FinishRegistration(c *fiber.Ctx) error {
+	log.Info("FinishRegistration: Completing passkey registration")
+
+	var input struct {
+		CeremonyID string          `json:"ceremony_id"`
+		Name       string          `json:"name"`
+		Credential json.RawMessage `json:"credential"`
+	}
+	if err := c.BodyParser(&input); err != nil || len(input.Credential) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	ceremony, err := h.passkeyRepo.TakeCeremony(input.CeremonyID, PasskeyCeremonyRegistration)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if ceremony == nil || ceremony.UserID != userId {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrPasskeyCeremonyInvalid,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	user := h.users.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrUserNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(input.Credential))
+	if err != nil {
+		log.Warnf("FinishRegistration: Failed to parse credential: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrPasskeyInvalid,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	cred, err := h.webAuthn.CreateCredential(&passkeyUser{user: user}, ceremony.Session, parsed)
+	if err != nil {
+		log.Warnf("FinishRegistration: Credential verification failed: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrPasskeyInvalid,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	name := input.Name
+	if name == "" {
+		name = "Passkey"
+	}
+	passkey := NewPasskeyCredential(userId, name, cred)
+	if err := h.passkeyRepo.CreatePasskey(passkey); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("FinishRegistration: Passkey %s registered for user %s", passkey.ID.Hex(), userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkey registered",
+		"errors":  nil,
+		"data": fiber.Map{
+			"passkey": passkey,
+		},
+	})
+}
+
+// BeginLogin returns assertion options for a discoverable (usernameless) passkey login
+func (h *PasskeyHandler) BeginLogin(c *fiber.Ctx) error {
+	log.Info("BeginLogin: Starting passkey login")
+
+	options, session, err := h.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		log.Errorf("BeginLogin: Failed to begin login: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	ceremonyID, err := h.saveCeremony(PasskeyCeremonyLogin, "", session)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkey login started",
+		"errors":  nil,
+		"data": fiber.Map{
+			"ceremony_id": ceremonyID,
+			"options":     options,
+		},
+	})
+}
+
+// FinishLogin verifies the assertion, tracks the sign count and issues a session
+func (h *PasskeyHandler) FinishLogin(c *fiber.Ctx) error {
+	log.Info("FinishLogin: Completing passkey login")
+
+	var input struct {
+		CeremonyID string          `json:"ceremony_id"`
+		Credential json.RawMessage `json:"credential"`
+	}
+	if err := c.BodyParser(&input); err != nil || len(input.Credential) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	ceremony, err := h.passkeyRepo.TakeCeremony(input.CeremonyID, PasskeyCeremonyLogin)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if ceremony == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrPasskeyCeremonyInvalid,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(input.Credential))
+	if err != nil {
+		log.Warnf("FinishLogin: Failed to parse assertion: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrPasskeyInvalid,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	var user *User
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		if len(userHandle) != len(primitive.ObjectID{}) {
+			return nil, errors.New("malformed user handle")
+		}
+		var id primitive.ObjectID
+		copy(id[:], userHandle)
+
+		user = h.users.userRepo.FindByID(id.Hex())
+		if user == nil || user.ID.IsZero() {
+			return nil, errors.New("user not found")
+		}
+		passkeys, err := h.passkeyRepo.FindPasskeysByUserID(id.Hex())
+		if err != nil {
+			return nil, err
+		}
+		return &passkeyUser{user: user, passkeys: passkeys}, nil
+	}
+
+	cred, err := h.webAuthn.ValidateDiscoverableLogin(lookup, ceremony.Session, parsed)
+	if err != nil {
+		log.Warnf("FinishLogin: Assertion verification failed: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrPasskeyInvalid,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if user.Disabled {
+		log.Warnf("FinishLogin: Disabled account %s", user.ID.Hex())
+		h.users.audit(c, AuditLoginFailure, AuditResultAccountDisabled, user.ID.Hex(), "", map[string]string{"method": "passkey"})
+		return accountDisabled(c)
+	}
+
+	// A sign count that did not increase means the credential may have been cloned
+	if cred.Authenticator.CloneWarning {
+		log.Warnf("FinishLogin: Sign count did not increase for a passkey of user %s - possible cloned authenticator", user.ID.Hex())
+		h.users.audit(c, AuditLoginFailure, AuditResultInvalidCredentials, user.ID.Hex(), "", map[string]string{"method": "passkey", "reason": "sign_count"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrPasskeyInvalid,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.passkeyRepo.UpdatePasskeyUsage(cred.ID, cred.Authenticator.SignCount, cred.Flags.BackupState); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	accessToken, refreshToken, err := h.users.createSessionTokens(c, user, "passkey")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("FinishLogin: User logged in with passkey: %s", user.Email)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Login successful",
+		"errors":  nil,
+		"data": fiber.Map{
+			"access_token":  accessToken,
+			"refresh_token": refreshToken,
+			"token_type":    "Bearer",
+			"expires_in":    h.users.cfg.TokenExpiryHours * 3600,
+		},
+	})
+}
+
+// GetPasskeys lists the passkeys registered by the authenticated user
+func (h *PasskeyHandler) GetPasskeys(c *fiber.Ctx) error {
+	log.Info("GetPasskeys: Retrieving user passkeys")
+
+	userId, _ := c.Locals("userId").(string)
+	passkeys, err := h.passkeyRepo.FindPasskeysByUserID(userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkeys retrieved successfully",
+		"errors":  nil,
+		"data": map[string]interface{}{
+			"passkeys": passkeys,
+		},
+	})
+}
+
+// RemovePasskey deletes one of the authenticated user's passkeys
+func (h *PasskeyHandler) RemovePasskey(c *fiber.Ctx) error {
+	log.Info("RemovePasskey: Removing passkey")
+
+	userId, _ := c.Locals("userId").(string)
+	passkeyId := c.Params("passkeyId")
+
+	deleted, err := h.passkeyRepo.DeletePasskey(passkeyId, userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": ErrPasskeyNotFound,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("RemovePasskey: Passkey %s removed for user %s", passkeyId, userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkey removed successfully",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
@@ -0,0 +1,356 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockPasskeyRepository keeps passkeys and ceremonies in memory
+type MockPasskeyRepository struct {
+	passkeys   []PasskeyCredential
+	ceremonies map[string]*PasskeyCeremony
+}
+
+func NewMockPasskeyRepository() *MockPasskeyRepository {
+	return &MockPasskeyRepository{ceremonies: map[string]*PasskeyCeremony{}}
+}
+
+func (m *MockPasskeyRepository) CreatePasskey(passkey *PasskeyCredential) error {
+	m.passkeys = append(m.passkeys, *passkey)
+	return nil
+}
+
+func (m *MockPasskeyRepository) FindPasskeysByUserID(userID string) ([]PasskeyCredential, error) {
+	var out []PasskeyCredential
+	for _, p := range m.passkeys {
+		if p.UserID == userID {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (m *MockPasskeyRepository) UpdatePasskeyUsage(credentialID []byte, signCount uint32, backupState bool) error {
+	for i := range m.passkeys {
+		if bytes.Equal(m.passkeys[i].CredentialID, credentialID) {
+			now := time.Now().UTC()
+			m.passkeys[i].SignCount = signCount
+			m.passkeys[i].BackupState = backupState
+			m.passkeys[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MockPasskeyRepository) DeletePasskey(id string, userID string) (bool, error) {
+	for i, p := range m.passkeys {
+		if p.ID.Hex() == id && p.UserID == userID {
+			m.passkeys = append(m.passkeys[:i], m.passkeys[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockPasskeyRepository) DeletePasskeysByUserID(userID string) error {
+	kept := m.passkeys[:0]
+	for _, p := range m.passkeys {
+		if p.UserID != userID {
+			kept = append(kept, p)
+		}
+	}
+	m.passkeys = kept
+	return nil
+}
+
+func (m *MockPasskeyRepository) SaveCeremony(ceremony *PasskeyCeremony) error {
+	m.ceremonies[ceremony.CeremonyID] = ceremony
+	return nil
+}
+
+func (m *MockPasskeyRepository) TakeCeremony(ceremonyID string, kind string) (*PasskeyCeremony, error) {
+	ceremony, ok := m.ceremonies[ceremonyID]
+	if !ok || ceremony.Kind != kind {
+		return nil, nil
+	}
+	delete(m.ceremonies, ceremonyID)
+	return ceremony, nil
+}
+
+// softAuthenticator is a software WebAuthn authenticator producing "none" attestations and ES256 assertions
+type softAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	credID     []byte
+	userHandle []byte
+	signCount  uint32
+	rpID       string
+	origin     string
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	credID := make([]byte, 16)
+	_, _ = rand.Read(credID)
+	return &softAuthenticator{key: key, credID: credID, rpID: rpID, origin: origin}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(a.rpID))
+	var counter [4]byte
+	binary.BigEndian.PutUint32(counter[:], a.signCount)
+
+	data := append(rpHash[:], flags)
+	data = append(data, counter[:]...)
+	return append(data, attested...)
+}
+
+// create answers a registration ceremony for the given options
+func (a *softAuthenticator) create(t *testing.T, options map[string]interface{}) json.RawMessage {
+	t.Helper()
+	publicKey := options["publicKey"].(map[string]interface{})
+	user := publicKey["user"].(map[string]interface{})
+	handle, err := base64.RawURLEncoding.DecodeString(user["id"].(string))
+	require.NoError(t, err)
+	a.userHandle = handle
+
+	coseKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credID)))
+	attested = append(attested, a.credID...)
+	attested = append(attested, coseKey...)
+
+	attObj, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x45, attested), // UP | UV | AT
+	})
+	require.NoError(t, err)
+
+	clientData, _ := json.Marshal(map[string]string{
+		"type":      "webauthn.create",
+		"challenge": publicKey["challenge"].(string),
+		"origin":    a.origin,
+	})
+
+	out, _ := json.Marshal(map[string]interface{}{
+		"id":    b64(a.credID),
+		"rawId": b64(a.credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"attestationObject": b64(attObj),
+		},
+	})
+	return out
+}
+
+// get answers a login ceremony, incrementing the sign count unless told otherwise
+func (a *softAuthenticator) get(t *testing.T, options map[string]interface{}, increment bool) json.RawMessage {
+	t.Helper()
+	publicKey := options["publicKey"].(map[string]interface{})
+	if increment {
+		a.signCount++
+	}
+
+	authData := a.authData(0x05, nil) // UP | UV
+	clientData, _ := json.Marshal(map[string]string{
+		"type":      "webauthn.get",
+		"challenge": publicKey["challenge"].(string),
+		"origin":    a.origin,
+	})
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	out, _ := json.Marshal(map[string]interface{}{
+		"id":    b64(a.credID),
+		"rawId": b64(a.credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(sig),
+			"userHandle":        b64(a.userHandle),
+		},
+	})
+	return out
+}
+
+func newPasskeyTestApp(t *testing.T, user *User) (*fiber.App, *MockPasskeyRepository) {
+	t.Helper()
+	userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User {
+		if id == user.ID.Hex() {
+			return user
+		}
+		return nil
+	}}
+	passkeyRepo := NewMockPasskeyRepository()
+	handler, err := NewPasskeyHandler(NewUserHandler(newMockConfig(), userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer()), passkeyRepo)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	app.Post("/passkeys/register/begin", handler.BeginRegistration)
+	app.Post("/passkeys/register/finish", handler.FinishRegistration)
+	app.Post("/passkeys/login/begin", handler.BeginLogin)
+	app.Post("/passkeys/login/finish", handler.FinishLogin)
+	app.Get("/devices/passkeys", handler.GetPasskeys)
+	app.Post("/devices/passkeys/:passkeyId/remove", handler.RemovePasskey)
+	return app, passkeyRepo
+}
+
+func passkeyRequest(t *testing.T, app *fiber.App, method, path, userID string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	raw, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", userID)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	var out map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func registerSoftPasskey(t *testing.T, app *fiber.App, user *User, auth *softAuthenticator) {
+	t.Helper()
+	status, body := passkeyRequest(t, app, fiber.MethodPost, "/passkeys/register/begin", user.ID.Hex(), nil)
+	require.Equal(t, fiber.StatusOK, status)
+	data := body["data"].(map[string]interface{})
+
+	status, body = passkeyRequest(t, app, fiber.MethodPost, "/passkeys/register/finish", user.ID.Hex(), map[string]interface{}{
+		"ceremony_id": data["ceremony_id"],
+		"name":        "Test key",
+		"credential":  auth.create(t, data["options"].(map[string]interface{})),
+	})
+	require.Equal(t, fiber.StatusOK, status, body["message"])
+}
+
+func loginSoftPasskey(t *testing.T, app *fiber.App, auth *softAuthenticator, increment bool) (int, map[string]interface{}) {
+	t.Helper()
+	status, body := passkeyRequest(t, app, fiber.MethodPost, "/passkeys/login/begin", "", nil)
+	require.Equal(t, fiber.StatusOK, status)
+	data := body["data"].(map[string]interface{})
+
+	return passkeyRequest(t, app, fiber.MethodPost, "/passkeys/login/finish", "", map[string]interface{}{
+		"ceremony_id": data["ceremony_id"],
+		"credential":  auth.get(t, data["options"].(map[string]interface{}), increment),
+	})
+}
+
+func TestPasskey_RegisterAndLogin(t *testing.T) {
+	user := NewUser("passkey@example.com")
+	app, repo := newPasskeyTestApp(t, user)
+	auth := newSoftAuthenticator(t, "localhost", "http://localhost:3000")
+
+	registerSoftPasskey(t, app, user, auth)
+	require.Len(t, repo.passkeys, 1)
+	assert.Equal(t, "Test key", repo.passkeys[0].Name)
+	assert.Equal(t, auth.credID, repo.passkeys[0].CredentialID)
+
+	status, body := loginSoftPasskey(t, app, auth, true)
+	require.Equal(t, fiber.StatusOK, status, body["message"])
+	data := body["data"].(map[string]interface{})
+	assert.NotEmpty(t, data["access_token"])
+	assert.NotEmpty(t, data["refresh_token"])
+	assert.Equal(t, uint32(1), repo.passkeys[0].SignCount)
+	assert.NotNil(t, repo.passkeys[0].LastUsedAt)
+}
+
+func TestPasskey_RejectsStaleSignCount(t *testing.T) {
+	user := NewUser("passkey@example.com")
+	app, _ := newPasskeyTestApp(t, user)
+	auth := newSoftAuthenticator(t, "localhost", "http://localhost:3000")
+	registerSoftPasskey(t, app, user, auth)
+
+	status, _ := loginSoftPasskey(t, app, auth, true)
+	require.Equal(t, fiber.StatusOK, status)
+
+	status, _ = loginSoftPasskey(t, app, auth, false)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestPasskey_RejectsWrongOriginAndReusedCeremony(t *testing.T) {
+	user := NewUser("passkey@example.com")
+	app, _ := newPasskeyTestApp(t, user)
+	auth := newSoftAuthenticator(t, "localhost", "http://localhost:3000")
+	registerSoftPasskey(t, app, user, auth)
+
+	status, body := passkeyRequest(t, app, fiber.MethodPost, "/passkeys/login/begin", "", nil)
+	require.Equal(t, fiber.StatusOK, status)
+	data := body["data"].(map[string]interface{})
+	options := data["options"].(map[string]interface{})
+
+	evil := *auth
+	evil.origin = "https://evil.example.com"
+	status, _ = passkeyRequest(t, app, fiber.MethodPost, "/passkeys/login/finish", "", map[string]interface{}{
+		"ceremony_id": data["ceremony_id"],
+		"credential":  evil.get(t, options, true),
+	})
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// The ceremony was consumed by the failed attempt
+	status, _ = passkeyRequest(t, app, fiber.MethodPost, "/passkeys/login/finish", "", map[string]interface{}{
+		"ceremony_id": data["ceremony_id"],
+		"credential":  auth.get(t, options, true),
+	})
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
+
+func TestPasskey_ListAndRemove(t *testing.T) {
+	user := NewUser("passkey@example.com")
+	app, repo := newPasskeyTestApp(t, user)
+	auth := newSoftAuthenticator(t, "localhost", "http://localhost:3000")
+	registerSoftPasskey(t, app, user, auth)
+
+	status, body := passkeyRequest(t, app, fiber.MethodGet, "/devices/passkeys", user.ID.Hex(), nil)
+	require.Equal(t, fiber.StatusOK, status)
+	passkeys := body["data"].(map[string]interface{})["passkeys"].([]interface{})
+	require.Len(t, passkeys, 1)
+	id := passkeys[0].(map[string]interface{})["id"].(string)
+
+	status, _ = passkeyRequest(t, app, fiber.MethodPost, "/devices/passkeys/"+id+"/remove", primitive.NewObjectID().Hex(), nil)
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	status, _ = passkeyRequest(t, app, fiber.MethodPost, "/devices/passkeys/"+id+"/remove", user.ID.Hex(), nil)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Empty(t, repo.passkeys)
+
+	status, _ = loginSoftPasskey(t, app, auth, true)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
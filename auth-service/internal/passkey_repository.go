@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	initx "github.com/instrlabs/shared/init"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PasskeyRepository handles database operations for passkeys and pending WebAuthn ceremonies
+type PasskeyRepository struct {
+	db         *initx.Mongo
+	collection *mongo.Collection
+	ceremonies *mongo.Collection
+}
+
+// NewPasskeyRepository creates a new passkey repository instance
+func NewPasskeyRepository(db *initx.Mongo) *PasskeyRepository {
+	return &PasskeyRepository{
+		db:         db,
+		collection: db.DB.Collection("passkeys"),
+		ceremonies: db.DB.Collection("passkey_ceremonies"),
+	}
+}
+
+// CreatePasskey stores a newly registered credential
+func (r *PasskeyRepository) CreatePasskey(passkey *PasskeyCredential) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, passkey)
+	if err != nil {
+		log.Errorf("CreatePasskey: Failed to create passkey: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindPasskeysByUserID returns all passkeys registered by a user, oldest first
+func (r *PasskeyRepository) FindPasskeysByUserID(userID string) ([]PasskeyCredential, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		log.Errorf("FindPasskeysByUserID: Failed to find passkeys: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	passkeys := []PasskeyCredential{}
+	if err := cursor.All(ctx, &passkeys); err != nil {
+		log.Errorf("FindPasskeysByUserID: Failed to decode passkeys: %v", err)
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+// UpdatePasskeyUsage records the sign count and flags reported by the last successful login
+func (r *PasskeyRepository) UpdatePasskeyUsage(credentialID []byte, signCount uint32, backupState bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"sign_count":   signCount,
+			"backup_state": backupState,
+			"last_used_at": time.Now().UTC(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"credential_id": credentialID}, update)
+	if err != nil {
+		log.Errorf("UpdatePasskeyUsage: Failed to update passkey: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeletePasskey removes a passkey owned by the user. Returns false if it does not exist.
+func (r *PasskeyRepository) DeletePasskey(id string, userID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID, "user_id": userID})
+	if err != nil {
+		log.Errorf("DeletePasskey: Failed to delete passkey %s: %v", id, err)
+		return false, err
+	}
+	return res.DeletedCount == 1, nil
+}
+
+// DeletePasskeysByUserID removes every passkey of the user
+func (r *PasskeyRepository) DeletePasskeysByUserID(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		log.Errorf("DeletePasskeysByUserID: Failed to delete passkeys of user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// SaveCeremony stores the state of a started registration or login ceremony
+func (r *PasskeyRepository) SaveCeremony(ceremony *PasskeyCeremony) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.ceremonies.InsertOne(ctx, ceremony)
+	if err != nil {
+		log.Errorf("SaveCeremony: Failed to save ceremony: %v", err)
+		return err
+	}
+	return nil
+}
+
+// TakeCeremony loads and deletes a ceremony so its challenge can only be answered once.
+// Returns nil if the ceremony does not exist, has expired or is of another kind.
+func (r *PasskeyRepository) TakeCeremony(ceremonyID string, kind string) (*PasskeyCeremony, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var ceremony PasskeyCeremony
+	err := r.ceremonies.FindOneAndDelete(ctx, bson.M{"ceremony_id": ceremonyID, "kind": kind}).Decode(&ceremony)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Warnf("TakeCeremony: Ceremony %s not found", ceremonyID)
+			return nil, nil
+		}
+		log.Errorf("TakeCeremony: Failed to find ceremony: %v", err)
+		return nil, err
+	}
+
+	if time.Now().UTC().After(ceremony.ExpiresAt) {
+		log.Warnf("TakeCeremony: Ceremony %s has expired", ceremonyID)
+		return nil, nil
+	}
+	return &ceremony, nil
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"image/jpeg"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // the release image ships without a zoneinfo database
+	"unicode/utf8"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	AvatarSize           = 256
+	avatarJPEGQuality    = 85
+	displayNameMaxLength = 64
+	emailChangeTTL       = 24 * time.Hour
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,29}$`)
+	localePattern   = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	emailPattern    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// ProfileUpdate holds the profile fields a user may change. Nil fields are left as they are.
+type ProfileUpdate struct {
+	Username    *string `json:"username" bson:"username,omitempty"`
+	DisplayName *string `json:"display_name" bson:"display_name,omitempty"`
+	Locale      *string `json:"locale" bson:"locale,omitempty"`
+	Timezone    *string `json:"timezone" bson:"timezone,omitempty"`
+}
+
+// Normalize trims the fields and lowercases the username
+func (p *ProfileUpdate) Normalize() {
+	for _, field := range []*string{p.Username, p.DisplayName, p.Locale, p.Timezone} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	if p.Username != nil {
+		*p.Username = strings.ToLower(*p.Username)
+	}
+}
+
+// Validate returns the error message for the first invalid field, or "" if the update is valid.
+// Empty display name, locale and timezone clear the field; the username cannot be cleared.
+func (p *ProfileUpdate) Validate() string {
+	if p.Username != nil && !usernamePattern.MatchString(*p.Username) {
+		return ErrInvalidUsername
+	}
+	if p.DisplayName != nil && utf8.RuneCountInString(*p.DisplayName) > displayNameMaxLength {
+		return ErrInvalidDisplayName
+	}
+	if p.Locale != nil && *p.Locale != "" && !localePattern.MatchString(*p.Locale) {
+		return ErrInvalidLocale
+	}
+	if p.Timezone != nil && *p.Timezone != "" {
+		if _, err := time.LoadLocation(*p.Timezone); err != nil || *p.Timezone == "Local" {
+			return ErrInvalidTimezone
+		}
+	}
+	return ""
+}
+
+// EmailChange is a pending change of the user's email address. It applies once
+// the links sent to both the current and the new address have been confirmed.
+type EmailChange struct {
+	NewEmail     string    `json:"new_email" bson:"new_email"`
+	OldTokenHash string    `json:"-" bson:"old_token_hash"`
+	NewTokenHash string    `json:"-" bson:"new_token_hash"`
+	OldConfirmed bool      `json:"old_confirmed" bson:"old_confirmed"`
+	NewConfirmed bool      `json:"new_confirmed" bson:"new_confirmed"`
+	ExpiresAt    time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// NewEmailChange starts a change to newEmail and returns it with the plaintext
+// tokens for the current and the new address
+func NewEmailChange(newEmail string) (*EmailChange, string, string, error) {
+	oldToken, err := generateEmailChangeToken()
+	if err != nil {
+		return nil, "", "", err
+	}
+	newToken, err := generateEmailChangeToken()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return &EmailChange{
+		NewEmail:     newEmail,
+		OldTokenHash: HashEmailChangeToken(oldToken),
+		NewTokenHash: HashEmailChangeToken(newToken),
+		ExpiresAt:    time.Now().UTC().Add(emailChangeTTL),
+	}, oldToken, newToken, nil
+}
+
+// Confirm marks the address the token was sent to as confirmed and reports whether the token matched
+func (e *EmailChange) Confirm(tokenHash string) bool {
+	switch tokenHash {
+	case e.OldTokenHash:
+		e.OldConfirmed = true
+	case e.NewTokenHash:
+		e.NewConfirmed = true
+	default:
+		return false
+	}
+	return true
+}
+
+func (e *EmailChange) IsExpired() bool {
+	return time.Now().UTC().After(e.ExpiresAt)
+}
+
+func generateEmailChangeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashEmailChangeToken returns the SHA256 hex digest under which an email change token is stored
+func HashEmailChangeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResizeAvatar center-crops an uploaded image to a square of AvatarSize pixels and re-encodes it as JPEG.
+// Re-encoding also drops any metadata embedded in the upload.
+func ResizeAvatar(data []byte) ([]byte, error) {
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+
+	resized := imaging.Fill(img, AvatarSize, AvatarSize, imaging.Center, imaging.Lanczos)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: avatarJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,446 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+var (
+	avatarUserPattern = regexp.MustCompile(`^[0-9a-f]{24}$`)
+	avatarNamePattern = regexp.MustCompile(`^[0-9a-f]{16}\.jpg$`)
+)
+
+// ProfileHandler lets users edit their profile, avatar and email address
+type ProfileHandler struct {
+	users *UserHandler
+	store IObjectStore
+}
+
+func NewProfileHandler(users *UserHandler, store IObjectStore) *ProfileHandler {
+	return &ProfileHandler{
+		users: users,
+		store: store,
+	}
+}
+
+// currentUser loads the authenticated user
+func (h *ProfileHandler) currentUser(c *fiber.Ctx) *User {
+	userId, _ := c.Locals("userId").(string)
+	user := h.users.userRepo.FindByID(userId)
+	if user == nil || user.ID.IsZero() {
+		return nil
+	}
+	return user
+}
+
+func profileUserNotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"message": ErrUserNotFound,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// UpdateProfile changes the username, display name, locale or timezone. Omitted fields are kept.
+func (h *ProfileHandler) UpdateProfile(c *fiber.Ctx) error {
+	log.Info("UpdateProfile: Updating user profile")
+
+	var input ProfileUpdate
+	if err := c.BodyParser(&input); err != nil {
+		log.Warnf("UpdateProfile: Invalid request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	input.Normalize()
+	if msg := input.Validate(); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": msg,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	user := h.currentUser(c)
+	if user == nil {
+		return profileUserNotFound(c)
+	}
+
+	if input.Username != nil && *input.Username != user.Username {
+		if taken := h.users.userRepo.FindByUsername(*input.Username); taken != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": ErrUsernameTaken,
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+	}
+
+	if err := h.users.userRepo.UpdateProfile(user.ID.Hex(), input); errors.Is(err, ErrUsernameExists) {
+		// Claimed by another user since the check above
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": ErrUsernameTaken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("UpdateProfile: Profile updated for user %s", user.ID.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Profile updated successfully",
+		"errors":  nil,
+		"data":    map[string]interface{}{"user": h.users.userRepo.FindByID(user.ID.Hex())},
+	})
+}
+
+// UploadAvatar replaces the user's avatar with the uploaded image, resized to a square
+func (h *ProfileHandler) UploadAvatar(c *fiber.Ctx) error {
+	log.Info("UploadAvatar: Uploading avatar")
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrAvatarRequired,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if file.Size > int64(h.users.cfg.AvatarMaxBytes) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"message": ErrAvatarTooLarge,
+			"errors":  nil,
+			"data": fiber.Map{
+				"max_bytes": h.users.cfg.AvatarMaxBytes,
+			},
+		})
+	}
+
+	user := h.currentUser(c)
+	if user == nil {
+		return profileUserNotFound(c)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		log.Errorf("UploadAvatar: Failed to open upload: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		log.Errorf("UploadAvatar: Failed to read upload: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	avatar, err := ResizeAvatar(data)
+	if err != nil {
+		log.Warnf("UploadAvatar: Failed to decode avatar of user %s: %v", user.ID.Hex(), err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrAvatarInvalid,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	// Every upload gets a new name, so the URL can be cached forever
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	name := hex.EncodeToString(b) + ".jpg"
+	key := avatarKey(user.ID.Hex(), name)
+
+	if err := h.store.Put(key, avatar); err != nil {
+		log.Errorf("UploadAvatar: Failed to store avatar %s: %v", key, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	previousKey := user.AvatarKey
+	avatarURL := fmt.Sprintf("%s/auth/avatars/%s/%s", h.users.cfg.ApiUrl, user.ID.Hex(), name)
+	if err := h.users.userRepo.SetAvatar(user.ID.Hex(), key, avatarURL); err != nil {
+		_ = h.store.Delete(key)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.deleteAvatar(previousKey)
+
+	log.Infof("UploadAvatar: Avatar updated for user %s", user.ID.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Avatar updated successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"avatar_url": avatarURL},
+	})
+}
+
+// RemoveAvatar deletes the user's avatar
+func (h *ProfileHandler) RemoveAvatar(c *fiber.Ctx) error {
+	log.Info("RemoveAvatar: Removing avatar")
+
+	user := h.currentUser(c)
+	if user == nil {
+		return profileUserNotFound(c)
+	}
+
+	previousKey := user.AvatarKey
+	if err := h.users.userRepo.SetAvatar(user.ID.Hex(), "", ""); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.deleteAvatar(previousKey)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Avatar removed successfully",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// GetAvatar serves an avatar image. Avatar URLs are public so they can be used in img tags.
+func (h *ProfileHandler) GetAvatar(c *fiber.Ctx) error {
+	userId, name := c.Params("userId"), c.Params("name")
+	if !avatarUserPattern.MatchString(userId) || !avatarNamePattern.MatchString(name) {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	data := h.store.Get(avatarKey(userId, name))
+	if data == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	c.Set(fiber.HeaderContentType, "image/jpeg")
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	return c.Send(data)
+}
+
+func (h *ProfileHandler) deleteAvatar(key string) {
+	if key == "" {
+		return
+	}
+	if err := h.store.Delete(key); err != nil {
+		log.Warnf("deleteAvatar: Failed to delete avatar %s: %v", key, err)
+	}
+}
+
+func avatarKey(userID string, name string) string {
+	return "avatars/" + userID + "/" + name
+}
+
+// ChangeEmail starts an email change. Links are sent to both the current and the new address,
+// and the change only applies once both are confirmed.
+func (h *ProfileHandler) ChangeEmail(c *fiber.Ctx) error {
+	log.Info("ChangeEmail: Starting email change")
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	newEmail := strings.ToLower(strings.TrimSpace(input.Email))
+	if !emailPattern.MatchString(newEmail) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidEmail,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	user := h.currentUser(c)
+	if user == nil {
+		return profileUserNotFound(c)
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrEmailUnchanged,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if taken := h.users.userRepo.FindByEmail(newEmail); taken != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": ErrEmailTaken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	change, oldToken, newToken, err := NewEmailChange(newEmail)
+	if err != nil {
+		log.Errorf("ChangeEmail: Failed to generate tokens: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if err := h.users.userRepo.SetEmailChange(user.ID.Hex(), change); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.users.mailer.Send(user.Email, user.Locale, MailEmailChangeApprove, EmailChangeApproveMail{
+		NewEmail: newEmail,
+		URL:      h.confirmEmailURL(oldToken),
+	}); err != nil {
+		log.Errorf("ChangeEmail: Failed to email current address of user %s: %v", user.ID.Hex(), err)
+	}
+	if err := h.users.mailer.Send(newEmail, user.Locale, MailEmailChangeConfirm, EmailChangeConfirmMail{
+		URL: h.confirmEmailURL(newToken),
+	}); err != nil {
+		log.Errorf("ChangeEmail: Failed to email new address of user %s: %v", user.ID.Hex(), err)
+	}
+
+	log.Infof("ChangeEmail: Email change started for user %s", user.ID.Hex())
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Confirmation links sent to both email addresses",
+		"errors":  nil,
+		"data":    fiber.Map{"email_change": change},
+	})
+}
+
+func (h *ProfileHandler) confirmEmailURL(token string) string {
+	return h.users.cfg.WebUrl + "/profile/email/confirm?token=" + url.QueryEscape(token)
+}
+
+// CancelEmailChange drops the pending email change
+func (h *ProfileHandler) CancelEmailChange(c *fiber.Ctx) error {
+	user := h.currentUser(c)
+	if user == nil {
+		return profileUserNotFound(c)
+	}
+
+	if err := h.users.userRepo.SetEmailChange(user.ID.Hex(), nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Email change cancelled",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// ConfirmEmailChange confirms one side of a pending email change with the token from its link.
+// It does not require a session, since the link may be opened on another device.
+func (h *ProfileHandler) ConfirmEmailChange(c *fiber.Ctx) error {
+	log.Info("ConfirmEmailChange: Confirming email change")
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	tokenHash := HashEmailChangeToken(input.Token)
+	user := h.users.userRepo.FindByEmailChangeToken(tokenHash)
+	if user == nil || user.EmailChange == nil || user.EmailChange.IsExpired() || !user.EmailChange.Confirm(tokenHash) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidEmailChange,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	change := user.EmailChange
+
+	if !change.OldConfirmed || !change.NewConfirmed {
+		if err := h.users.userRepo.SetEmailChange(user.ID.Hex(), change); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": ErrInternalServer,
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Address confirmed. Waiting for the other address to be confirmed.",
+			"errors":  nil,
+			"data":    fiber.Map{"email_change": change, "changed": false},
+		})
+	}
+
+	// The new address may have been registered since the change started
+	if taken := h.users.userRepo.FindByEmail(change.NewEmail); taken != nil {
+		_ = h.users.userRepo.SetEmailChange(user.ID.Hex(), nil)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": ErrEmailTaken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.users.userRepo.ChangeEmail(user.ID.Hex(), change.NewEmail); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.users.mailer.Send(user.Email, user.Locale, MailEmailChanged, EmailChangedMail{
+		NewEmail: change.NewEmail,
+	}); err != nil {
+		log.Errorf("ConfirmEmailChange: Failed to notify previous address of user %s: %v", user.ID.Hex(), err)
+	}
+
+	log.Infof("ConfirmEmailChange: Email changed for user %s", user.ID.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Email address changed successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"email": change.NewEmail, "changed": true},
+	})
+}
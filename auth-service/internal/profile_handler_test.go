@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryObjectStore is an in-memory IObjectStore
+type memoryObjectStore struct {
+	objects map[string][]byte
+}
+
+func (s *memoryObjectStore) Put(name string, data []byte) error {
+	s.objects[name] = data
+	return nil
+}
+
+func (s *memoryObjectStore) Get(name string) []byte {
+	return s.objects[name]
+}
+
+func (s *memoryObjectStore) Delete(name string) error {
+	delete(s.objects, name)
+	return nil
+}
+
+// profileUsers is a MockUserRepository over a fixed set of users that applies profile changes
+func profileUsers(users ...*User) *MockUserRepository {
+	repo := memoryUserDirectory(users...)
+	repo.FindByEmailFunc = func(email string) *User {
+		for _, u := range users {
+			if u.Email == email {
+				return u
+			}
+		}
+		return nil
+	}
+	repo.FindByUsernameFunc = func(username string) *User {
+		for _, u := range users {
+			if u.Username == username {
+				return u
+			}
+		}
+		return nil
+	}
+	repo.UpdateProfileFunc = func(userID string, update ProfileUpdate) error {
+		user := repo.FindByIDFunc(userID)
+		if update.Username != nil {
+			user.Username = *update.Username
+		}
+		if update.DisplayName != nil {
+			user.DisplayName = *update.DisplayName
+		}
+		if update.Locale != nil {
+			user.Locale = *update.Locale
+		}
+		if update.Timezone != nil {
+			user.Timezone = *update.Timezone
+		}
+		return nil
+	}
+	repo.SetAvatarFunc = func(userID string, key string, url string) error {
+		user := repo.FindByIDFunc(userID)
+		user.AvatarKey, user.AvatarURL = key, url
+		return nil
+	}
+	repo.SetEmailChangeFunc = func(userID string, change *EmailChange) error {
+		repo.FindByIDFunc(userID).EmailChange = change
+		return nil
+	}
+	repo.FindByEmailChangeTokenFunc = func(tokenHash string) *User {
+		for _, u := range users {
+			if u.EmailChange != nil && (u.EmailChange.OldTokenHash == tokenHash || u.EmailChange.NewTokenHash == tokenHash) {
+				copied := *u
+				change := *u.EmailChange
+				copied.EmailChange = &change
+				return &copied
+			}
+		}
+		return nil
+	}
+	repo.ChangeEmailFunc = func(userID string, email string) error {
+		user := repo.FindByIDFunc(userID)
+		user.Email, user.EmailChange = email, nil
+		return nil
+	}
+	return repo
+}
+
+func newProfileTestApp(userRepo *MockUserRepository, store *memoryObjectStore) *fiber.App {
+	users := NewUserHandler(newMockConfig(), userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	handler := NewProfileHandler(users, store)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", strings.Clone(c.Get("X-Test-User")))
+		return c.Next()
+	})
+	app.Patch("/profile", handler.UpdateProfile)
+	app.Post("/profile/avatar", handler.UploadAvatar)
+	app.Post("/profile/email", handler.ChangeEmail)
+	app.Post("/profile/email/confirm", handler.ConfirmEmailChange)
+	app.Get("/avatars/:userId/:name", handler.GetAvatar)
+	return app
+}
+
+func TestUpdateProfile(t *testing.T) {
+	user := NewUser("user@example.com")
+	user.Username = "user1234"
+	other := NewUser("other@example.com")
+	other.Username = "taken"
+	app := newProfileTestApp(profileUsers(user, other), &memoryObjectStore{objects: map[string][]byte{}})
+
+	invalid := map[string]string{
+		"short username":    `{"username":"ab"}`,
+		"username symbols":  `{"username":"a b!"}`,
+		"long display name": `{"display_name":"` + strings.Repeat("x", 65) + `"}`,
+		"bad locale":        `{"locale":"english"}`,
+		"bad timezone":      `{"timezone":"Mars/Olympus"}`,
+	}
+	for name, body := range invalid {
+		status, _ := apiKeyRequest(t, app, fiber.MethodPatch, "/profile", user.ID.Hex(), body)
+		assert.Equal(t, fiber.StatusBadRequest, status, name)
+	}
+
+	status, body := apiKeyRequest(t, app, fiber.MethodPatch, "/profile", user.ID.Hex(), `{"username":"Taken"}`)
+	assert.Equal(t, fiber.StatusConflict, status)
+	assert.Equal(t, ErrUsernameTaken, body["message"])
+
+	status, _ = apiKeyRequest(t, app, fiber.MethodPatch, "/profile", user.ID.Hex(),
+		`{"username":" New.Name ","display_name":"New Name","locale":"pt-BR","timezone":"Europe/Berlin"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "new.name", user.Username)
+	assert.Equal(t, "New Name", user.DisplayName)
+	assert.Equal(t, "pt-BR", user.Locale)
+	assert.Equal(t, "Europe/Berlin", user.Timezone)
+
+	// Omitted fields are kept, empty ones are cleared
+	status, _ = apiKeyRequest(t, app, fiber.MethodPatch, "/profile", user.ID.Hex(), `{"timezone":""}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "new.name", user.Username)
+	assert.Empty(t, user.Timezone)
+}
+
+func TestUpdateProfile_UsernameClaimedConcurrently(t *testing.T) {
+	user := NewUser("user@example.com")
+	repo := profileUsers(user)
+	// The username was free when checked, but another user took it before the update landed
+	repo.UpdateProfileFunc = func(userID string, update ProfileUpdate) error {
+		return ErrUsernameExists
+	}
+	app := newProfileTestApp(repo, &memoryObjectStore{objects: map[string][]byte{}})
+
+	status, body := apiKeyRequest(t, app, fiber.MethodPatch, "/profile", user.ID.Hex(), `{"username":"racer"}`)
+	assert.Equal(t, fiber.StatusConflict, status)
+	assert.Equal(t, ErrUsernameTaken, body["message"])
+}
+
+func avatarUpload(t *testing.T, app *fiber.App, user string, data []byte) (int, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, err := w.CreateFormFile("avatar", "avatar.png")
+	require.NoError(t, err)
+	_, _ = part.Write(data)
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(fiber.MethodPost, "/profile/avatar", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("X-Test-User", user)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(raw)
+}
+
+func TestUploadAvatar_ResizesAndReplaces(t *testing.T) {
+	user := NewUser("user@example.com")
+	store := &memoryObjectStore{objects: map[string][]byte{}}
+	app := newProfileTestApp(profileUsers(user), store)
+
+	status, _ := avatarUpload(t, app, user.ID.Hex(), []byte("not an image"))
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	src := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for x := 0; x < 800; x++ {
+		for y := 0; y < 400; y++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, src))
+
+	status, _ = avatarUpload(t, app, user.ID.Hex(), encoded.Bytes())
+	require.Equal(t, fiber.StatusOK, status)
+	require.Len(t, store.objects, 1)
+	first := user.AvatarKey
+
+	stored, format, err := image.Decode(bytes.NewReader(store.objects[first]))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Rect(0, 0, AvatarSize, AvatarSize), stored.Bounds())
+	assert.True(t, strings.HasPrefix(user.AvatarURL, "http://localhost:3001/auth/avatars/"+user.ID.Hex()+"/"))
+
+	// The avatar is served from its URL
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, strings.TrimPrefix(user.AvatarURL, "http://localhost:3001/auth"), nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/jpeg", resp.Header.Get(fiber.HeaderContentType))
+
+	// A new upload replaces the old object
+	status, _ = avatarUpload(t, app, user.ID.Hex(), encoded.Bytes())
+	require.Equal(t, fiber.StatusOK, status)
+	assert.NotEqual(t, first, user.AvatarKey)
+	assert.Len(t, store.objects, 1)
+}
+
+func TestChangeEmail_RequiresBothConfirmations(t *testing.T) {
+	user := NewUser("old@example.com")
+	taken := NewUser("taken@example.com")
+	app := newProfileTestApp(profileUsers(user, taken), &memoryObjectStore{objects: map[string][]byte{}})
+
+	status, _ := apiKeyRequest(t, app, fiber.MethodPost, "/profile/email", user.ID.Hex(), `{"email":"taken@example.com"}`)
+	assert.Equal(t, fiber.StatusConflict, status)
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/profile/email", user.ID.Hex(), `{"email":"not-an-email"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, _ = apiKeyRequest(t, app, fiber.MethodPost, "/profile/email", user.ID.Hex(), `{"email":"New@Example.com"}`)
+	require.Equal(t, fiber.StatusAccepted, status)
+	require.NotNil(t, user.EmailChange)
+	assert.Equal(t, "new@example.com", user.EmailChange.NewEmail)
+
+	// The handler only sees token hashes, so swap in tokens the test knows
+	change, oldToken, newToken, err := NewEmailChange("new@example.com")
+	require.NoError(t, err)
+	user.EmailChange = change
+
+	status, _ = postJSON(t, app, "/profile/email/confirm", `{"token":"wrong"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, body := postJSON(t, app, "/profile/email/confirm", `{"token":"`+newToken+`"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, false, body["data"].(map[string]interface{})["changed"])
+	assert.Equal(t, "old@example.com", user.Email)
+
+	status, body = postJSON(t, app, "/profile/email/confirm", `{"token":"`+oldToken+`"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, true, body["data"].(map[string]interface{})["changed"])
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.Nil(t, user.EmailChange)
+
+	// Tokens cannot be reused
+	status, _ = postJSON(t, app, "/profile/email/confirm", `{"token":"`+oldToken+`"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
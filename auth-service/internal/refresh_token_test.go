@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memorySessions mirrors the refresh token family bookkeeping of SessionRepository
+func memorySessions(session *UserSession) *MockSessionRepository {
+	// No middleware sets the device locals in tests, so requests come from the device with an empty IP and User-Agent
+	if session.DeviceHash == "" {
+		session.DeviceHash = GenerateDeviceHash("", "")
+	}
+	if session.LastActivityAt.IsZero() {
+		session.LastActivityAt = time.Now().UTC()
+	}
+	return &MockSessionRepository{
+		FindSessionByRefreshTokenFunc: func(token string) (*UserSession, error) {
+			if session.IsActive && session.RefreshTokenHash == HashRefreshToken(token) {
+				copied := *session
+				return &copied, nil
+			}
+			return nil, nil
+		},
+		FindSessionByPreviousRefreshTokenFunc: func(token string) (*UserSession, error) {
+			for _, h := range session.PreviousTokenHashes {
+				if h == HashRefreshToken(token) {
+					copied := *session
+					return &copied, nil
+				}
+			}
+			return nil, nil
+		},
+		RotateSessionRefreshTokenFunc: func(sessionID string, current string, next string) (bool, error) {
+			if !session.IsActive || session.RefreshTokenHash != HashRefreshToken(current) {
+				return false, nil
+			}
+			session.PreviousTokenHashes = append(session.PreviousTokenHashes, session.RefreshTokenHash)
+			session.RefreshTokenHash = HashRefreshToken(next)
+			return true, nil
+		},
+		DeactivateSessionFunc: func(sessionID string) error {
+			session.IsActive = false
+			return nil
+		},
+	}
+}
+
+func newRefreshTestApp(t *testing.T, sessionRepo *MockSessionRepository, user *User) *fiber.App {
+	t.Helper()
+	userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User { return user }}
+	handler := NewUserHandler(newMockConfig(), userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	app.Post("/refresh", handler.RefreshToken)
+	return app
+}
+
+func refresh(t *testing.T, app *fiber.App, token string) (int, string) {
+	t.Helper()
+	status, body := postJSON(t, app, "/refresh", `{"refresh_token":"`+token+`"}`)
+	next := ""
+	if data, ok := body["data"].(map[string]interface{}); ok {
+		next, _ = data["refresh_token"].(string)
+	}
+	return status, next
+}
+
+func TestRefreshToken_RotatesWithinFamily(t *testing.T) {
+	user := NewUser("user@example.com")
+	session := &UserSession{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), SessionID: "s1", IsActive: true, RefreshTokenHash: HashRefreshToken("first")}
+	app := newRefreshTestApp(t, memorySessions(session), user)
+
+	status, second := refresh(t, app, "first")
+	require.Equal(t, fiber.StatusOK, status)
+	require.NotEmpty(t, second)
+
+	status, third := refresh(t, app, second)
+	require.Equal(t, fiber.StatusOK, status)
+	require.NotEmpty(t, third)
+
+	assert.Equal(t, HashRefreshToken(third), session.RefreshTokenHash)
+	assert.Equal(t, []string{HashRefreshToken("first"), HashRefreshToken(second)}, session.PreviousTokenHashes)
+	assert.True(t, session.IsActive)
+}
+
+func TestRefreshToken_ReuseRevokesSession(t *testing.T) {
+	user := NewUser("user@example.com")
+	session := &UserSession{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), SessionID: "s1", IsActive: true, RefreshTokenHash: HashRefreshToken("first")}
+	app := newRefreshTestApp(t, memorySessions(session), user)
+
+	status, second := refresh(t, app, "first")
+	require.Equal(t, fiber.StatusOK, status)
+
+	// Replaying the rotated token signs the whole session out
+	status, _ = refresh(t, app, "first")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.False(t, session.IsActive)
+
+	// including the token the legitimate client holds now
+	status, _ = refresh(t, app, second)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestRefreshToken_LostConcurrentRotationRevokesSession(t *testing.T) {
+	user := NewUser("user@example.com")
+	session := &UserSession{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), SessionID: "s1", IsActive: true, RefreshTokenHash: HashRefreshToken("first")}
+	sessionRepo := memorySessions(session)
+	sessionRepo.RotateSessionRefreshTokenFunc = func(string, string, string) (bool, error) { return false, nil }
+	app := newRefreshTestApp(t, sessionRepo, user)
+
+	status, _ := refresh(t, app, "first")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.False(t, session.IsActive)
+}
+
+func TestRefreshToken_UnknownTokenKeepsSessions(t *testing.T) {
+	user := NewUser("user@example.com")
+	session := &UserSession{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), SessionID: "s1", IsActive: true, RefreshTokenHash: HashRefreshToken("first")}
+	app := newRefreshTestApp(t, memorySessions(session), user)
+
+	status, _ := refresh(t, app, "never-issued")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.True(t, session.IsActive)
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	assert.Len(t, HashRefreshToken("token"), 64)
+	assert.Equal(t, HashRefreshToken("token"), HashRefreshToken("token"))
+	assert.NotEqual(t, HashRefreshToken("token"), HashRefreshToken("token2"))
+}
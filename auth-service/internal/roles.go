@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Roles carried in access tokens and forwarded by the gateway as x-user-roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var Roles = []string{RoleUser, RoleAdmin}
+
+// validRoles reports whether roles is non-empty, known and includes the user role
+func validRoles(roles []string) bool {
+	hasUser := false
+	for _, role := range roles {
+		known := false
+		for _, r := range Roles {
+			if r == role {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return false
+		}
+		if role == RoleUser {
+			hasUser = true
+		}
+	}
+	return hasUser
+}
+
+// RequireRole only lets through authenticated users holding one of the roles. Roles are read from
+// the database rather than the token, so a role change or account disable applies immediately.
+// image-service and pdf-service have no user store and check the roles the gateway forwards.
+func RequireRole(userRepo IUserRepository, roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userId, _ := c.Locals("userId").(string)
+		user := userRepo.FindByID(userId)
+		if user == nil || user.Disabled || !user.HasRole(roles...) {
+			log.Warnf("RequireRole: User %q denied %s %s", userId, c.Method(), c.Path())
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": ErrForbidden,
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Service tokens are short-lived client-credentials tokens issued to internal services listed in
+// SERVICE_CLIENTS. The gateway sends its token with every request it forwards, and services honor the
+// identity headers it sets only on requests that carry it.
+const (
+	ServiceTokenHeader = "x-service-token"
+	serviceTokenUse    = "service"
+)
+
+var ErrNotServiceToken = errors.New("not a service token")
+
+// identityHeaders carry the caller's identity from the gateway
+var identityHeaders = []string{"x-user-id", "x-user-roles", "x-user-scopes", "x-org-id", "x-org-role", "x-session-id"}
+
+// VerifyServiceToken checks a service token and returns the name of the service it was issued to
+func VerifyServiceToken(keyfunc jwt.Keyfunc, token string) (string, error) {
+	if token == "" {
+		return "", ErrNotServiceToken
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, keyfunc,
+		jwt.WithValidMethods([]string{SigningAlgRS256, SigningAlgEdDSA}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+	if use, _ := claims["token_use"].(string); use != serviceTokenUse {
+		return "", ErrNotServiceToken
+	}
+	return claims.GetSubject()
+}
+
+// SetupServiceIdentity only lets identity headers through on requests of a trusted service. On any
+// other request they are removed, so SetupAuthenticated, registered after it, treats the caller as
+// anonymous and a process that reaches the service directly cannot pose as a user. The session of a
+// trusted request is kept in the sessionId local for the handlers that mark or rebind it.
+func SetupServiceIdentity(app *fiber.App, keyfunc jwt.Keyfunc, trusted []string) {
+	app.Use(func(c *fiber.Ctx) error {
+		token := c.Get(ServiceTokenHeader)
+		c.Request().Header.Del(ServiceTokenHeader)
+
+		service, err := VerifyServiceToken(keyfunc, token)
+		if err == nil && slices.Contains(trusted, service) {
+			if sessionID := c.Get("x-session-id"); sessionID != "" {
+				c.Locals("sessionId", sessionID)
+			}
+			return c.Next()
+		}
+		if c.Get("x-user-id") != "" {
+			log.Warnf("SetupServiceIdentity: Ignoring identity headers of %s %s from an untrusted caller: %v", c.Method(), c.Path(), err)
+		}
+		for _, header := range identityHeaders {
+			c.Request().Header.Del(header)
+		}
+		return c.Next()
+	})
+}
+
+// clientCredentials issues a service token to an internal service (RFC 6749 section 4.4).
+// Service tokens have no refresh token; services request a new one before theirs expires.
+func (h *OAuthServerHandler) clientCredentials(c *fiber.Ctx) error {
+	name, secret, ok := clientAuth(c)
+	expected, known := h.users.cfg.ServiceClients[name]
+	if !ok || !known || subtle.ConstantTimeCompare([]byte(HashOAuthToken(secret)), []byte(HashOAuthToken(expected))) != 1 {
+		log.Warnf("clientCredentials: Authentication failed for service %q", name)
+		return invalidClient(c)
+	}
+
+	now := time.Now().UTC()
+	lifetime := time.Duration(h.users.cfg.ServiceTokenTTLMinutes) * time.Minute
+	token, err := h.users.keys.Sign(jwt.MapClaims{
+		"sub":       name,
+		"token_use": serviceTokenUse,
+		"iat":       now.Unix(),
+		"exp":       now.Add(lifetime).Unix(),
+	})
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, OAuthErrServerError, ErrInternalServer)
+	}
+
+	log.Infof("clientCredentials: Issued service token to %s", name)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(lifetime.Seconds()),
+	})
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuthServer_ClientCredentials(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	grant := url.Values{"grant_type": {"client_credentials"}}
+
+	status, body := formRequest(t, env.app, "/oauth2/token", grant, "gateway-service", "wrong")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, OAuthErrInvalidClient, body["error"])
+
+	status, body = formRequest(t, env.app, "/oauth2/token", grant, "image-service", "gateway-secret")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, OAuthErrInvalidClient, body["error"])
+
+	status, body = formRequest(t, env.app, "/oauth2/token", grant, "gateway-service", "gateway-secret")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.Equal(t, float64(300), body["expires_in"])
+	assert.NotContains(t, body, "refresh_token")
+
+	service, err := VerifyServiceToken(env.handler.users.keys.Keyfunc, body["access_token"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "gateway-service", service)
+}
+
+func TestVerifyServiceToken_RejectsUserTokens(t *testing.T) {
+	keys := newMockKeyManager()
+	token, err := keys.Sign(jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+
+	_, err = VerifyServiceToken(keys.Keyfunc, token)
+	assert.ErrorIs(t, err, ErrNotServiceToken)
+
+	expired, err := keys.Sign(jwt.MapClaims{
+		"sub":       "gateway-service",
+		"token_use": serviceTokenUse,
+		"exp":       time.Now().Add(-time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+	_, err = VerifyServiceToken(keys.Keyfunc, expired)
+	assert.Error(t, err)
+}
+
+// serviceToken signs a service token for the named internal service
+func serviceToken(t *testing.T, keys *KeyManager, name string) string {
+	t.Helper()
+	token, err := keys.Sign(jwt.MapClaims{
+		"sub":       name,
+		"token_use": serviceTokenUse,
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func TestSetupServiceIdentity(t *testing.T) {
+	keys := newMockKeyManager()
+	app := fiber.New()
+	SetupServiceIdentity(app, keys.Keyfunc, []string{"gateway-service"})
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		sessionId, _ := c.Locals("sessionId").(string)
+		return c.SendString(c.Get("x-user-id") + "|" + c.Get("x-org-id") + "|" + sessionId + "|" + c.Get(ServiceTokenHeader))
+	})
+
+	whoami := func(token string) string {
+		req := httptest.NewRequest(fiber.MethodGet, "/whoami", nil)
+		req.Header.Set("x-user-id", "user-1")
+		req.Header.Set("x-org-id", "org-1")
+		req.Header.Set("x-session-id", "session-1")
+		if token != "" {
+			req.Header.Set(ServiceTokenHeader, token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "user-1|org-1|session-1|", whoami(serviceToken(t, keys, "gateway-service")))
+	assert.Equal(t, "|||", whoami(""))
+	assert.Equal(t, "|||", whoami("not-a-token"))
+	assert.Equal(t, "|||", whoami(serviceToken(t, keys, "image-service")))
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -13,17 +14,46 @@ import (
 // UserSession represents a user's device session for binding tokens
 // Each login creates a new session with device-specific binding
 type UserSession struct {
-	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	UserID         string             `json:"user_id" bson:"user_id"`                                    // User ID this session belongs to
-	SessionID      string             `json:"session_id" bson:"session_id"`                              // Unique per session
-	DeviceHash     string             `json:"-" bson:"device_hash"`                                      // Hash of IP + User-Agent
-	IPAddress      string             `json:"ip_address" bson:"ip_address"`                              // Device IP for reference
-	UserAgent      string             `json:"-" bson:"user_agent"`                                       // Device User-Agent (not exposed in JSON)
-	RefreshToken   string             `json:"-" bson:"refresh_token"`                                    // Stored but not exposed
-	IsActive       bool               `json:"is_active" bson:"is_active"`                                // Track if session is active
-	LastActivityAt time.Time          `json:"last_activity_at" bson:"last_activity_at"`                  // Last request time
-	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`                              // Session creation time
-	ExpiresAt      time.Time          `json:"-" bson:"expires_at"`                                       // Session expiry time
+	ID                  primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID              string             `json:"user_id" bson:"user_id"`                   // User ID this session belongs to
+	SessionID           string             `json:"session_id" bson:"session_id"`             // Unique per session
+	DeviceHash          string             `json:"-" bson:"device_hash"`                     // Hash of IP + User-Agent
+	IPAddress           string             `json:"ip_address" bson:"ip_address"`             // Device IP for reference
+	UserAgent           string             `json:"-" bson:"user_agent"`                      // Device User-Agent (not exposed in JSON)
+	Device              DeviceInfo         `json:"device" bson:"device"`                     // Browser, OS and device type parsed from the User-Agent
+	Name                string             `json:"name" bson:"name,omitempty"`               // Name given to the device by the user
+	Current             bool               `json:"current" bson:"-"`                         // Set for the session making the request
+	RevokeTokenHash     string             `json:"-" bson:"revoke_token_hash,omitempty"`     // SHA256 of the "this wasn't me" token of a new-device alert
+	RefreshTokenHash    string             `json:"-" bson:"refresh_token_hash"`              // SHA256 of the current refresh token
+	PreviousTokenHashes []string           `json:"-" bson:"previous_token_hashes,omitempty"` // SHA256 of refresh tokens already rotated in this session
+	IsActive            bool               `json:"is_active" bson:"is_active"`               // Track if session is active
+	LastActivityAt      time.Time          `json:"last_activity_at" bson:"last_activity_at"` // Last request time
+	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`             // Session creation time
+	ExpiresAt           time.Time          `json:"-" bson:"expires_at"`                      // Absolute session expiry time
+	RevokedAt           *time.Time         `json:"-" bson:"revoked_at,omitempty"`            // When the session was signed out
+	ActiveOrgID         string             `json:"-" bson:"active_org_id,omitempty"`         // Organization the session acts in, empty for the personal workspace
+	ActiveOrgRole       string             `json:"-" bson:"active_org_role,omitempty"`       // Role of the user in the active organization
+	OrgIDs              []string           `json:"-" bson:"org_ids,omitempty"`               // Organizations the session acted in, whose claims its access tokens may carry
+	ClientID            string             `json:"-" bson:"client_id,omitempty"`             // OAuth client the user authorized, empty for sign-ins
+	Scopes              []string           `json:"-" bson:"scopes,omitempty"`                // Scopes granted to the OAuth client
+}
+
+// OAuthState tracks a started OAuth login until its callback arrives
+// The state is also set in a short-lived cookie to bind the flow to the browser that started it
+type OAuthState struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	State        string             `bson:"state"`         // Random state sent to the provider
+	CodeVerifier string             `bson:"code_verifier"` // PKCE verifier, only its S256 challenge leaves the server
+	Provider     string             `bson:"provider"`      // Provider the flow was started for
+	UserID       string             `bson:"user_id"`       // Set when an authenticated user is linking an identity
+	CreatedAt    time.Time          `bson:"created_at"`
+	ExpiresAt    time.Time          `bson:"expires_at"`
+}
+
+// HashRefreshToken returns the SHA256 hex digest under which a refresh token is stored
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // GenerateDeviceHash creates a SHA256 hash of IP + User-Agent
@@ -9,25 +9,41 @@ import (
 	initx "github.com/instrlabs/shared/init"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // SessionRepository handles all database operations for user sessions
 type SessionRepository struct {
-	db         *initx.Mongo
-	collection *mongo.Collection
+	db          *initx.Mongo
+	collection  *mongo.Collection
+	oauthStates *mongo.Collection
+	lifetime    time.Duration
 }
 
-// NewSessionRepository creates a new session repository instance
-func NewSessionRepository(db *initx.Mongo) *SessionRepository {
+// NewSessionRepository creates a new session repository instance whose sessions expire after lifetime,
+// however active they are
+func NewSessionRepository(db *initx.Mongo, lifetime time.Duration) *SessionRepository {
 	return &SessionRepository{
-		db:         db,
-		collection: db.DB.Collection("user_sessions"),
+		db:          db,
+		collection:  db.DB.Collection("user_sessions"),
+		oauthStates: db.DB.Collection("oauth_states"),
+		lifetime:    lifetime,
 	}
 }
 
 // CreateSession creates a new session for a user with device binding
 // Returns the created session or error
 func (r *SessionRepository) CreateSession(userID, ipAddress, userAgent string) (*UserSession, error) {
+	return r.createSession(userID, "", nil, ipAddress, userAgent)
+}
+
+// CreateClientSession creates the session of an OAuth client the user authorized. It holds the
+// client's refresh token and is bound to the client's server like a sign-in to its device.
+func (r *SessionRepository) CreateClientSession(userID, clientID string, scopes []string, ipAddress, userAgent string) (*UserSession, error) {
+	return r.createSession(userID, clientID, scopes, ipAddress, userAgent)
+}
+
+func (r *SessionRepository) createSession(userID, clientID string, scopes []string, ipAddress, userAgent string) (*UserSession, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -37,10 +53,13 @@ func (r *SessionRepository) CreateSession(userID, ipAddress, userAgent string) (
 		DeviceHash:     GenerateDeviceHash(ipAddress, userAgent),
 		IPAddress:      ipAddress,
 		UserAgent:      userAgent,
+		Device:         ParseUserAgent(userAgent),
 		IsActive:       true,
 		LastActivityAt: time.Now().UTC(),
 		CreatedAt:      time.Now().UTC(),
-		ExpiresAt:      time.Now().UTC().AddDate(0, 0, 30), // 30 days
+		ExpiresAt:      time.Now().UTC().Add(r.lifetime),
+		ClientID:       clientID,
+		Scopes:         scopes,
 	}
 
 	_, err := r.collection.InsertOne(ctx, session)
@@ -53,17 +72,110 @@ func (r *SessionRepository) CreateSession(userID, ipAddress, userAgent string) (
 	return session, nil
 }
 
-// FindSessionByRefreshToken finds a session by refresh token and checks if active
+// IsNewDevice reports whether the user signs in from a device hash none of their sessions used before.
+// The first session of an account is not reported, there is nothing to compare it with.
+func (r *SessionRepository) IsNewDevice(userID, deviceHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	known, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID, "device_hash": deviceHash}, options.Count().SetLimit(1))
+	if err != nil {
+		log.Errorf("IsNewDevice: Failed to look up device: %v", err)
+		return false, err
+	}
+	if known > 0 {
+		return false, nil
+	}
+
+	sessions, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID}, options.Count().SetLimit(1))
+	if err != nil {
+		log.Errorf("IsNewDevice: Failed to count sessions: %v", err)
+		return false, err
+	}
+	return sessions > 0, nil
+}
+
+// RenameSession sets the name the user gave a device session; an empty name removes it
+// Returns false if the session does not belong to the user
+func (r *SessionRepository) RenameSession(sessionID, userID, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"name": name}}
+	if name == "" {
+		update = bson.M{"$unset": bson.M{"name": ""}}
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"session_id": sessionID, "user_id": userID}, update)
+	if err != nil {
+		log.Errorf("RenameSession: Failed to rename session: %v", err)
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// SetSessionRevokeToken stores the hash of the token that lets the user revoke the session from a new-device alert
+func (r *SessionRepository) SetSessionRevokeToken(sessionID, tokenHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"session_id": sessionID}, bson.M{
+		"$set": bson.M{"revoke_token_hash": tokenHash},
+	})
+	if err != nil {
+		log.Errorf("SetSessionRevokeToken: Failed to set revoke token: %v", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeSessionByToken deactivates the session of a revoke token and consumes the token
+// Returns the session as it was before, or nil if the token is unknown or already used
+func (r *SessionRepository) RevokeSessionByToken(tokenHash string) (*UserSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session UserSession
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"revoke_token_hash": tokenHash}, bson.M{
+		"$set":   bson.M{"is_active": false, "revoked_at": time.Now().UTC()},
+		"$unset": bson.M{"revoke_token_hash": ""},
+	}).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Warn("RevokeSessionByToken: Revoke token not found or already used")
+			return nil, nil
+		}
+		log.Errorf("RevokeSessionByToken: Failed to revoke session: %v", err)
+		return nil, err
+	}
+
+	log.Infof("RevokeSessionByToken: Session %s revoked", session.SessionID)
+	return &session, nil
+}
+
+// maxPreviousTokenHashes bounds how many rotated refresh tokens a session remembers for reuse detection
+const maxPreviousTokenHashes = 100
+
+// currentRefreshTokenFilter matches the session whose current refresh token is the given one.
+// Sessions created before tokens were hashed still hold the plaintext token until their next rotation.
+func currentRefreshTokenFilter(refreshToken string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"refresh_token_hash": HashRefreshToken(refreshToken)},
+		bson.M{"refresh_token": refreshToken},
+	}}
+}
+
+// FindSessionByRefreshToken finds a session by its current refresh token and checks if active
 // Returns nil if not found or expired
 func (r *SessionRepository) FindSessionByRefreshToken(refreshToken string) (*UserSession, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	filter := currentRefreshTokenFilter(refreshToken)
+	filter["is_active"] = true
+
 	var session UserSession
-	err := r.collection.FindOne(ctx, bson.M{
-		"refresh_token": refreshToken,
-		"is_active":     true,
-	}).Decode(&session)
+	err := r.collection.FindOne(ctx, filter).Decode(&session)
 
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -84,6 +196,28 @@ func (r *SessionRepository) FindSessionByRefreshToken(refreshToken string) (*Use
 	return &session, nil
 }
 
+// FindSessionByPreviousRefreshToken finds the session in which the refresh token was already rotated
+// Returns nil if the token was never part of a session
+func (r *SessionRepository) FindSessionByPreviousRefreshToken(refreshToken string) (*UserSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session UserSession
+	err := r.collection.FindOne(ctx, bson.M{
+		"previous_token_hashes": HashRefreshToken(refreshToken),
+	}).Decode(&session)
+
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		log.Errorf("FindSessionByPreviousRefreshToken: Failed to find session: %v", err)
+		return nil, err
+	}
+
+	return &session, nil
+}
+
 // FindSessionByID finds a specific session by ID and user ID
 // Returns nil if not found
 func (r *SessionRepository) FindSessionByID(sessionID, userID string) (*UserSession, error) {
@@ -108,33 +242,28 @@ func (r *SessionRepository) FindSessionByID(sessionID, userID string) (*UserSess
 	return &session, nil
 }
 
-// ValidateSession checks if a session is valid for the given device
-// Returns true only if session exists, is active, not expired, and device hash matches
-func (r *SessionRepository) ValidateSession(sessionID, userID, deviceHash string) bool {
-	session, err := r.FindSessionByID(sessionID, userID)
-	if err != nil || session == nil {
-		return false
-	}
-
-	if !session.IsActive {
-		log.Warnf("ValidateSession: Session %s is inactive", sessionID)
-		return false
-	}
+// RebindSession binds the session to a new device after the user re-verified their identity
+func (r *SessionRepository) RebindSession(sessionID, ipAddress, userAgent string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	if time.Now().UTC().After(session.ExpiresAt) {
-		log.Warnf("ValidateSession: Session %s has expired", sessionID)
-		_ = r.DeactivateSession(sessionID)
-		return false
+	update := bson.M{
+		"$set": bson.M{
+			"device_hash": GenerateDeviceHash(ipAddress, userAgent),
+			"ip_address":  ipAddress,
+			"user_agent":  userAgent,
+			"device":      ParseUserAgent(userAgent),
+		},
 	}
 
-	if session.DeviceHash != deviceHash {
-		log.Warnf("ValidateSession: Device hash mismatch for session %s - possible token theft", sessionID)
-		// Deactivate session immediately due to potential token theft
-		_ = r.DeactivateSession(sessionID)
-		return false
+	_, err := r.collection.UpdateOne(ctx, bson.M{"session_id": sessionID}, update)
+	if err != nil {
+		log.Errorf("RebindSession: Failed to rebind session: %v", err)
+		return err
 	}
 
-	return true
+	log.Infof("RebindSession: Session %s bound to IP %s", sessionID, ipAddress)
+	return nil
 }
 
 // UpdateSessionActivity updates the last activity timestamp for a session
@@ -166,11 +295,12 @@ func (r *SessionRepository) DeactivateSession(sessionID string) error {
 
 	update := bson.M{
 		"$set": bson.M{
-			"is_active": false,
+			"is_active":  false,
+			"revoked_at": time.Now().UTC(),
 		},
 	}
 
-	_, err := r.collection.UpdateOne(ctx, bson.M{"session_id": sessionID}, update)
+	_, err := r.collection.UpdateOne(ctx, bson.M{"session_id": sessionID, "is_active": true}, update)
 	if err != nil {
 		log.Errorf("DeactivateSession: Failed to deactivate session: %v", err)
 		return err
@@ -206,6 +336,98 @@ func (r *SessionRepository) GetUserSessions(userID string) ([]UserSession, error
 	return sessions, nil
 }
 
+// FindIdleSessions returns the active sessions whose last activity is before cutoff
+func (r *SessionRepository) FindIdleSessions(cutoff time.Time) ([]UserSession, error) {
+	return r.findSessions("FindIdleSessions", bson.M{
+		"is_active":        true,
+		"last_activity_at": bson.M{"$lt": cutoff},
+	})
+}
+
+// FindClientSessions returns the active sessions of an OAuth client
+func (r *SessionRepository) FindClientSessions(clientID string) ([]UserSession, error) {
+	return r.findSessions("FindClientSessions", bson.M{
+		"client_id": clientID,
+		"is_active": true,
+	})
+}
+
+// FindRevokedSessions returns the sessions revoked since the given time
+func (r *SessionRepository) FindRevokedSessions(since time.Time) ([]UserSession, error) {
+	return r.findSessions("FindRevokedSessions", bson.M{
+		"revoked_at": bson.M{"$gte": since},
+	})
+}
+
+// FindOrgSessions returns the active sessions that acted in the organization, only those of userID when it is set
+func (r *SessionRepository) FindOrgSessions(orgID string, userID string) ([]UserSession, error) {
+	filter := bson.M{
+		"$or":       bson.A{bson.M{"org_ids": orgID}, bson.M{"active_org_id": orgID}},
+		"is_active": true,
+	}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	return r.findSessions("FindOrgSessions", filter)
+}
+
+// SetSessionOrg switches the organization a session acts in. An empty orgID switches to the personal workspace.
+func (r *SessionRepository) SetSessionOrg(sessionID string, orgID string, role string) error {
+	return r.setSessionOrg("SetSessionOrg", bson.M{"session_id": sessionID}, orgID, role)
+}
+
+// UpdateSessionOrgRole applies a member's new role to their sessions acting in the organization.
+// An empty role means they left it, and the sessions switch to the personal workspace.
+func (r *SessionRepository) UpdateSessionOrgRole(userID string, orgID string, role string) error {
+	filter := bson.M{"user_id": userID, "active_org_id": orgID}
+	if role == "" {
+		return r.setSessionOrg("UpdateSessionOrgRole", filter, "", "")
+	}
+	return r.setSessionOrg("UpdateSessionOrgRole", filter, orgID, role)
+}
+
+// ClearSessionOrg switches every session acting in a deleted organization to the personal workspace
+func (r *SessionRepository) ClearSessionOrg(orgID string) error {
+	return r.setSessionOrg("ClearSessionOrg", bson.M{"active_org_id": orgID}, "", "")
+}
+
+func (r *SessionRepository) setSessionOrg(caller string, filter bson.M, orgID string, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set":      bson.M{"active_org_id": orgID, "active_org_role": role},
+		"$addToSet": bson.M{"org_ids": orgID},
+	}
+	if orgID == "" {
+		update = bson.M{"$unset": bson.M{"active_org_id": "", "active_org_role": ""}}
+	}
+	if _, err := r.collection.UpdateMany(ctx, filter, update); err != nil {
+		log.Errorf("%s: Failed to update session organization: %v", caller, err)
+		return err
+	}
+	return nil
+}
+
+func (r *SessionRepository) findSessions(caller string, filter bson.M) ([]UserSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		log.Errorf("%s: Failed to find sessions: %v", caller, err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []UserSession{}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		log.Errorf("%s: Failed to decode sessions: %v", caller, err)
+		return nil, err
+	}
+	return sessions, nil
+}
+
 // ClearExpiredSessions removes expired sessions for a user
 // Should be called periodically or after session operations
 func (r *SessionRepository) ClearExpiredSessions(userID string) error {
@@ -237,11 +459,12 @@ func (r *SessionRepository) ClearAllUserSessions(userID string) error {
 
 	update := bson.M{
 		"$set": bson.M{
-			"is_active": false,
+			"is_active":  false,
+			"revoked_at": time.Now().UTC(),
 		},
 	}
 
-	result, err := r.collection.UpdateMany(ctx, bson.M{"user_id": userID}, update)
+	result, err := r.collection.UpdateMany(ctx, bson.M{"user_id": userID, "is_active": true}, update)
 	if err != nil {
 		log.Errorf("ClearAllUserSessions: Failed to deactivate sessions: %v", err)
 		return err
@@ -251,16 +474,31 @@ func (r *SessionRepository) ClearAllUserSessions(userID string) error {
 	return nil
 }
 
-// UpdateSessionRefreshToken updates the refresh token for a session
-// Called when issuing new tokens after refresh
+// DeleteUserSessions removes every session of the user, active or not
+func (r *SessionRepository) DeleteUserSessions(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		log.Errorf("DeleteUserSessions: Failed to delete sessions: %v", err)
+		return err
+	}
+
+	log.Infof("DeleteUserSessions: Deleted %d sessions for user %s", result.DeletedCount, userID)
+	return nil
+}
+
+// UpdateSessionRefreshToken sets the first refresh token of a new session
+// Only its hash is stored
 func (r *SessionRepository) UpdateSessionRefreshToken(sessionID, newRefreshToken string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	update := bson.M{
 		"$set": bson.M{
-			"refresh_token":    newRefreshToken,
-			"last_activity_at": time.Now().UTC(),
+			"refresh_token_hash": HashRefreshToken(newRefreshToken),
+			"last_activity_at":   time.Now().UTC(),
 		},
 	}
 
@@ -272,3 +510,73 @@ func (r *SessionRepository) UpdateSessionRefreshToken(sessionID, newRefreshToken
 
 	return nil
 }
+
+// RotateSessionRefreshToken replaces the current refresh token and remembers the old one as rotated.
+// Returns false if currentRefreshToken is no longer the session's current token, e.g. it was rotated concurrently.
+func (r *SessionRepository) RotateSessionRefreshToken(sessionID, currentRefreshToken, newRefreshToken string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := currentRefreshTokenFilter(currentRefreshToken)
+	filter["session_id"] = sessionID
+	filter["is_active"] = true
+
+	update := bson.M{
+		"$set": bson.M{
+			"refresh_token_hash": HashRefreshToken(newRefreshToken),
+			"last_activity_at":   time.Now().UTC(),
+		},
+		"$unset": bson.M{"refresh_token": ""},
+		"$push": bson.M{
+			"previous_token_hashes": bson.M{
+				"$each":  bson.A{HashRefreshToken(currentRefreshToken)},
+				"$slice": -maxPreviousTokenHashes,
+			},
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Errorf("RotateSessionRefreshToken: Failed to rotate refresh token: %v", err)
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// SaveOAuthState stores the state and PKCE verifier of a started OAuth login
+func (r *SessionRepository) SaveOAuthState(state *OAuthState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.oauthStates.InsertOne(ctx, state)
+	if err != nil {
+		log.Errorf("SaveOAuthState: Failed to save OAuth state: %v", err)
+		return err
+	}
+	return nil
+}
+
+// TakeOAuthState loads and deletes an OAuth state so a callback can only be completed once
+// Returns nil if the state is unknown, already used or expired
+func (r *SessionRepository) TakeOAuthState(state string) (*OAuthState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var oauthState OAuthState
+	err := r.oauthStates.FindOneAndDelete(ctx, bson.M{"state": state}).Decode(&oauthState)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Warn("TakeOAuthState: OAuth state not found or already used")
+			return nil, nil
+		}
+		log.Errorf("TakeOAuthState: Failed to find OAuth state: %v", err)
+		return nil, err
+	}
+
+	if time.Now().UTC().After(oauthState.ExpiresAt) {
+		log.Warn("TakeOAuthState: OAuth state has expired")
+		return nil, nil
+	}
+	return &oauthState, nil
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// SessionSweepInterval is how often sessions past their idle timeout are signed out
+const SessionSweepInterval = 15 * time.Minute
+
+// RevokedSession tells the gateway and notification service to reject access tokens of a session
+// until Until, when every token issued for it has expired on its own
+type RevokedSession struct {
+	SessionID string    `json:"session_id"`
+	Until     time.Time `json:"until"`
+}
+
+// SessionRevocations is published when sessions are revoked. It is also the reply to a revocation
+// list request, which services send on startup to fill their cache.
+type SessionRevocations struct {
+	Sessions []RevokedSession `json:"sessions"`
+}
+
+// SessionActivity is published by the gateway, at most once per interval for each session in use
+type SessionActivity struct {
+	SessionID string `json:"session_id"`
+}
+
+func (h *UserHandler) accessTokenLifetime() time.Duration {
+	return time.Duration(h.cfg.TokenExpiryHours) * time.Hour
+}
+
+func (h *UserHandler) idleTimeout() time.Duration {
+	return time.Duration(h.cfg.SessionIdleTimeoutHours) * time.Hour
+}
+
+// revokeSession deactivates a session and broadcasts its revocation, so its access tokens stop working at once
+func (h *UserHandler) revokeSession(sessionID string) error {
+	if err := h.sessionRepo.DeactivateSession(sessionID); err != nil {
+		return err
+	}
+	h.publishRevocations([]string{sessionID})
+	return nil
+}
+
+// revokeAllSessions signs the user out of every device and broadcasts the revocations
+func (h *UserHandler) revokeAllSessions(userID string) error {
+	sessions, err := h.sessionRepo.GetUserSessions(userID)
+	if err != nil {
+		return err
+	}
+	if err := h.sessionRepo.ClearAllUserSessions(userID); err != nil {
+		return err
+	}
+
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		sessionIDs = append(sessionIDs, session.SessionID)
+	}
+	h.publishRevocations(sessionIDs)
+	return nil
+}
+
+func (h *UserHandler) publishRevocations(sessionIDs []string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+
+	until := time.Now().UTC().Add(h.accessTokenLifetime())
+	revocations := SessionRevocations{Sessions: make([]RevokedSession, 0, len(sessionIDs))}
+	for _, sessionID := range sessionIDs {
+		revocations.Sessions = append(revocations.Sessions, RevokedSession{SessionID: sessionID, Until: until})
+	}
+
+	data, _ := json.Marshal(revocations)
+	if err := h.events.Publish(h.cfg.NatsSubjectSessionRevoked, data); err != nil {
+		log.Errorf("publishRevocations: Failed to publish %d session revocations: %v", len(sessionIDs), err)
+	}
+}
+
+// expireIdleSession signs out a session that has not been used for longer than the idle timeout.
+// Returns true if the session was expired.
+func (h *UserHandler) expireIdleSession(c *fiber.Ctx, session *UserSession) bool {
+	if time.Since(session.LastActivityAt) <= h.idleTimeout() {
+		return false
+	}
+
+	log.Infof("expireIdleSession: Session %s idle since %s", session.SessionID, session.LastActivityAt.Format(time.RFC3339))
+	if err := h.revokeSession(session.SessionID); err != nil {
+		log.Errorf("expireIdleSession: Failed to revoke session %s: %v", session.SessionID, err)
+	}
+	h.audit(c, AuditSessionExpired, AuditResultIdle, session.UserID, session.SessionID, nil)
+	return true
+}
+
+// sessionIdle rejects a refresh of a session that was signed out for inactivity
+func sessionIdle(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"message": ErrSessionIdle,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// RevokeIdleSessions signs out every session that has not been used for longer than the idle timeout
+func (h *UserHandler) RevokeIdleSessions() {
+	sessions, err := h.sessionRepo.FindIdleSessions(time.Now().UTC().Add(-h.idleTimeout()))
+	if err != nil {
+		return
+	}
+
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		if err := h.sessionRepo.DeactivateSession(session.SessionID); err != nil {
+			continue
+		}
+		sessionIDs = append(sessionIDs, session.SessionID)
+	}
+	h.publishRevocations(sessionIDs)
+	if len(sessionIDs) > 0 {
+		log.Infof("RevokeIdleSessions: Signed out %d idle sessions", len(sessionIDs))
+	}
+}
+
+// SessionActivityMessage records that the gateway saw a request of the session
+func (h *UserHandler) SessionActivityMessage(data []byte) {
+	var msg SessionActivity
+	if err := json.Unmarshal(data, &msg); err != nil || msg.SessionID == "" {
+		log.Warnf("SessionActivityMessage: Invalid message: %s", string(data))
+		return
+	}
+	_ = h.sessionRepo.UpdateSessionActivity(msg.SessionID)
+}
+
+// RevokedSessionsMessage answers a revocation list request with every session whose access tokens may still be valid
+func (h *UserHandler) RevokedSessionsMessage() []byte {
+	lifetime := h.accessTokenLifetime()
+	revocations := SessionRevocations{Sessions: []RevokedSession{}}
+
+	sessions, err := h.sessionRepo.FindRevokedSessions(time.Now().UTC().Add(-lifetime))
+	if err == nil {
+		for _, session := range sessions {
+			if session.RevokedAt == nil {
+				continue
+			}
+			revocations.Sessions = append(revocations.Sessions, RevokedSession{
+				SessionID: session.SessionID,
+				Until:     session.RevokedAt.Add(lifetime),
+			})
+		}
+	}
+
+	data, _ := json.Marshal(revocations)
+	return data
+}
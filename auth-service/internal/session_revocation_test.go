@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func revocationsOf(t *testing.T, events *recordingPublisher) []RevokedSession {
+	t.Helper()
+	var sessions []RevokedSession
+	for i, subject := range events.subjects {
+		if subject != "auth.sessions.revoked" {
+			continue
+		}
+		var msg SessionRevocations
+		require.NoError(t, json.Unmarshal(events.messages[i], &msg))
+		sessions = append(sessions, msg.Sessions...)
+	}
+	return sessions
+}
+
+func TestLogout_PublishesRevocation(t *testing.T) {
+	sessionRepo := &MockSessionRepository{}
+	events := &recordingPublisher{}
+	handler := NewUserHandler(newMockConfig(), &MockUserRepository{}, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, events, newMockMailer())
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", "user-1")
+		c.Locals("sessionId", "s1")
+		return c.Next()
+	})
+	app.Post("/logout", handler.Logout)
+
+	status, _ := postJSON(t, app, "/logout", "")
+	require.Equal(t, fiber.StatusOK, status)
+
+	revoked := revocationsOf(t, events)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, "s1", revoked[0].SessionID)
+	// Access tokens issued just before the logout stay valid for TokenExpiryHours, so must the revocation
+	assert.WithinDuration(t, time.Now().Add(time.Hour), revoked[0].Until, time.Minute)
+}
+
+func TestLogoutAllDevices_PublishesEveryActiveSession(t *testing.T) {
+	cleared := false
+	sessionRepo := &MockSessionRepository{
+		GetUserSessionsFunc: func(userID string) ([]UserSession, error) {
+			return []UserSession{{SessionID: "s1"}, {SessionID: "s2"}}, nil
+		},
+		ClearAllUserSessionsFunc: func(userID string) error {
+			cleared = true
+			return nil
+		},
+	}
+	events := &recordingPublisher{}
+	handler := NewUserHandler(newMockConfig(), &MockUserRepository{}, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, events, newMockMailer())
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", "user-1")
+		return c.Next()
+	})
+	app.Post("/devices/logout-all", handler.LogoutAllDevices)
+
+	status, _ := postJSON(t, app, "/devices/logout-all", "")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.True(t, cleared)
+
+	revoked := revocationsOf(t, events)
+	require.Len(t, revoked, 2)
+	assert.Equal(t, "s1", revoked[0].SessionID)
+	assert.Equal(t, "s2", revoked[1].SessionID)
+}
+
+func TestRefreshToken_IdleSessionExpires(t *testing.T) {
+	user := NewUser("user@example.com")
+	session := &UserSession{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), SessionID: "s1", IsActive: true,
+		RefreshTokenHash: HashRefreshToken("first"), LastActivityAt: time.Now().UTC().Add(-169 * time.Hour)}
+	sessionRepo := memorySessions(session)
+	events := &recordingPublisher{}
+	auditLog := &memoryAuditLog{}
+	userRepo := &MockUserRepository{FindByIDFunc: func(id string) *User { return user }}
+	handler := NewUserHandler(newMockConfig(), userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), auditLog, events, newMockMailer())
+	app := fiber.New()
+	app.Post("/refresh", handler.RefreshToken)
+
+	status, body := postJSON(t, app, "/refresh", `{"refresh_token":"first"}`)
+	require.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, ErrSessionIdle, body["message"])
+	assert.False(t, session.IsActive)
+	assert.Contains(t, auditLog.types(), AuditSessionExpired+":"+AuditResultIdle)
+
+	revoked := revocationsOf(t, events)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, "s1", revoked[0].SessionID)
+}
+
+func TestRevokeIdleSessions(t *testing.T) {
+	var cutoff time.Time
+	deactivated := []string{}
+	sessionRepo := &MockSessionRepository{
+		FindIdleSessionsFunc: func(before time.Time) ([]UserSession, error) {
+			cutoff = before
+			return []UserSession{{SessionID: "s1"}, {SessionID: "s2"}}, nil
+		},
+		DeactivateSessionFunc: func(sessionID string) error {
+			deactivated = append(deactivated, sessionID)
+			return nil
+		},
+	}
+	events := &recordingPublisher{}
+	handler := NewUserHandler(newMockConfig(), &MockUserRepository{}, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, events, newMockMailer())
+
+	handler.RevokeIdleSessions()
+
+	assert.WithinDuration(t, time.Now().Add(-168*time.Hour), cutoff, time.Minute)
+	assert.Equal(t, []string{"s1", "s2"}, deactivated)
+	assert.Len(t, events.messages, 1, "revocations are batched into one message")
+	assert.Len(t, revocationsOf(t, events), 2)
+}
+
+func TestRevokedSessionsMessage(t *testing.T) {
+	revokedAt := time.Now().UTC().Add(-10 * time.Minute).Truncate(time.Second)
+	var since time.Time
+	sessionRepo := &MockSessionRepository{FindRevokedSessionsFunc: func(after time.Time) ([]UserSession, error) {
+		since = after
+		return []UserSession{{SessionID: "s1", RevokedAt: &revokedAt}}, nil
+	}}
+	handler := NewUserHandler(newMockConfig(), &MockUserRepository{}, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	var reply SessionRevocations
+	require.NoError(t, json.Unmarshal(handler.RevokedSessionsMessage(), &reply))
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), since, time.Minute)
+	require.Len(t, reply.Sessions, 1)
+	assert.Equal(t, "s1", reply.Sessions[0].SessionID)
+	assert.True(t, revokedAt.Add(time.Hour).Equal(reply.Sessions[0].Until))
+}
+
+func TestSessionActivityMessage(t *testing.T) {
+	touched := []string{}
+	sessionRepo := &MockSessionRepository{UpdateSessionActivityFunc: func(sessionID string) error {
+		touched = append(touched, sessionID)
+		return nil
+	}}
+	handler := NewUserHandler(newMockConfig(), &MockUserRepository{}, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+
+	handler.SessionActivityMessage([]byte(`{"session_id":"s1"}`))
+	handler.SessionActivityMessage([]byte(`{"session_id":""}`))
+	handler.SessionActivityMessage([]byte(`not json`))
+	assert.Equal(t, []string{"s1"}, touched)
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Supported access token signing algorithms
+const (
+	SigningAlgRS256 = "RS256"
+	SigningAlgEdDSA = "EdDSA"
+)
+
+const rsaKeyBits = 2048
+
+// SigningKey is an access token signing key. Keys are published in the JWKS from creation until
+// ExpiresAt, sign tokens between ActivatesAt and RetiresAt, and stay published afterwards
+// until every token they signed has expired.
+type SigningKey struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	KID         string             `bson:"kid"`
+	Algorithm   string             `bson:"algorithm"`
+	PrivateKey  []byte             `bson:"private_key"` // PKCS#8 DER
+	CreatedAt   time.Time          `bson:"created_at"`
+	ActivatesAt time.Time          `bson:"activates_at"`
+	RetiresAt   time.Time          `bson:"retires_at"`
+	ExpiresAt   time.Time          `bson:"expires_at"`
+}
+
+// NewSigningKey generates a key that signs from activatesAt for lifetime and is published for overlap after that
+func NewSigningKey(algorithm string, activatesAt time.Time, lifetime, overlap time.Duration) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case SigningAlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case SigningAlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	kid := make([]byte, 12)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:          primitive.NewObjectID(),
+		KID:         base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:   algorithm,
+		PrivateKey:  der,
+		CreatedAt:   time.Now().UTC(),
+		ActivatesAt: activatesAt,
+		RetiresAt:   activatesAt.Add(lifetime),
+		ExpiresAt:   activatesAt.Add(lifetime + overlap),
+	}, nil
+}
+
+// Signer parses the stored private key
+func (k *SigningKey) Signer() (crypto.Signer, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not a signer", k.KID)
+	}
+	return signer, nil
+}
+
+// Method returns the JWT signing method of the key
+func (k *SigningKey) Method() jwt.SigningMethod {
+	if k.Algorithm == SigningAlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KTY string `json:"kty"`
+	KID string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	CRV string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// PublicJWK describes the public half of the key
+func PublicJWK(kid string, algorithm string, public crypto.PublicKey) (JWK, error) {
+	jwk := JWK{KID: kid, Use: "sig", Alg: algorithm}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		jwk.KTY = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KTY = "OKP"
+		jwk.CRV = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+	return jwk, nil
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	initx "github.com/instrlabs/shared/init"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SigningKeyRepository stores access token signing keys shared by all auth-service instances
+type SigningKeyRepository struct {
+	db         *initx.Mongo
+	collection *mongo.Collection
+}
+
+// NewSigningKeyRepository creates a new signing key repository instance
+func NewSigningKeyRepository(db *initx.Mongo) *SigningKeyRepository {
+	return &SigningKeyRepository{
+		db:         db,
+		collection: db.DB.Collection("signing_keys"),
+	}
+}
+
+// CreateSigningKey stores a newly generated key
+func (r *SigningKeyRepository) CreateSigningKey(key *SigningKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, key)
+	if err != nil {
+		log.Errorf("CreateSigningKey: Failed to create signing key: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindSigningKeys returns the keys still published at now, oldest activation first
+func (r *SigningKeyRepository) FindSigningKeys(now time.Time) ([]SigningKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"expires_at": bson.M{"$gt": now}}, options.Find().SetSort(bson.M{"activates_at": 1}))
+	if err != nil {
+		log.Errorf("FindSigningKeys: Failed to find signing keys: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []SigningKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		log.Errorf("FindSigningKeys: Failed to decode signing keys: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// DeleteExpiredSigningKeys removes keys that are no longer published
+func (r *SigningKeyRepository) DeleteExpiredSigningKeys(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		log.Errorf("DeleteExpiredSigningKeys: Failed to delete expired signing keys: %v", err)
+		return err
+	}
+	return nil
+}
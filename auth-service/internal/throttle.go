@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Throttle keys
+const (
+	throttleLoginEmail   = "login:email:"
+	throttleLoginIP      = "login:ip:"
+	throttlePin          = "pin:"
+	throttleSendPinEmail = "send-pin:email:"
+	throttleSendPinIP    = "send-pin:ip:"
+	throttlePinCooldown  = "send-pin:cooldown:"
+	throttleMFAUser      = "mfa:user:"
+	throttleMFAIP        = "mfa:ip:"
+	throttleMFAToken     = "mfa:token:"
+)
+
+// Throttle limits attempts per key. Once a key reaches its limit it is locked, and every further
+// attempt after the lock ends doubles the lockout, up to LockoutMaxSeconds.
+type Throttle struct {
+	cfg   *Config
+	store IAttemptStore
+}
+
+func NewThrottle(cfg *Config, store IAttemptStore) *Throttle {
+	return &Throttle{cfg: cfg, store: store}
+}
+
+// Wait returns how long the most restrictive of the keys stays locked. Store errors fail open
+// so an unavailable store does not lock everyone out; they are logged.
+func (t *Throttle) Wait(keys ...string) time.Duration {
+	now := time.Now().UTC()
+	var wait time.Duration
+	for _, key := range keys {
+		record, err := t.store.GetAttempts(key)
+		if err != nil {
+			log.Errorf("Throttle: Failed to read %s: %v", key, err)
+			continue
+		}
+		if record != nil && record.LockedUntil.After(now) {
+			if d := record.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// Hit records an attempt for key and locks it once limit attempts were made within the window.
+// Returns the attempt count.
+func (t *Throttle) Hit(key string, limit int) int {
+	record, err := t.store.IncrementAttempts(key, time.Duration(t.cfg.AttemptWindowMinutes)*time.Minute)
+	if err != nil {
+		log.Errorf("Throttle: Failed to count %s: %v", key, err)
+		return 0
+	}
+
+	if limit > 0 && record.Count >= limit {
+		lockout := t.lockout(record.Count - limit)
+		log.Warnf("Throttle: %s reached %d attempts, locked for %s", key, record.Count, lockout)
+		if err := t.store.LockAttempts(key, time.Now().UTC().Add(lockout)); err != nil {
+			log.Errorf("Throttle: Failed to lock %s: %v", key, err)
+		}
+	}
+	return record.Count
+}
+
+// Lock blocks key for d regardless of its count
+func (t *Throttle) Lock(key string, d time.Duration) {
+	if err := t.store.LockAttempts(key, time.Now().UTC().Add(d)); err != nil {
+		log.Errorf("Throttle: Failed to lock %s: %v", key, err)
+	}
+}
+
+// Use records a use of a single-use value for d and reports whether it was the first.
+// Unlike the limits, it fails closed: a store error counts as a repeated use.
+func (t *Throttle) Use(key string, d time.Duration) bool {
+	record, err := t.store.IncrementAttempts(key, d)
+	if err != nil {
+		log.Errorf("Throttle: Failed to record use of %s: %v", key, err)
+		return false
+	}
+	return record.Count == 1
+}
+
+// Reset forgets the attempts for key
+func (t *Throttle) Reset(key string) {
+	if err := t.store.ResetAttempts(key); err != nil {
+		log.Errorf("Throttle: Failed to reset %s: %v", key, err)
+	}
+}
+
+// lockout is LockoutBaseSeconds doubled for every attempt past the limit, capped at LockoutMaxSeconds
+func (t *Throttle) lockout(over int) time.Duration {
+	base := time.Duration(t.cfg.LockoutBaseSeconds) * time.Second
+	max := time.Duration(t.cfg.LockoutMaxSeconds) * time.Second
+	d := base
+	for i := 0; i < over && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
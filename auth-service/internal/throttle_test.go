@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryPinUsers keeps one user's PIN the way UserRepository does
+func memoryPinUsers(user *User) *MockUserRepository {
+	return &MockUserRepository{
+		FindByEmailFunc: func(email string) *User {
+			if email != user.Email {
+				return nil
+			}
+			copied := *user
+			return &copied
+		},
+		SetPinWithExpiryFunc: func(email string, hashedPin string) error {
+			user.PinHash = &hashedPin
+			expires := time.Now().Add(10 * time.Minute)
+			user.PinExpires = &expires
+			return nil
+		},
+		ClearPinFunc: func(userID string) error {
+			user.PinHash = nil
+			user.PinExpires = nil
+			return nil
+		},
+	}
+}
+
+func userWithPin(t *testing.T, pin string) *User {
+	t.Helper()
+	user := NewUser("user@example.com")
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.MinCost)
+	require.NoError(t, err)
+	hashed := string(hash)
+	expires := time.Now().Add(10 * time.Minute)
+	user.PinHash = &hashed
+	user.PinExpires = &expires
+	return user
+}
+
+func newThrottleTestApp(cfg *Config, userRepo *MockUserRepository) *fiber.App {
+	handler := NewUserHandler(cfg, userRepo, &MockSessionRepository{}, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
+	app := fiber.New()
+	app.Post("/login", handler.Login)
+	app.Post("/send-pin", handler.SendPin)
+	return app
+}
+
+func TestThrottle_LockoutDoublesUpToMax(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.LockoutBaseSeconds = 60
+	cfg.LockoutMaxSeconds = 300
+	throttle := NewThrottle(cfg, NewMemoryAttemptStore())
+
+	assert.Equal(t, 60*time.Second, throttle.lockout(0))
+	assert.Equal(t, 120*time.Second, throttle.lockout(1))
+	assert.Equal(t, 240*time.Second, throttle.lockout(2))
+	assert.Equal(t, 300*time.Second, throttle.lockout(3))
+	assert.Equal(t, 300*time.Second, throttle.lockout(30))
+}
+
+func TestThrottle_LocksAtLimitAndResets(t *testing.T) {
+	throttle := NewThrottle(newMockConfig(), NewMemoryAttemptStore())
+
+	throttle.Hit("k", 3)
+	throttle.Hit("k", 3)
+	assert.Zero(t, throttle.Wait("k"))
+
+	assert.Equal(t, 3, throttle.Hit("k", 3))
+	wait := throttle.Wait("other", "k")
+	assert.InDelta(t, float64(60*time.Second), float64(wait), float64(time.Second))
+
+	throttle.Reset("k")
+	assert.Zero(t, throttle.Wait("k"))
+}
+
+func TestLogin_LocksEmailAfterRepeatedFailures(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.PinMaxAttempts = 100
+	user := userWithPin(t, "123456")
+	app := newThrottleTestApp(cfg, memoryPinUsers(user))
+
+	for i := 0; i < cfg.LoginMaxFailuresPerEmail; i++ {
+		status, _ := postJSON(t, app, "/login", `{"email":"user@example.com","pin":"000000"}`)
+		require.Equal(t, fiber.StatusBadRequest, status)
+	}
+
+	// Even the right PIN is refused while the email is locked
+	status, body := postJSON(t, app, "/login", `{"email":"USER@example.com","pin":"123456"}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	assert.Equal(t, ErrTooManyAttempts, body["message"])
+}
+
+func TestLogin_LocksIPAcrossEmails(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.LoginMaxFailuresPerIP = 3
+	app := newThrottleTestApp(cfg, &MockUserRepository{})
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		status, _ := postJSON(t, app, "/login", `{"email":"`+email+`","pin":"000000"}`)
+		require.Equal(t, fiber.StatusBadRequest, status)
+	}
+
+	status, _ := postJSON(t, app, "/login", `{"email":"d@example.com","pin":"000000"}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+}
+
+func TestLogin_InvalidatesPinAfterMaxAttempts(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.PinMaxAttempts = 3
+	cfg.LoginMaxFailuresPerEmail = 100
+	user := userWithPin(t, "123456")
+	app := newThrottleTestApp(cfg, memoryPinUsers(user))
+
+	for i := 0; i < 2; i++ {
+		status, _ := postJSON(t, app, "/login", `{"email":"user@example.com","pin":"000000"}`)
+		require.Equal(t, fiber.StatusBadRequest, status)
+	}
+	assert.NotNil(t, user.PinHash)
+
+	status, _ := postJSON(t, app, "/login", `{"email":"user@example.com","pin":"000000"}`)
+	require.Equal(t, fiber.StatusBadRequest, status)
+	assert.Nil(t, user.PinHash)
+
+	// The right PIN no longer works once it has been invalidated
+	status, _ = postJSON(t, app, "/login", `{"email":"user@example.com","pin":"123456"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
+
+func TestSendPin_EnforcesResendCooldown(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.PinEnabled = false
+	user := NewUser("user@example.com")
+	app := newThrottleTestApp(cfg, memoryPinUsers(user))
+
+	status, _ := postJSON(t, app, "/send-pin", `{"email":"user@example.com"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	require.NotNil(t, user.PinHash)
+
+	status, _ = postJSON(t, app, "/send-pin", `{"email":"user@example.com"}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+}
+
+func TestSendPin_LimitsRequestsPerIP(t *testing.T) {
+	cfg := newMockConfig()
+	cfg.PinEnabled = false
+	cfg.SendPinMaxPerIP = 2
+	app := newThrottleTestApp(cfg, &MockUserRepository{})
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		status, _ := postJSON(t, app, "/send-pin", `{"email":"`+email+`"}`)
+		require.Equal(t, fiber.StatusOK, status)
+	}
+
+	status, _ := postJSON(t, app, "/send-pin", `{"email":"c@example.com"}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+}
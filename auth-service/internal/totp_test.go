@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 appendix B secret ("12345678901234567890") in base32
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for ts, want := range vectors {
+		code, err := totpCode(rfcTOTPSecret, ts/totpPeriod)
+		assert.NoError(t, err)
+		assert.Equal(t, want, code, "timestamp %d", ts)
+	}
+}
+
+func TestValidateTOTP_Skew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	step, ok := ValidateTOTP(rfcTOTPSecret, "005924", now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1234567890/totpPeriod), step)
+
+	_, ok = ValidateTOTP(rfcTOTPSecret, "005924", now.Add(totpPeriod*time.Second), 0)
+	assert.True(t, ok)
+
+	_, ok = ValidateTOTP(rfcTOTPSecret, "005924", now.Add(3*totpPeriod*time.Second), 0)
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(rfcTOTPSecret, "123", now, 0)
+	assert.False(t, ok)
+}
+
+func TestValidateTOTP_RejectsReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	step, ok := ValidateTOTP(rfcTOTPSecret, "005924", now, 0)
+	assert.True(t, ok)
+
+	_, ok = ValidateTOTP(rfcTOTPSecret, "005924", now, step)
+	assert.False(t, ok)
+}
+
+func TestGenerateTOTPSecret_RoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	now := time.Now()
+	code, err := totpCode(secret, now.Unix()/totpPeriod)
+	assert.NoError(t, err)
+
+	_, ok := ValidateTOTP(secret, code, now, 0)
+	assert.True(t, ok)
+}
+
+func TestTOTPURI_Format(t *testing.T) {
+	uri := TOTPURI("Instrlabs", "user@example.com", "ABC")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Instrlabs:user@example.com?"))
+	assert.Contains(t, uri, "secret=ABC")
+	assert.Contains(t, uri, "issuer=Instrlabs")
+	assert.Contains(t, uri, "digits=6")
+}
+
+func TestGenerateRecoveryCodes_HashedAndUnique(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodes)
+	assert.Len(t, hashes, recoveryCodes)
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		assert.False(t, seen[code], "Duplicate recovery code generated")
+		seen[code] = true
+		assert.NotContains(t, hashes, code)
+		assert.Equal(t, hashes[i], HashRecoveryCode(strings.ToUpper(code)))
+	}
+
+	user := &User{MFARecoveryCodes: hashes}
+	assert.True(t, user.HasRecoveryCode(codes[0]))
+	assert.False(t, user.HasRecoveryCode("aaaa-aaaa"))
+}
@@ -7,15 +7,34 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// PinExpiryMinutes is how long an emailed PIN stays valid
+const PinExpiryMinutes = 10
+
 type User struct {
 	ID                  primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Username            string             `json:"username" bson:"username"`
 	Email               string             `json:"email" bson:"email"`
+	DisplayName         string             `json:"display_name" bson:"display_name"`
+	Locale              string             `json:"locale" bson:"locale"`
+	Timezone            string             `json:"timezone" bson:"timezone"`
+	AvatarURL           string             `json:"avatar_url" bson:"avatar_url"`
+	AvatarKey           string             `json:"-" bson:"avatar_key"`
+	EmailChange         *EmailChange       `json:"email_change,omitempty" bson:"email_change,omitempty"`
 	PinHash             *string            `json:"-" bson:"pin_hash"`
 	PinExpires          *time.Time         `json:"-" bson:"pin_expires"`
-	GoogleID            *string            `json:"-" bson:"google_id"`
+	MagicLink           *MagicLink         `json:"-" bson:"magic_link,omitempty"`
+	Identities          []LinkedIdentity   `json:"identities" bson:"identities,omitempty"`
+	Roles               []string           `json:"roles" bson:"roles,omitempty"`
+	Disabled            bool               `json:"disabled" bson:"disabled"`
+	DisabledAt          *time.Time         `json:"disabled_at,omitempty" bson:"disabled_at,omitempty"`
+	DeletionRequestedAt *time.Time         `json:"deletion_requested_at,omitempty" bson:"deletion_requested_at,omitempty"`
+	DeletionScheduledAt *time.Time         `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"`
 	RefreshToken        *string            `json:"-" bson:"refresh_token"`
 	RefreshTokenExpires *time.Time         `json:"-" bson:"refresh_token_expires"`
+	MFAEnabled          bool               `json:"mfa_enabled" bson:"mfa_enabled"`
+	MFASecret           *string            `json:"-" bson:"mfa_secret"`
+	MFALastStep         int64              `json:"-" bson:"mfa_last_step"`
+	MFARecoveryCodes    []string           `json:"-" bson:"mfa_recovery_codes"`
 	RegisteredAt        *time.Time         `json:"registered_at" bson:"registered_at"`
 	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt           time.Time          `json:"updated_at" bson:"updated_at"`
@@ -26,14 +45,23 @@ func NewUser(email string) *User {
 	return &User{
 		ID:        primitive.NewObjectID(),
 		Email:     email,
+		Roles:     []string{RoleUser},
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 }
 
-func NewGoogleUser(email, googleID string) *User {
+// LinkedIdentity is an external provider account the user can sign in with
+type LinkedIdentity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"-" bson:"subject"`
+	Email    string    `json:"email" bson:"email"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+func NewOAuthUser(email string, identity LinkedIdentity) *User {
 	user := NewUser(email)
-	user.GoogleID = &googleID
+	user.Identities = []LinkedIdentity{identity}
 	return user
 }
 
@@ -47,3 +75,44 @@ func (u *User) ComparePin(pin string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(*u.PinHash), []byte(pin))
 	return err == nil
 }
+
+// RoleList returns the user's roles. Users created before roles were stored are plain users.
+func (u *User) RoleList() []string {
+	if len(u.Roles) == 0 {
+		return []string{RoleUser}
+	}
+	return u.Roles
+}
+
+// HasRole reports whether the user has any of the roles
+func (u *User) HasRole(roles ...string) bool {
+	for _, have := range u.RoleList() {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Identity returns the identity linked for provider, or nil
+func (u *User) Identity(provider string) *LinkedIdentity {
+	for i := range u.Identities {
+		if u.Identities[i].Provider == provider {
+			return &u.Identities[i]
+		}
+	}
+	return nil
+}
+
+// HasRecoveryCode reports whether the code matches one of the stored recovery code hashes
+func (u *User) HasRecoveryCode(code string) bool {
+	hash := HashRecoveryCode(code)
+	for _, h := range u.MFARecoveryCodes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
@@ -1,41 +1,74 @@
 package internal
 
 import (
-	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"math/big"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2/log"
 	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/instrlabs/shared/email"
 )
 
 type UserHandler struct {
 	cfg         *Config
 	userRepo    IUserRepository
 	sessionRepo ISessionRepository
+	keys        *KeyManager
+	throttle    *Throttle
+	auditRepo   IAuditRepository
+	events      IEventPublisher
+	binding     BindingPolicy
+	mailer      *Mailer
 }
 
-func NewUserHandler(cfg *Config, userRepo IUserRepository, sessionRepo ISessionRepository) *UserHandler {
+func NewUserHandler(cfg *Config, userRepo IUserRepository, sessionRepo ISessionRepository, keys *KeyManager, attempts IAttemptStore, auditRepo IAuditRepository, events IEventPublisher, mailer *Mailer) *UserHandler {
 	return &UserHandler{
 		cfg:         cfg,
 		userRepo:    userRepo,
 		sessionRepo: sessionRepo,
+		keys:        keys,
+		throttle:    NewThrottle(cfg, attempts),
+		auditRepo:   auditRepo,
+		events:      events,
+		binding:     NewBindingPolicy(cfg),
+		mailer:      mailer,
 	}
 }
 
+// accountDisabled rejects a sign-in to a disabled account
+func accountDisabled(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message": ErrAccountDisabled,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// tooManyAttempts rejects a throttled request, telling the client when to retry
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	setRetryAfter(c, wait)
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"message": ErrTooManyAttempts,
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// setRetryAfter tells the client how many whole seconds to wait before trying again
+func setRetryAfter(c *fiber.Ctx, wait time.Duration) {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
+
 func generateSixDigitPIN() string {
 	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
 	if err != nil {
@@ -45,18 +78,29 @@ func generateSixDigitPIN() string {
 	return fmt.Sprintf("%06d", n.Int64())
 }
 
-func (h *UserHandler) generateAccessToken(userID string, roles []string, sessionID string) (string, error) {
+// generateAccessToken signs an access token for the session, carrying the organization it acts in.
+// Tokens of an OAuth client carry its scopes instead of the user's roles.
+func (h *UserHandler) generateAccessToken(userID string, roles []string, session *UserSession) (string, error) {
 	now := time.Now().UTC()
 	expirationTime := now.Add(time.Duration(h.cfg.TokenExpiryHours) * time.Hour)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"user_id":    userID,
 		"roles":      roles,
-		"session_id": sessionID,
+		"session_id": session.SessionID,
 		"iat":        now.Unix(),
 		"exp":        expirationTime.Unix(),
-	})
-	return token.SignedString([]byte(h.cfg.JWTSecret))
+	}
+	if session.ActiveOrgID != "" {
+		claims["org_id"] = session.ActiveOrgID
+		claims["org_role"] = session.ActiveOrgRole
+	}
+	if session.ClientID != "" {
+		claims["roles"] = []string{}
+		claims["client_id"] = session.ClientID
+		claims["scope"] = strings.Join(session.Scopes, " ")
+	}
+	return h.keys.Sign(claims)
 }
 
 func (h *UserHandler) generateRefreshToken() (string, error) {
@@ -67,6 +111,90 @@ func (h *UserHandler) generateRefreshToken() (string, error) {
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
+// createSessionTokens opens a device-bound session, issues its access and refresh tokens
+// and records the successful login with the method used. A sign-in from a device the user
+// never used before is reported to them.
+func (h *UserHandler) createSessionTokens(c *fiber.Ctx, user *User, method string) (string, string, error) {
+	userID := user.ID.Hex()
+
+	// Extract device info from locals (set by SetupAuthenticated middleware)
+	userIP, _ := c.Locals("userIP").(string)
+	userAgent, _ := c.Locals("userAgent").(string)
+
+	// Looked up before the new session makes the device known. A failed lookup skips the alert, not the login.
+	newDevice, _ := h.sessionRepo.IsNewDevice(userID, GenerateDeviceHash(userIP, userAgent))
+
+	// Create session with device binding
+	session, err := h.sessionRepo.CreateSession(userID, userIP, userAgent)
+	if err != nil {
+		log.Errorf("createSessionTokens: Failed to create session: %v", err)
+		return "", "", err
+	}
+
+	accessToken, err := h.generateAccessToken(userID, user.RoleList(), session)
+	if err != nil {
+		log.Errorf("createSessionTokens: Failed to generate access token: %v", err)
+		return "", "", err
+	}
+	refreshToken, err := h.generateRefreshToken()
+	if err != nil {
+		log.Errorf("createSessionTokens: Failed to generate refresh token: %v", err)
+		return "", "", err
+	}
+	if err := h.sessionRepo.UpdateSessionRefreshToken(session.SessionID, refreshToken); err != nil {
+		log.Errorf("createSessionTokens: Failed to update refresh token: %v", err)
+		return "", "", err
+	}
+
+	h.audit(c, AuditLoginSuccess, AuditResultSuccess, userID, session.SessionID, map[string]string{"method": method})
+	if newDevice {
+		h.alertNewDevice(c, user, session)
+	}
+	return accessToken, refreshToken, nil
+}
+
+// alertNewDevice emails the user about a sign-in from a new device, with a link that revokes the
+// session if it wasn't them, and pushes a real-time notification to their other open sessions
+func (h *UserHandler) alertNewDevice(c *fiber.Ctx, user *User, session *UserSession) {
+	userID := user.ID.Hex()
+	h.audit(c, AuditNewDevice, AuditResultSuccess, userID, session.SessionID, map[string]string{"device": session.Device.Label()})
+
+	token, err := GenerateDeviceRevokeToken()
+	if err != nil {
+		log.Errorf("alertNewDevice: Failed to generate revoke token: %v", err)
+		return
+	}
+	if err := h.sessionRepo.SetSessionRevokeToken(session.SessionID, HashDeviceRevokeToken(token)); err != nil {
+		return
+	}
+
+	if err := h.mailer.Send(user.Email, user.Locale, MailNewDevice, NewDeviceMail{
+		Device:    session.Device.Label(),
+		IPAddress: session.IPAddress,
+		Time:      session.CreatedAt,
+		RevokeURL: h.revokeDeviceURL(token),
+	}); err != nil {
+		log.Errorf("alertNewDevice: Failed to email user %s: %v", userID, err)
+	}
+
+	notification, _ := json.Marshal(NewDeviceNotification{
+		UserID:    userID,
+		Type:      NotificationNewDevice,
+		SessionID: session.SessionID,
+		Device:    session.Device,
+		IPAddress: session.IPAddress,
+		CreatedAt: session.CreatedAt,
+	})
+	if err := h.events.Publish(h.cfg.NatsSubjectNotificationsSSE, notification); err != nil {
+		log.Errorf("alertNewDevice: Failed to publish notification for user %s: %v", userID, err)
+	}
+}
+
+// revokeDeviceURL is the web page behind the "this wasn't me" link of a new-device alert
+func (h *UserHandler) revokeDeviceURL(token string) string {
+	return h.cfg.WebUrl + "/devices/revoke?token=" + url.QueryEscape(token)
+}
+
 func (h *UserHandler) Login(c *fiber.Ctx) error {
 	log.Info("Login: Processing login request")
 
@@ -102,10 +230,20 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	emailKey := throttleLoginEmail + strings.ToLower(input.Email)
+	ipKey := throttleLoginIP + c.IP()
+	if wait := h.throttle.Wait(emailKey, ipKey); wait > 0 {
+		log.Warnf("Login: Too many failed attempts for email %s or IP %s", input.Email, c.IP())
+		h.audit(c, AuditLoginFailure, AuditResultThrottled, "", "", map[string]string{"method": "pin", "email": input.Email})
+		return tooManyAttempts(c, wait)
+	}
+
 	log.Infof("Login: Attempting to login user with email: %s", input.Email)
 	user := h.userRepo.FindByEmail(input.Email)
 	if user == nil || user.ID.IsZero() {
 		log.Infof("Login: Invalid credentials for email: %s", input.Email)
+		h.loginFailed(emailKey, ipKey, nil)
+		h.audit(c, AuditLoginFailure, AuditResultInvalidCredentials, "", "", map[string]string{"method": "pin", "email": input.Email})
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": ErrInvalidCredentials,
 			"errors":  nil,
@@ -114,6 +252,8 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 	}
 	if !user.ComparePin(input.Pin) {
 		log.Infof("Login: Invalid PIN for email: %s", input.Email)
+		h.loginFailed(emailKey, ipKey, user)
+		h.audit(c, AuditLoginFailure, AuditResultInvalidCredentials, user.ID.Hex(), "", map[string]string{"method": "pin"})
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": ErrInvalidCredentials,
 			"errors":  nil,
@@ -122,36 +262,32 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 	}
 
 	_ = h.userRepo.ClearPin(user.ID.Hex())
+	h.throttle.Reset(emailKey)
+	h.throttle.Reset(throttlePin + user.ID.Hex())
+
+	return h.completeLogin(c, user, LoginMethodPin)
+}
+
+// completeLogin finishes a sign-in whose emailed credential checked out: it registers the user on
+// their first sign-in, then asks for the second factor or opens a session
+func (h *UserHandler) completeLogin(c *fiber.Ctx, user *User, method string) error {
 	if user.RegisteredAt == nil || user.RegisteredAt.IsZero() {
 		if err := h.userRepo.SetRegisteredAt(user.ID.Hex()); err != nil {
 			log.Errorf("Login: Failed to set RegisteredAt for user %s: %v", user.ID.Hex(), err)
 		}
 	}
 
-	// Extract device info from locals (set by SetupAuthenticated middleware)
-	userIP, _ := c.Locals("userIP").(string)
-	userAgent, _ := c.Locals("userAgent").(string)
-
-	// Create session with device binding
-	session, err := h.sessionRepo.CreateSession(user.ID.Hex(), userIP, userAgent)
-	if err != nil {
-		log.Errorf("Login: Failed to create session: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
-			"errors":  nil,
-			"data":    nil,
-		})
+	if user.Disabled {
+		log.Warnf("Login: Disabled account: %s", user.Email)
+		h.audit(c, AuditLoginFailure, AuditResultAccountDisabled, user.ID.Hex(), "", map[string]string{"method": method})
+		return accountDisabled(c)
 	}
 
-	accessToken, err := h.generateAccessToken(user.ID.Hex(), []string{"user"}, session.SessionID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
-			"errors":  nil,
-			"data":    nil,
-		})
+	if user.MFAEnabled {
+		return h.respondMFARequired(c, user.ID.Hex())
 	}
-	refreshToken, err := h.generateRefreshToken()
+
+	accessToken, refreshToken, err := h.createSessionTokens(c, user, method)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": ErrInternalServer,
@@ -159,15 +295,8 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 			"data":    nil,
 		})
 	}
-	if err := h.sessionRepo.UpdateSessionRefreshToken(session.SessionID, refreshToken); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
-			"errors":  nil,
-			"data":    nil,
-		})
-	}
 
-	log.Infof("Login: User logged in successfully: %s", input.Email)
+	log.Infof("Login: User logged in successfully: %s", user.Email)
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Login successful",
 		"errors":  nil,
@@ -180,6 +309,26 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 	})
 }
 
+// loginFailed counts a failed login against the email and IP, and invalidates the user's PIN
+// once it has been guessed at PinMaxAttempts times
+func (h *UserHandler) loginFailed(emailKey string, ipKey string, user *User) {
+	h.throttle.Hit(emailKey, h.cfg.LoginMaxFailuresPerEmail)
+	h.throttle.Hit(ipKey, h.cfg.LoginMaxFailuresPerIP)
+	if user == nil || user.PinHash == nil || *user.PinHash == "" {
+		return
+	}
+
+	pinKey := throttlePin + user.ID.Hex()
+	if h.throttle.Hit(pinKey, 0) < h.cfg.PinMaxAttempts {
+		return
+	}
+	log.Warnf("Login: PIN for user %s invalidated after %d failed attempts", user.ID.Hex(), h.cfg.PinMaxAttempts)
+	if err := h.userRepo.ClearPin(user.ID.Hex()); err != nil {
+		log.Errorf("Login: Failed to clear PIN for user %s: %v", user.ID.Hex(), err)
+	}
+	h.throttle.Reset(pinKey)
+}
+
 func (h *UserHandler) RefreshToken(c *fiber.Ctx) error {
 	log.Info("RefreshToken: Processing token refresh request")
 
@@ -210,6 +359,9 @@ func (h *UserHandler) RefreshToken(c *fiber.Ctx) error {
 
 	session, err := h.sessionRepo.FindSessionByRefreshToken(refreshToken)
 	if session == nil || err != nil {
+		if err == nil {
+			h.detectRefreshTokenReuse(c, refreshToken)
+		}
 		log.Warn("RefreshToken: Invalid refresh token or session")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": ErrInvalidToken,
@@ -217,14 +369,42 @@ func (h *UserHandler) RefreshToken(c *fiber.Ctx) error {
 			"data":    nil,
 		})
 	}
+	if session.ClientID != "" {
+		// OAuth clients refresh at /oauth2/token, authenticating themselves
+		log.Warnf("RefreshToken: Refresh token of OAuth client %s presented", session.ClientID)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrInvalidToken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if h.expireIdleSession(c, session) {
+		return sessionIdle(c)
+	}
 
 	// Get device info from locals
 	userIP, _ := c.Locals("userIP").(string)
 	userAgent, _ := c.Locals("userAgent").(string)
-	deviceHash := GenerateDeviceHash(userIP, userAgent)
 
-	if !h.sessionRepo.ValidateSession(session.SessionID, session.UserID, deviceHash) {
-		log.Warn("RefreshToken: Device hash mismatch - possible token theft")
+	if !h.binding.Matches(session, userIP, userAgent) {
+		log.Warnf("RefreshToken: Session %s does not match its device under the %s binding policy - possible token theft",
+			session.SessionID, h.binding.Name())
+		details := map[string]string{"session_ip": session.IPAddress, "policy": h.binding.Name()}
+		if h.cfg.SessionBindingStepUp {
+			// The session stays usable once the user re-verifies with a PIN from this device
+			details["step_up"] = "required"
+			h.audit(c, AuditSuspiciousRefresh, AuditResultDeviceMismatch, session.UserID, session.SessionID, details)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": ErrStepUpRequired,
+				"errors":  nil,
+				"data":    fiber.Map{"step_up_required": true},
+			})
+		}
+
+		// Revoke session immediately due to potential token theft
+		_ = h.revokeSession(session.SessionID)
+		h.audit(c, AuditSuspiciousRefresh, AuditResultDeviceMismatch, session.UserID, session.SessionID, details)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": ErrInvalidToken,
 			"errors":  nil,
@@ -243,214 +423,219 @@ func (h *UserHandler) RefreshToken(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate new access token with SAME session ID
-	newAccessToken, err := h.generateAccessToken(user.ID.Hex(), []string{"user"}, session.SessionID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
-			"errors":  nil,
-			"data":    nil,
-		})
-	}
+	return h.refreshSession(c, user, session, refreshToken)
+}
 
-	newRefreshToken, err := h.generateRefreshToken()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
+// StepUpRefresh resumes a session whose refresh was refused by the binding policy. The user proves
+// it is them with a PIN from /send-pin, and with an MFA code when MFA is enabled, then the session is
+// bound to the current device and refreshed.
+func (h *UserHandler) StepUpRefresh(c *fiber.Ctx) error {
+	log.Info("StepUpRefresh: Processing step-up refresh request")
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+		Pin          string `json:"pin"`
+		mfaCodeInput
+	}
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" || input.Pin == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
-
-	// Update session with new refresh token
-	if err := h.sessionRepo.UpdateSessionRefreshToken(session.SessionID, newRefreshToken); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
+	if !h.cfg.SessionBindingStepUp {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": ErrStepUpDisabled,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
 
-	log.Info("RefreshToken: Token refreshed successfully")
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Token refreshed successfully",
-		"errors":  nil,
-		"data": fiber.Map{
-			"access_token":  newAccessToken,
-			"refresh_token": newRefreshToken,
-			"token_type":    "Bearer",
-			"expires_in":    h.cfg.TokenExpiryHours * 3600,
-		},
-	})
-}
-
-func (h *UserHandler) GoogleLogin(c *fiber.Ctx) error {
-	log.Info("GoogleLogin: Initiating Google OAuth login")
-
-	b := make([]byte, 16)
-	_, _ = rand.Read(b)
-	state := base64.StdEncoding.EncodeToString(b)
-	conf := &oauth2.Config{
-		ClientID:     h.cfg.GoogleClientID,
-		ClientSecret: h.cfg.GoogleClientSecret,
-		RedirectURL:  h.cfg.GoogleRedirectUrl,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
-	}
-
-	redirectUrl := conf.AuthCodeURL(state)
-	log.Infof("GoogleLogin: Redirecting to Google OAuth URL: %s", redirectUrl)
-
-	return c.Redirect(redirectUrl)
-}
-
-func (h *UserHandler) GoogleCallback(c *fiber.Ctx) error {
-	log.Info("GoogleCallback: Processing Google OAuth callback")
-
-	code := c.Query("code")
-	if code == "" {
-		log.Info("GoogleCallback: Missing authorization code")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+	session, err := h.sessionRepo.FindSessionByRefreshToken(input.RefreshToken)
+	if session == nil || err != nil {
+		if err == nil {
+			h.detectRefreshTokenReuse(c, input.RefreshToken)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": ErrInvalidToken,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
-
-	conf := &oauth2.Config{
-		ClientID:     h.cfg.GoogleClientID,
-		ClientSecret: h.cfg.GoogleClientSecret,
-		RedirectURL:  h.cfg.GoogleRedirectUrl,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
-	}
-	token, err := conf.Exchange(context.Background(), code)
-	if err != nil {
-		log.Errorf("GoogleCallback: Failed to exchange token: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
+	if session.ClientID != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrInvalidToken,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
-
-	client := conf.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-	if err != nil {
-		log.Errorf("GoogleCallback: Failed to get user info: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
-			"errors":  nil,
-			"data":    nil,
-		})
+	if h.expireIdleSession(c, session) {
+		return sessionIdle(c)
 	}
-	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Errorf("GoogleCallback: Failed to read response body: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
+	user := h.userRepo.FindByID(session.UserID)
+	if user == nil || user.ID.IsZero() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrUserNotFound,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
 
-	var googleInfo struct {
-		ID    string `json:"id"`
-		Email string `json:"email"`
+	// PIN guesses count against the same limits as PIN logins
+	emailKey := throttleLoginEmail + strings.ToLower(user.Email)
+	ipKey := throttleLoginIP + c.IP()
+	if wait := h.throttle.Wait(emailKey, ipKey); wait > 0 {
+		h.audit(c, AuditStepUp, AuditResultThrottled, user.ID.Hex(), session.SessionID, nil)
+		return tooManyAttempts(c, wait)
 	}
-	if err := json.Unmarshal(data, &googleInfo); err != nil {
-		log.Errorf("GoogleCallback: Failed to unmarshal user info: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
+	if !user.ComparePin(input.Pin) {
+		h.loginFailed(emailKey, ipKey, user)
+		h.audit(c, AuditStepUp, AuditResultInvalidCredentials, user.ID.Hex(), session.SessionID, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidCredentials,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
-	user := h.userRepo.FindByGoogleID(googleInfo.ID)
-	if user == nil || user.ID.IsZero() {
-		u2 := h.userRepo.FindByEmail(googleInfo.Email)
-		if u2 == nil || u2.ID.IsZero() {
-			newUser := NewGoogleUser(googleInfo.Email, googleInfo.ID)
-			created := h.userRepo.Create(newUser)
-			if created == nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"message": ErrInternalServer,
-					"errors":  nil,
-					"data":    nil,
-				})
-			}
-			user = created
-		} else {
-			user = u2
-			if err := h.userRepo.UpdateGoogleID(user.ID.Hex(), googleInfo.ID); err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"message": ErrInternalServer,
-					"errors":  nil,
-					"data":    nil,
-				})
-			}
+
+	// A PIN only proves access to the mailbox, so MFA users also give a code, under the MFA limits
+	if user.MFAEnabled {
+		if input.Code == "" && input.RecoveryCode == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": ErrMFACodeRequired,
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+		if ok, wait := h.checkMFAThrottled(c, user, input.mfaCodeInput, true); wait > 0 {
+			h.audit(c, AuditStepUp, AuditResultThrottled, user.ID.Hex(), session.SessionID, map[string]string{"method": "mfa"})
+			return tooManyAttempts(c, wait)
+		} else if !ok {
+			log.Infof("StepUpRefresh: Invalid MFA code for user %s", user.ID.Hex())
+			h.audit(c, AuditStepUp, AuditResultInvalidCode, user.ID.Hex(), session.SessionID, map[string]string{"method": "mfa"})
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": ErrInvalidMFACode,
+				"errors":  nil,
+				"data":    nil,
+			})
 		}
 	}
+	_ = h.userRepo.ClearPin(user.ID.Hex())
+	h.throttle.Reset(emailKey)
+	h.throttle.Reset(throttlePin + user.ID.Hex())
 
-	// Create session with device binding
 	userIP, _ := c.Locals("userIP").(string)
 	userAgent, _ := c.Locals("userAgent").(string)
-
-	session, err := h.sessionRepo.CreateSession(user.ID.Hex(), userIP, userAgent)
-	if err != nil {
-		log.Errorf("GoogleCallback: Failed to create session: %v", err)
+	if err := h.sessionRepo.RebindSession(session.SessionID, userIP, userAgent); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": ErrInternalServer,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
+	h.audit(c, AuditStepUp, AuditResultSuccess, user.ID.Hex(), session.SessionID, map[string]string{"previous_ip": session.IPAddress})
 
-	accessToken, err := h.generateAccessToken(user.ID.Hex(), []string{"user"}, session.SessionID)
-	if err != nil {
-		log.Errorf("GoogleCallback: Failed to generate access token: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
-			"errors":  nil,
-			"data":    nil,
-		})
+	return h.refreshSession(c, user, session, input.RefreshToken)
+}
+
+// refreshSession rotates the session's refresh token and responds with new tokens for the same session
+func (h *UserHandler) refreshSession(c *fiber.Ctx, user *User, session *UserSession, refreshToken string) error {
+	if user.Disabled {
+		log.Warnf("RefreshToken: Disabled account %s", user.ID.Hex())
+		_ = h.revokeSession(session.SessionID)
+		return accountDisabled(c)
 	}
-	refreshToken, err := h.generateRefreshToken()
+
+	newAccessToken, newRefreshToken, err := h.rotateSession(c, user, session, refreshToken)
 	if err != nil {
-		log.Errorf("GoogleCallback: Failed to generate refresh token: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": ErrInternalServer,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
-	if err := h.sessionRepo.UpdateSessionRefreshToken(session.SessionID, refreshToken); err != nil {
-		log.Errorf("GoogleCallback: Failed to update refresh token: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": ErrInternalServer,
+	if newRefreshToken == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": ErrInvalidToken,
 			"errors":  nil,
 			"data":    nil,
 		})
 	}
 
-	expiresIn := h.cfg.TokenExpiryHours * 3600
-	redirectURL := fmt.Sprintf("%s?access_token=%s&refresh_token=%s&token_type=Bearer&expires_in=%s",
-		h.cfg.WebUrl,
-		url.QueryEscape(accessToken),
-		url.QueryEscape(refreshToken),
-		strconv.Itoa(expiresIn),
-	)
+	h.audit(c, AuditTokenRefreshed, AuditResultSuccess, user.ID.Hex(), session.SessionID, nil)
+	log.Info("RefreshToken: Token refreshed successfully")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Token refreshed successfully",
+		"errors":  nil,
+		"data": fiber.Map{
+			"access_token":  newAccessToken,
+			"refresh_token": newRefreshToken,
+			"token_type":    "Bearer",
+			"expires_in":    h.cfg.TokenExpiryHours * 3600,
+		},
+	})
+}
+
+// rotateSession issues a new access token for the same session and rotates its refresh token.
+// It returns empty tokens when the presented token lost a concurrent rotation, after revoking the session.
+func (h *UserHandler) rotateSession(c *fiber.Ctx, user *User, session *UserSession, refreshToken string) (string, string, error) {
+	newAccessToken, err := h.generateAccessToken(user.ID.Hex(), user.RoleList(), session)
+	if err != nil {
+		return "", "", err
+	}
+	newRefreshToken, err := h.generateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Rotate only if the presented token is still current; losing a concurrent rotation means it was replayed
+	rotated, err := h.sessionRepo.RotateSessionRefreshToken(session.SessionID, refreshToken, newRefreshToken)
+	if err != nil {
+		return "", "", err
+	}
+	if !rotated {
+		h.revokeReusedSession(c, session)
+		return "", "", nil
+	}
+	return newAccessToken, newRefreshToken, nil
+}
+
+// detectRefreshTokenReuse revokes the session if the unknown refresh token was already rotated in it
+func (h *UserHandler) detectRefreshTokenReuse(c *fiber.Ctx, refreshToken string) {
+	session, err := h.sessionRepo.FindSessionByPreviousRefreshToken(refreshToken)
+	if err != nil || session == nil {
+		return
+	}
+	h.revokeReusedSession(c, session)
+}
 
-	log.Infof("GoogleCallback: User logged in successfully: %s", googleInfo.Email)
-	return c.Redirect(redirectURL, fiber.StatusFound)
+// revokeReusedSession handles a replayed refresh token. Either the legitimate client or an attacker
+// holds a stolen copy, and there is no telling which, so the whole session is signed out.
+func (h *UserHandler) revokeReusedSession(c *fiber.Ctx, session *UserSession) {
+	userIP, _ := c.Locals("userIP").(string)
+	log.Warnf("SECURITY: Refresh token reuse detected for session %s of user %s from IP %s, revoking session",
+		session.SessionID, session.UserID, userIP)
+	h.audit(c, AuditSuspiciousRefresh, AuditResultTokenReuse, session.UserID, session.SessionID, nil)
+
+	if !session.IsActive {
+		return
+	}
+	if err := h.revokeSession(session.SessionID); err != nil {
+		log.Errorf("revokeReusedSession: Failed to revoke session %s: %v", session.SessionID, err)
+	}
+
+	user := h.userRepo.FindByID(session.UserID)
+	if user == nil || user.ID.IsZero() {
+		return
+	}
+	if err := h.mailer.Send(user.Email, user.Locale, MailSessionRevoked, SessionRevokedMail{
+		StartedAt: session.CreatedAt,
+		IPAddress: session.IPAddress,
+	}); err != nil {
+		log.Errorf("revokeReusedSession: Failed to notify user %s: %v", session.UserID, err)
+	}
 }
 
 func (h *UserHandler) GetProfile(c *fiber.Ctx) error {
@@ -483,7 +668,7 @@ func (h *UserHandler) Logout(c *fiber.Ctx) error {
 
 	// Deactivate this specific session
 	if sessionId != "" {
-		if err := h.sessionRepo.DeactivateSession(sessionId); err != nil {
+		if err := h.revokeSession(sessionId); err != nil {
 			log.Errorf("Logout: Failed to deactivate session: %v", err)
 		}
 	}
@@ -520,6 +705,22 @@ func (h *UserHandler) GetDevices(c *fiber.Ctx) error {
 		})
 	}
 
+	currentSessionId, _ := c.Locals("sessionId").(string)
+	devices := make([]UserSession, 0, len(sessions))
+	for _, session := range sessions {
+		// Grants to OAuth clients are listed under /oauth2/authorizations
+		if session.ClientID != "" {
+			continue
+		}
+		session.Current = session.SessionID == currentSessionId
+		// Sessions created before device info was stored
+		if session.Device == (DeviceInfo{}) {
+			session.Device = ParseUserAgent(session.UserAgent)
+		}
+		devices = append(devices, session)
+	}
+	sessions = devices
+
 	log.Infof("GetDevices: Retrieved %d devices for user %s", len(sessions), userId)
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Devices retrieved successfully",
@@ -530,6 +731,35 @@ func (h *UserHandler) GetDevices(c *fiber.Ctx) error {
 	})
 }
 
+// GetSecurityEvents returns the authenticated user's security audit trail, newest first
+func (h *UserHandler) GetSecurityEvents(c *fiber.Ctx) error {
+	log.Info("GetSecurityEvents: Retrieving security events")
+
+	userId, _ := c.Locals("userId").(string)
+	search := parseAuditSearch(c)
+	search.UserID = userId
+
+	events, total, err := h.auditRepo.FindEvents(search)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Security events retrieved successfully",
+		"errors":  nil,
+		"data": fiber.Map{
+			"events": events,
+			"total":  total,
+			"page":   search.Page,
+			"limit":  search.Limit,
+		},
+	})
+}
+
 // RevokeDevice deactivates a specific device session
 func (h *UserHandler) RevokeDevice(c *fiber.Ctx) error {
 	log.Info("RevokeDevice: Revoking device access")
@@ -556,7 +786,7 @@ func (h *UserHandler) RevokeDevice(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.sessionRepo.DeactivateSession(sessionId); err != nil {
+	if err := h.revokeSession(sessionId); err != nil {
 		log.Errorf("RevokeDevice: Failed to deactivate session: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": ErrInternalServer,
@@ -565,6 +795,7 @@ func (h *UserHandler) RevokeDevice(c *fiber.Ctx) error {
 		})
 	}
 
+	h.audit(c, AuditDeviceRevoked, AuditResultSuccess, userId, "", map[string]string{"revoked_session_id": sessionId})
 	log.Infof("RevokeDevice: Device %s revoked for user %s", sessionId, userId)
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Device revoked successfully",
@@ -573,13 +804,108 @@ func (h *UserHandler) RevokeDevice(c *fiber.Ctx) error {
 	})
 }
 
+// RenameDevice sets the name the user gives one of their device sessions; an empty name removes it
+func (h *UserHandler) RenameDevice(c *fiber.Ctx) error {
+	log.Info("RenameDevice: Renaming device")
+
+	userId, _ := c.Locals("userId").(string)
+	sessionId := c.Params("sessionId")
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	name := strings.TrimSpace(input.Name)
+	if utf8.RuneCountInString(name) > DeviceNameMaxLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrDeviceNameTooLong,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	found, err := h.sessionRepo.RenameSession(sessionId, userId, name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Device not found",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("RenameDevice: Device %s renamed for user %s", sessionId, userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Device renamed successfully",
+		"errors":  nil,
+		"data":    fiber.Map{"session_id": sessionId, "name": name},
+	})
+}
+
+// RevokeUnrecognizedDevice signs out the session of a new-device alert with the token from its
+// "this wasn't me" link. It does not require a session, since the link is opened from an email.
+func (h *UserHandler) RevokeUnrecognizedDevice(c *fiber.Ctx) error {
+	log.Info("RevokeUnrecognizedDevice: Revoking device from alert link")
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	session, err := h.sessionRepo.RevokeSessionByToken(HashDeviceRevokeToken(input.Token))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if session == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRevokeToken,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	h.publishRevocations([]string{session.SessionID})
+
+	h.audit(c, AuditDeviceRevoked, AuditResultSuccess, session.UserID, "", map[string]string{
+		"revoked_session_id": session.SessionID,
+		"via":                "new_device_alert",
+	})
+	log.Infof("RevokeUnrecognizedDevice: Device %s revoked for user %s", session.SessionID, session.UserID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Device signed out. Review your account and sign out of all devices if you don't recognize other sessions.",
+		"errors":  nil,
+		"data":    fiber.Map{"session_id": session.SessionID},
+	})
+}
+
 // LogoutAllDevices deactivates all sessions for the user (logout from all devices)
 func (h *UserHandler) LogoutAllDevices(c *fiber.Ctx) error {
 	log.Info("LogoutAllDevices: Logging out from all devices")
 
 	userId, _ := c.Locals("userId").(string)
 
-	if err := h.sessionRepo.ClearAllUserSessions(userId); err != nil {
+	if err := h.revokeAllSessions(userId); err != nil {
 		log.Errorf("LogoutAllDevices: Failed to deactivate sessions: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": ErrInternalServer,
@@ -588,6 +914,7 @@ func (h *UserHandler) LogoutAllDevices(c *fiber.Ctx) error {
 		})
 	}
 
+	h.audit(c, AuditLogoutAll, AuditResultSuccess, userId, "", nil)
 	log.Infof("LogoutAllDevices: User %s logged out from all devices", userId)
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Logged out from all devices",
@@ -600,7 +927,8 @@ func (h *UserHandler) SendPin(c *fiber.Ctx) error {
 	log.Info("SendPin: Processing send-pin request")
 
 	var input struct {
-		Email string `json:"email"`
+		Email  string `json:"email"`
+		Method string `json:"method"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -621,11 +949,34 @@ func (h *UserHandler) SendPin(c *fiber.Ctx) error {
 		})
 	}
 
+	if input.Method == "" {
+		input.Method = LoginMethodPin
+	}
+	if input.Method != LoginMethodPin && input.Method != LoginMethodMagicLink {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidLoginMethod,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	normalizedEmail := strings.ToLower(input.Email)
+	cooldownKey := throttlePinCooldown + normalizedEmail
+	emailKey := throttleSendPinEmail + normalizedEmail
+	ipKey := throttleSendPinIP + c.IP()
+	if wait := h.throttle.Wait(cooldownKey, emailKey, ipKey); wait > 0 {
+		log.Warnf("SendPin: Throttled send-pin for email %s from IP %s", input.Email, c.IP())
+		h.audit(c, AuditPinSent, AuditResultThrottled, "", "", map[string]string{"email": input.Email})
+		return tooManyAttempts(c, wait)
+	}
+	h.throttle.Hit(emailKey, h.cfg.SendPinMaxPerEmail)
+	h.throttle.Hit(ipKey, h.cfg.SendPinMaxPerIP)
+
 	log.Infof("SendPin: Sending pin with email: %s", input.Email)
 	user := h.userRepo.FindByEmail(input.Email)
 	if user == nil || user.ID.IsZero() {
-		newUser := NewUser(input.Email)
-		if created := h.userRepo.Create(newUser); created == nil {
+		user = h.userRepo.Create(NewUser(input.Email))
+		if user == nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"message": ErrInternalServer,
 				"errors":  nil,
@@ -647,6 +998,14 @@ func (h *UserHandler) SendPin(c *fiber.Ctx) error {
 			"data":    nil,
 		})
 	}
+	// A new PIN gets a fresh set of guesses, and cannot be replaced again until the cooldown ends
+	h.throttle.Reset(throttlePin + user.ID.Hex())
+	h.throttle.Lock(cooldownKey, time.Duration(h.cfg.PinResendCooldownSeconds)*time.Second)
+	h.audit(c, AuditPinSent, AuditResultSuccess, user.ID.Hex(), "", map[string]string{"method": input.Method})
+
+	if input.Method == LoginMethodMagicLink {
+		return h.sendMagicLink(c, user, input.Email, pin)
+	}
 
 	if !h.cfg.PinEnabled {
 		log.Infof("SendPin: PIN_ENABLED enabled. Using fixed PIN 000000 for email: %s", input.Email)
@@ -657,9 +1016,7 @@ func (h *UserHandler) SendPin(c *fiber.Ctx) error {
 		})
 	}
 
-	subject := "Your Login PIN"
-	body := fmt.Sprintf("Your one-time PIN is: %s. It expires in 10 minutes.", pin)
-	if err := email.SendEmail(input.Email, subject, body); err != nil {
+	if err := h.mailer.Send(input.Email, user.Locale, MailPin, PinMail{Pin: pin, ExpiresMinutes: PinExpiryMinutes}); err != nil {
 		log.Errorf("SendPin: Failed to send email: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": ErrInternalServer,
@@ -674,3 +1031,111 @@ func (h *UserHandler) SendPin(c *fiber.Ctx) error {
 		"data":    nil,
 	})
 }
+
+// sendMagicLink emails a sign-in link bound to the requesting device, with the PIN as a code
+// for signing in on another device
+func (h *UserHandler) sendMagicLink(c *fiber.Ctx, user *User, emailAddress string, pin string) error {
+	userIP, _ := c.Locals("userIP").(string)
+	userAgent, _ := c.Locals("userAgent").(string)
+
+	link, token, err := h.newMagicLink(user.ID.Hex(), userIP, userAgent)
+	if err == nil {
+		err = h.userRepo.SetMagicLink(user.ID.Hex(), link)
+	}
+	if err != nil {
+		log.Errorf("SendPin: Failed to create magic link for user %s: %v", user.ID.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	if err := h.mailer.Send(emailAddress, user.Locale, MailMagicLink, MagicLinkMail{
+		URL:               h.magicLinkURL(token),
+		Pin:               pin,
+		ExpiresMinutes:    h.cfg.MagicLinkExpiryMinutes,
+		PinExpiresMinutes: PinExpiryMinutes,
+	}); err != nil {
+		log.Errorf("SendPin: Failed to send email: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": ErrInternalServer,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Sign-in link sent",
+		"errors":  nil,
+		"data":    nil,
+	})
+}
+
+// LoginMagicLink signs in with the token of an emailed magic link. The link only works on the
+// device that requested it; other devices are pointed to the code in the same email.
+func (h *UserHandler) LoginMagicLink(c *fiber.Ctx) error {
+	log.Info("LoginMagicLink: Processing magic link login")
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidRequestBody,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	ipKey := throttleLoginIP + c.IP()
+	if wait := h.throttle.Wait(ipKey); wait > 0 {
+		h.audit(c, AuditLoginFailure, AuditResultThrottled, "", "", map[string]string{"method": LoginMethodMagicLink})
+		return tooManyAttempts(c, wait)
+	}
+
+	invalidLink := func(userID string) error {
+		h.throttle.Hit(ipKey, h.cfg.LoginMaxFailuresPerIP)
+		h.audit(c, AuditLoginFailure, AuditResultInvalidCredentials, userID, "", map[string]string{"method": LoginMethodMagicLink})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": ErrInvalidMagicLink,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	claims, err := h.parseMagicLink(input.Token)
+	if err != nil {
+		log.Warnf("LoginMagicLink: Invalid token: %v", err)
+		return invalidLink("")
+	}
+	tokenHash := HashMagicLinkID(claims.LinkID)
+	user := h.userRepo.FindByMagicLink(tokenHash)
+	if user == nil || user.ID.Hex() != claims.UserID || user.MagicLink.Fingerprint != claims.Fingerprint {
+		return invalidLink(claims.UserID)
+	}
+
+	// The link stays valid on a mismatch, so the user can still open it on the right device
+	userIP, _ := c.Locals("userIP").(string)
+	userAgent, _ := c.Locals("userAgent").(string)
+	origin := &UserSession{IPAddress: user.MagicLink.IPAddress, UserAgent: user.MagicLink.UserAgent, DeviceHash: user.MagicLink.Fingerprint}
+	if !h.binding.Matches(origin, userIP, userAgent) {
+		log.Warnf("LoginMagicLink: Link of user %s opened on another device", claims.UserID)
+		h.audit(c, AuditLoginFailure, AuditResultDeviceMismatch, claims.UserID, "", map[string]string{
+			"method": LoginMethodMagicLink, "policy": h.binding.Name(),
+		})
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": ErrMagicLinkDevice,
+			"errors":  nil,
+			"data":    fiber.Map{"use_code": true},
+		})
+	}
+
+	if !h.userRepo.ConsumeMagicLink(claims.UserID, tokenHash) {
+		return invalidLink(claims.UserID)
+	}
+	h.throttle.Reset(throttleLoginEmail + strings.ToLower(user.Email))
+	h.throttle.Reset(throttlePin + claims.UserID)
+
+	return h.completeLogin(c, user, LoginMethodMagicLink)
+}
@@ -20,9 +20,32 @@ type MockUserRepository struct {
 	SetPinWithExpiryFunc             func(email string, hashedPin string) error
 	ClearPinFunc                     func(userID string) error
 	SetRegisteredAtFunc              func(userID string) error
-	UpdateGoogleIDFunc               func(userID string, googleID string) error
-	FindByGoogleIDFunc               func(googleID string) *User
+	FindByIdentityFunc               func(provider string, subject string) *User
+	LinkIdentityFunc                 func(userID string, identity LinkedIdentity) error
+	UnlinkIdentityFunc               func(userID string, provider string) (bool, error)
 	FindByRefreshTokenFunc           func(token string) *User
+	SetMFASecretFunc                 func(userID string, secret string) error
+	EnableMFAFunc                    func(userID string, step int64, recoveryCodeHashes []string) error
+	DisableMFAFunc                   func(userID string) error
+	UpdateMFALastStepFunc            func(userID string, step int64) error
+	SetRecoveryCodesFunc             func(userID string, recoveryCodeHashes []string) error
+	ConsumeRecoveryCodeFunc          func(userID string, codeHash string) bool
+	SetMagicLinkFunc                 func(userID string, link *MagicLink) error
+	FindByMagicLinkFunc              func(tokenHash string) *User
+	ConsumeMagicLinkFunc             func(userID string, tokenHash string) bool
+	SearchUsersFunc                  func(search UserSearch) ([]User, int64, error)
+	SetRolesFunc                     func(userID string, roles []string) error
+	GrantRoleByEmailFunc             func(email string, role string) error
+	SetDisabledFunc                  func(userID string, disabled bool) error
+	FindByUsernameFunc               func(username string) *User
+	UpdateProfileFunc                func(userID string, update ProfileUpdate) error
+	SetAvatarFunc                    func(userID string, key string, url string) error
+	SetEmailChangeFunc               func(userID string, change *EmailChange) error
+	FindByEmailChangeTokenFunc       func(tokenHash string) *User
+	ChangeEmailFunc                  func(userID string, email string) error
+	ScheduleDeletionFunc             func(userID string, at *time.Time) error
+	FindDueForDeletionFunc           func(now time.Time) ([]User, error)
+	DeleteUserFunc                   func(userID string) error
 }
 
 func (m *MockUserRepository) Create(user *User) *User {
@@ -88,20 +111,27 @@ func (m *MockUserRepository) SetRegisteredAt(userID string) error {
 	return nil
 }
 
-func (m *MockUserRepository) UpdateGoogleID(userID string, googleID string) error {
-	if m.UpdateGoogleIDFunc != nil {
-		return m.UpdateGoogleIDFunc(userID, googleID)
+func (m *MockUserRepository) FindByIdentity(provider string, subject string) *User {
+	if m.FindByIdentityFunc != nil {
+		return m.FindByIdentityFunc(provider, subject)
 	}
 	return nil
 }
 
-func (m *MockUserRepository) FindByGoogleID(googleID string) *User {
-	if m.FindByGoogleIDFunc != nil {
-		return m.FindByGoogleIDFunc(googleID)
+func (m *MockUserRepository) LinkIdentity(userID string, identity LinkedIdentity) error {
+	if m.LinkIdentityFunc != nil {
+		return m.LinkIdentityFunc(userID, identity)
 	}
 	return nil
 }
 
+func (m *MockUserRepository) UnlinkIdentity(userID string, provider string) (bool, error) {
+	if m.UnlinkIdentityFunc != nil {
+		return m.UnlinkIdentityFunc(userID, provider)
+	}
+	return false, nil
+}
+
 func (m *MockUserRepository) FindByRefreshToken(token string) *User {
 	if m.FindByRefreshTokenFunc != nil {
 		return m.FindByRefreshTokenFunc(token)
@@ -109,17 +139,188 @@ func (m *MockUserRepository) FindByRefreshToken(token string) *User {
 	return nil
 }
 
+func (m *MockUserRepository) SetMFASecret(userID string, secret string) error {
+	if m.SetMFASecretFunc != nil {
+		return m.SetMFASecretFunc(userID, secret)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) EnableMFA(userID string, step int64, recoveryCodeHashes []string) error {
+	if m.EnableMFAFunc != nil {
+		return m.EnableMFAFunc(userID, step, recoveryCodeHashes)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) DisableMFA(userID string) error {
+	if m.DisableMFAFunc != nil {
+		return m.DisableMFAFunc(userID)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) UpdateMFALastStep(userID string, step int64) error {
+	if m.UpdateMFALastStepFunc != nil {
+		return m.UpdateMFALastStepFunc(userID, step)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) SetRecoveryCodes(userID string, recoveryCodeHashes []string) error {
+	if m.SetRecoveryCodesFunc != nil {
+		return m.SetRecoveryCodesFunc(userID, recoveryCodeHashes)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) ConsumeRecoveryCode(userID string, codeHash string) bool {
+	if m.ConsumeRecoveryCodeFunc != nil {
+		return m.ConsumeRecoveryCodeFunc(userID, codeHash)
+	}
+	return false
+}
+
+func (m *MockUserRepository) SetMagicLink(userID string, link *MagicLink) error {
+	if m.SetMagicLinkFunc != nil {
+		return m.SetMagicLinkFunc(userID, link)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) FindByMagicLink(tokenHash string) *User {
+	if m.FindByMagicLinkFunc != nil {
+		return m.FindByMagicLinkFunc(tokenHash)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) ConsumeMagicLink(userID string, tokenHash string) bool {
+	if m.ConsumeMagicLinkFunc != nil {
+		return m.ConsumeMagicLinkFunc(userID, tokenHash)
+	}
+	return false
+}
+
+func (m *MockUserRepository) SearchUsers(search UserSearch) ([]User, int64, error) {
+	if m.SearchUsersFunc != nil {
+		return m.SearchUsersFunc(search)
+	}
+	return []User{}, 0, nil
+}
+
+func (m *MockUserRepository) SetRoles(userID string, roles []string) error {
+	if m.SetRolesFunc != nil {
+		return m.SetRolesFunc(userID, roles)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) GrantRoleByEmail(email string, role string) error {
+	if m.GrantRoleByEmailFunc != nil {
+		return m.GrantRoleByEmailFunc(email, role)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) SetDisabled(userID string, disabled bool) error {
+	if m.SetDisabledFunc != nil {
+		return m.SetDisabledFunc(userID, disabled)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) FindByUsername(username string) *User {
+	if m.FindByUsernameFunc != nil {
+		return m.FindByUsernameFunc(username)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) UpdateProfile(userID string, update ProfileUpdate) error {
+	if m.UpdateProfileFunc != nil {
+		return m.UpdateProfileFunc(userID, update)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) SetAvatar(userID string, key string, url string) error {
+	if m.SetAvatarFunc != nil {
+		return m.SetAvatarFunc(userID, key, url)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) SetEmailChange(userID string, change *EmailChange) error {
+	if m.SetEmailChangeFunc != nil {
+		return m.SetEmailChangeFunc(userID, change)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) FindByEmailChangeToken(tokenHash string) *User {
+	if m.FindByEmailChangeTokenFunc != nil {
+		return m.FindByEmailChangeTokenFunc(tokenHash)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) ChangeEmail(userID string, email string) error {
+	if m.ChangeEmailFunc != nil {
+		return m.ChangeEmailFunc(userID, email)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) ScheduleDeletion(userID string, at *time.Time) error {
+	if m.ScheduleDeletionFunc != nil {
+		return m.ScheduleDeletionFunc(userID, at)
+	}
+	return nil
+}
+
+func (m *MockUserRepository) FindDueForDeletion(now time.Time) ([]User, error) {
+	if m.FindDueForDeletionFunc != nil {
+		return m.FindDueForDeletionFunc(now)
+	}
+	return []User{}, nil
+}
+
+func (m *MockUserRepository) DeleteUser(userID string) error {
+	if m.DeleteUserFunc != nil {
+		return m.DeleteUserFunc(userID)
+	}
+	return nil
+}
+
 type MockSessionRepository struct {
-	CreateSessionFunc             func(userID string, ipAddress string, userAgent string) (*UserSession, error)
-	FindSessionByRefreshTokenFunc func(token string) (*UserSession, error)
-	FindSessionByIDFunc           func(sessionID string, userID string) (*UserSession, error)
-	ValidateSessionFunc           func(sessionID string, userID string, deviceHash string) bool
-	UpdateSessionActivityFunc     func(sessionID string) error
-	DeactivateSessionFunc         func(sessionID string) error
-	GetUserSessionsFunc           func(userID string) ([]UserSession, error)
-	ClearExpiredSessionsFunc      func(userID string) error
-	ClearAllUserSessionsFunc      func(userID string) error
-	UpdateSessionRefreshTokenFunc func(sessionID string, refreshToken string) error
+	CreateSessionFunc                     func(userID string, ipAddress string, userAgent string) (*UserSession, error)
+	FindSessionByRefreshTokenFunc         func(token string) (*UserSession, error)
+	FindSessionByIDFunc                   func(sessionID string, userID string) (*UserSession, error)
+	RebindSessionFunc                     func(sessionID string, ipAddress string, userAgent string) error
+	UpdateSessionActivityFunc             func(sessionID string) error
+	DeactivateSessionFunc                 func(sessionID string) error
+	GetUserSessionsFunc                   func(userID string) ([]UserSession, error)
+	ClearExpiredSessionsFunc              func(userID string) error
+	ClearAllUserSessionsFunc              func(userID string) error
+	UpdateSessionRefreshTokenFunc         func(sessionID string, refreshToken string) error
+	RotateSessionRefreshTokenFunc         func(sessionID string, currentRefreshToken string, newRefreshToken string) (bool, error)
+	FindSessionByPreviousRefreshTokenFunc func(token string) (*UserSession, error)
+	SaveOAuthStateFunc                    func(state *OAuthState) error
+	TakeOAuthStateFunc                    func(state string) (*OAuthState, error)
+	DeleteUserSessionsFunc                func(userID string) error
+	IsNewDeviceFunc                       func(userID string, deviceHash string) (bool, error)
+	RenameSessionFunc                     func(sessionID string, userID string, name string) (bool, error)
+	SetSessionRevokeTokenFunc             func(sessionID string, tokenHash string) error
+	RevokeSessionByTokenFunc              func(tokenHash string) (*UserSession, error)
+	FindIdleSessionsFunc                  func(cutoff time.Time) ([]UserSession, error)
+	FindRevokedSessionsFunc               func(since time.Time) ([]UserSession, error)
+	SetSessionOrgFunc                     func(sessionID string, orgID string, role string) error
+	UpdateSessionOrgRoleFunc              func(userID string, orgID string, role string) error
+	ClearSessionOrgFunc                   func(orgID string) error
+	FindOrgSessionsFunc                   func(orgID string, userID string) ([]UserSession, error)
+	CreateClientSessionFunc               func(userID string, clientID string, scopes []string, ipAddress string, userAgent string) (*UserSession, error)
+	FindClientSessionsFunc                func(clientID string) ([]UserSession, error)
 }
 
 func (m *MockSessionRepository) CreateSession(userID string, ipAddress string, userAgent string) (*UserSession, error) {
@@ -143,11 +344,11 @@ func (m *MockSessionRepository) FindSessionByID(sessionID string, userID string)
 	return nil, nil
 }
 
-func (m *MockSessionRepository) ValidateSession(sessionID string, userID string, deviceHash string) bool {
-	if m.ValidateSessionFunc != nil {
-		return m.ValidateSessionFunc(sessionID, userID, deviceHash)
+func (m *MockSessionRepository) RebindSession(sessionID string, ipAddress string, userAgent string) error {
+	if m.RebindSessionFunc != nil {
+		return m.RebindSessionFunc(sessionID, ipAddress, userAgent)
 	}
-	return true
+	return nil
 }
 
 func (m *MockSessionRepository) UpdateSessionActivity(sessionID string) error {
@@ -192,48 +393,227 @@ func (m *MockSessionRepository) UpdateSessionRefreshToken(sessionID string, refr
 	return nil
 }
 
+func (m *MockSessionRepository) RotateSessionRefreshToken(sessionID string, currentRefreshToken string, newRefreshToken string) (bool, error) {
+	if m.RotateSessionRefreshTokenFunc != nil {
+		return m.RotateSessionRefreshTokenFunc(sessionID, currentRefreshToken, newRefreshToken)
+	}
+	return true, nil
+}
+
+func (m *MockSessionRepository) FindSessionByPreviousRefreshToken(token string) (*UserSession, error) {
+	if m.FindSessionByPreviousRefreshTokenFunc != nil {
+		return m.FindSessionByPreviousRefreshTokenFunc(token)
+	}
+	return nil, nil
+}
+
+func (m *MockSessionRepository) SaveOAuthState(state *OAuthState) error {
+	if m.SaveOAuthStateFunc != nil {
+		return m.SaveOAuthStateFunc(state)
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) TakeOAuthState(state string) (*OAuthState, error) {
+	if m.TakeOAuthStateFunc != nil {
+		return m.TakeOAuthStateFunc(state)
+	}
+	return nil, nil
+}
+
+func (m *MockSessionRepository) DeleteUserSessions(userID string) error {
+	if m.DeleteUserSessionsFunc != nil {
+		return m.DeleteUserSessionsFunc(userID)
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) IsNewDevice(userID string, deviceHash string) (bool, error) {
+	if m.IsNewDeviceFunc != nil {
+		return m.IsNewDeviceFunc(userID, deviceHash)
+	}
+	return false, nil
+}
+
+func (m *MockSessionRepository) RenameSession(sessionID string, userID string, name string) (bool, error) {
+	if m.RenameSessionFunc != nil {
+		return m.RenameSessionFunc(sessionID, userID, name)
+	}
+	return false, nil
+}
+
+func (m *MockSessionRepository) SetSessionRevokeToken(sessionID string, tokenHash string) error {
+	if m.SetSessionRevokeTokenFunc != nil {
+		return m.SetSessionRevokeTokenFunc(sessionID, tokenHash)
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) RevokeSessionByToken(tokenHash string) (*UserSession, error) {
+	if m.RevokeSessionByTokenFunc != nil {
+		return m.RevokeSessionByTokenFunc(tokenHash)
+	}
+	return nil, nil
+}
+
+func (m *MockSessionRepository) FindIdleSessions(cutoff time.Time) ([]UserSession, error) {
+	if m.FindIdleSessionsFunc != nil {
+		return m.FindIdleSessionsFunc(cutoff)
+	}
+	return []UserSession{}, nil
+}
+
+func (m *MockSessionRepository) FindRevokedSessions(since time.Time) ([]UserSession, error) {
+	if m.FindRevokedSessionsFunc != nil {
+		return m.FindRevokedSessionsFunc(since)
+	}
+	return []UserSession{}, nil
+}
+
+func (m *MockSessionRepository) SetSessionOrg(sessionID string, orgID string, role string) error {
+	if m.SetSessionOrgFunc != nil {
+		return m.SetSessionOrgFunc(sessionID, orgID, role)
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) UpdateSessionOrgRole(userID string, orgID string, role string) error {
+	if m.UpdateSessionOrgRoleFunc != nil {
+		return m.UpdateSessionOrgRoleFunc(userID, orgID, role)
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) ClearSessionOrg(orgID string) error {
+	if m.ClearSessionOrgFunc != nil {
+		return m.ClearSessionOrgFunc(orgID)
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) CreateClientSession(userID string, clientID string, scopes []string, ipAddress string, userAgent string) (*UserSession, error) {
+	if m.CreateClientSessionFunc != nil {
+		return m.CreateClientSessionFunc(userID, clientID, scopes, ipAddress, userAgent)
+	}
+	return &UserSession{ID: primitive.NewObjectID(), SessionID: "test-session", ClientID: clientID, Scopes: scopes}, nil
+}
+
+func (m *MockSessionRepository) FindOrgSessions(orgID string, userID string) ([]UserSession, error) {
+	if m.FindOrgSessionsFunc != nil {
+		return m.FindOrgSessionsFunc(orgID, userID)
+	}
+	return nil, nil
+}
+
+func (m *MockSessionRepository) FindClientSessions(clientID string) ([]UserSession, error) {
+	if m.FindClientSessionsFunc != nil {
+		return m.FindClientSessionsFunc(clientID)
+	}
+	return nil, nil
+}
+
 func newMockConfig() *Config {
 	return &Config{
-		Environment:        "test",
-		Port:               ":3000",
-		MongoURI:           "mongodb://localhost:27017",
-		MongoDB:            "auth_test",
-		JWTSecret:          "test-secret-key-for-testing-only",
-		TokenExpiryHours:   1,
-		RefreshExpiryHours: 168,
-		SMTPHost:           "localhost",
-		SMTPPort:           "1025",
-		SMTPUsername:       "test",
-		SMTPPassword:       "test",
-		EmailFrom:          "test@example.com",
-		GoogleClientID:     "test-client-id",
-		GoogleClientSecret: "test-secret",
-		GoogleRedirectUrl:  "http://localhost:3000/google/callback",
-		ApiUrl:             "http://localhost:3001",
-		WebUrl:             "http://localhost:3000",
-		PinEnabled:         true,
+		Environment:         "test",
+		Port:                ":3000",
+		MongoURI:            "mongodb://localhost:27017",
+		MongoDB:             "auth_test",
+		JWTSecret:           "test-secret-key-for-testing-only",
+		TokenExpiryHours:    1,
+		RefreshExpiryHours:  168,
+		SMTPHost:            "localhost",
+		SMTPPort:            "1025",
+		SMTPUsername:        "test",
+		SMTPPassword:        "test",
+		EmailFrom:           "test@example.com",
+		GoogleClientID:      "test-client-id",
+		GoogleClientSecret:  "test-secret",
+		GoogleRedirectUrl:   "http://localhost:3000/google/callback",
+		ApiUrl:              "http://localhost:3001",
+		WebUrl:              "http://localhost:3000",
+		PinEnabled:          true,
+		MFAIssuer:           "Instrlabs",
+		MFATokenExpiryMins:  5,
+		WebAuthnRPID:        "localhost",
+		WebAuthnRPName:      "Instrlabs",
+		WebAuthnOrigins:     []string{"http://localhost:3000"},
+		JWTSigningAlgorithm: SigningAlgEdDSA,
+		JWTKeyRotationHours: 720,
+
+		LoginMaxFailuresPerEmail: 5,
+		LoginMaxFailuresPerIP:    20,
+		LockoutBaseSeconds:       60,
+		LockoutMaxSeconds:        3600,
+		PinMaxAttempts:           5,
+		MFAMaxFailures:           5,
+		PinResendCooldownSeconds: 60,
+		SendPinMaxPerEmail:       5,
+		SendPinMaxPerIP:          10,
+		AttemptWindowMinutes:     60,
+
+		APIKeyDefaultExpiryDays:  90,
+		APIKeyMaxExpiryDays:      365,
+		NatsSubjectAPIKeyResolve: "auth.api_keys.resolve",
+		NatsSubjectAPIKeyRevoked: "auth.api_keys.revoked",
+
+		NatsSubjectNotificationsSSE: "notifications.sse",
+
+		AvatarMaxBytes: 2 * 1024 * 1024,
+
+		AccountDeletionGraceDays:       14,
+		AccountServices:                []string{"image", "pdf"},
+		NatsSubjectAccountDeleted:      "accounts.deleted",
+		NatsSubjectAccountDeletionDone: "accounts.deletion.completed",
+		NatsSubjectAccountExport:       "accounts.export",
+
+		SessionIdleTimeoutHours:       168,
+		SessionMaxLifetimeDays:        30,
+		NatsSubjectSessionRevoked:     "auth.sessions.revoked",
+		NatsSubjectSessionRevocations: "auth.sessions.revocations",
+		NatsSubjectSessionActivity:    "auth.sessions.activity",
+
+		MagicLinkExpiryMinutes: 10,
+
+		OrgInvitationExpiryDays: 7,
+
+		ServiceClients:         map[string]string{"gateway-service": "gateway-secret"},
+		ServiceTokenTTLMinutes: 5,
+		TrustedServices:        []string{"gateway-service"},
+
+		MailTransport:        MailTransportMemory,
+		MailDefaultLocale:    "en",
+		MailQueueSize:        100,
+		MailMaxAttempts:      3,
+		MailRetryBaseSeconds: 0,
 	}
 }
 
+// newMockMailer renders emails into a queue that nothing delivers
+func newMockMailer() *Mailer {
+	mailer, err := NewMailer(newMockConfig(), &MemoryTransport{})
+	if err != nil {
+		panic(err)
+	}
+	return mailer
+}
+
 func TestGenerateAccessToken_ValidToken(t *testing.T) {
 	config := newMockConfig()
 	userRepo := &MockUserRepository{}
 	sessionRepo := &MockSessionRepository{}
-	handler := NewUserHandler(config, userRepo, sessionRepo)
+	handler := NewUserHandler(config, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
 
 	userID := "test-user-id"
 	sessionID := "test-session-id"
 	roles := []string{"user"}
 
-	token, err := handler.generateAccessToken(userID, roles, sessionID)
+	token, err := handler.generateAccessToken(userID, roles, &UserSession{SessionID: sessionID})
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 
 	claims := jwt.MapClaims{}
-	parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWTSecret), nil
-	})
+	parsedToken, err := jwt.ParseWithClaims(token, claims, handler.keys.Keyfunc)
 
 	assert.NoError(t, err)
 	assert.True(t, parsedToken.Valid)
@@ -245,15 +625,13 @@ func TestGenerateAccessToken_HasExpiry(t *testing.T) {
 	config := newMockConfig()
 	userRepo := &MockUserRepository{}
 	sessionRepo := &MockSessionRepository{}
-	handler := NewUserHandler(config, userRepo, sessionRepo)
+	handler := NewUserHandler(config, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
 
 	before := time.Now()
-	token, _ := handler.generateAccessToken("user-id", []string{"user"}, "session-id")
+	token, _ := handler.generateAccessToken("user-id", []string{"user"}, &UserSession{SessionID: "session-id"})
 
 	claims := jwt.MapClaims{}
-	jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWTSecret), nil
-	})
+	jwt.ParseWithClaims(token, claims, handler.keys.Keyfunc)
 
 	expTime := time.Unix(int64(claims["exp"].(float64)), 0)
 	expectedExpiry := time.Duration(config.TokenExpiryHours) * time.Hour
@@ -267,7 +645,7 @@ func TestGenerateRefreshToken_ValidFormat(t *testing.T) {
 	config := newMockConfig()
 	userRepo := &MockUserRepository{}
 	sessionRepo := &MockSessionRepository{}
-	handler := NewUserHandler(config, userRepo, sessionRepo)
+	handler := NewUserHandler(config, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
 
 	token, err := handler.generateRefreshToken()
 
@@ -280,7 +658,7 @@ func TestGenerateRefreshToken_Uniqueness(t *testing.T) {
 	config := newMockConfig()
 	userRepo := &MockUserRepository{}
 	sessionRepo := &MockSessionRepository{}
-	handler := NewUserHandler(config, userRepo, sessionRepo)
+	handler := NewUserHandler(config, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
 
 	token1, _ := handler.generateRefreshToken()
 	token2, _ := handler.generateRefreshToken()
@@ -292,15 +670,13 @@ func TestGenerateAccessToken_ContainsRoles(t *testing.T) {
 	config := newMockConfig()
 	userRepo := &MockUserRepository{}
 	sessionRepo := &MockSessionRepository{}
-	handler := NewUserHandler(config, userRepo, sessionRepo)
+	handler := NewUserHandler(config, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
 
 	roles := []string{"user", "admin"}
-	token, _ := handler.generateAccessToken("user-id", roles, "session-id")
+	token, _ := handler.generateAccessToken("user-id", roles, &UserSession{SessionID: "session-id"})
 
 	claims := jwt.MapClaims{}
-	jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWTSecret), nil
-	})
+	jwt.ParseWithClaims(token, claims, handler.keys.Keyfunc)
 
 	claimsRoles := claims["roles"].([]interface{})
 	assert.Equal(t, 2, len(claimsRoles))
@@ -374,7 +750,7 @@ func TestUserHandler_RepositoryDependencyInjection(t *testing.T) {
 	userRepo := &MockUserRepository{}
 	sessionRepo := &MockSessionRepository{}
 
-	handler := NewUserHandler(config, userRepo, sessionRepo)
+	handler := NewUserHandler(config, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
 
 	assert.NotNil(t, handler)
 	assert.Equal(t, config, handler.cfg)
@@ -420,35 +796,19 @@ func TestMockSessionRepository_CreateSession(t *testing.T) {
 	assert.Equal(t, "test-session", session.SessionID)
 }
 
-func TestMockSessionRepository_ValidateSession(t *testing.T) {
-	mockRepo := &MockSessionRepository{}
-
-	mockRepo.ValidateSessionFunc = func(sessionID string, userID string, deviceHash string) bool {
-		return deviceHash == "valid-hash"
-	}
-
-	result := mockRepo.ValidateSession("session-1", "user-1", "valid-hash")
-	assert.True(t, result)
-
-	result = mockRepo.ValidateSession("session-1", "user-1", "invalid-hash")
-	assert.False(t, result)
-}
-
 func TestGenerateAccessToken_MultipleRoles(t *testing.T) {
 	config := newMockConfig()
 	userRepo := &MockUserRepository{}
 	sessionRepo := &MockSessionRepository{}
-	handler := NewUserHandler(config, userRepo, sessionRepo)
+	handler := NewUserHandler(config, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
 
 	roles := []string{"user", "moderator", "admin"}
-	token, err := handler.generateAccessToken("user-123", roles, "session-456")
+	token, err := handler.generateAccessToken("user-123", roles, &UserSession{SessionID: "session-456"})
 
 	assert.NoError(t, err)
 
 	claims := jwt.MapClaims{}
-	jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWTSecret), nil
-	})
+	jwt.ParseWithClaims(token, claims, handler.keys.Keyfunc)
 
 	assert.Equal(t, "user-123", claims["user_id"])
 	assert.Equal(t, "session-456", claims["session_id"])
@@ -458,9 +818,9 @@ func TestGenerateAccessToken_NoRoles(t *testing.T) {
 	config := newMockConfig()
 	userRepo := &MockUserRepository{}
 	sessionRepo := &MockSessionRepository{}
-	handler := NewUserHandler(config, userRepo, sessionRepo)
+	handler := NewUserHandler(config, userRepo, sessionRepo, newMockKeyManager(), NewMemoryAttemptStore(), &memoryAuditLog{}, &recordingPublisher{}, newMockMailer())
 
-	token, err := handler.generateAccessToken("user-id", []string{}, "session-id")
+	token, err := handler.generateAccessToken("user-id", []string{}, &UserSession{SessionID: "session-id"})
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"regexp"
 	"strings"
 	"time"
 
@@ -15,18 +16,40 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrUsernameExists is returned when an update would give a user another user's username
+var ErrUsernameExists = errors.New("username already exists")
+
 type UserRepository struct {
 	db         *initx.Mongo
 	collection *mongo.Collection
 }
 
 func NewUserRepository(db *initx.Mongo) *UserRepository {
-	return &UserRepository{
+	r := &UserRepository{
 		db:         db,
 		collection: db.DB.Collection("users"),
 	}
+	r.ensureIndexes()
+	return r
+}
+
+// ensureIndexes gives every username to at most one user, so two concurrent profile updates cannot
+// both claim the same one. Users without a username are left out of the index.
+func (r *UserRepository) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"username": bson.M{"$gt": ""}}),
+	})
+	if err != nil {
+		log.Errorf("ensureIndexes: Failed to create user indexes: %v", err)
+	}
 }
 
 func (r *UserRepository) Create(user *User) *User {
@@ -181,50 +204,97 @@ func (r *UserRepository) ClearRefreshToken(userID string) error {
 	return nil
 }
 
-func (r *UserRepository) FindByGoogleID(googleID string) *User {
+// FindByIdentity finds the user that linked the provider account.
+// Google accounts linked before identities existed are still matched by google_id.
+func (r *UserRepository) FindByIdentity(provider string, subject string) *User {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+	if provider == OAuthProviderGoogle {
+		filter = bson.M{"$or": bson.A{filter, bson.M{"google_id": subject}}}
+	}
+
 	var user User
-	err := r.collection.FindOne(ctx, bson.M{"google_id": googleID}).Decode(&user)
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			log.Warnf("Google ID not found for user: %s", googleID)
+			log.Warnf("No user linked to %s identity: %s", provider, subject)
 			return nil
 		}
 
-		log.Errorf("Failed to find user by Google ID: %v", err)
+		log.Errorf("Failed to find user by %s identity: %v", provider, err)
 		return nil
 	}
 
 	return &user
 }
 
-func (r *UserRepository) UpdateGoogleID(userID string, googleID string) error {
+// LinkIdentity adds a provider account to the user. A user can link one account per provider.
+func (r *UserRepository) LinkIdentity(userID string, identity LinkedIdentity) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
 	update := bson.M{
-		"$set": bson.M{
-			"google_id":  googleID,
-			"updated_at": time.Now().UTC(),
-		},
+		"$push": bson.M{"identities": identity},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+	if identity.Provider == OAuthProviderGoogle {
+		update["$unset"] = bson.M{"google_id": ""}
 	}
 
-	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	filter := bson.M{"_id": objectID, "identities.provider": bson.M{"$ne": identity.Provider}}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		log.Errorf("Failed to update google ID for user %s: %v", userID, err)
+		log.Errorf("Failed to link %s identity for user %s: %v", identity.Provider, userID, err)
 		return err
 	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("user %s not found or %s already linked", userID, identity.Provider)
+	}
 	return nil
 }
 
+// UnlinkIdentity removes the provider account from the user. Returns false if none was linked.
+func (r *UserRepository) UnlinkIdentity(userID string, provider string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, nil
+	}
+
+	filter := bson.M{"_id": objectID}
+	update := bson.M{
+		"$pull": bson.M{"identities": bson.M{"provider": provider}},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+	if provider == OAuthProviderGoogle {
+		filter["$or"] = bson.A{bson.M{"identities.provider": provider}, bson.M{"google_id": bson.M{"$exists": true}}}
+		update["$unset"] = bson.M{"google_id": ""}
+	} else {
+		filter["identities.provider"] = provider
+	}
+
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Errorf("Failed to unlink %s identity for user %s: %v", provider, userID, err)
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
 func (r *UserRepository) SetPinWithExpiry(email, hashedPin string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	expiry := time.Now().UTC().Add(10 * time.Minute)
+	expiry := time.Now().UTC().Add(PinExpiryMinutes * time.Minute)
 	update := bson.M{
 		"$set": bson.M{
 			"pin_hash":    hashedPin,
@@ -240,6 +310,7 @@ func (r *UserRepository) SetPinWithExpiry(email, hashedPin string) error {
 	return nil
 }
 
+// ClearPin invalidates the emailed sign-in credentials: the PIN and any magic link sent with it
 func (r *UserRepository) ClearPin(userID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -255,12 +326,81 @@ func (r *UserRepository) ClearPin(userID string) error {
 			"pin_expires": nil,
 			"updated_at":  time.Now().UTC(),
 		},
+		"$unset": bson.M{"magic_link": ""},
 	}
 
 	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
 	return err
 }
 
+// SetMagicLink stores the pending magic link, replacing any earlier one
+func (r *UserRepository) SetMagicLink(userID string, link *MagicLink) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	update := bson.M{
+		"$set": bson.M{"magic_link": link, "updated_at": time.Now().UTC()},
+	}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update); err != nil {
+		log.Errorf("Failed to set magic link for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// FindByMagicLink returns the user with an unexpired magic link of the given hash, or nil
+func (r *UserRepository) FindByMagicLink(tokenHash string) *User {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"magic_link.token_hash": tokenHash,
+		"magic_link.expires_at": bson.M{"$gt": time.Now().UTC()},
+	}
+
+	var user User
+	if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Errorf("Failed to find user by magic link: %v", err)
+		}
+		return nil
+	}
+	return &user
+}
+
+// ConsumeMagicLink removes the magic link and the PIN sent with it. Returns false if the link
+// was already used or replaced, so concurrent clicks sign in only once.
+func (r *UserRepository) ConsumeMagicLink(userID string, tokenHash string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"pin_hash":    nil,
+			"pin_expires": nil,
+			"updated_at":  time.Now().UTC(),
+		},
+		"$unset": bson.M{"magic_link": ""},
+	}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "magic_link.token_hash": tokenHash}, update)
+	if err != nil {
+		log.Errorf("Failed to consume magic link for user %s: %v", userID, err)
+		return false
+	}
+	return res.ModifiedCount == 1
+}
+
 func (r *UserRepository) SetRegisteredAt(userID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -282,6 +422,473 @@ func (r *UserRepository) SetRegisteredAt(userID string) error {
 	return err
 }
 
+func (r *UserRepository) SetMFASecret(userID string, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_secret":    secret,
+			"mfa_enabled":   false,
+			"mfa_last_step": 0,
+			"updated_at":    time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "mfa_enabled": bson.M{"$ne": true}}, update)
+	if err != nil {
+		log.Errorf("Failed to set MFA secret for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+func (r *UserRepository) EnableMFA(userID string, step int64, recoveryCodeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_enabled":        true,
+			"mfa_last_step":      step,
+			"mfa_recovery_codes": recoveryCodeHashes,
+			"updated_at":         time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to enable MFA for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+func (r *UserRepository) DisableMFA(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_enabled":        false,
+			"mfa_secret":         nil,
+			"mfa_last_step":      0,
+			"mfa_recovery_codes": nil,
+			"updated_at":         time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to disable MFA for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// UpdateMFALastStep records the last accepted TOTP step. The filter only matches older steps,
+// so two concurrent requests with the same code cannot both succeed.
+func (r *UserRepository) UpdateMFALastStep(userID string, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_last_step": step,
+			"updated_at":    time.Now().UTC(),
+		},
+	}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "mfa_last_step": bson.M{"$lt": step}}, update)
+	if err != nil {
+		log.Errorf("Failed to update MFA step for user %s: %v", userID, err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("MFA code already used")
+	}
+	return nil
+}
+
+func (r *UserRepository) SetRecoveryCodes(userID string, recoveryCodeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_recovery_codes": recoveryCodeHashes,
+			"updated_at":         time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to set recovery codes for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode removes a recovery code hash and reports whether it was present
+func (r *UserRepository) ConsumeRecoveryCode(userID string, codeHash string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false
+	}
+
+	update := bson.M{
+		"$pull": bson.M{"mfa_recovery_codes": codeHash},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "mfa_recovery_codes": codeHash}, update)
+	if err != nil {
+		log.Errorf("Failed to consume recovery code for user %s: %v", userID, err)
+		return false
+	}
+	return res.ModifiedCount == 1
+}
+
+// UserSearch filters the admin user list. Empty fields match every user.
+type UserSearch struct {
+	Query    string // Substring of email or username
+	Role     string
+	Disabled *bool
+	Page     int
+	Limit    int
+}
+
+// SearchUsers returns one page of users matching the search, newest first, and the total match count
+func (r *UserRepository) SearchUsers(search UserSearch) ([]User, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if search.Query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(search.Query), Options: "i"}
+		filter["$or"] = bson.A{bson.M{"email": pattern}, bson.M{"username": pattern}}
+	}
+	if search.Role == RoleUser {
+		// Users created before roles were stored have none and are plain users
+		filter["$and"] = bson.A{bson.M{"$or": bson.A{bson.M{"roles": RoleUser}, bson.M{"roles": bson.M{"$exists": false}}}}}
+	} else if search.Role != "" {
+		filter["roles"] = search.Role
+	}
+	if search.Disabled != nil {
+		if *search.Disabled {
+			filter["disabled"] = true
+		} else {
+			filter["disabled"] = bson.M{"$ne": true}
+		}
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Errorf("SearchUsers: Failed to count users: %v", err)
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetSkip(int64((search.Page - 1) * search.Limit)).
+		SetLimit(int64(search.Limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Errorf("SearchUsers: Failed to find users: %v", err)
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		log.Errorf("SearchUsers: Failed to decode users: %v", err)
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// SetRoles replaces the user's roles
+func (r *UserRepository) SetRoles(userID string, roles []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID)
+	update := bson.M{
+		"$set": bson.M{
+			"roles":      roles,
+			"updated_at": time.Now().UTC(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to set roles for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// GrantRoleByEmail adds a role to the user with the email, if there is one
+func (r *UserRepository) GrantRoleByEmail(email string, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$addToSet": bson.M{"roles": bson.M{"$each": bson.A{RoleUser, role}}},
+		"$set":      bson.M{"updated_at": time.Now().UTC()},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		log.Errorf("Failed to grant role %s to %s: %v", role, email, err)
+		return err
+	}
+	return nil
+}
+
+// SetDisabled disables or re-enables the user's account
+func (r *UserRepository) SetDisabled(userID string, disabled bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID)
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": bson.M{"disabled": true, "disabled_at": now, "updated_at": now},
+	}
+	if !disabled {
+		update = bson.M{
+			"$set":   bson.M{"disabled": false, "updated_at": now},
+			"$unset": bson.M{"disabled_at": ""},
+		}
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to set disabled=%t for user %s: %v", disabled, userID, err)
+		return err
+	}
+	return nil
+}
+
+// FindByUsername returns the user with the username, or nil
+func (r *UserRepository) FindByUsername(username string) *User {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user User
+	err := r.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Errorf("Failed to find user by username: %v", err)
+		}
+		return nil
+	}
+
+	return &user
+}
+
+// UpdateProfile sets the non-nil fields of the update
+func (r *UserRepository) UpdateProfile(userID string, update ProfileUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fields, err := bson.Marshal(update)
+	if err != nil {
+		return err
+	}
+	var set bson.M
+	if err := bson.Unmarshal(fields, &set); err != nil {
+		return err
+	}
+	set["updated_at"] = time.Now().UTC()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID)
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": set})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameExists
+	}
+	if err != nil {
+		log.Errorf("Failed to update profile for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// SetAvatar stores the avatar's object key and URL. Empty values remove the avatar.
+func (r *UserRepository) SetAvatar(userID string, key string, url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID)
+	update := bson.M{
+		"$set": bson.M{
+			"avatar_key": key,
+			"avatar_url": url,
+			"updated_at": time.Now().UTC(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to set avatar for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// SetEmailChange stores the pending email change. A nil change cancels it.
+func (r *UserRepository) SetEmailChange(userID string, change *EmailChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID)
+	update := bson.M{
+		"$set": bson.M{"email_change": change, "updated_at": time.Now().UTC()},
+	}
+	if change == nil {
+		update = bson.M{
+			"$set":   bson.M{"updated_at": time.Now().UTC()},
+			"$unset": bson.M{"email_change": ""},
+		}
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to set email change for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// FindByEmailChangeToken returns the user whose pending email change was sent the token, or nil
+func (r *UserRepository) FindByEmailChangeToken(tokenHash string) *User {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"email_change.old_token_hash": tokenHash},
+		bson.M{"email_change.new_token_hash": tokenHash},
+	}}
+
+	var user User
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Errorf("Failed to find user by email change token: %v", err)
+		}
+		return nil
+	}
+
+	return &user
+}
+
+// ChangeEmail switches the user to the new address and clears the pending change
+func (r *UserRepository) ChangeEmail(userID string, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID)
+	update := bson.M{
+		"$set":   bson.M{"email": email, "updated_at": time.Now().UTC()},
+		"$unset": bson.M{"email_change": ""},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to change email for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// ScheduleDeletion schedules the account to be purged at the given time. A nil time cancels the deletion.
+func (r *UserRepository) ScheduleDeletion(userID string, at *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID)
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": bson.M{"deletion_requested_at": now, "deletion_scheduled_at": at, "updated_at": now},
+	}
+	if at == nil {
+		update = bson.M{
+			"$set":   bson.M{"updated_at": now},
+			"$unset": bson.M{"deletion_requested_at": "", "deletion_scheduled_at": ""},
+		}
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		log.Errorf("Failed to schedule deletion for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// FindDueForDeletion returns the users whose deletion grace period ended before now
+func (r *UserRepository) FindDueForDeletion(now time.Time) ([]User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"deletion_scheduled_at": bson.M{"$lte": now}})
+	if err != nil {
+		log.Errorf("FindDueForDeletion: Failed to find users: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		log.Errorf("FindDueForDeletion: Failed to decode users: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// DeleteUser removes the user document
+func (r *UserRepository) DeleteUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID)
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		log.Errorf("Failed to delete user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
 func (r *UserRepository) generateUniqueUsername(ctx context.Context, email string) (string, error) {
 	base := email
 	if at := strings.Index(email, "@"); at != -1 {
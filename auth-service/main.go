@@ -1,10 +1,13 @@
 package main
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/instrlabs/auth-service/internal"
 	initx "github.com/instrlabs/shared/init"
+	natsgo "github.com/nats-io/nats.go"
 )
 
 func main() {
@@ -12,10 +15,112 @@ func main() {
 
 	mongo := initx.NewMongo(&initx.MongoConfig{MongoURI: cfg.MongoURI, MongoDB: cfg.MongoDB})
 	defer mongo.Close()
+	nats := initx.NewNats(cfg.NatsURI)
+	defer nats.Close()
+	s3 := initx.NewS3(&initx.S3Config{
+		S3Endpoint:  cfg.S3Endpoint,
+		S3AccessKey: cfg.S3AccessKey,
+		S3SecretKey: cfg.S3SecretKey,
+		S3UseSSL:    cfg.S3UseSSL,
+		S3Region:    cfg.S3Region,
+		S3Bucket:    cfg.S3Bucket,
+	})
+
+	if err := internal.CheckJWTSecret(cfg.JWTSecret); err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
 
 	userRepo := internal.NewUserRepository(mongo)
-	sessionRepo := internal.NewSessionRepository(mongo)
-	userHandler := internal.NewUserHandler(cfg, userRepo, sessionRepo)
+	sessionRepo := internal.NewSessionRepository(mongo, time.Duration(cfg.SessionMaxLifetimeDays)*24*time.Hour)
+	passkeyRepo := internal.NewPasskeyRepository(mongo)
+	signingKeyRepo := internal.NewSigningKeyRepository(mongo)
+	keys, err := internal.NewKeyManager(cfg, signingKeyRepo)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	var attempts internal.IAttemptStore = internal.NewMongoAttemptStore(mongo)
+	if cfg.AttemptStore == internal.AttemptStoreMemory {
+		attempts = internal.NewMemoryAttemptStore()
+	}
+	auditRepo := internal.NewAuditRepository(mongo, time.Duration(cfg.AuditRetentionDays)*24*time.Hour)
+	mailTransport, err := internal.NewMailTransport(cfg)
+	if err != nil {
+		log.Fatalf("Invalid mail transport configuration: %v", err)
+	}
+	mailer, err := internal.NewMailer(cfg, mailTransport)
+	if err != nil {
+		log.Fatalf("Failed to load email templates: %v", err)
+	}
+	go mailer.Run()
+	userHandler := internal.NewUserHandler(cfg, userRepo, sessionRepo, keys, attempts, auditRepo, nats.Conn, mailer)
+	passkeyHandler, err := internal.NewPasskeyHandler(userHandler, passkeyRepo)
+	if err != nil {
+		log.Fatalf("Invalid WebAuthn configuration: %v", err)
+	}
+	providers, err := internal.NewOAuthRegistry(cfg)
+	if err != nil {
+		log.Fatalf("Invalid OAuth provider configuration: %v", err)
+	}
+	oauthHandler := internal.NewOAuthHandler(userHandler, providers)
+	profileHandler := internal.NewProfileHandler(userHandler, s3)
+	apiKeyRepo := internal.NewAPIKeyRepository(mongo)
+	apiKeyHandler := internal.NewAPIKeyHandler(cfg, apiKeyRepo, userRepo, nats.Conn)
+	adminHandler := internal.NewAdminHandler(userHandler, apiKeyHandler)
+	tombstoneRepo := internal.NewAccountTombstoneRepository(mongo)
+	accountHandler := internal.NewAccountHandler(userHandler, passkeyRepo, apiKeyHandler, tombstoneRepo, s3, nats.Conn, nats.Conn)
+	orgRepo := internal.NewOrganizationRepository(mongo)
+	orgHandler := internal.NewOrganizationHandler(userHandler, orgRepo, apiKeyHandler)
+	oauthClientRepo := internal.NewOAuthClientRepository(mongo)
+	oauthServerHandler := internal.NewOAuthServerHandler(userHandler, oauthClientRepo)
+
+	for _, email := range cfg.AdminEmails {
+		if err := userRepo.GrantRoleByEmail(email, internal.RoleAdmin); err != nil {
+			log.Errorf("Failed to grant admin role to %s: %v", email, err)
+		}
+	}
+
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectAPIKeyResolve, func(m *natsgo.Msg) {
+		_ = m.Respond(apiKeyHandler.ResolveAPIKeyMessage(m.Data))
+	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectAccountDeletionDone, func(m *natsgo.Msg) {
+		accountHandler.AccountDeletionDoneMessage(m.Data)
+	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectAccountDeleted, func(m *natsgo.Msg) {
+		orgHandler.AccountDeletedMessage(m.Data)
+		oauthServerHandler.AccountDeletedMessage(m.Data)
+	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectSessionRevocations, func(m *natsgo.Msg) {
+		_ = m.Respond(userHandler.RevokedSessionsMessage())
+	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectSessionActivity, func(m *natsgo.Msg) {
+		userHandler.SessionActivityMessage(m.Data)
+	})
+
+	go func() {
+		ticker := time.NewTicker(internal.KeyRotationCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := keys.Rotate(); err != nil {
+				log.Errorf("Rotate: %v", err)
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(internal.AccountPurgeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			accountHandler.PurgeDueAccounts()
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(internal.SessionSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			userHandler.RevokeIdleSessions()
+		}
+	}()
 
 	app := fiber.New(fiber.Config{})
 
@@ -23,28 +128,114 @@ func main() {
 	initx.SetupLogger(app)
 	initx.SetupServiceSwagger(app, cfg.ApiUrl, "/auth")
 	initx.SetupServiceHealth(app)
-	initx.SetupAuthenticated(app, []string{
+	internal.SetupServiceIdentity(app, keys.Keyfunc, cfg.TrustedServices)
+	initx.SetupAuthenticated(app, append([]string{
 		"/login",
+		"/login/magic-link",
 		"/refresh",
+		"/refresh/step-up",
 		"/send-pin",
 		"/check",
+		"/.well-known/jwks.json",
 		"/google",
 		"/google/callback",
-	})
+		"/mfa/verify",
+		"/passkeys/login/begin",
+		"/passkeys/login/finish",
+		"/profile/email/confirm",
+		"/avatars",
+		"/devices/revoke-unrecognized",
+	}, append(oauthHandler.PublicPaths(), oauthServerHandler.PublicPaths()...)...))
+
+	app.Get("/.well-known/jwks.json", keys.JWKS)
 
 	app.Post("/login", userHandler.Login)
+	app.Post("/login/magic-link", userHandler.LoginMagicLink)
 	app.Post("/logout", userHandler.Logout)
 	app.Post("/refresh", userHandler.RefreshToken)
+	app.Post("/refresh/step-up", userHandler.StepUpRefresh)
 	app.Post("/send-pin", userHandler.SendPin)
 
 	app.Get("/profile", userHandler.GetProfile)
+	app.Patch("/profile", profileHandler.UpdateProfile)
+	app.Post("/profile/avatar", profileHandler.UploadAvatar)
+	app.Post("/profile/avatar/remove", profileHandler.RemoveAvatar)
+	app.Post("/profile/email", profileHandler.ChangeEmail)
+	app.Post("/profile/email/cancel", profileHandler.CancelEmailChange)
+	app.Post("/profile/email/confirm", profileHandler.ConfirmEmailChange)
+	app.Get("/avatars/:userId/:name", profileHandler.GetAvatar)
+	app.Post("/profile/identities/:provider/link", oauthHandler.LinkIdentity)
+	app.Post("/profile/identities/:provider/unlink", oauthHandler.UnlinkIdentity)
+
+	app.Post("/mfa/verify", userHandler.VerifyMFA)
+	app.Post("/mfa/setup", userHandler.SetupMFA)
+	app.Post("/mfa/enable", userHandler.EnableMFA)
+	app.Post("/mfa/disable", userHandler.DisableMFA)
+	app.Post("/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+
+	app.Post("/passkeys/register/begin", passkeyHandler.BeginRegistration)
+	app.Post("/passkeys/register/finish", passkeyHandler.FinishRegistration)
+	app.Post("/passkeys/login/begin", passkeyHandler.BeginLogin)
+	app.Post("/passkeys/login/finish", passkeyHandler.FinishLogin)
+
+	app.Get("/oauth/:provider", oauthHandler.Login)
+	app.Get("/oauth/:provider/callback", oauthHandler.Callback)
+	app.Get("/google", oauthHandler.Login)
+	app.Get("/google/callback", oauthHandler.Callback)
 
-	app.Get("/google", userHandler.GoogleLogin)
-	app.Get("/google/callback", userHandler.GoogleCallback)
+	app.Get("/oauth2/authorize", oauthServerHandler.GetAuthorization)
+	app.Post("/oauth2/authorize", oauthServerHandler.Authorize)
+	app.Post("/oauth2/token", oauthServerHandler.Token)
+	app.Post("/oauth2/revoke", oauthServerHandler.Revoke)
+	app.Post("/oauth2/introspect", oauthServerHandler.Introspect)
+	app.Get("/oauth2/clients", oauthServerHandler.GetClients)
+	app.Post("/oauth2/clients", oauthServerHandler.CreateClient)
+	app.Post("/oauth2/clients/:clientId/delete", oauthServerHandler.DeleteClient)
+	app.Get("/oauth2/authorizations", oauthServerHandler.GetAuthorizations)
+	app.Post("/oauth2/authorizations/:sessionId/revoke", oauthServerHandler.RevokeAuthorization)
+
+	app.Get("/security/events", userHandler.GetSecurityEvents)
 
 	app.Get("/devices", userHandler.GetDevices)
 	app.Post("/devices/:sessionId/revoke", userHandler.RevokeDevice)
+	app.Post("/devices/:sessionId/rename", userHandler.RenameDevice)
+	app.Post("/devices/revoke-unrecognized", userHandler.RevokeUnrecognizedDevice)
 	app.Post("/devices/revoke-all", userHandler.LogoutAllDevices)
+	app.Get("/devices/passkeys", passkeyHandler.GetPasskeys)
+	app.Post("/devices/passkeys/:passkeyId/remove", passkeyHandler.RemovePasskey)
+
+	app.Get("/api-keys", apiKeyHandler.GetAPIKeys)
+	app.Post("/api-keys", apiKeyHandler.CreateAPIKey)
+	app.Post("/api-keys/:keyId/revoke", apiKeyHandler.RevokeAPIKey)
+
+	app.Get("/orgs", orgHandler.GetOrganizations)
+	app.Post("/orgs", orgHandler.CreateOrganization)
+	app.Post("/orgs/switch", orgHandler.SwitchOrganization)
+	app.Post("/orgs/invitations/accept", orgHandler.AcceptInvitation)
+	app.Get("/orgs/:orgId", orgHandler.GetOrganization)
+	app.Post("/orgs/:orgId/rename", orgHandler.RenameOrganization)
+	app.Post("/orgs/:orgId/delete", orgHandler.DeleteOrganization)
+	app.Get("/orgs/:orgId/invitations", orgHandler.GetInvitations)
+	app.Post("/orgs/:orgId/invitations", orgHandler.InviteMember)
+	app.Post("/orgs/:orgId/invitations/:invitationId/revoke", orgHandler.RevokeInvitation)
+	app.Post("/orgs/:orgId/members/:userId/role", orgHandler.SetMemberRole)
+	app.Post("/orgs/:orgId/members/:userId/remove", orgHandler.RemoveMember)
+	app.Get("/orgs/:orgId/api-keys", orgHandler.GetOrgAPIKeys)
+	app.Post("/orgs/:orgId/api-keys", orgHandler.CreateOrgAPIKey)
+	app.Post("/orgs/:orgId/api-keys/:keyId/revoke", orgHandler.RevokeOrgAPIKey)
+
+	app.Get("/account/export", accountHandler.ExportData)
+	app.Post("/account/delete", accountHandler.RequestDeletion)
+	app.Post("/account/delete/cancel", accountHandler.CancelDeletion)
+
+	admin := app.Group("/admin", internal.RequireRole(userRepo, internal.RoleAdmin))
+	admin.Get("/users", adminHandler.ListUsers)
+	admin.Get("/users/:userId", adminHandler.GetUser)
+	admin.Post("/users/:userId/roles", adminHandler.SetUserRoles)
+	admin.Post("/users/:userId/disable", adminHandler.DisableUser)
+	admin.Post("/users/:userId/enable", adminHandler.EnableUser)
+	admin.Post("/users/:userId/logout", adminHandler.LogoutUser)
+	admin.Get("/security/events", adminHandler.ListSecurityEvents)
 
 	log.Fatal(app.Listen(cfg.Port))
 }
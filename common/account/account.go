@@ -0,0 +1,52 @@
+// Package account holds the messages services exchange with auth-service when an account is
+// deleted or its data is exported.
+package account
+
+import "encoding/json"
+
+// Deletion is published by auth-service when an account is purged. It may arrive more than once.
+type Deletion struct {
+	UserID string `json:"user_id"`
+}
+
+// DeletionDone confirms to auth-service that a service removed the user's data
+type DeletionDone struct {
+	UserID  string `json:"user_id"`
+	Service string `json:"service"`
+}
+
+// ExportRequest asks a service for the data of a user
+type ExportRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// ExportReply carries a service's records of the user, of the service's own type T, and the
+// S3 keys of the files to include in the export
+type ExportReply[T any] struct {
+	Service      string       `json:"service"`
+	Instructions []T          `json:"instructions"`
+	Files        []ExportFile `json:"files"`
+	Error        string       `json:"error,omitempty"`
+}
+
+type ExportFile struct {
+	Path string `json:"path"` // Path inside the service's folder of the archive
+	Key  string `json:"key"`  // S3 object key
+}
+
+// NewExportReply starts an empty reply of service
+func NewExportReply[T any](service string) ExportReply[T] {
+	return ExportReply[T]{Service: service, Instructions: []T{}, Files: []ExportFile{}}
+}
+
+// Marshal encodes the reply for the NATS response
+func (r ExportReply[T]) Marshal() []byte {
+	out, _ := json.Marshal(r)
+	return out
+}
+
+// Failed encodes the reply with the reason the export failed
+func (r ExportReply[T]) Failed(reason string) []byte {
+	r.Error = reason
+	return r.Marshal()
+}
@@ -0,0 +1,59 @@
+// Package identity lets services behind the gateway trust the identity headers it sets. The gateway
+// sends its service token with every request it forwards, and the headers are only honored on
+// requests that carry it.
+package identity
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ServiceTokenHeader carries the gateway's service token
+const ServiceTokenHeader = "x-service-token"
+
+var ErrNotServiceToken = errors.New("not a service token")
+
+// headers are only honored from a trusted service
+var headers = []string{"x-user-id", "x-user-roles", "x-user-scopes", "x-org-id", "x-org-role", "x-session-id"}
+
+// VerifyServiceToken checks a service token and returns the name of the service it was issued to
+func VerifyServiceToken(keyfunc jwt.Keyfunc, token string) (string, error) {
+	if token == "" {
+		return "", ErrNotServiceToken
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+	if use, _ := claims["token_use"].(string); use != "service" {
+		return "", ErrNotServiceToken
+	}
+	return claims.GetSubject()
+}
+
+// SetupServiceIdentity removes the identity headers of requests without a trusted service token,
+// so SetupAuthenticated treats them as anonymous
+func SetupServiceIdentity(app *fiber.App, keyfunc jwt.Keyfunc, trusted []string) {
+	app.Use(func(c *fiber.Ctx) error {
+		token := c.Get(ServiceTokenHeader)
+		c.Request().Header.Del(ServiceTokenHeader)
+
+		service, err := VerifyServiceToken(keyfunc, token)
+		if err == nil && slices.Contains(trusted, service) {
+			return c.Next()
+		}
+		if c.Get("x-user-id") != "" {
+			log.Warnf("SetupServiceIdentity: Ignoring identity headers of %s %s from an untrusted caller: %v", c.Method(), c.Path(), err)
+		}
+		for _, header := range headers {
+			c.Request().Header.Del(header)
+		}
+		return c.Next()
+	})
+}
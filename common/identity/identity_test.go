@@ -0,0 +1,85 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupServiceIdentity(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	keyfunc := func(*jwt.Token) (interface{}, error) { return pub, nil }
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(priv)
+		require.NoError(t, err)
+		return token
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	app := fiber.New()
+	SetupServiceIdentity(app, keyfunc, []string{"gateway-service"})
+	app.Get("/files", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	cases := map[string]int{
+		"": fiber.StatusForbidden,
+		sign(jwt.MapClaims{"sub": "gateway-service", "token_use": "service", "exp": exp}): fiber.StatusOK,
+		sign(jwt.MapClaims{"sub": "pdf-service", "token_use": "service", "exp": exp}):     fiber.StatusForbidden,
+		sign(jwt.MapClaims{"sub": "gateway-service", "exp": exp}):                         fiber.StatusForbidden,
+		sign(jwt.MapClaims{"sub": "gateway-service", "token_use": "service"}):             fiber.StatusForbidden,
+	}
+	for token, want := range cases {
+		req := httptest.NewRequest(fiber.MethodGet, "/files", nil)
+		req.Header.Set("x-user-id", "user-1")
+		req.Header.Set("x-user-roles", "admin")
+		if token != "" {
+			req.Header.Set(ServiceTokenHeader, token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, want, resp.StatusCode, token)
+	}
+}
+
+func TestSetupServiceIdentity_StripsHeadersOfUntrustedCallers(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	keyfunc := func(*jwt.Token) (interface{}, error) { return pub, nil }
+	token, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"sub": "gateway-service", "token_use": "service", "exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString(priv)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	SetupServiceIdentity(app, keyfunc, []string{"gateway-service"})
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		return c.SendString(c.Get("x-user-id") + "|" + c.Get("x-org-id") + "|" + c.Get("x-session-id") + "|" + c.Get(ServiceTokenHeader))
+	})
+
+	whoami := func(token string) string {
+		req := httptest.NewRequest(fiber.MethodGet, "/whoami", nil)
+		req.Header.Set("x-user-id", "user-1")
+		req.Header.Set("x-org-id", "org-1")
+		req.Header.Set("x-session-id", "session-1")
+		if token != "" {
+			req.Header.Set(ServiceTokenHeader, token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "user-1|org-1|session-1|", whoami(token), "the service token itself is not passed on")
+	assert.Equal(t, "|||", whoami(""))
+	assert.Equal(t, "|||", whoami("not-a-token"))
+}
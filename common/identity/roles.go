@@ -0,0 +1,38 @@
+package identity
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Roles forwarded by the gateway from the verified access token
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// RequireRole only lets through requests whose x-user-roles header, set by the gateway,
+// contains one of the roles. API key requests carry no roles.
+//
+// Unlike auth-service, which owns the users and checks their roles in the database, the
+// services using this have no user store and trust the roles of the verified access token. The header
+// is only honored on requests with the gateway's service token (see SetupServiceIdentity),
+// and a role change applies once the user's short-lived access token is refreshed.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, have := range strings.Split(c.Get("x-user-roles"), ",") {
+			for _, want := range roles {
+				if strings.TrimSpace(have) == want {
+					return c.Next()
+				}
+			}
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Forbidden",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+}
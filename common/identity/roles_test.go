@@ -0,0 +1,58 @@
+package identity
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRole(t *testing.T) {
+	app := fiber.New()
+	app.Get("/files", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	cases := map[string]int{
+		"":           fiber.StatusForbidden,
+		" ":          fiber.StatusForbidden,
+		",":          fiber.StatusForbidden,
+		"user":       fiber.StatusForbidden,
+		"user,admin": fiber.StatusOK,
+		"admin":      fiber.StatusOK,
+		"superadmin": fiber.StatusForbidden,
+	}
+	for roles, want := range cases {
+		req := httptest.NewRequest(fiber.MethodGet, "/files", nil)
+		if roles != "" {
+			req.Header.Set("x-user-roles", roles)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, want, resp.StatusCode, roles)
+	}
+}
+
+func TestRequireRole_RejectsSpoofedRoles(t *testing.T) {
+	// No caller holds a trusted service token, so every identity header is spoofed
+	keyfunc := func(*jwt.Token) (interface{}, error) { return nil, errors.New("no keys") }
+	app := fiber.New()
+	SetupServiceIdentity(app, keyfunc, []string{"gateway-service"})
+	app.Get("/files", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	for _, roles := range []string{"admin", "user,admin", "", " ", ",", " , "} {
+		req := httptest.NewRequest(fiber.MethodGet, "/files", nil)
+		req.Header.Set("x-user-id", "user-1")
+		req.Header.Set("x-user-roles", roles)
+		req.Header.Set(ServiceTokenHeader, "forged")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode, "roles %q", roles)
+	}
+}
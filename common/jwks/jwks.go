@@ -0,0 +1,161 @@
+// Package jwks verifies tokens signed by auth-service with the public keys it publishes at
+// /.well-known/jwks.json. Keys published by a rotation are picked up by refetching the set.
+package jwks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRefreshInterval limits refetches triggered by tokens with an unknown kid
+const minRefreshInterval = 30 * time.Second
+
+type publicKey struct {
+	alg string
+	key interface{}
+}
+
+// JWKS fetches and caches the public keys auth-service signs access and service tokens with
+type JWKS struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	refreshMu   sync.Mutex
+	mu          sync.RWMutex
+	keys        map[string]publicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// New creates a JWKS for the key set at url, refetched once the cached keys are older than ttl
+func New(url string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   map[string]publicKey{},
+	}
+}
+
+// Keyfunc resolves the verification key by kid. The JWKS is refetched when the cache is stale
+// or the kid is unknown, which is how keys published by a rotation are picked up.
+func (j *JWKS) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	key, ok, stale := j.lookup(kid)
+	if !ok || stale {
+		if err := j.refresh(); err != nil {
+			log.Warnf("JWKS: Failed to refresh keys: %v", err)
+		}
+		key, ok, _ = j.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("algorithm %s does not match key %s", token.Method.Alg(), kid)
+	}
+	return key.key, nil
+}
+
+func (j *JWKS) lookup(kid string) (publicKey, bool, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	key, ok := j.keys[kid]
+	return key, ok, time.Since(j.fetchedAt) > j.ttl
+}
+
+// refresh fetches the JWKS, at most once per minRefreshInterval. On failure the cached keys are kept.
+func (j *JWKS) refresh() error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+
+	if time.Since(j.lastAttempt) < minRefreshInterval {
+		return nil
+	}
+	j.lastAttempt = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", j.url, resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []struct {
+			KTY string `json:"kty"`
+			KID string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			CRV string `json:"crv"`
+			X   string `json:"x"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+
+	keys := map[string]publicKey{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.KTY == "RSA" && k.Alg == "RS256":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				log.Warnf("JWKS: Skipping malformed RSA key %s", k.KID)
+				continue
+			}
+			keys[k.KID] = publicKey{alg: k.Alg, key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}}
+		case k.KTY == "OKP" && k.CRV == "Ed25519" && k.Alg == "EdDSA":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				log.Warnf("JWKS: Skipping malformed Ed25519 key %s", k.KID)
+				continue
+			}
+			keys[k.KID] = publicKey{alg: k.Alg, key: ed25519.PublicKey(x)}
+		default:
+			log.Warnf("JWKS: Skipping unsupported key %s (%s %s)", k.KID, k.KTY, k.Alg)
+		}
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+	return nil
+}
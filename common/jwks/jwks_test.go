@@ -0,0 +1,164 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuthService serves a JWKS that tests can change to simulate key rotation
+type fakeAuthService struct {
+	mu       sync.Mutex
+	keys     []map[string]string
+	requests int
+	server   *httptest.Server
+}
+
+func newFakeAuthService(t *testing.T) *fakeAuthService {
+	t.Helper()
+	f := &fakeAuthService{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.requests++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": f.keys})
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeAuthService) publishEd25519(kid string, pub ed25519.PublicKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, map[string]string{
+		"kty": "OKP", "kid": kid, "use": "sig", "alg": "EdDSA", "crv": "Ed25519",
+		"x": base64.RawURLEncoding.EncodeToString(pub),
+	})
+}
+
+func (f *fakeAuthService) publishRSA(kid string, pub *rsa.PublicKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	})
+}
+
+// retire stops publishing a key, as auth-service does once a rotated key has expired
+func (f *fakeAuthService) retire(kid string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := f.keys[:0]
+	for _, k := range f.keys {
+		if k["kid"] != kid {
+			keys = append(keys, k)
+		}
+	}
+	f.keys = keys
+}
+
+func (f *fakeAuthService) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// verify signs a token with the key and checks it against the JWKS
+func verify(t *testing.T, keys *JWKS, method jwt.SigningMethod, kid string, key interface{}) error {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	_, err = jwt.Parse(signed, keys.Keyfunc, jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+	return err
+}
+
+func TestJWKS_VerifiesRSAAndEd25519(t *testing.T) {
+	auth := newFakeAuthService(t)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	auth.publishEd25519("ed-1", edPub)
+	auth.publishRSA("rsa-1", &rsaPriv.PublicKey)
+	keys := New(auth.server.URL, 10*time.Minute)
+
+	assert.NoError(t, verify(t, keys, jwt.SigningMethodEdDSA, "ed-1", edPriv))
+	assert.NoError(t, verify(t, keys, jwt.SigningMethodRS256, "rsa-1", rsaPriv))
+	assert.Equal(t, 1, auth.requestCount(), "both tokens were verified from a single fetch")
+
+	// A token must carry a kid and use the algorithm of the key it names
+	assert.Error(t, verify(t, keys, jwt.SigningMethodEdDSA, "", edPriv))
+	assert.Error(t, verify(t, keys, jwt.SigningMethodRS256, "ed-1", rsaPriv))
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	assert.Error(t, verify(t, keys, jwt.SigningMethodEdDSA, "ed-1", otherPriv))
+}
+
+func TestJWKS_RefetchesForRotatedKey(t *testing.T) {
+	auth := newFakeAuthService(t)
+	oldPub, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	auth.publishEd25519("old", oldPub)
+	keys := New(auth.server.URL, 10*time.Minute)
+	require.NoError(t, verify(t, keys, jwt.SigningMethodEdDSA, "old", oldPriv))
+
+	newPub, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+	auth.publishEd25519("new", newPub)
+	keys.lastAttempt = time.Time{}
+
+	require.NoError(t, verify(t, keys, jwt.SigningMethodEdDSA, "new", newPriv))
+	assert.Equal(t, 2, auth.requestCount())
+
+	// Tokens of the previous key stay valid while it is still published
+	assert.NoError(t, verify(t, keys, jwt.SigningMethodEdDSA, "old", oldPriv))
+
+	// Unknown kids cannot force a fetch per request
+	assert.Error(t, verify(t, keys, jwt.SigningMethodEdDSA, "bogus", newPriv))
+	assert.Equal(t, 2, auth.requestCount())
+}
+
+func TestJWKS_DropsRetiredKeys(t *testing.T) {
+	auth := newFakeAuthService(t)
+	oldPub, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	newPub, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+	auth.publishEd25519("old", oldPub)
+	auth.publishEd25519("new", newPub)
+	keys := New(auth.server.URL, time.Millisecond)
+	require.NoError(t, verify(t, keys, jwt.SigningMethodEdDSA, "old", oldPriv))
+
+	auth.retire("old")
+	time.Sleep(5 * time.Millisecond)
+	keys.lastAttempt = time.Time{}
+
+	// The stale cache is refetched and the retired key no longer verifies anything
+	require.NoError(t, verify(t, keys, jwt.SigningMethodEdDSA, "new", newPriv))
+	assert.Equal(t, 2, auth.requestCount())
+	assert.Error(t, verify(t, keys, jwt.SigningMethodEdDSA, "old", oldPriv))
+}
+
+func TestJWKS_KeepsCachedKeysWhenRefreshFails(t *testing.T) {
+	auth := newFakeAuthService(t)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	auth.publishEd25519("ed-1", pub)
+	keys := New(auth.server.URL, time.Millisecond)
+	require.NoError(t, verify(t, keys, jwt.SigningMethodEdDSA, "ed-1", priv))
+
+	auth.server.Close()
+	time.Sleep(5 * time.Millisecond)
+	keys.lastAttempt = time.Time{}
+
+	assert.NoError(t, verify(t, keys, jwt.SigningMethodEdDSA, "ed-1", priv))
+}
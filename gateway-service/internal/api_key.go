@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/nats-io/nats.go"
+)
+
+// APIKeyPrefix marks API keys issued by auth-service
+const APIKeyPrefix = "ilk_"
+
+var ErrAPIKeyInvalid = errors.New("API_KEY_INVALID")
+
+const (
+	// apiKeyResolveTimeout bounds how long a request waits for auth-service
+	apiKeyResolveTimeout = 2 * time.Second
+	// apiKeyInvalidTTL is how long an invalid key is remembered, so retries of a bad key do not
+	// each reach auth-service
+	apiKeyInvalidTTL = 30 * time.Second
+	// apiKeyCacheSize bounds the number of cached keys, valid or not
+	apiKeyCacheSize = 10000
+)
+
+// Requester sends a request and waits for the reply; *nats.Conn satisfies it
+type Requester interface {
+	Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error)
+}
+
+type apiKeyResolution struct {
+	UserID    string     `json:"user_id"`
+	OrgID     string     `json:"org_id"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// cachedAPIKey is a resolved key, or an invalid one when info is nil
+type cachedAPIKey struct {
+	info      *TokenInfo
+	expiresAt time.Time
+}
+
+// APIKeys resolves API keys to users through auth-service and caches the result. auth-service
+// publishes revocations, which evict the key at once; the cache TTL only bounds staleness if
+// a revocation message is lost. Expired entries are pruned once per TTL and the cache holds at
+// most apiKeyCacheSize keys.
+type APIKeys struct {
+	conn    Requester
+	subject string
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	cache     map[string]cachedAPIKey
+	lastPrune time.Time
+}
+
+func NewAPIKeys(conn Requester, subject string, ttl time.Duration) *APIKeys {
+	return &APIKeys{
+		conn:      conn,
+		subject:   subject,
+		ttl:       ttl,
+		cache:     map[string]cachedAPIKey{},
+		lastPrune: time.Now(),
+	}
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Resolve returns the user, organization and scopes of an API key
+func (k *APIKeys) Resolve(key string) (*TokenInfo, error) {
+	keyHash := hashAPIKey(key)
+	now := time.Now()
+
+	k.mu.Lock()
+	cached, ok := k.cache[keyHash]
+	k.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		if cached.info == nil {
+			return nil, ErrAPIKeyInvalid
+		}
+		return cached.info, nil
+	}
+
+	msg, err := k.conn.Request(k.subject, []byte(keyHash), apiKeyResolveTimeout)
+	if err != nil {
+		log.Errorf("APIKeys: Failed to resolve API key: %v", err)
+		return nil, err
+	}
+
+	var resolution apiKeyResolution
+	if err := json.Unmarshal(msg.Data, &resolution); err != nil {
+		log.Errorf("APIKeys: Invalid resolve reply: %v", err)
+		return nil, err
+	}
+	if resolution.UserID == "" {
+		k.store(keyHash, cachedAPIKey{expiresAt: now.Add(min(k.ttl, apiKeyInvalidTTL))}, now)
+		return nil, ErrAPIKeyInvalid
+	}
+
+	info := &TokenInfo{UserID: resolution.UserID, OrgID: resolution.OrgID, Scopes: resolution.Scopes, IsAPIKey: true}
+	expiresAt := now.Add(k.ttl)
+	if resolution.ExpiresAt != nil && resolution.ExpiresAt.Before(expiresAt) {
+		expiresAt = *resolution.ExpiresAt
+	}
+	k.store(keyHash, cachedAPIKey{info: info, expiresAt: expiresAt}, now)
+	return info, nil
+}
+
+// store caches a resolution, making room when the cache is full
+func (k *APIKeys) store(keyHash string, entry cachedAPIKey, now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.prune(now, false)
+	if _, ok := k.cache[keyHash]; !ok && len(k.cache) >= apiKeyCacheSize {
+		k.prune(now, true)
+		// Still full of live keys: drop arbitrary ones, they are resolved again when used
+		for hash := range k.cache {
+			if len(k.cache) < apiKeyCacheSize {
+				break
+			}
+			delete(k.cache, hash)
+		}
+	}
+	k.cache[keyHash] = entry
+}
+
+// prune drops expired keys once per TTL, or at once when forced; k.mu must be held
+func (k *APIKeys) prune(now time.Time, force bool) {
+	if !force && now.Sub(k.lastPrune) < k.ttl {
+		return
+	}
+	k.lastPrune = now
+	for hash, cached := range k.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(k.cache, hash)
+		}
+	}
+}
+
+// Evict drops a key from the cache
+func (k *APIKeys) Evict(keyHash string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.cache, keyHash)
+}
+
+// RevocationMessage handles a revocation published by auth-service
+func (k *APIKeys) RevocationMessage(data []byte) {
+	var revocation struct {
+		KeyHash string `json:"key_hash"`
+	}
+	if err := json.Unmarshal(data, &revocation); err != nil || revocation.KeyHash == "" {
+		log.Errorf("APIKeys: Invalid revocation message: %v", err)
+		return
+	}
+	k.Evict(revocation.KeyHash)
+	log.Infof("APIKeys: Evicted revoked API key")
+}
+
+// requiredScope is the scope an API key or OAuth client needs for a request: the service prefix and read or write
+func requiredScope(method, path string) string {
+	service := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	access := "write"
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		access = "read"
+	}
+	return service + ":" + access
+}
+
+// HasScope reports whether the token grants the scope. JWTs of the user's own sessions carry their full access.
+func (t *TokenInfo) HasScope(scope string) bool {
+	if !t.IsAPIKey && t.ClientID == "" {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNats answers requests with respond and records published messages
+type fakeNats struct {
+	mu        sync.Mutex
+	respond   func(subject string, data []byte) ([]byte, error)
+	requests  []string
+	published []*nats.Msg
+}
+
+func (f *fakeNats) Request(subject string, data []byte, _ time.Duration) (*nats.Msg, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, string(data))
+	respond := f.respond
+	f.mu.Unlock()
+
+	reply, err := respond(subject, data)
+	if err != nil {
+		return nil, err
+	}
+	return &nats.Msg{Subject: subject, Data: reply}, nil
+}
+
+func (f *fakeNats) Publish(subject string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = append(f.published, &nats.Msg{Subject: subject, Data: data})
+	return nil
+}
+
+func (f *fakeNats) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+// resolvesTo makes auth-service resolve every key to the resolution
+func resolvesTo(resolution apiKeyResolution) func(string, []byte) ([]byte, error) {
+	return func(string, []byte) ([]byte, error) {
+		return json.Marshal(resolution)
+	}
+}
+
+// newAuthenticatedApp runs the gateway middleware in front of a route that echoes the identity headers
+func newAuthenticatedApp(t *testing.T, jwksURL string, apiKeys *APIKeys, sessions *Sessions) *fiber.App {
+	t.Helper()
+	app := fiber.New()
+	SetupMiddleware(app, &Config{Origins: "http://localhost:8000", JWKSURL: jwksURL, JWKSCacheMinutes: 10}, apiKeys, sessions)
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"user_id":    c.Get("x-user-id"),
+			"scopes":     c.Get("x-user-scopes"),
+			"org_id":     c.Get("x-org-id"),
+			"session_id": c.Get("x-session-id"),
+		})
+	})
+	return app
+}
+
+// callGateway sends a request with the credential in header and returns the status and echoed identity
+func callGateway(t *testing.T, app *fiber.App, method, path, header, credential string) (int, map[string]string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if credential != "" {
+		req.Header.Set(header, credential)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	identity := map[string]string{}
+	_ = json.Unmarshal(body, &identity)
+	return resp.StatusCode, identity
+}
+
+func TestAPIKeys_CachesResolution(t *testing.T) {
+	auth := &fakeNats{respond: resolvesTo(apiKeyResolution{UserID: "user-1", OrgID: "org-1", Scopes: []string{"images:read"}})}
+	keys := NewAPIKeys(auth, "auth.api_keys.resolve", time.Minute)
+
+	info, err := keys.Resolve("ilk_secret")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", info.UserID)
+	assert.Equal(t, "org-1", info.OrgID)
+	assert.Equal(t, []string{"images:read"}, info.Scopes)
+	assert.True(t, info.IsAPIKey)
+
+	_, err = keys.Resolve("ilk_secret")
+	require.NoError(t, err)
+	assert.Equal(t, 1, auth.requestCount(), "the second lookup is served from the cache")
+
+	// Only the hash of the key leaves the gateway
+	assert.Equal(t, []string{hashAPIKey("ilk_secret")}, auth.requests)
+}
+
+func TestAPIKeys_RevocationEvictsAtOnce(t *testing.T) {
+	auth := &fakeNats{respond: resolvesTo(apiKeyResolution{UserID: "user-1", Scopes: []string{"images:read"}})}
+	keys := NewAPIKeys(auth, "auth.api_keys.resolve", time.Hour)
+
+	_, err := keys.Resolve("ilk_secret")
+	require.NoError(t, err)
+
+	// auth-service revokes the key; until the revocation arrives the cached resolution is used
+	auth.respond = resolvesTo(apiKeyResolution{})
+	_, err = keys.Resolve("ilk_secret")
+	require.NoError(t, err)
+
+	revocation, _ := json.Marshal(map[string]string{"key_hash": hashAPIKey("ilk_secret")})
+	keys.RevocationMessage(revocation)
+
+	_, err = keys.Resolve("ilk_secret")
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+	assert.Equal(t, 2, auth.requestCount())
+
+	// Revocations of other keys and malformed messages leave the cache alone
+	keys.RevocationMessage([]byte(`{"key_hash":""}`))
+	keys.RevocationMessage([]byte(`not json`))
+}
+
+func TestAPIKeys_CacheEndsWithKeyExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	auth := &fakeNats{respond: resolvesTo(apiKeyResolution{UserID: "user-1", ExpiresAt: &expiresAt})}
+	keys := NewAPIKeys(auth, "auth.api_keys.resolve", time.Hour)
+
+	_, err := keys.Resolve("ilk_secret")
+	require.NoError(t, err)
+
+	time.Sleep(30 * time.Millisecond)
+	auth.respond = resolvesTo(apiKeyResolution{})
+	_, err = keys.Resolve("ilk_secret")
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+}
+
+func TestAPIKeys_CachesInvalidKeysBriefly(t *testing.T) {
+	auth := &fakeNats{respond: resolvesTo(apiKeyResolution{})}
+	keys := NewAPIKeys(auth, "auth.api_keys.resolve", 10*time.Millisecond)
+
+	_, err := keys.Resolve("ilk_bogus")
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+	_, err = keys.Resolve("ilk_bogus")
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+	assert.Equal(t, 1, auth.requestCount(), "retries of an invalid key are answered from the cache")
+
+	// The invalid result is not kept longer than the TTL
+	time.Sleep(20 * time.Millisecond)
+	auth.respond = resolvesTo(apiKeyResolution{UserID: "user-1"})
+	info, err := keys.Resolve("ilk_bogus")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", info.UserID)
+}
+
+func TestAPIKeys_PrunesExpiredKeys(t *testing.T) {
+	auth := &fakeNats{respond: resolvesTo(apiKeyResolution{UserID: "user-1"})}
+	keys := NewAPIKeys(auth, "auth.api_keys.resolve", 10*time.Millisecond)
+
+	_, _ = keys.Resolve("ilk_first")
+	auth.respond = resolvesTo(apiKeyResolution{})
+	_, _ = keys.Resolve("ilk_bogus")
+	time.Sleep(20 * time.Millisecond)
+
+	auth.respond = resolvesTo(apiKeyResolution{UserID: "user-1"})
+	_, err := keys.Resolve("ilk_second")
+	require.NoError(t, err)
+
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	assert.Len(t, keys.cache, 1, "expired keys, valid or not, are dropped")
+	assert.Contains(t, keys.cache, hashAPIKey("ilk_second"))
+}
+
+func TestAPIKeys_CacheIsBounded(t *testing.T) {
+	auth := &fakeNats{respond: resolvesTo(apiKeyResolution{UserID: "user-1"})}
+	keys := NewAPIKeys(auth, "auth.api_keys.resolve", time.Hour)
+
+	live := cachedAPIKey{info: &TokenInfo{UserID: "user-1", IsAPIKey: true}, expiresAt: time.Now().Add(time.Hour)}
+	keys.mu.Lock()
+	for i := 0; i < apiKeyCacheSize; i++ {
+		keys.cache[hashAPIKey(fmt.Sprintf("ilk_%d", i))] = live
+	}
+	keys.mu.Unlock()
+
+	_, err := keys.Resolve("ilk_new")
+	require.NoError(t, err)
+
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	assert.Len(t, keys.cache, apiKeyCacheSize)
+	assert.Contains(t, keys.cache, hashAPIKey("ilk_new"))
+}
+
+func TestAPIKeys_FailsClosedWithoutAuthService(t *testing.T) {
+	auth := &fakeNats{respond: func(string, []byte) ([]byte, error) { return nil, nats.ErrTimeout }}
+	keys := NewAPIKeys(auth, "auth.api_keys.resolve", time.Minute)
+
+	_, err := keys.Resolve("ilk_secret")
+	assert.True(t, errors.Is(err, nats.ErrTimeout))
+}
+
+func TestRequiredScope(t *testing.T) {
+	cases := []struct {
+		method, path, scope string
+	}{
+		{fiber.MethodGet, "/images/instructions", "images:read"},
+		{fiber.MethodHead, "/images/instructions/1", "images:read"},
+		{fiber.MethodOptions, "/pdfs/products", "pdfs:read"},
+		{fiber.MethodPost, "/pdfs/instructions", "pdfs:write"},
+		{fiber.MethodPatch, "/auth/profile", "auth:write"},
+		{fiber.MethodDelete, "/images/instructions/1", "images:write"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.scope, requiredScope(tc.method, tc.path), "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestTokenInfo_HasScope(t *testing.T) {
+	session := &TokenInfo{UserID: "user-1"}
+	assert.True(t, session.HasScope("images:write"), "session tokens carry the user's full access")
+
+	apiKey := &TokenInfo{UserID: "user-1", IsAPIKey: true, Scopes: []string{"images:read"}}
+	assert.True(t, apiKey.HasScope("images:read"))
+	assert.False(t, apiKey.HasScope("images:write"))
+	assert.False(t, apiKey.HasScope("pdfs:read"))
+
+	client := &TokenInfo{UserID: "user-1", ClientID: "client-1", Scopes: []string{"pdfs:write"}}
+	assert.True(t, client.HasScope("pdfs:write"))
+	assert.False(t, client.HasScope("pdfs:read"))
+
+	unscoped := &TokenInfo{UserID: "user-1", IsAPIKey: true}
+	assert.False(t, unscoped.HasScope("images:read"))
+}
+
+func TestMiddleware_EnforcesAPIKeyScopes(t *testing.T) {
+	auth := &fakeNats{respond: resolvesTo(apiKeyResolution{UserID: "user-1", OrgID: "org-1", Scopes: []string{"images:read"}})}
+	apiKeys := NewAPIKeys(auth, "auth.api_keys.resolve", time.Minute)
+	sessions := NewSessions(auth, "auth.sessions.revocations", "auth.sessions.activity", time.Minute)
+	app := newAuthenticatedApp(t, newFakeAuthService(t).server.URL, apiKeys, sessions)
+
+	status, identity := callGateway(t, app, fiber.MethodGet, "/images/instructions", "X-API-Key", "ilk_secret")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "user-1", identity["user_id"])
+	assert.Equal(t, "images:read", identity["scopes"])
+	assert.Equal(t, "org-1", identity["org_id"])
+
+	status, _ = callGateway(t, app, fiber.MethodPost, "/images/instructions", "X-API-Key", "ilk_secret")
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	status, _ = callGateway(t, app, fiber.MethodGet, "/pdfs/instructions", "X-API-Key", "ilk_secret")
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	// A revoked key is anonymous on the next request
+	revocation, _ := json.Marshal(map[string]string{"key_hash": hashAPIKey("ilk_secret")})
+	auth.respond = resolvesTo(apiKeyResolution{})
+	apiKeys.RevocationMessage(revocation)
+	status, identity = callGateway(t, app, fiber.MethodGet, "/images/instructions", "X-API-Key", "ilk_secret")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Empty(t, identity["user_id"])
+}
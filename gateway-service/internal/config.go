@@ -12,23 +12,54 @@ type ServiceConfig struct {
 }
 
 type Config struct {
-	Environment string
-	Port        string
-	Origins     string
-	JWTSecret   string
-	CSRFEnabled bool
-	Services    []ServiceConfig
+	Environment      string
+	Port             string
+	Origins          string
+	JWKSURL          string
+	JWKSCacheMinutes int
+	CSRFEnabled      bool
+	Services         []ServiceConfig
+
+	ServiceName     string
+	ServiceSecret   string
+	ServiceTokenURL string
+
+	NatsURI                  string
+	NatsSubjectAPIKeyResolve string
+	NatsSubjectAPIKeyRevoked string
+	APIKeyCacheSeconds       int
+
+	NatsSubjectSessionRevoked     string
+	NatsSubjectSessionRevocations string
+	NatsSubjectSessionActivity    string
+	SessionActivityIntervalSecs   int
 }
 
 func LoadConfig() *Config {
 	_ = godotenv.Load()
 
 	return &Config{
-		Environment: initx.GetEnv("ENVIRONMENT", "development"),
-		Port:        initx.GetEnv("PORT", ":3000"),
-		Origins:     initx.GetEnv("ORIGINS_ALLOWED", "http://localhost:8000"),
-		JWTSecret:   initx.GetEnv("JWT_SECRET", ""),
-		CSRFEnabled: initx.GetEnvBool("CSRF_ENABLED", true),
+		Environment:      initx.GetEnv("ENVIRONMENT", "development"),
+		Port:             initx.GetEnv("PORT", ":3000"),
+		Origins:          initx.GetEnv("ORIGINS_ALLOWED", "http://localhost:8000"),
+		JWKSURL:          initx.GetEnv("JWKS_URL", initx.GetEnv("AUTH_SERVICE", "http://auth-service:3000")+"/.well-known/jwks.json"),
+		JWKSCacheMinutes: initx.GetEnvInt("JWKS_CACHE_MINUTES", 10),
+		CSRFEnabled:      initx.GetEnvBool("CSRF_ENABLED", true),
+
+		ServiceName:     initx.GetEnv("SERVICE_NAME", "gateway-service"),
+		ServiceSecret:   initx.GetEnv("SERVICE_SECRET", ""),
+		ServiceTokenURL: initx.GetEnv("SERVICE_TOKEN_URL", initx.GetEnv("AUTH_SERVICE", "http://auth-service:3000")+"/oauth2/token"),
+
+		NatsURI:                  initx.GetEnv("NATS_URI", "nats://localhost:4222"),
+		NatsSubjectAPIKeyResolve: initx.GetEnv("NATS_SUBJECT_API_KEY_RESOLVE", "auth.api_keys.resolve"),
+		NatsSubjectAPIKeyRevoked: initx.GetEnv("NATS_SUBJECT_API_KEY_REVOKED", "auth.api_keys.revoked"),
+		APIKeyCacheSeconds:       initx.GetEnvInt("API_KEY_CACHE_SECONDS", 60),
+
+		NatsSubjectSessionRevoked:     initx.GetEnv("NATS_SUBJECT_SESSION_REVOKED", "auth.sessions.revoked"),
+		NatsSubjectSessionRevocations: initx.GetEnv("NATS_SUBJECT_SESSION_REVOCATIONS", "auth.sessions.revocations"),
+		NatsSubjectSessionActivity:    initx.GetEnv("NATS_SUBJECT_SESSION_ACTIVITY", "auth.sessions.activity"),
+		SessionActivityIntervalSecs:   initx.GetEnvInt("SESSION_ACTIVITY_INTERVAL_SECONDS", 300),
+
 		Services: []ServiceConfig{
 			{
 				Name:   "auth-service",
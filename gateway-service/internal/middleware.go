@@ -13,10 +13,12 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/helmet"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/instrlabs/common/jwks"
 )
 
 var (
-	ErrForbiddenOrigin = errors.New("FORBIDDEN_ORIGIN")
+	ErrForbiddenOrigin   = errors.New("FORBIDDEN_ORIGIN")
+	ErrInsufficientScope = errors.New("INSUFFICIENT_SCOPE")
 )
 
 func isAllowedOrigin(origin, allowlist string) bool {
@@ -29,7 +31,7 @@ func isAllowedOrigin(origin, allowlist string) bool {
 	return false
 }
 
-func SetupMiddleware(app *fiber.App, cfg *Config) {
+func SetupMiddleware(app *fiber.App, cfg *Config, apiKeys *APIKeys, sessions *Sessions) {
 	app.Use(helmet.New())
 	app.Use(recover.New())
 	app.Use(etag.New())
@@ -52,8 +54,8 @@ func SetupMiddleware(app *fiber.App, cfg *Config) {
 	// CORS
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.Origins,
-		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
-		AllowHeaders:     "content-type, cookie, authorization",
+		AllowMethods:     "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+		AllowHeaders:     "content-type, cookie, authorization, x-api-key",
 		AllowCredentials: true,
 	}))
 
@@ -72,7 +74,8 @@ func SetupMiddleware(app *fiber.App, cfg *Config) {
 		return c.Next()
 	})
 
-	// JWT token extraction and user authentication
+	// JWT / API key extraction and user authentication
+	keys := jwks.New(cfg.JWKSURL, time.Duration(cfg.JWKSCacheMinutes)*time.Minute)
 	app.Use(func(c *fiber.Ctx) error {
 		var accessToken string
 
@@ -83,16 +86,62 @@ func SetupMiddleware(app *fiber.App, cfg *Config) {
 				accessToken = parts[1]
 			}
 		}
+		if apiKey := c.Get("X-API-Key"); apiKey != "" {
+			accessToken = apiKey
+		}
 
 		c.Request().Header.Set("x-user-id", "")
+		c.Request().Header.Set("x-user-roles", "")
+		c.Request().Header.Set("x-user-scopes", "")
+		c.Request().Header.Set("x-org-id", "")
+		c.Request().Header.Set("x-org-role", "")
+		c.Request().Header.Set("x-session-id", "")
+		c.Request().Header.Del("X-API-Key")
+
+		if accessToken == "" {
+			return c.Next()
+		}
 
-		if accessToken != "" {
-			if info, err := ExtractTokenInfo(cfg.JWTSecret, accessToken); err == nil {
-				log.Infof("Authenticated user %s for %s %s", info.UserID, c.Method(), c.Path())
-				c.Request().Header.Set("x-user-id", info.UserID)
-			} else {
-				log.Warnf("Token extraction failed for %s %s: %v", c.Method(), c.Path(), err)
+		var info *TokenInfo
+		var err error
+		if IsAPIKey(accessToken) {
+			info, err = apiKeys.Resolve(accessToken)
+		} else {
+			info, err = ExtractTokenInfo(keys, accessToken)
+		}
+		if err != nil {
+			log.Warnf("Token extraction failed for %s %s: %v", c.Method(), c.Path(), err)
+			return c.Next()
+		}
+		if info.SessionID != "" {
+			if sessions.IsRevoked(info.SessionID) {
+				log.Warnf("Token extraction failed for %s %s: %v", c.Method(), c.Path(), ErrSessionRevoked)
+				return c.Next()
 			}
+			sessions.Touch(info.SessionID)
+		}
+
+		if scope := requiredScope(c.Method(), c.Path()); !info.HasScope(scope) {
+			log.Warnf("Scoped token of user %s lacks scope %s for %s %s", info.UserID, scope, c.Method(), c.Path())
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": ErrInsufficientScope.Error(),
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+
+		log.Infof("Authenticated user %s for %s %s", info.UserID, c.Method(), c.Path())
+		c.Request().Header.Set("x-user-id", info.UserID)
+		c.Request().Header.Set("x-user-roles", strings.Join(info.Roles, ","))
+		if info.IsAPIKey || info.ClientID != "" {
+			c.Request().Header.Set("x-user-scopes", strings.Join(info.Scopes, ","))
+		}
+		if info.OrgID != "" {
+			c.Request().Header.Set("x-org-id", info.OrgID)
+			c.Request().Header.Set("x-org-role", info.OrgRole)
+		}
+		if info.SessionID != "" {
+			c.Request().Header.Set("x-session-id", info.SessionID)
 		}
 
 		return c.Next()
@@ -10,7 +10,7 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/proxy"
 )
 
-func SetupGatewayRoutes(app *fiber.App, config *Config) {
+func SetupGatewayRoutes(app *fiber.App, config *Config, serviceToken *ServiceToken) {
 	app.Get("/health", func(c *fiber.Ctx) error {
 		health := map[string]interface{}{
 			"status":   "ok",
@@ -47,6 +47,13 @@ func SetupGatewayRoutes(app *fiber.App, config *Config) {
 				parsedUrl += "?" + queryString
 			}
 
+			// Clients cannot set the header themselves; it is always replaced here
+			token, err := serviceToken.Token()
+			if err != nil {
+				log.Errorf("Failed to get service token: %v", err)
+			}
+			c.Request().Header.Set(ServiceTokenHeader, token)
+
 			if err := proxy.DoTimeout(c, parsedUrl, 30*time.Second); err != nil {
 				log.Errorf("proxy error: service=%s method=%s path=%s query=%s err=%v", srv.Name, c.Method(), forwardPath, queryString, err)
 
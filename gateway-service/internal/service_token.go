@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// serviceTokenRenewBefore renews the service token ahead of its expiry, so a token never expires in flight
+const serviceTokenRenewBefore = time.Minute
+
+// ServiceTokenHeader carries the gateway's service token to the services it forwards requests to.
+// Services only honor the identity headers the gateway sets on requests that carry a valid one.
+const ServiceTokenHeader = "x-service-token"
+
+// ServiceToken obtains and caches the gateway's service token from auth-service with the
+// OAuth2 client-credentials grant
+type ServiceToken struct {
+	url    string
+	name   string
+	secret string
+	client *http.Client
+	renews singleflight.Group
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewServiceToken(url, name, secret string) *ServiceToken {
+	return &ServiceToken{
+		url:    url,
+		name:   name,
+		secret: secret,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Token returns the cached service token. Within serviceTokenRenewBefore of its expiry a new one is
+// requested in the background while the cached token keeps being returned until it expires; only
+// without a usable token does Token wait for auth-service. Concurrent callers share one request.
+func (s *ServiceToken) Token() (string, error) {
+	s.mu.Lock()
+	token, expiresAt := s.token, s.expiresAt
+	s.mu.Unlock()
+
+	now := time.Now()
+	if token != "" && now.Before(expiresAt) {
+		if !now.Before(expiresAt.Add(-serviceTokenRenewBefore)) {
+			s.renews.DoChan("renew", s.renew)
+		}
+		return token, nil
+	}
+
+	renewed, err, _ := s.renews.Do("renew", s.renew)
+	if err != nil {
+		return "", err
+	}
+	return renewed.(string), nil
+}
+
+// renew requests a new service token and caches it
+func (s *ServiceToken) renew() (interface{}, error) {
+	requestedAt := time.Now()
+	token, expiresIn, err := s.request()
+	if err != nil {
+		log.Warnf("ServiceToken: Failed to renew the service token: %v", err)
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	s.expiresAt = requestedAt.Add(expiresIn)
+	return token, nil
+}
+
+func (s *ServiceToken) request() (string, time.Duration, error) {
+	if s.secret == "" {
+		return "", 0, errors.New("SERVICE_SECRET is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.name), url.QueryEscape(s.secret))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("POST %s returned status %d", s.url, resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", 0, err
+	}
+	if body.AccessToken == "" {
+		return "", 0, errors.New("token response has no access_token")
+	}
+	return body.AccessToken, time.Duration(body.ExpiresIn) * time.Second, nil
+}
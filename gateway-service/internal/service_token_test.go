@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTokenEndpoint issues numbered service tokens, each after delay, until it is told to fail
+type fakeTokenEndpoint struct {
+	mu        sync.Mutex
+	issued    int
+	expiresIn int
+	fail      bool
+	delay     time.Duration
+	server    *httptest.Server
+}
+
+func newFakeTokenEndpoint(t *testing.T, expiresIn int) *fakeTokenEndpoint {
+	t.Helper()
+	f := &fakeTokenEndpoint{expiresIn: expiresIn}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		delay := f.delay
+		f.mu.Unlock()
+		time.Sleep(delay)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		name, secret, ok := r.BasicAuth()
+		if f.fail || !ok || name != "gateway-service" || secret != "gateway-secret" || r.PostFormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.issued++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", f.issued),
+			"token_type":   "Bearer",
+			"expires_in":   f.expiresIn,
+		})
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeTokenEndpoint) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func (f *fakeTokenEndpoint) setDelay(delay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delay = delay
+}
+
+func (f *fakeTokenEndpoint) issuedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.issued
+}
+
+// expireIn moves the expiry of the cached token
+func (s *ServiceToken) expireIn(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expiresAt = time.Now().Add(d)
+}
+
+func TestServiceToken_RenewsOneMinuteBeforeExpiry(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t, 300)
+	tokens := NewServiceToken(endpoint.server.URL, "gateway-service", "gateway-secret")
+
+	token, err := tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	token, err = tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token, "a token with more than a minute left is reused")
+
+	tokens.expireIn(serviceTokenRenewBefore + time.Second)
+	token, err = tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, 1, endpoint.issuedCount())
+
+	// Within a minute of expiry the token is renewed in the background while it is still handed out
+	tokens.expireIn(serviceTokenRenewBefore - time.Second)
+	token, err = tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+	assert.Eventually(t, func() bool {
+		token, err := tokens.Token()
+		return err == nil && token == "token-2"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, endpoint.issuedCount())
+}
+
+func TestServiceToken_RenewalDoesNotBlockCallers(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t, 300)
+	tokens := NewServiceToken(endpoint.server.URL, "gateway-service", "gateway-secret")
+	_, err := tokens.Token()
+	require.NoError(t, err)
+
+	endpoint.setDelay(200 * time.Millisecond)
+	tokens.expireIn(30 * time.Second)
+
+	// Every caller gets the cached token at once, and they share a single renewal
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tokens.Token()
+			assert.NoError(t, err)
+			assert.Equal(t, "token-1", token)
+		}()
+	}
+	wg.Wait()
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	assert.Eventually(t, func() bool { return endpoint.issuedCount() == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, endpoint.issuedCount())
+}
+
+func TestServiceToken_CallersWithoutTokenShareOneRequest(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t, 300)
+	endpoint.setDelay(50 * time.Millisecond)
+	tokens := NewServiceToken(endpoint.server.URL, "gateway-service", "gateway-secret")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tokens.Token()
+			assert.NoError(t, err)
+			assert.Equal(t, "token-1", token)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, endpoint.issuedCount())
+}
+
+func TestServiceToken_KeepsUnexpiredTokenWhenRenewalFails(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t, 300)
+	tokens := NewServiceToken(endpoint.server.URL, "gateway-service", "gateway-secret")
+
+	_, err := tokens.Token()
+	require.NoError(t, err)
+
+	endpoint.setFail(true)
+	tokens.expireIn(30 * time.Second)
+	token, err := tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token, "the cached token still works until it expires")
+
+	// Let the background renewal fail before the token expires
+	time.Sleep(50 * time.Millisecond)
+	tokens.expireIn(-time.Second)
+	_, err = tokens.Token()
+	assert.Error(t, err, "an expired token is never handed out")
+}
+
+func TestServiceToken_RequiresCredentials(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t, 300)
+
+	_, err := NewServiceToken(endpoint.server.URL, "gateway-service", "").Token()
+	assert.Error(t, err)
+
+	_, err = NewServiceToken(endpoint.server.URL, "gateway-service", "wrong").Token()
+	assert.Error(t, err)
+	assert.Equal(t, 0, endpoint.issuedCount())
+}
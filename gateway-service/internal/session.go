@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+var ErrSessionRevoked = errors.New("SESSION_REVOKED")
+
+// sessionRevocationsTimeout bounds how long startup waits for the revocation list
+const sessionRevocationsTimeout = 5 * time.Second
+
+// SessionConn requests the revocation list and publishes activity; *nats.Conn satisfies it
+type SessionConn interface {
+	Requester
+	Publish(subject string, data []byte) error
+}
+
+type sessionRevocations struct {
+	Sessions []struct {
+		SessionID string    `json:"session_id"`
+		Until     time.Time `json:"until"`
+	} `json:"sessions"`
+}
+
+// Sessions tracks the sessions auth-service revoked, so their access tokens stop working before
+// they expire, and reports session activity back to auth-service for its idle timeout. A revocation
+// is kept until every access token of the session has expired on its own.
+type Sessions struct {
+	conn               SessionConn
+	revocationsSubject string
+	activitySubject    string
+	activityInterval   time.Duration
+
+	mu        sync.Mutex
+	revoked   map[string]time.Time
+	touched   map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewSessions(conn SessionConn, revocationsSubject string, activitySubject string, activityInterval time.Duration) *Sessions {
+	return &Sessions{
+		conn:               conn,
+		revocationsSubject: revocationsSubject,
+		activitySubject:    activitySubject,
+		activityInterval:   activityInterval,
+		revoked:            map[string]time.Time{},
+		touched:            map[string]time.Time{},
+		lastPrune:          time.Now(),
+	}
+}
+
+// Load fills the cache with the revocations auth-service still considers current
+func (s *Sessions) Load() error {
+	msg, err := s.conn.Request(s.revocationsSubject, nil, sessionRevocationsTimeout)
+	if err != nil {
+		log.Errorf("Sessions: Failed to load revoked sessions: %v", err)
+		return err
+	}
+	count, err := s.add(msg.Data)
+	if err != nil {
+		log.Errorf("Sessions: Invalid revocation list: %v", err)
+		return err
+	}
+	log.Infof("Sessions: Loaded %d revoked sessions", count)
+	return nil
+}
+
+// RevocationMessage handles revocations published by auth-service
+func (s *Sessions) RevocationMessage(data []byte) {
+	count, err := s.add(data)
+	if err != nil {
+		log.Errorf("Sessions: Invalid revocation message: %v", err)
+		return
+	}
+	log.Infof("Sessions: Revoked %d sessions", count)
+}
+
+func (s *Sessions) add(data []byte) (int, error) {
+	var revocations sessionRevocations
+	if err := json.Unmarshal(data, &revocations); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	count := 0
+	for _, session := range revocations.Sessions {
+		if session.SessionID == "" || !now.Before(session.Until) {
+			continue
+		}
+		s.revoked[session.SessionID] = session.Until
+		delete(s.touched, session.SessionID)
+		count++
+	}
+	s.prune(now)
+	return count, nil
+}
+
+// IsRevoked reports whether access tokens of the session must be rejected
+func (s *Sessions) IsRevoked(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.revoked[sessionID]
+	return ok && time.Now().Before(until)
+}
+
+// Touch reports a request of the session to auth-service, at most once per activity interval
+func (s *Sessions) Touch(sessionID string) {
+	now := time.Now()
+
+	s.mu.Lock()
+	last, ok := s.touched[sessionID]
+	if ok && now.Sub(last) < s.activityInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.touched[sessionID] = now
+	s.prune(now)
+	s.mu.Unlock()
+
+	data, _ := json.Marshal(map[string]string{"session_id": sessionID})
+	if err := s.conn.Publish(s.activitySubject, data); err != nil {
+		log.Errorf("Sessions: Failed to publish activity of session %s: %v", sessionID, err)
+	}
+}
+
+// prune drops expired revocations and stale activity once per activity interval; s.mu must be held
+func (s *Sessions) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < s.activityInterval {
+		return
+	}
+	s.lastPrune = now
+	for sessionID, until := range s.revoked {
+		if !now.Before(until) {
+			delete(s.revoked, sessionID)
+		}
+	}
+	for sessionID, last := range s.touched {
+		if now.Sub(last) >= s.activityInterval {
+			delete(s.touched, sessionID)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func revocationList(t *testing.T, until map[string]time.Time) []byte {
+	t.Helper()
+	var list sessionRevocations
+	for sessionID, u := range until {
+		list.Sessions = append(list.Sessions, struct {
+			SessionID string    `json:"session_id"`
+			Until     time.Time `json:"until"`
+		}{SessionID: sessionID, Until: u})
+	}
+	data, err := json.Marshal(list)
+	require.NoError(t, err)
+	return data
+}
+
+func TestSessions_LoadsRevocationList(t *testing.T) {
+	now := time.Now()
+	list := revocationList(t, map[string]time.Time{
+		"revoked": now.Add(time.Hour),
+		"expired": now.Add(-time.Minute),
+		"":        now.Add(time.Hour),
+	})
+	auth := &fakeNats{respond: func(string, []byte) ([]byte, error) { return list, nil }}
+	sessions := NewSessions(auth, "auth.sessions.revocations", "auth.sessions.activity", time.Minute)
+
+	require.NoError(t, sessions.Load())
+	assert.True(t, sessions.IsRevoked("revoked"))
+	assert.False(t, sessions.IsRevoked("expired"), "revocations past their tokens' expiry are not kept")
+	assert.False(t, sessions.IsRevoked("active"))
+}
+
+func TestSessions_LoadFailsWithoutAuthService(t *testing.T) {
+	auth := &fakeNats{respond: func(string, []byte) ([]byte, error) { return nil, nats.ErrTimeout }}
+	sessions := NewSessions(auth, "auth.sessions.revocations", "auth.sessions.activity", time.Minute)
+	assert.Error(t, sessions.Load())
+
+	auth.respond = func(string, []byte) ([]byte, error) { return []byte("not json"), nil }
+	assert.Error(t, sessions.Load())
+}
+
+func TestSessions_RevocationLastsUntilTokensExpire(t *testing.T) {
+	sessions := NewSessions(&fakeNats{}, "auth.sessions.revocations", "auth.sessions.activity", time.Millisecond)
+
+	sessions.RevocationMessage(revocationList(t, map[string]time.Time{"session-1": time.Now().Add(20 * time.Millisecond)}))
+	assert.True(t, sessions.IsRevoked("session-1"))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, sessions.IsRevoked("session-1"))
+
+	// The expired entry is pruned from the cache on the next change
+	sessions.RevocationMessage(revocationList(t, map[string]time.Time{"session-2": time.Now().Add(time.Hour)}))
+	sessions.mu.Lock()
+	assert.NotContains(t, sessions.revoked, "session-1")
+	sessions.mu.Unlock()
+}
+
+func TestSessions_TouchReportsActivityOncePerInterval(t *testing.T) {
+	auth := &fakeNats{}
+	sessions := NewSessions(auth, "auth.sessions.revocations", "auth.sessions.activity", time.Hour)
+
+	sessions.Touch("session-1")
+	sessions.Touch("session-1")
+	sessions.Touch("session-2")
+	require.Len(t, auth.published, 2)
+	assert.Equal(t, "auth.sessions.activity", auth.published[0].Subject)
+	assert.JSONEq(t, `{"session_id":"session-1"}`, string(auth.published[0].Data))
+
+	// Revoking a session forgets its activity
+	sessions.RevocationMessage(revocationList(t, map[string]time.Time{"session-1": time.Now().Add(time.Hour)}))
+	sessions.Touch("session-1")
+	assert.Len(t, auth.published, 3)
+}
+
+func TestMiddleware_RejectsTokensOfRevokedSessions(t *testing.T) {
+	auth := newFakeAuthService(t)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	auth.publishEd25519("ed-1", pub)
+	conn := &fakeNats{}
+	sessions := NewSessions(conn, "auth.sessions.revocations", "auth.sessions.activity", time.Minute)
+	app := newAuthenticatedApp(t, auth.server.URL, NewAPIKeys(conn, "auth.api_keys.resolve", time.Minute), sessions)
+
+	token := signToken(t, jwt.SigningMethodEdDSA, "ed-1", priv, jwt.MapClaims{"user_id": "user-1", "session_id": "session-1"})
+	status, identity := callGateway(t, app, fiber.MethodGet, "/images/instructions", "Authorization", "Bearer "+token)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "user-1", identity["user_id"])
+	assert.Equal(t, "session-1", identity["session_id"], "the session is forwarded for auth-service")
+
+	_, identity = callGateway(t, app, fiber.MethodGet, "/images/instructions", "x-session-id", "session-1")
+	assert.Empty(t, identity["session_id"], "clients cannot name a session themselves")
+
+	sessions.RevocationMessage(revocationList(t, map[string]time.Time{"session-1": time.Now().Add(time.Hour)}))
+
+	status, identity = callGateway(t, app, fiber.MethodGet, "/images/instructions", "Authorization", "Bearer "+token)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Empty(t, identity["user_id"], "tokens of a revoked session are treated as anonymous")
+	assert.Empty(t, identity["session_id"])
+
+	other := signToken(t, jwt.SigningMethodEdDSA, "ed-1", priv, jwt.MapClaims{"user_id": "user-1", "session_id": "session-2"})
+	_, identity = callGateway(t, app, fiber.MethodGet, "/images/instructions", "Authorization", "Bearer "+other)
+	assert.Equal(t, "user-1", identity["user_id"], "other sessions of the user are unaffected")
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/instrlabs/common/jwks"
 )
 
 var ErrTokenExpired = errors.New("TOKEN_EXPIRED")
@@ -15,23 +16,25 @@ var ErrTokenInvalid = errors.New("TOKEN_INVALID")
 var ErrTokenEmpty = errors.New("TOKEN_EMPTY")
 
 type TokenInfo struct {
-	UserID string
+	UserID    string
+	SessionID string
+	Roles     []string
+	OrgID     string
+	OrgRole   string
+	Scopes    []string
+	ClientID  string // OAuth client the token was issued to
+	IsAPIKey  bool
 }
 
-func ExtractTokenInfo(secret string, tokenString string) (*TokenInfo, error) {
+func ExtractTokenInfo(keys *jwks.JWKS, tokenString string) (*TokenInfo, error) {
 	if strings.TrimSpace(tokenString) == "" {
 		return nil, ErrTokenEmpty
 	}
 
-	parser := jwt.NewParser(jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
 
 	claims := jwt.MapClaims{}
-	token, err := parser.ParseWithClaims(
-		tokenString, claims,
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		},
-	)
+	token, err := parser.ParseWithClaims(tokenString, claims, keys.Keyfunc)
 
 	if err != nil {
 		log.Errorf("ExtractTokenInfo: Failed to parse token: %v", err)
@@ -43,8 +46,23 @@ func ExtractTokenInfo(secret string, tokenString string) (*TokenInfo, error) {
 		return nil, ErrTokenInvalid
 	}
 
+	// Service tokens authenticate the gateway to services and never act for a user
+	if toString(claims["token_use"]) == "service" {
+		log.Warnf("ExtractTokenInfo: Rejected service token of %s", toString(claims["sub"]))
+		return nil, ErrTokenInvalid
+	}
+
 	userID := toString(claims["user_id"])
 
+	var roles []string
+	if list, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range list {
+			if r := toString(role); r != "" {
+				roles = append(roles, r)
+			}
+		}
+	}
+
 	if date, err := claims.GetExpirationTime(); err == nil && date != nil {
 		if time.Now().UTC().After(date.Time) {
 			log.Warnf("ExtractTokenInfo: Token expired: %v", token)
@@ -52,7 +70,15 @@ func ExtractTokenInfo(secret string, tokenString string) (*TokenInfo, error) {
 		}
 	}
 
-	return &TokenInfo{UserID: userID}, nil
+	return &TokenInfo{
+		UserID:    userID,
+		SessionID: toString(claims["session_id"]),
+		Roles:     roles,
+		OrgID:     toString(claims["org_id"]),
+		OrgRole:   toString(claims["org_role"]),
+		ClientID:  toString(claims["client_id"]),
+		Scopes:    strings.Fields(toString(claims["scope"])),
+	}, nil
 }
 
 func toString(v any) string {
@@ -1,23 +1,44 @@
 package main
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/instrlabs/gateway-service/internal"
 	initx "github.com/instrlabs/shared/init"
+	natsgo "github.com/nats-io/nats.go"
 )
 
 func main() {
 	cfg := internal.LoadConfig()
 
+	nats := initx.NewNats(cfg.NatsURI)
+	defer nats.Close()
+
+	apiKeys := internal.NewAPIKeys(nats.Conn, cfg.NatsSubjectAPIKeyResolve, time.Duration(cfg.APIKeyCacheSeconds)*time.Second)
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectAPIKeyRevoked, func(m *natsgo.Msg) {
+		apiKeys.RevocationMessage(m.Data)
+	})
+
+	sessions := internal.NewSessions(nats.Conn, cfg.NatsSubjectSessionRevocations, cfg.NatsSubjectSessionActivity,
+		time.Duration(cfg.SessionActivityIntervalSecs)*time.Second)
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectSessionRevoked, func(m *natsgo.Msg) {
+		sessions.RevocationMessage(m.Data)
+	})
+	// Subscribe first, so a revocation published while the list loads is not missed
+	_ = sessions.Load()
+
+	serviceToken := internal.NewServiceToken(cfg.ServiceTokenURL, cfg.ServiceName, cfg.ServiceSecret)
+
 	app := fiber.New(fiber.Config{})
 
 	initx.SetupPrometheus(app)
 	initx.SetupServiceHealth(app)
 	initx.SetupLogger(app)
 	internal.SetupGatewaySwaggerUI(app)
-	internal.SetupMiddleware(app, cfg)
-	internal.SetupGatewayRoutes(app, cfg)
+	internal.SetupMiddleware(app, cfg, apiKeys, sessions)
+	internal.SetupGatewayRoutes(app, cfg, serviceToken)
 
 	log.Fatal(app.Listen(cfg.Port))
 }
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/instrlabs/common/account"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const accountServiceName = "image"
+
+// AccountExportItem is an instruction of the user with its details
+type AccountExportItem struct {
+	Instruction
+	Details []InstructionDetail `json:"details"`
+}
+
+// AccountDeletionMessage removes the instructions, details and stored files of a deleted account.
+// Deleting an account that has no data left is a no-op, so redelivered events are confirmed again.
+func (h *InstructionHandler) AccountDeletionMessage(data []byte) {
+	var msg account.Deletion
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Infof("AccountDeletionMessage: invalid message: %v", err)
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(msg.UserID)
+	if err != nil {
+		log.Infof("AccountDeletionMessage: invalid user id %q", msg.UserID)
+		return
+	}
+
+	instructions, err := h.instrRepo.ListByUser(userID)
+	if err != nil {
+		return
+	}
+	instrIDs := make([]primitive.ObjectID, 0, len(instructions))
+	for _, instr := range instructions {
+		instrIDs = append(instrIDs, instr.ID)
+	}
+
+	details, err := h.detailRepo.ListByInstructions(instrIDs)
+	if err != nil {
+		return
+	}
+	for _, d := range details {
+		if d.FileName == "" || d.IsCleaned {
+			continue
+		}
+		if err := h.s3.Delete(d.FileName); err != nil {
+			log.Infof("AccountDeletionMessage: failed to delete S3 object %s: %v", d.FileName, err)
+		}
+	}
+
+	if err := h.detailRepo.DeleteByInstructions(instrIDs); err != nil {
+		return
+	}
+	if err := h.instrRepo.DeleteByUser(userID); err != nil {
+		return
+	}
+
+	done, _ := json.Marshal(account.DeletionDone{UserID: msg.UserID, Service: accountServiceName})
+	if err := h.nats.Conn.Publish(h.cfg.NatsSubjectAccountDeletionDone, done); err != nil {
+		log.Infof("AccountDeletionMessage: publish error: %v", err)
+		return
+	}
+	log.Infof("AccountDeletionMessage: deleted %d instructions and %d files of user %s", len(instructions), len(details), msg.UserID)
+}
+
+// AccountExportMessage answers an export request with the user's instruction history
+// and the output files that have not been cleaned yet
+func (h *InstructionHandler) AccountExportMessage(data []byte) []byte {
+	reply := account.NewExportReply[AccountExportItem](accountServiceName)
+
+	var msg account.ExportRequest
+	_ = json.Unmarshal(data, &msg)
+	userID, err := primitive.ObjectIDFromHex(msg.UserID)
+	if err != nil {
+		return reply.Failed("invalid user id")
+	}
+
+	instructions, err := h.instrRepo.ListByUser(userID)
+	if err != nil {
+		return reply.Failed("failed to list instructions")
+	}
+	instrIDs := make([]primitive.ObjectID, 0, len(instructions))
+	for _, instr := range instructions {
+		instrIDs = append(instrIDs, instr.ID)
+	}
+	details, err := h.detailRepo.ListByInstructions(instrIDs)
+	if err != nil {
+		return reply.Failed("failed to list instruction details")
+	}
+
+	byInstruction := make(map[primitive.ObjectID][]InstructionDetail, len(instructions))
+	for _, d := range details {
+		byInstruction[d.InstructionID] = append(byInstruction[d.InstructionID], d)
+		if d.OutputID == nil && d.Status == FileStatusDone && !d.IsCleaned && d.FileName != "" {
+			reply.Files = append(reply.Files, account.ExportFile{
+				Path: d.InstructionID.Hex() + "/" + filepath.Base(d.FileName),
+				Key:  d.FileName,
+			})
+		}
+	}
+	for _, instr := range instructions {
+		item := AccountExportItem{Instruction: instr, Details: byInstruction[instr.ID]}
+		if item.Details == nil {
+			item.Details = []InstructionDetail{}
+		}
+		reply.Instructions = append(reply.Instructions, item)
+	}
+
+	return reply.Marshal()
+}
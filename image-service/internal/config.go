@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"strings"
+
 	initx "github.com/instrlabs/shared/init"
 	"github.com/joho/godotenv"
 )
@@ -21,8 +23,17 @@ type Config struct {
 
 	NatsURI                     string
 	NatsSubjectImageRequests    string
+	NatsSubjectPdfImages        string
 	NatsSubjectNotificationsSSE string
 
+	NatsSubjectAccountDeleted      string
+	NatsSubjectAccountDeletionDone string
+	NatsSubjectAccountExport       string
+
+	JWKSURL          string
+	JWKSCacheMinutes int
+	TrustedServices  []string
+
 	ApiUrl string
 }
 
@@ -45,8 +56,28 @@ func LoadConfig() *Config {
 
 		NatsURI:                     initx.GetEnv("NATS_URI", "nats://nats:4222"),
 		NatsSubjectImageRequests:    initx.GetEnv("NATS_SUBJECT_IMAGE_REQUESTS", "image.requests"),
+		NatsSubjectPdfImages:        initx.GetEnv("NATS_SUBJECT_PDF_IMAGES", "pdf.images"),
 		NatsSubjectNotificationsSSE: initx.GetEnv("NATS_SUBJECT_NOTIFICATIONS_SSE", "notifications.sse"),
 
+		NatsSubjectAccountDeleted:      initx.GetEnv("NATS_SUBJECT_ACCOUNT_DELETED", "accounts.deleted"),
+		NatsSubjectAccountDeletionDone: initx.GetEnv("NATS_SUBJECT_ACCOUNT_DELETION_DONE", "accounts.deletion.completed"),
+		NatsSubjectAccountExport:       initx.GetEnv("NATS_SUBJECT_ACCOUNT_EXPORT", "accounts.export.image"),
+
+		JWKSURL:          initx.GetEnv("JWKS_URL", initx.GetEnv("AUTH_SERVICE", "http://auth-service:3000")+"/.well-known/jwks.json"),
+		JWKSCacheMinutes: initx.GetEnvInt("JWKS_CACHE_MINUTES", 10),
+		TrustedServices:  splitList(initx.GetEnv("TRUSTED_SERVICES", "gateway-service")),
+
 		ApiUrl: initx.GetEnv("API_URL", ""),
 	}
 }
+
+// splitList parses a comma separated env value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -20,11 +20,22 @@ type InstructionType string
 type Instruction struct {
 	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	OrgID     string             `json:"org_id,omitempty" bson:"org_id,omitempty"` // Set when created in an organization workspace
 	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
+// AccessibleBy reports whether a user acting in orgID, empty for the personal workspace, may use
+// the instruction. Organization instructions are shared by its members; personal ones are not
+// visible from an organization, even to their owner.
+func (i *Instruction) AccessibleBy(userID primitive.ObjectID, orgID string) bool {
+	if orgID != "" {
+		return i.OrgID == orgID
+	}
+	return i.OrgID == "" && i.UserID == userID
+}
+
 type InstructionDetail struct {
 	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
 	InstructionID primitive.ObjectID  `json:"instruction_id" bson:"instruction_id"`
@@ -192,3 +192,34 @@ func (r *InstructionDetailRepository) MarkCleaned(ids []primitive.ObjectID) erro
 	}
 	return err
 }
+
+func (r *InstructionDetailRepository) ListByInstructions(instrIDs []primitive.ObjectID) ([]InstructionDetail, error) {
+	if len(instrIDs) == 0 {
+		return []InstructionDetail{}, nil
+	}
+	ctx := context.Background()
+	cur, err := r.collection.Find(ctx, bson.M{"instruction_id": bson.M{"$in": instrIDs}})
+	if err != nil {
+		log.Infof("instruction_detail_repository.ListByInstructions: Find failed for count=%d: %v", len(instrIDs), err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []InstructionDetail{}
+	if err := cur.All(ctx, &out); err != nil {
+		log.Infof("instruction_detail_repository.ListByInstructions: cursor decode failed: %v", err)
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *InstructionDetailRepository) DeleteByInstructions(instrIDs []primitive.ObjectID) error {
+	if len(instrIDs) == 0 {
+		return nil
+	}
+	_, err := r.collection.DeleteMany(context.Background(), bson.M{"instruction_id": bson.M{"$in": instrIDs}})
+	if err != nil {
+		log.Infof("instruction_detail_repository.DeleteByInstructions: DeleteMany failed for count=%d: %v", len(instrIDs), err)
+	}
+	return err
+}
@@ -72,6 +72,7 @@ func (h *InstructionHandler) CreateInstruction(c *fiber.Ctx) error {
 	instr := &Instruction{
 		ID:        instructionID,
 		UserID:    objUserID,
+		OrgID:     c.Get("x-org-id"),
 		ProductID: objProductID,
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
@@ -94,7 +95,7 @@ func (h *InstructionHandler) CreateInstruction(c *fiber.Ctx) error {
 
 func (h *InstructionHandler) ListInstructions(c *fiber.Ctx) error {
 	userId, _ := c.Locals("userId").(string)
-	instructions, err := h.instrRepo.ListLatest(userId, 10)
+	instructions, err := h.instrRepo.ListLatest(userId, c.Get("x-org-id"), 10)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "failed to list instructions",
@@ -141,9 +142,7 @@ func (h *InstructionHandler) GetInstructionDetails(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "instruction not found", "errors": nil, "data": nil})
 	}
 
-	localUserID, _ := c.Locals("userId").(string)
-	userID, _ := primitive.ObjectIDFromHex(localUserID)
-	if instr.UserID != userID {
+	if !canAccess(c, instr) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden", "errors": nil, "data": nil})
 	}
 
@@ -155,6 +154,13 @@ func (h *InstructionHandler) GetInstructionDetails(c *fiber.Ctx) error {
 	})
 }
 
+// canAccess checks the instruction against the user and the organization the gateway forwards in x-org-id
+func canAccess(c *fiber.Ctx, instr *Instruction) bool {
+	localUserID, _ := c.Locals("userId").(string)
+	userID, _ := primitive.ObjectIDFromHex(localUserID)
+	return instr.AccessibleBy(userID, c.Get("x-org-id"))
+}
+
 func (h *InstructionHandler) CreateInstructionDetails(c *fiber.Ctx) error {
 	instrIDHex := c.Params("id", "")
 	if instrIDHex == "" {
@@ -170,9 +176,7 @@ func (h *InstructionHandler) CreateInstructionDetails(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "instruction not found", "errors": nil, "data": nil})
 	}
 
-	localUserID, _ := c.Locals("userId").(string)
-	userID, _ := primitive.ObjectIDFromHex(localUserID)
-	if instr.UserID != userID {
+	if !canAccess(c, instr) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden", "errors": nil, "data": nil})
 	}
 
@@ -430,9 +434,7 @@ func (h *InstructionHandler) GetInstructionDetilFile(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "instruction not found", "errors": nil, "data": nil})
 	}
 
-	localUserID, _ := c.Locals("userId").(string)
-	userID, _ := primitive.ObjectIDFromHex(localUserID)
-	if instr.UserID != userID {
+	if !canAccess(c, instr) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden", "errors": nil, "data": nil})
 	}
 
@@ -486,9 +488,7 @@ func (h *InstructionHandler) GetInstructionDetail(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "instruction not found", "errors": nil, "data": nil})
 	}
 
-	localUserID, _ := c.Locals("userId").(string)
-	userID, _ := primitive.ObjectIDFromHex(localUserID)
-	if instr.UserID != userID {
+	if !canAccess(c, instr) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden", "errors": nil, "data": nil})
 	}
 
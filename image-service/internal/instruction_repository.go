@@ -38,10 +38,15 @@ func (r *InstructionRepository) GetByID(id primitive.ObjectID) *Instruction {
 	return &instruction
 }
 
-func (r *InstructionRepository) ListLatest(userId string, limit int64) ([]Instruction, error) {
+// ListLatest lists the latest instructions of an organization, or the personal ones of the user when orgId is empty
+func (r *InstructionRepository) ListLatest(userId string, orgId string, limit int64) ([]Instruction, error) {
 	objectUserId, _ := primitive.ObjectIDFromHex(userId)
+	filter := personalInstructions(objectUserId)
+	if orgId != "" {
+		filter = bson.M{"org_id": orgId}
+	}
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
-	cursor, err := r.collection.Find(context.Background(), bson.M{"user_id": objectUserId}, opts)
+	cursor, err := r.collection.Find(context.Background(), filter, opts)
 	if err != nil {
 		log.Errorf("Failed to list instructions: %v", err)
 		return nil, err
@@ -60,3 +65,36 @@ func (r *InstructionRepository) ListLatest(userId string, limit int64) ([]Instru
 
 	return instructions, nil
 }
+
+// ListByUser lists the personal instructions of a user. Instructions created in an organization belong to it.
+func (r *InstructionRepository) ListByUser(userId primitive.ObjectID) ([]Instruction, error) {
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, personalInstructions(userId), opts)
+	if err != nil {
+		log.Errorf("Failed to list instructions of user %s: %v", userId.Hex(), err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	instructions := []Instruction{}
+	if err := cursor.All(ctx, &instructions); err != nil {
+		log.Errorf("Failed to decode instructions of user %s: %v", userId.Hex(), err)
+		return nil, err
+	}
+	return instructions, nil
+}
+
+// DeleteByUser deletes the personal instructions of a user
+func (r *InstructionRepository) DeleteByUser(userId primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(context.Background(), personalInstructions(userId))
+	if err != nil {
+		log.Errorf("Failed to delete instructions of user %s: %v", userId.Hex(), err)
+		return err
+	}
+	return nil
+}
+
+func personalInstructions(userId primitive.ObjectID) bson.M {
+	return bson.M{"user_id": userId, "org_id": bson.M{"$exists": false}}
+}
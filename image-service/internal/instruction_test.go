@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInstruction_AccessibleBy(t *testing.T) {
+	owner := primitive.NewObjectID()
+	teammate := primitive.NewObjectID()
+
+	personal := &Instruction{UserID: owner}
+	assert.True(t, personal.AccessibleBy(owner, ""))
+	assert.False(t, personal.AccessibleBy(teammate, ""))
+	assert.False(t, personal.AccessibleBy(owner, "org-1"), "personal instructions stay out of organization workspaces")
+
+	shared := &Instruction{UserID: owner, OrgID: "org-1"}
+	assert.True(t, shared.AccessibleBy(owner, "org-1"))
+	assert.True(t, shared.AccessibleBy(teammate, "org-1"))
+	assert.False(t, shared.AccessibleBy(teammate, "org-2"))
+	assert.False(t, shared.AccessibleBy(owner, ""), "organization instructions are not listed as personal ones")
+}
+
+func TestHandoffOutputs(t *testing.T) {
+	outputID := primitive.NewObjectID()
+	details := []InstructionDetail{
+		{FileName: "images/in.png", Status: FileStatusDone, OutputID: &outputID},
+		{ID: outputID, FileName: "images/out.png", Status: FileStatusDone},
+		{FileName: "images/pending.png", Status: FileStatusProcessing},
+		{FileName: "images/cleaned.png", Status: FileStatusDone, IsCleaned: true},
+	}
+
+	outputs := handoffOutputs(details)
+	if assert.Len(t, outputs, 1) {
+		assert.Equal(t, outputID, outputs[0].ID)
+	}
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pdfHandoffTimeout bounds the wait for pdf-service to store the images and create its instruction
+const pdfHandoffTimeout = 10 * time.Second
+
+// ImagesHandoff asks pdf-service to turn images into a PDF. The images travel in the message,
+// since the services do not share a bucket.
+type ImagesHandoff struct {
+	UserID  string                 `json:"user_id"`
+	OrgID   string                 `json:"org_id,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"` // pdfs/images-to-pdf options
+	Images  []HandoffImage         `json:"images"`
+}
+
+type HandoffImage struct {
+	FileName string `json:"file_name"`
+	Data     []byte `json:"data"`
+}
+
+type ImagesHandoffReply struct {
+	InstructionID string `json:"instruction_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// handoffOutputs returns the outputs of an instruction that are processed and still stored
+func handoffOutputs(details []InstructionDetail) []InstructionDetail {
+	var outputs []InstructionDetail
+	for _, d := range details {
+		if d.OutputID == nil && d.Status == FileStatusDone && !d.IsCleaned {
+			outputs = append(outputs, d)
+		}
+	}
+	return outputs
+}
+
+// SendToPDF hands the processed images of an instruction to pdf-service, which creates an
+// images-to-pdf instruction for the same user and workspace and processes it like an upload
+func (h *InstructionHandler) SendToPDF(c *fiber.Ctx) error {
+	instrID, err := primitive.ObjectIDFromHex(c.Params("id", ""))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid instruction id", "errors": nil, "data": nil})
+	}
+
+	var body struct {
+		Options map[string]interface{} `json:"options"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid request body", "errors": nil, "data": nil})
+		}
+	}
+
+	instr := h.instrRepo.GetByID(instrID)
+	if instr == nil || instr.ID.IsZero() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "instruction not found", "errors": nil, "data": nil})
+	}
+
+	if !canAccess(c, instr) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden", "errors": nil, "data": nil})
+	}
+
+	outputs := handoffOutputs(h.detailRepo.ListByInstruction(instr.ID))
+	if len(outputs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "instruction has no processed images", "errors": nil, "data": nil})
+	}
+
+	msg := ImagesHandoff{
+		UserID:  instr.UserID.Hex(),
+		OrgID:   instr.OrgID,
+		Options: body.Options,
+		Images:  make([]HandoffImage, 0, len(outputs)),
+	}
+	for _, output := range outputs {
+		b := h.s3.Get(output.FileName)
+		if b == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "file blob not found", "errors": nil, "data": nil})
+		}
+		msg.Images = append(msg.Images, HandoffImage{FileName: filepath.Base(output.FileName), Data: b})
+	}
+
+	payload, _ := json.Marshal(msg)
+	if int64(len(payload)) > h.nats.Conn.MaxPayload() {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"message": "images are too large to send to pdf-service", "errors": nil, "data": nil})
+	}
+
+	res, err := h.nats.Conn.Request(h.cfg.NatsSubjectPdfImages, payload, pdfHandoffTimeout)
+	if err != nil {
+		log.Infof("SendToPDF: request to pdf-service failed for instruction %s: %v", instr.ID.Hex(), err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"message": "pdf-service is unavailable", "errors": nil, "data": nil})
+	}
+
+	var reply ImagesHandoffReply
+	if err := json.Unmarshal(res.Data, &reply); err != nil || (reply.Error == "" && reply.InstructionID == "") {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "invalid reply from pdf-service", "errors": nil, "data": nil})
+	}
+	if reply.Error != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "pdf-service rejected the images", "errors": reply.Error, "data": nil})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "pdf instruction created",
+		"errors":  nil,
+		"data":    fiber.Map{"pdf_instruction_id": reply.InstructionID},
+	})
+}
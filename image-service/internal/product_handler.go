@@ -2,6 +2,9 @@ package internal
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ProductHandler struct {
@@ -29,3 +32,69 @@ func (h *ProductHandler) ListProducts(c *fiber.Ctx) error {
 		},
 	})
 }
+
+// UpdateProduct changes a product's title, description, active or free flag. Admin only.
+func (h *ProductHandler) UpdateProduct(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid product ID",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	var input struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		IsActive    *bool   `json:"is_active"`
+		IsFree      *bool   `json:"is_free"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	fields := bson.M{}
+	if input.Title != nil {
+		fields["title"] = *input.Title
+	}
+	if input.Description != nil {
+		fields["description"] = *input.Description
+	}
+	if input.IsActive != nil {
+		fields["is_active"] = *input.IsActive
+	}
+	if input.IsFree != nil {
+		fields["is_free"] = *input.IsFree
+	}
+
+	product, err := h.repo.Update(id, fields)
+	if err != nil {
+		log.Errorf("UpdateProduct: Failed to update product %s: %v", id.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Internal server error",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+	if product == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Product not found",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	log.Infof("UpdateProduct: Product %s updated", id.Hex())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Product updated successfully",
+		"errors":  nil,
+		"data": map[string]interface{}{
+			"product": product,
+		},
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProductRepository struct {
@@ -61,3 +62,23 @@ func (r *ProductRepository) FindByID(id primitive.ObjectID) (*Product, error) {
 	}
 	return &p, nil
 }
+
+// Update sets the given fields on an image product and returns it, or nil if it does not exist
+func (r *ProductRepository) Update(id primitive.ObjectID, fields bson.M) (*Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fields["updatedAt"] = time.Now().UTC()
+	filter := bson.M{"_id": id, "product_type": "image"}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var p Product
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": fields}, opts).Decode(&p)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
+	"github.com/instrlabs/common/identity"
+	"github.com/instrlabs/common/jwks"
 	initx "github.com/instrlabs/shared/init"
 	natsgo "github.com/nats-io/nats.go"
 
@@ -36,6 +38,7 @@ func main() {
 	initx.SetupLogger(app)
 	initx.SetupServiceSwagger(app, cfg.ApiUrl, "/images")
 	initx.SetupServiceHealth(app)
+	identity.SetupServiceIdentity(app, jwks.New(cfg.JWKSURL, time.Duration(cfg.JWKSCacheMinutes)*time.Minute).Keyfunc, cfg.TrustedServices)
 	initx.SetupAuthenticated(app, []string{
 		"/products",
 	})
@@ -52,6 +55,12 @@ func main() {
 	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectImageRequests, func(m *natsgo.Msg) {
 		instrHandler.RunInstructionMessage(m.Data)
 	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectAccountDeleted, func(m *natsgo.Msg) {
+		instrHandler.AccountDeletionMessage(m.Data)
+	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectAccountExport, func(m *natsgo.Msg) {
+		_ = m.Respond(instrHandler.AccountExportMessage(m.Data))
+	})
 
 	go func() {
 		ticker := time.NewTicker(30 * time.Minute)
@@ -66,6 +75,7 @@ func main() {
 
 	app.Post("/instructions", instrHandler.CreateInstruction)
 	app.Post("/instructions/:id/details", instrHandler.CreateInstructionDetails)
+	app.Post("/instructions/:id/pdf", instrHandler.SendToPDF)
 
 	app.Get("/instructions/:id/details/:detailId", instrHandler.GetInstructionDetail)
 	app.Get("/instructions/:id/details/:detailId/file", instrHandler.GetInstructionDetilFile)
@@ -73,9 +83,12 @@ func main() {
 	app.Get("/instructions/:id", instrHandler.GetInstructionByID)
 	app.Get("/instructions/:id/details", instrHandler.GetInstructionDetails)
 
-	app.Get("/files", instrHandler.ListUncleanedFiles)
+	admin := identity.RequireRole(identity.RoleAdmin)
+
+	app.Get("/files", admin, instrHandler.ListUncleanedFiles)
 
 	app.Get("/products", productHandler.ListProducts)
+	app.Post("/products/:id", admin, productHandler.UpdateProduct)
 
 	log.Fatal(app.Listen(cfg.Port))
 }
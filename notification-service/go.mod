@@ -5,6 +5,7 @@ go 1.24.4
 require (
 	github.com/gofiber/fiber/v2 v2.52.9
 	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/instrlabs/common v0.0.0
 	github.com/instrlabs/shared v0.0.15
 	github.com/joho/godotenv v1.5.1
 	github.com/nats-io/nats.go v1.46.1
@@ -61,3 +62,5 @@ require (
 	google.golang.org/protobuf v1.36.10 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/instrlabs/common => ../common
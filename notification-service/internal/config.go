@@ -9,12 +9,16 @@ type Config struct {
 	Environment string
 	Port        string
 
-	Origins   string
-	JWTSecret string
+	Origins          string
+	JWKSURL          string
+	JWKSCacheMinutes int
 
 	AuthService                 string
 	NatsURI                     string
 	NatsSubjectNotificationsSSE string
+
+	NatsSubjectSessionRevoked     string
+	NatsSubjectSessionRevocations string
 }
 
 func NewConfig() *Config {
@@ -24,11 +28,15 @@ func NewConfig() *Config {
 		Environment: initx.GetEnv("ENVIRONMENT", "development"),
 		Port:        initx.GetEnv("PORT", ":3001"),
 
-		Origins:   initx.GetEnv("ORIGINS_ALLOWED", "http://localhost:8000"),
-		JWTSecret: initx.GetEnv("JWT_SECRET", ""),
+		Origins:          initx.GetEnv("ORIGINS_ALLOWED", "http://localhost:8000"),
+		JWKSURL:          initx.GetEnv("JWKS_URL", initx.GetEnv("AUTH_SERVICE", "http://auth-service:3000")+"/.well-known/jwks.json"),
+		JWKSCacheMinutes: initx.GetEnvInt("JWKS_CACHE_MINUTES", 10),
 
 		AuthService:                 initx.GetEnv("AUTH_SERVICE", "http://auth-service:3000"),
 		NatsURI:                     initx.GetEnv("NATS_URI", "nats://localhost:4222"),
 		NatsSubjectNotificationsSSE: initx.GetEnv("NATS_SUBJECT_NOTIFICATIONS_SSE", "notifications.sse"),
+
+		NatsSubjectSessionRevoked:     initx.GetEnv("NATS_SUBJECT_SESSION_REVOKED", "auth.sessions.revoked"),
+		NatsSubjectSessionRevocations: initx.GetEnv("NATS_SUBJECT_SESSION_REVOCATIONS", "auth.sessions.revocations"),
 	}
 }
@@ -11,10 +11,11 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/instrlabs/common/jwks"
 )
 
 // SetupMiddleware sets up middleware for authentication
-func SetupMiddleware(app *fiber.App, cfg *Config) {
+func SetupMiddleware(app *fiber.App, cfg *Config, revoked *RevokedSessions) {
 	app.Use(helmet.New())
 	app.Use(requestid.New())
 	app.Use(recover.New())
@@ -33,6 +34,7 @@ func SetupMiddleware(app *fiber.App, cfg *Config) {
 	}))
 
 	// Token extraction
+	keys := jwks.New(cfg.JWKSURL, time.Duration(cfg.JWKSCacheMinutes)*time.Minute)
 	app.Use(func(c *fiber.Ctx) error {
 		var accessToken string
 
@@ -45,10 +47,12 @@ func SetupMiddleware(app *fiber.App, cfg *Config) {
 		}
 
 		c.Request().Header.Set("x-user-id", "")
+		c.Request().Header.Set("x-session-id", "")
 
 		if accessToken != "" {
-			if info, err := ExtractTokenInfo(cfg.JWTSecret, accessToken); err == nil {
+			if info, err := ExtractTokenInfo(keys, accessToken); err == nil && !revoked.IsRevoked(info.SessionID) {
 				c.Request().Header.Set("x-user-id", info.UserID)
+				c.Request().Header.Set("x-session-id", info.SessionID)
 			}
 		}
 
@@ -0,0 +1,21 @@
+package internal
+
+import "time"
+
+// NotificationNewDevice is published by the auth service when a user signs in from a device they never used
+const NotificationNewDevice = "security.new_device"
+
+type DeviceInfo struct {
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	Type    string `json:"type"`
+}
+
+type NewDeviceNotification struct {
+	UserID    string     `json:"user_id"`
+	Type      string     `json:"type"`
+	SessionID string     `json:"session_id"`
+	Device    DeviceInfo `json:"device"`
+	IPAddress string     `json:"ip_address"`
+	CreatedAt time.Time  `json:"created_at"`
+}
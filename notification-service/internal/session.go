@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/nats-io/nats.go"
+)
+
+// sessionRevocationsTimeout bounds how long startup waits for the revocation list
+const sessionRevocationsTimeout = 5 * time.Second
+
+// Requester sends a request and waits for the reply; *nats.Conn satisfies it
+type Requester interface {
+	Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error)
+}
+
+type sessionRevocations struct {
+	Sessions []struct {
+		SessionID string    `json:"session_id"`
+		Until     time.Time `json:"until"`
+	} `json:"sessions"`
+}
+
+// RevokedSessions caches the sessions auth-service revoked, so their access tokens cannot open
+// streams before they expire. A revocation is kept until the session's last access token expires.
+type RevokedSessions struct {
+	conn    Requester
+	subject string
+
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewRevokedSessions(conn Requester, subject string) *RevokedSessions {
+	return &RevokedSessions{
+		conn:    conn,
+		subject: subject,
+		revoked: map[string]time.Time{},
+	}
+}
+
+// Load fills the cache with the revocations auth-service still considers current
+func (r *RevokedSessions) Load() error {
+	msg, err := r.conn.Request(r.subject, nil, sessionRevocationsTimeout)
+	if err != nil {
+		log.Errorf("RevokedSessions: Failed to load revoked sessions: %v", err)
+		return err
+	}
+	sessionIDs, err := r.add(msg.Data)
+	if err != nil {
+		log.Errorf("RevokedSessions: Invalid revocation list: %v", err)
+		return err
+	}
+	log.Infof("RevokedSessions: Loaded %d revoked sessions", len(sessionIDs))
+	return nil
+}
+
+// RevocationMessage handles revocations published by auth-service and returns the revoked session IDs
+func (r *RevokedSessions) RevocationMessage(data []byte) []string {
+	sessionIDs, err := r.add(data)
+	if err != nil {
+		log.Errorf("RevokedSessions: Invalid revocation message: %v", err)
+		return nil
+	}
+	return sessionIDs
+}
+
+func (r *RevokedSessions) add(data []byte) ([]string, error) {
+	var revocations sessionRevocations
+	if err := json.Unmarshal(data, &revocations); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for sessionID, until := range r.revoked {
+		if !now.Before(until) {
+			delete(r.revoked, sessionID)
+		}
+	}
+
+	var sessionIDs []string
+	for _, session := range revocations.Sessions {
+		if session.SessionID == "" || !now.Before(session.Until) {
+			continue
+		}
+		r.revoked[session.SessionID] = session.Until
+		sessionIDs = append(sessionIDs, session.SessionID)
+	}
+	return sessionIDs, nil
+}
+
+// IsRevoked reports whether access tokens of the session must be rejected
+func (r *RevokedSessions) IsRevoked(sessionID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	until, ok := r.revoked[sessionID]
+	return ok && time.Now().Before(until)
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubRequester struct {
+	reply []byte
+	err   error
+}
+
+func (r *stubRequester) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &nats.Msg{Subject: subject, Data: r.reply}, nil
+}
+
+func revocationJSON(sessionID string, until time.Time) []byte {
+	return []byte(fmt.Sprintf(`{"sessions":[{"session_id":%q,"until":%q}]}`, sessionID, until.Format(time.RFC3339Nano)))
+}
+
+func TestRevokedSessions_Load(t *testing.T) {
+	conn := &stubRequester{reply: revocationJSON("s1", time.Now().Add(time.Hour))}
+	revoked := NewRevokedSessions(conn, "auth.sessions.revocations")
+
+	require.NoError(t, revoked.Load())
+	assert.True(t, revoked.IsRevoked("s1"))
+	assert.False(t, revoked.IsRevoked("s2"))
+	assert.False(t, revoked.IsRevoked(""))
+
+	conn.err = errors.New("no responders")
+	assert.Error(t, NewRevokedSessions(conn, "auth.sessions.revocations").Load())
+}
+
+func TestRevokedSessions_RevocationMessage(t *testing.T) {
+	revoked := NewRevokedSessions(&stubRequester{}, "auth.sessions.revocations")
+
+	assert.Equal(t, []string{"s1"}, revoked.RevocationMessage(revocationJSON("s1", time.Now().Add(time.Hour))))
+	assert.True(t, revoked.IsRevoked("s1"))
+
+	// Every access token of the session has expired, so there is nothing left to reject
+	assert.Empty(t, revoked.RevocationMessage(revocationJSON("s2", time.Now().Add(-time.Minute))))
+	assert.False(t, revoked.IsRevoked("s2"))
+
+	assert.Nil(t, revoked.RevocationMessage([]byte("not json")))
+}
+
+func TestSSEService_DisconnectSessions(t *testing.T) {
+	service := NewSSEService(&Config{})
+	revokedClient := &SSEClient{userId: "user-1", sessionId: "s1", connection: make(chan []byte, 1), done: make(chan bool)}
+	otherClient := &SSEClient{userId: "user-2", sessionId: "s2", connection: make(chan []byte, 1), done: make(chan bool)}
+	service.clients["user-1"] = revokedClient
+	service.clients["user-2"] = otherClient
+
+	service.DisconnectSessions([]string{"s1"})
+
+	select {
+	case <-revokedClient.done:
+	case <-time.After(time.Second):
+		t.Fatal("stream of the revoked session was not closed")
+	}
+	assert.NotContains(t, service.clients, "user-1")
+	assert.Contains(t, service.clients, "user-2")
+}
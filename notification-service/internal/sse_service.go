@@ -13,6 +13,7 @@ import (
 
 type SSEClient struct {
 	userId      string
+	sessionId   string
 	connection  chan []byte
 	done        chan bool
 	connectedAt time.Time
@@ -42,6 +43,61 @@ func (s *SSEService) NotificationUser(msg []byte) {
 	}
 }
 
+// encodeNotification returns the SSE event name and payload of a NATS message. Instruction
+// updates carry no type and are sent as "message" events, typed notifications under their type.
+func encodeNotification(data []byte) (string, []byte, error) {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return "", nil, err
+	}
+
+	if envelope.Type == NotificationNewDevice {
+		var msg NewDeviceNotification
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return "", nil, err
+		}
+		out, err := json.Marshal(msg)
+		return NotificationNewDevice, out, err
+	}
+
+	var msg InstructionNotification
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return "", nil, err
+	}
+	out, err := json.Marshal(msg)
+	return "message", out, err
+}
+
+// DisconnectSessions closes the streams opened with access tokens of the given sessions
+func (s *SSEService) DisconnectSessions(sessionIDs []string) {
+	revoked := make(map[string]bool, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		revoked[sessionID] = true
+	}
+
+	s.mutex.Lock()
+	var closing []*SSEClient
+	for userId, client := range s.clients {
+		if client.sessionId != "" && revoked[client.sessionId] {
+			delete(s.clients, userId)
+			closing = append(closing, client)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, client := range closing {
+		log.Infof("Closing connection of revoked session %s for user %s", client.sessionId, client.userId)
+		go func(client *SSEClient) {
+			select {
+			case client.done <- true:
+			case <-time.After(5 * time.Second):
+			}
+		}(client)
+	}
+}
+
 func NewSSEService(cfg *Config) *SSEService {
 	return &SSEService{
 		cfg:     cfg,
@@ -51,6 +107,7 @@ func NewSSEService(cfg *Config) *SSEService {
 
 func (s *SSEService) HandleSSE(c *fiber.Ctx) error {
 	userId := c.Get("x-user-id")
+	sessionId := c.Get("x-session-id")
 	c.Set("content-type", "text/event-stream")
 	c.Set("cache-control", "no-cache")
 	c.Set("connection", "keep-alive")
@@ -60,6 +117,7 @@ func (s *SSEService) HandleSSE(c *fiber.Ctx) error {
 
 	client := &SSEClient{
 		userId:      userId,
+		sessionId:   sessionId,
 		connection:  messageChan,
 		done:        doneChan,
 		connectedAt: time.Now().UTC(),
@@ -105,14 +163,13 @@ func (s *SSEService) HandleSSE(c *fiber.Ctx) error {
 				log.Infof("SSE client disconnected for user %s. Total clients: %d", userId, len(s.clients))
 				return
 			case data := <-client.connection:
-				var msg InstructionNotification
-				if err := json.Unmarshal(data, &msg); err != nil {
+				event, msgJson, err := encodeNotification(data)
+				if err != nil {
 					log.Infof("RunInstructionMessage: unmarshal error: %v", err)
 					return
 				}
 
-				msgJson, _ := json.Marshal(msg)
-				_, _ = fmt.Fprintf(w, "event: message\ndata: %s\n\n", string(msgJson))
+				_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, string(msgJson))
 				_ = w.Flush()
 			case <-ticker.C:
 				info := map[string]interface{}{"time": time.Now().UTC()}
@@ -18,7 +18,7 @@ func TestNewSSEService(t *testing.T) {
 		Environment:                 "test",
 		Port:                        ":3001",
 		Origins:                     "http://localhost:8000",
-		JWTSecret:                   "test-secret",
+		JWKSURL:                     "http://auth-service:3000/.well-known/jwks.json",
 		AuthService:                 "http://auth-service:3000",
 		NatsURI:                     "nats://localhost:4222",
 		NatsSubjectNotificationsSSE: "notifications.sse",
@@ -33,7 +33,7 @@ func TestNewSSEService(t *testing.T) {
 }
 
 func TestSSEService_NotificationUser_Success(t *testing.T) {
-	cfg := &Config{JWTSecret: "test-secret"}
+	cfg := &Config{}
 	service := NewSSEService(cfg)
 
 	// Setup mock client
@@ -76,7 +76,7 @@ func TestSSEService_NotificationUser_Success(t *testing.T) {
 }
 
 func TestSSEService_NotificationUser_ClientNotFound(t *testing.T) {
-	cfg := &Config{JWTSecret: "test-secret"}
+	cfg := &Config{}
 	service := NewSSEService(cfg)
 
 	// No clients registered
@@ -98,7 +98,7 @@ func TestSSEService_NotificationUser_ClientNotFound(t *testing.T) {
 }
 
 func TestSSEService_NotificationUser_InvalidJSON(t *testing.T) {
-	cfg := &Config{JWTSecret: "test-secret"}
+	cfg := &Config{}
 	service := NewSSEService(cfg)
 
 	// Setup mock client
@@ -129,7 +129,7 @@ func TestSSEService_NotificationUser_InvalidJSON(t *testing.T) {
 }
 
 func TestSSEService_NotificationUser_EmptyMessage(t *testing.T) {
-	cfg := &Config{JWTSecret: "test-secret"}
+	cfg := &Config{}
 	service := NewSSEService(cfg)
 
 	// Setup mock client
@@ -160,7 +160,7 @@ func TestSSEService_NotificationUser_EmptyMessage(t *testing.T) {
 }
 
 func TestSSEService_NotificationUser_ConcurrentNotifications(t *testing.T) {
-	cfg := &Config{JWTSecret: "test-secret"}
+	cfg := &Config{}
 	service := NewSSEService(cfg)
 
 	// Setup mock client with buffered channel
@@ -215,7 +215,7 @@ loop:
 }
 
 func TestSSEService_NotificationUser_ChannelFull(t *testing.T) {
-	cfg := &Config{JWTSecret: "test-secret"}
+	cfg := &Config{}
 	service := NewSSEService(cfg)
 
 	// Setup client with small buffer
@@ -263,7 +263,7 @@ func TestSSEService_NotificationUser_ChannelFull(t *testing.T) {
 }
 
 func TestSSEService_MultipleClients(t *testing.T) {
-	cfg := &Config{JWTSecret: "test-secret"}
+	cfg := &Config{}
 	service := NewSSEService(cfg)
 
 	// Setup multiple clients
@@ -314,3 +314,23 @@ func TestSSEService_MultipleClients(t *testing.T) {
 		// Expected - no message for user-2
 	}
 }
+
+func TestEncodeNotification(t *testing.T) {
+	event, payload, err := encodeNotification([]byte(`{"user_id":"user-1","instruction_id":"instr-1","instruction_detail_id":"detail-1"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "message", event)
+	assert.JSONEq(t, `{"user_id":"user-1","instruction_id":"instr-1","instruction_detail_id":"detail-1"}`, string(payload))
+
+	event, payload, err = encodeNotification([]byte(`{"user_id":"user-1","type":"security.new_device","session_id":"s1",` +
+		`"device":{"browser":"Safari","os":"iOS","type":"mobile"},"ip_address":"203.0.113.50","created_at":"2024-01-01T00:00:00Z","extra":"dropped"}`))
+	require.NoError(t, err)
+	assert.Equal(t, NotificationNewDevice, event)
+	var notification NewDeviceNotification
+	require.NoError(t, json.Unmarshal(payload, &notification))
+	assert.Equal(t, "s1", notification.SessionID)
+	assert.Equal(t, "iOS", notification.Device.OS)
+	assert.NotContains(t, string(payload), "extra")
+
+	_, _, err = encodeNotification([]byte(`{invalid json`))
+	assert.Error(t, err)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/instrlabs/common/jwks"
 )
 
 var ErrTokenExpired = errors.New("TOKEN_EXPIRED")
@@ -15,23 +16,19 @@ var ErrTokenInvalid = errors.New("TOKEN_INVALID")
 var ErrTokenEmpty = errors.New("TOKEN_EMPTY")
 
 type TokenInfo struct {
-	UserID string
+	UserID    string
+	SessionID string
 }
 
-func ExtractTokenInfo(secret string, tokenString string) (*TokenInfo, error) {
+func ExtractTokenInfo(keys *jwks.JWKS, tokenString string) (*TokenInfo, error) {
 	if strings.TrimSpace(tokenString) == "" {
 		return nil, ErrTokenEmpty
 	}
 
-	parser := jwt.NewParser(jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
 
 	claims := jwt.MapClaims{}
-	token, err := parser.ParseWithClaims(
-		tokenString, claims,
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		},
-	)
+	token, err := parser.ParseWithClaims(tokenString, claims, keys.Keyfunc)
 
 	if err != nil {
 		log.Errorf("ExtractTokenInfo: Failed to parse token: %v", err)
@@ -43,6 +40,12 @@ func ExtractTokenInfo(secret string, tokenString string) (*TokenInfo, error) {
 		return nil, ErrTokenInvalid
 	}
 
+	// Service tokens authenticate the gateway to services and never act for a user
+	if toString(claims["token_use"]) == "service" {
+		log.Warnf("ExtractTokenInfo: Rejected service token of %s", toString(claims["sub"]))
+		return nil, ErrTokenInvalid
+	}
+
 	userID := toString(claims["user_id"])
 
 	if date, err := claims.GetExpirationTime(); err == nil && date != nil {
@@ -52,7 +55,7 @@ func ExtractTokenInfo(secret string, tokenString string) (*TokenInfo, error) {
 		}
 	}
 
-	return &TokenInfo{UserID: userID}, nil
+	return &TokenInfo{UserID: userID, SessionID: toString(claims["session_id"])}, nil
 }
 
 func toString(v any) string {
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/instrlabs/common/jwks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuthService serves a JWKS that tests can change to simulate key rotation
+type fakeAuthService struct {
+	mu       sync.Mutex
+	keys     []map[string]string
+	requests int
+	server   *httptest.Server
+}
+
+func newFakeAuthService(t *testing.T) *fakeAuthService {
+	t.Helper()
+	f := &fakeAuthService{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.requests++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": f.keys})
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeAuthService) publishEd25519(kid string, pub ed25519.PublicKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, map[string]string{
+		"kty": "OKP", "kid": kid, "use": "sig", "alg": "EdDSA", "crv": "Ed25519",
+		"x": base64.RawURLEncoding.EncodeToString(pub),
+	})
+}
+
+func (f *fakeAuthService) publishRSA(kid string, pub *rsa.PublicKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	})
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, userID string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestExtractTokenInfo_VerifiesWithJWKS(t *testing.T) {
+	auth := newFakeAuthService(t)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	auth.publishEd25519("ed-1", edPub)
+	auth.publishRSA("rsa-1", &rsaPriv.PublicKey)
+	keys := jwks.New(auth.server.URL, 10*time.Minute)
+
+	info, err := ExtractTokenInfo(keys, signToken(t, jwt.SigningMethodEdDSA, "ed-1", edPriv, "user-ed"))
+	require.NoError(t, err)
+	assert.Equal(t, "user-ed", info.UserID)
+
+	info, err = ExtractTokenInfo(keys, signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaPriv, "user-rsa"))
+	require.NoError(t, err)
+	assert.Equal(t, "user-rsa", info.UserID)
+
+	// Both tokens were verified from a single fetch
+	assert.Equal(t, 1, auth.requests)
+}
+
+func TestExtractTokenInfo_RejectsSharedSecretAndMismatchedKeys(t *testing.T) {
+	auth := newFakeAuthService(t)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	auth.publishEd25519("ed-1", edPub)
+	keys := jwks.New(auth.server.URL, 10*time.Minute)
+
+	_, err := ExtractTokenInfo(keys, signToken(t, jwt.SigningMethodHS256, "ed-1", []byte("shared-secret"), "attacker"))
+	assert.Error(t, err)
+
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	_, err = ExtractTokenInfo(keys, signToken(t, jwt.SigningMethodEdDSA, "ed-1", otherPriv, "attacker"))
+	assert.Error(t, err)
+
+	_, err = ExtractTokenInfo(keys, signToken(t, jwt.SigningMethodEdDSA, "", otherPriv, "attacker"))
+	assert.Error(t, err)
+}
+
+func TestExtractTokenInfo_RejectsServiceTokens(t *testing.T) {
+	auth := newFakeAuthService(t)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	auth.publishEd25519("ed-1", pub)
+	keys := jwks.New(auth.server.URL, 10*time.Minute)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"sub":       "gateway-service",
+		"token_use": "service",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = "ed-1"
+	signed, err := token.SignedString(priv)
+	require.NoError(t, err)
+
+	_, err = ExtractTokenInfo(keys, signed)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
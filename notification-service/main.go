@@ -20,12 +20,19 @@ func main() {
 		sseService.NotificationUser(m.Data)
 	})
 
+	revoked := internal.NewRevokedSessions(natsSrv.Conn, cfg.NatsSubjectSessionRevocations)
+	_, _ = natsSrv.Conn.Subscribe(cfg.NatsSubjectSessionRevoked, func(m *natsgo.Msg) {
+		sseService.DisconnectSessions(revoked.RevocationMessage(m.Data))
+	})
+	// Subscribe first, so a revocation published while the list loads is not missed
+	_ = revoked.Load()
+
 	app := fiber.New(fiber.Config{})
 
 	initx.SetupPrometheus(app)
 	initx.SetupServiceHealth(app)
 	initx.SetupLogger(app)
-	internal.SetupMiddleware(app, cfg)
+	internal.SetupMiddleware(app, cfg, revoked)
 	initx.SetupAuthenticated(app, []string{})
 
 	app.Get("/sse", sseService.HandleSSE)
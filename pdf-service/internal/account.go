@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"encoding/json"
+	"log"
+	"path/filepath"
+
+	"github.com/instrlabs/common/account"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const accountServiceName = "pdf"
+
+// AccountExportItem is an instruction of the user with its details
+type AccountExportItem struct {
+	Instruction
+	Details []InstructionDetail `json:"details"`
+}
+
+// AccountDeletionMessage removes the instructions, details and stored files of a deleted account.
+// Deleting an account that has no data left is a no-op, so redelivered events are confirmed again.
+func (h *InstructionHandler) AccountDeletionMessage(data []byte) {
+	var msg account.Deletion
+	if err := json.Unmarshal(data, &msg); err != nil || msg.UserID == "" {
+		log.Printf("AccountDeletionMessage: invalid message: %s", string(data))
+		return
+	}
+
+	instructions, err := h.instrRepo.ListByUser(msg.UserID)
+	if err != nil {
+		return
+	}
+	instructionIDs := make([]primitive.ObjectID, 0, len(instructions))
+	for _, instruction := range instructions {
+		instructionIDs = append(instructionIDs, instruction.ID)
+	}
+
+	details, err := h.detailRepo.ListByInstructions(instructionIDs)
+	if err != nil {
+		return
+	}
+	for _, detail := range details {
+		if detail.FilePath == "" || detail.Status == "CLEANED" {
+			continue
+		}
+		if err := h.s3.Delete(detail.FilePath); err != nil {
+			log.Printf("AccountDeletionMessage: failed to delete S3 object %s: %v", detail.FilePath, err)
+		}
+	}
+
+	if err := h.detailRepo.DeleteByInstructions(instructionIDs); err != nil {
+		return
+	}
+	if err := h.instrRepo.DeleteByUser(msg.UserID); err != nil {
+		return
+	}
+
+	done, _ := json.Marshal(account.DeletionDone{UserID: msg.UserID, Service: accountServiceName})
+	if err := h.nats.Conn.Publish(h.cfg.NatsSubjectAccountDeletionDone, done); err != nil {
+		log.Printf("AccountDeletionMessage: failed to publish confirmation: %v", err)
+		return
+	}
+	log.Printf("AccountDeletionMessage: deleted %d instructions and %d files of user %s", len(instructions), len(details), msg.UserID)
+}
+
+// AccountExportMessage answers an export request with the user's instruction history
+// and the output files that have not been cleaned yet
+func (h *InstructionHandler) AccountExportMessage(data []byte) []byte {
+	reply := account.NewExportReply[AccountExportItem](accountServiceName)
+
+	var msg account.ExportRequest
+	if err := json.Unmarshal(data, &msg); err != nil || msg.UserID == "" {
+		return reply.Failed("invalid user id")
+	}
+
+	instructions, err := h.instrRepo.ListByUser(msg.UserID)
+	if err != nil {
+		return reply.Failed("failed to list instructions")
+	}
+	instructionIDs := make([]primitive.ObjectID, 0, len(instructions))
+	for _, instruction := range instructions {
+		instructionIDs = append(instructionIDs, instruction.ID)
+	}
+	details, err := h.detailRepo.ListByInstructions(instructionIDs)
+	if err != nil {
+		return reply.Failed("failed to list instruction details")
+	}
+
+	byInstruction := make(map[primitive.ObjectID][]InstructionDetail, len(instructions))
+	for _, detail := range details {
+		byInstruction[detail.InstructionID] = append(byInstruction[detail.InstructionID], detail)
+		if detail.Type == "output" && detail.Status == FileStatusDone && detail.FilePath != "" {
+			reply.Files = append(reply.Files, account.ExportFile{
+				Path: detail.InstructionID.Hex() + "/" + filepath.Base(detail.FilePath),
+				Key:  detail.FilePath,
+			})
+		}
+	}
+	for _, instruction := range instructions {
+		item := AccountExportItem{Instruction: instruction, Details: byInstruction[instruction.ID]}
+		if item.Details == nil {
+			item.Details = []InstructionDetail{}
+		}
+		reply.Instructions = append(reply.Instructions, item)
+	}
+
+	return reply.Marshal()
+}
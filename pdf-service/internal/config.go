@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"strings"
+
 	initx "github.com/instrlabs/shared/init"
 	"github.com/joho/godotenv"
 )
@@ -23,8 +25,19 @@ type Config struct {
 	S3UseSSL    bool
 
 	// NATS
-	NatsURI                string
-	NatsSubjectPdfRequests string
+	NatsURI                     string
+	NatsSubjectPdfRequests      string
+	NatsSubjectPdfImages        string
+	NatsSubjectNotificationsSSE string
+
+	NatsSubjectAccountDeleted      string
+	NatsSubjectAccountDeletionDone string
+	NatsSubjectAccountExport       string
+
+	// Service-to-service authentication
+	JWKSURL          string
+	JWKSCacheMinutes int
+	TrustedServices  []string
 
 	// API
 	ApiUrl string
@@ -47,9 +60,30 @@ func LoadConfig() *Config {
 		S3Bucket:    initx.GetEnv("S3_BUCKET", "instrlabs"),
 		S3UseSSL:    initx.GetEnvBool("S3_USE_SSL", false),
 
-		NatsURI:                initx.GetEnv("NATS_URI", "nats://localhost:4222"),
-		NatsSubjectPdfRequests: initx.GetEnv("NATS_SUBJECT_PDF_REQUESTS", "pdf.requests"),
+		NatsURI:                     initx.GetEnv("NATS_URI", "nats://localhost:4222"),
+		NatsSubjectPdfRequests:      initx.GetEnv("NATS_SUBJECT_PDF_REQUESTS", "pdf.requests"),
+		NatsSubjectPdfImages:        initx.GetEnv("NATS_SUBJECT_PDF_IMAGES", "pdf.images"),
+		NatsSubjectNotificationsSSE: initx.GetEnv("NATS_SUBJECT_NOTIFICATIONS_SSE", "notifications.sse"),
+
+		NatsSubjectAccountDeleted:      initx.GetEnv("NATS_SUBJECT_ACCOUNT_DELETED", "accounts.deleted"),
+		NatsSubjectAccountDeletionDone: initx.GetEnv("NATS_SUBJECT_ACCOUNT_DELETION_DONE", "accounts.deletion.completed"),
+		NatsSubjectAccountExport:       initx.GetEnv("NATS_SUBJECT_ACCOUNT_EXPORT", "accounts.export.pdf"),
+
+		JWKSURL:          initx.GetEnv("JWKS_URL", initx.GetEnv("AUTH_SERVICE", "http://auth-service:3000")+"/.well-known/jwks.json"),
+		JWKSCacheMinutes: initx.GetEnvInt("JWKS_CACHE_MINUTES", 10),
+		TrustedServices:  splitList(initx.GetEnv("TRUSTED_SERVICES", "gateway-service")),
 
 		ApiUrl: initx.GetEnv("API_URL", "http://localhost:3000"),
 	}
 }
+
+// splitList parses a comma separated env value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// ImagesHandoff is requested by image-service to turn the images of one of its instructions into a
+// PDF. The images travel in the message, since the services do not share a bucket.
+type ImagesHandoff struct {
+	UserID  string                 `json:"user_id"`
+	OrgID   string                 `json:"org_id,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"` // pdfs/images-to-pdf options
+	Images  []HandoffImage         `json:"images"`
+}
+
+type HandoffImage struct {
+	FileName string `json:"file_name"`
+	Data     []byte `json:"data"`
+}
+
+// ImagesHandoffReply names the images-to-pdf instruction that was created, or why none was
+type ImagesHandoffReply struct {
+	InstructionID string `json:"instruction_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+func (m *ImagesHandoff) validate() error {
+	if m.UserID == "" {
+		return errors.New("user_id is required")
+	}
+	if len(m.Images) == 0 {
+		return errors.New("no images to convert")
+	}
+	for _, img := range m.Images {
+		if !IsSupportedImage(img.Data) {
+			return fmt.Errorf("%s is not a JPEG or PNG file", img.FileName)
+		}
+	}
+	return ValidateOptions(ProductKeyImagesToPDF, m.Options)
+}
+
+// ImagesHandoffMessage creates an images-to-pdf instruction for the user from the images handed over
+// by image-service and queues it like an upload
+func (h *InstructionHandler) ImagesHandoffMessage(data []byte) []byte {
+	reply := func(r ImagesHandoffReply) []byte {
+		out, _ := json.Marshal(r)
+		return out
+	}
+
+	var msg ImagesHandoff
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return reply(ImagesHandoffReply{Error: "invalid message"})
+	}
+	if err := msg.validate(); err != nil {
+		return reply(ImagesHandoffReply{Error: err.Error()})
+	}
+
+	product, err := h.productRepo.FindByKey(ProductKeyImagesToPDF, "pdf")
+	if err != nil || product == nil {
+		return reply(ImagesHandoffReply{Error: "images-to-pdf is not available"})
+	}
+
+	instruction, err := h.instrRepo.Create(&Instruction{
+		UserID:    msg.UserID,
+		OrgID:     msg.OrgID,
+		ProductID: product.ID,
+		Options:   msg.Options,
+	})
+	if err != nil {
+		return reply(ImagesHandoffReply{Error: "failed to create instruction"})
+	}
+
+	uploads := make([]upload, 0, len(msg.Images))
+	for _, img := range msg.Images {
+		uploads = append(uploads, upload{name: img.FileName, mimeType: http.DetectContentType(img.Data), data: img.Data})
+	}
+	if _, err := h.createDetails(instruction, product.Key, uploads); err != nil {
+		return reply(ImagesHandoffReply{Error: err.Error()})
+	}
+
+	log.Printf("ImagesHandoffMessage: queued %d images of user %s as instruction %s", len(uploads), msg.UserID, instruction.ID.Hex())
+	return reply(ImagesHandoffReply{InstructionID: instruction.ID.Hex()})
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImagesHandoff_Validate(t *testing.T) {
+	valid := func() ImagesHandoff {
+		return ImagesHandoff{
+			UserID:  "user-1",
+			Options: map[string]interface{}{"pageSize": "A4", "order": "name"},
+			Images:  []HandoffImage{{FileName: "a.png", Data: testPNG(t, 20, 10)}},
+		}
+	}
+
+	// The images survive the JSON round trip image-service sends them through
+	b, err := json.Marshal(valid())
+	require.NoError(t, err)
+	var msg ImagesHandoff
+	require.NoError(t, json.Unmarshal(b, &msg))
+	assert.NoError(t, msg.validate())
+
+	noUser := valid()
+	noUser.UserID = ""
+	assert.Error(t, noUser.validate())
+
+	noImages := valid()
+	noImages.Images = nil
+	assert.Error(t, noImages.validate())
+
+	notAnImage := valid()
+	notAnImage.Images = append(notAnImage.Images, HandoffImage{FileName: "notes.txt", Data: []byte("hello")})
+	assert.ErrorContains(t, notAnImage.validate(), "notes.txt")
+
+	badOptions := valid()
+	badOptions.Options = map[string]interface{}{"fit": "stretch"}
+	assert.Error(t, badOptions.validate())
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"errors"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type InspectHandler struct {
+	pdfSvc *PDFService
+}
+
+func NewInspectHandler(pdfSvc *PDFService) *InspectHandler {
+	return &InspectHandler{
+		pdfSvc: pdfSvc,
+	}
+}
+
+// InspectFile reports properties, bookmarks and layout of an uploaded PDF without storing it
+func (h *InspectHandler) InspectFile(c *fiber.Ctx) error {
+	b, err := readUploadedFile(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "File upload required",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+
+	info, err := h.pdfSvc.Inspect(b)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid PDF file",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"errors":  nil,
+		"data":    info,
+	})
+}
+
+// ListFormFields returns the form fields of an uploaded PDF as a JSON schema
+func (h *InspectHandler) ListFormFields(c *fiber.Ctx) error {
+	b, err := readUploadedFile(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "File upload required",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+
+	schema, err := h.pdfSvc.FormFields(b)
+	if errors.Is(err, ErrNoFormFields) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "PDF has no form fields",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid PDF file",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"errors":  nil,
+		"data":    schema,
+	})
+}
+
+func readUploadedFile(c *fiber.Ctx) ([]byte, error) {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
@@ -1,31 +1,59 @@
 package internal
 
 import (
+	"encoding/json"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Instruction struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	UserID    string             `json:"userId" bson:"userId"`
-	ProductID primitive.ObjectID `json:"productId" bson:"productId"`
-	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
-	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ID        primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	UserID    string                 `json:"userId" bson:"userId"`
+	OrgID     string                 `json:"orgId,omitempty" bson:"orgId,omitempty"` // Set when created in an organization workspace
+	ProductID primitive.ObjectID     `json:"productId" bson:"productId"`
+	Options   map[string]interface{} `json:"options,omitempty" bson:"options,omitempty"` // Product-specific processing options
+	CreatedAt time.Time              `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time              `json:"updatedAt" bson:"updatedAt"`
+}
+
+// AccessibleBy reports whether a user acting in orgID, empty for the personal workspace, may use
+// the instruction. Organization instructions are shared by its members; personal ones are not
+// visible from an organization, even to their owner.
+func (i *Instruction) AccessibleBy(userID string, orgID string) bool {
+	if orgID != "" {
+		return i.OrgID == orgID
+	}
+	return i.OrgID == "" && i.UserID == userID
+}
+
+// DecodeOptions decodes the instruction options into the product-specific options struct
+func (i *Instruction) DecodeOptions(v interface{}) error {
+	if len(i.Options) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(i.Options)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
 }
 
 type InstructionDetail struct {
-	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
-	InstructionID primitive.ObjectID  `json:"-" bson:"instructionId"`
-	FileName      string              `json:"fileName" bson:"fileName"`
-	FileSize      int64               `json:"fileSize" bson:"fileSize"`
-	Status        FileStatus          `json:"status" bson:"status"`
-	Type          string              `json:"type" bson:"type"`            // "input" or "output"
-	InputID       *primitive.ObjectID `json:"-" bson:"inputId,omitempty"`  // Links output to input
-	OutputID      *primitive.ObjectID `json:"-" bson:"outputId,omitempty"` // Links input to output
-	FilePath      string              `json:"filePath" bson:"filePath"`    // S3 file path
-	CreatedAt     time.Time           `json:"createdAt" bson:"createdAt"`
-	UpdatedAt     time.Time           `json:"updatedAt" bson:"updatedAt"`
+	ID            primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	InstructionID primitive.ObjectID   `json:"-" bson:"instructionId"`
+	FileName      string               `json:"fileName" bson:"fileName"`
+	FileSize      int64                `json:"fileSize" bson:"fileSize"`
+	MimeType      string               `json:"mimeType" bson:"mimeType"`
+	Status        FileStatus           `json:"status" bson:"status"`
+	Type          string               `json:"type" bson:"type"`                         // "input" or "output"
+	InputID       *primitive.ObjectID  `json:"-" bson:"inputId,omitempty"`               // Links output to input
+	InputIDs      []primitive.ObjectID `json:"-" bson:"inputIds,omitempty"`              // Links output to all inputs of a multi-input product
+	OutputID      *primitive.ObjectID  `json:"-" bson:"outputId,omitempty"`              // Links input to output
+	FilePath      string               `json:"filePath" bson:"filePath"`                 // S3 file path
+	Report        *CompressReport      `json:"report,omitempty" bson:"report,omitempty"` // Set on compress outputs once done
+	CreatedAt     time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time            `json:"updatedAt" bson:"updatedAt"`
 }
 
 type FileStatus string
@@ -27,7 +27,10 @@ func (r *InstructionDetailRepository) CreateMany(details []InstructionDetail) ([
 
 	docs := make([]interface{}, len(details))
 	for i := range details {
-		details[i].ID = primitive.NewObjectID()
+		// Keep pre-assigned IDs so input/output links stay valid
+		if details[i].ID.IsZero() {
+			details[i].ID = primitive.NewObjectID()
+		}
 		details[i].CreatedAt = time.Now()
 		details[i].UpdatedAt = time.Now()
 		docs[i] = details[i]
@@ -59,6 +62,39 @@ func (r *InstructionDetailRepository) GetByID(id primitive.ObjectID) (*Instructi
 	return &detail, nil
 }
 
+// ListByIDs returns the details for the given IDs in the same order as ids
+func (r *InstructionDetailRepository) ListByIDs(ids []primitive.ObjectID) ([]InstructionDetail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		log.Printf("Failed to list instruction details by IDs: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []InstructionDetail
+	if err := cursor.All(ctx, &found); err != nil {
+		log.Printf("Failed to decode instruction details: %v", err)
+		return nil, err
+	}
+
+	byID := make(map[primitive.ObjectID]InstructionDetail, len(found))
+	for _, d := range found {
+		byID[d.ID] = d
+	}
+
+	details := make([]InstructionDetail, 0, len(ids))
+	for _, id := range ids {
+		if d, ok := byID[id]; ok {
+			details = append(details, d)
+		}
+	}
+
+	return details, nil
+}
+
 func (r *InstructionDetailRepository) ListByInstruction(instructionID primitive.ObjectID) ([]InstructionDetail, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -120,6 +156,26 @@ func (r *InstructionDetailRepository) UpdateStatusAndSize(id primitive.ObjectID,
 	return nil
 }
 
+func (r *InstructionDetailRepository) UpdateReport(id primitive.ObjectID, report *CompressReport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"report":    report,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		log.Printf("Failed to update report for instruction detail %s: %v", id.Hex(), err)
+		return err
+	}
+
+	return nil
+}
+
 func (r *InstructionDetailRepository) ListOlderThan(olderThan time.Time) ([]InstructionDetail, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -225,3 +281,44 @@ func (r *InstructionDetailRepository) ListUncleaned() ([]InstructionDetail, erro
 
 	return details, nil
 }
+
+func (r *InstructionDetailRepository) ListByInstructions(instructionIDs []primitive.ObjectID) ([]InstructionDetail, error) {
+	if len(instructionIDs) == 0 {
+		return []InstructionDetail{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"instructionId": bson.M{"$in": instructionIDs}})
+	if err != nil {
+		log.Printf("Failed to list instruction details for %d instructions: %v", len(instructionIDs), err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	details := []InstructionDetail{}
+	if err := cursor.All(ctx, &details); err != nil {
+		log.Printf("Failed to decode instruction details: %v", err)
+		return nil, err
+	}
+
+	return details, nil
+}
+
+func (r *InstructionDetailRepository) DeleteByInstructions(instructionIDs []primitive.ObjectID) error {
+	if len(instructionIDs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteMany(ctx, bson.M{"instructionId": bson.M{"$in": instructionIDs}})
+	if err != nil {
+		log.Printf("Failed to delete instruction details for %d instructions: %v", len(instructionIDs), err)
+		return err
+	}
+
+	return nil
+}
@@ -1,10 +1,15 @@
 package internal
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -44,7 +49,8 @@ func NewInstructionHandler(
 
 func (h *InstructionHandler) CreateInstruction(c *fiber.Ctx) error {
 	var req struct {
-		ProductID string `json:"productId"`
+		ProductID string                 `json:"productId"`
+		Options   map[string]interface{} `json:"options"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -74,10 +80,20 @@ func (h *InstructionHandler) CreateInstruction(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := ValidateOptions(product.Key, req.Options); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid options",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+
 	userID := c.Locals("userId").(string)
 	instruction := &Instruction{
 		UserID:    userID,
+		OrgID:     c.Get("x-org-id"),
 		ProductID: productID,
+		Options:   req.Options,
 	}
 
 	createdInstruction, err := h.instrRepo.Create(instruction)
@@ -117,8 +133,7 @@ func (h *InstructionHandler) CreateInstructionDetails(c *fiber.Ctx) error {
 		})
 	}
 
-	localUserID := c.Locals("userId").(string)
-	if instruction.UserID != localUserID {
+	if !canAccess(c, instruction) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"message": "Access denied",
 			"errors":  nil,
@@ -126,96 +141,194 @@ func (h *InstructionHandler) CreateInstructionDetails(c *fiber.Ctx) error {
 		})
 	}
 
-	fh, err := c.FormFile("file")
-	if err != nil || fh == nil {
+	product, err := h.productRepo.FindByID(instruction.ProductID, "pdf")
+	if err != nil || product == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Product not found",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["file"]) == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "File upload required",
-			"errors":  err.Error(),
+			"errors":  nil,
 			"data":    nil,
 		})
 	}
 
-	// Read file
-	f, _ := fh.Open()
-	b, _ := io.ReadAll(f)
-	_ = f.Close()
+	// Only multi-input products take more than one file per request
+	fileHeaders := form.File["file"]
+	if product.Key != ProductKeyImagesToPDF {
+		fileHeaders = fileHeaders[:1]
+	}
 
-	// Validate PDF file
-	if err := h.pdfSvc.Validate(b); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid PDF file",
+	// Fill-form optionally takes a CSV data file, producing one filled PDF per row
+	if product.Key == ProductKeyFillForm && len(form.File["data"]) > 0 {
+		fileHeaders = append(fileHeaders, form.File["data"][0])
+	}
+
+	uploads := make([]upload, 0, len(fileHeaders))
+	for i, fh := range fileHeaders {
+		f, err := fh.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Failed to read uploaded file",
+				"errors":  err.Error(),
+				"data":    nil,
+			})
+		}
+		b, _ := io.ReadAll(f)
+		_ = f.Close()
+
+		if product.Key == ProductKeyImagesToPDF {
+			if !IsSupportedImage(b) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"message": "Invalid image file",
+					"errors":  fh.Filename + " is not a JPEG or PNG file",
+					"data":    nil,
+				})
+			}
+		} else if i > 0 {
+			if !strings.HasPrefix(http.DetectContentType(b), "text/plain") {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"message": "Invalid data file",
+					"errors":  fh.Filename + " is not a CSV file",
+					"data":    nil,
+				})
+			}
+		} else if err := h.pdfSvc.Validate(b); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid PDF file",
+				"errors":  err.Error(),
+				"data":    nil,
+			})
+		}
+
+		uploads = append(uploads, upload{name: fh.Filename, mimeType: http.DetectContentType(b), data: b})
+	}
+
+	createdDetails, err := h.createDetails(instruction, product.Key, uploads)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to upload file",
 			"errors":  err.Error(),
 			"data":    nil,
 		})
 	}
 
-	inputID := primitive.NewObjectID()
-	outputID := primitive.NewObjectID()
-	ext := filepath.Ext(fh.Filename)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "File uploaded successfully",
+		"errors":  nil,
+		"data":    createdDetails,
+	})
+}
 
-	inName := "pdfs/" + inputID.Hex() + "_input" + ext
-	outName := "pdfs/" + outputID.Hex() + "_output" + ext
+// upload is a file added to an instruction, read and checked but not stored yet
+type upload struct {
+	name     string
+	mimeType string
+	data     []byte
+}
+
+// createDetails stores the uploads as inputs of a new output of the instruction and queues the output
+// for processing
+func (h *InstructionHandler) createDetails(instruction *Instruction, productKey string, uploads []upload) ([]InstructionDetail, error) {
+	outputID := primitive.NewObjectID()
+	outFileName, outExt, outMimeType := outputFileFor(productKey, uploads[0].name, len(uploads))
+	outName := "pdfs/" + outputID.Hex() + "_output" + outExt
 
 	now := time.Now().UTC()
-	input := &InstructionDetail{
-		ID:            inputID,
-		InstructionID: instruction.ID,
-		FileName:      fh.Filename,
-		FileSize:      int64(len(b)),
-		Status:        FileStatusDone,
-		Type:          "input",
-		FilePath:      inName,
-		InputID:       nil,
-		OutputID:      &outputID,
-		CreatedAt:     now,
-		UpdatedAt:     now,
+	details := make([]InstructionDetail, 0, len(uploads)+1)
+	inputIDs := make([]primitive.ObjectID, 0, len(uploads))
+	for _, u := range uploads {
+		inputID := primitive.NewObjectID()
+		inName := "pdfs/" + inputID.Hex() + "_input" + filepath.Ext(u.name)
+
+		// Upload input file to S3
+		if err := h.s3.Put(inName, u.data); err != nil {
+			log.Printf("Failed to upload file to S3: %v", err)
+			return nil, fmt.Errorf("failed to upload file: %w", err)
+		}
+
+		inputIDs = append(inputIDs, inputID)
+		details = append(details, InstructionDetail{
+			ID:            inputID,
+			InstructionID: instruction.ID,
+			FileName:      u.name,
+			FileSize:      int64(len(u.data)),
+			MimeType:      u.mimeType,
+			Status:        FileStatusDone,
+			Type:          "input",
+			FilePath:      inName,
+			InputID:       nil,
+			OutputID:      &outputID,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
 	}
 
-	output := &InstructionDetail{
+	output := InstructionDetail{
 		ID:            outputID,
 		InstructionID: instruction.ID,
-		FileName:      "compressed_" + fh.Filename,
+		FileName:      outFileName,
 		FileSize:      0,
+		MimeType:      outMimeType,
 		Status:        FileStatusPending,
 		Type:          "output",
 		FilePath:      outName,
-		InputID:       &inputID,
+		InputID:       &inputIDs[0],
 		OutputID:      nil,
 		CreatedAt:     now,
 		UpdatedAt:     now,
 	}
-
-	// Upload input file to S3
-	if err := h.s3.Put(inName, b); err != nil {
-		log.Printf("Failed to upload file to S3: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to upload file",
-			"errors":  err.Error(),
-			"data":    nil,
-		})
+	if len(inputIDs) > 1 {
+		output.InputIDs = inputIDs
 	}
+	details = append(details, output)
 
 	// Create details
-	details := []InstructionDetail{*input, *output}
 	createdDetails, err := h.detailRepo.CreateMany(details)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to create instruction details",
-			"errors":  err.Error(),
-			"data":    nil,
-		})
+		return nil, fmt.Errorf("failed to create instruction details: %w", err)
 	}
 
 	// Publish NATS message for processing
-	if err := h.nats.Conn.Publish(h.cfg.NatsSubjectPdfRequests, []byte(inputID.Hex())); err != nil {
+	if err := h.nats.Conn.Publish(h.cfg.NatsSubjectPdfRequests, []byte(inputIDs[0].Hex())); err != nil {
 		log.Printf("Failed to publish NATS message: %v", err)
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "File uploaded successfully",
-		"errors":  nil,
-		"data":    createdDetails,
-	})
+	return createdDetails, nil
+}
+
+// outputFileFor returns the output file name, extension and mime type for a product
+func outputFileFor(productKey, inputName string, inputCount int) (string, string, string) {
+	ext := filepath.Ext(inputName)
+	base := strings.TrimSuffix(inputName, ext)
+
+	switch productKey {
+	case ProductKeyImagesToPDF:
+		return base + ".pdf", ".pdf", "application/pdf"
+	case ProductKeyPDFToImages:
+		return base + "_images.zip", ".zip", "application/zip"
+	case ProductKeyEditMetadata:
+		return inputName, ext, "application/pdf"
+	case ProductKeyFillForm:
+		if inputCount > 1 {
+			return base + "_filled.zip", ".zip", "application/zip"
+		}
+		return base + "_filled.pdf", ".pdf", "application/pdf"
+	case ProductKeyNUp:
+		return base + "_nup.pdf", ".pdf", "application/pdf"
+	case ProductKeyBooklet:
+		return base + "_booklet.pdf", ".pdf", "application/pdf"
+	case ProductKeyResize:
+		return base + "_resized.pdf", ".pdf", "application/pdf"
+	default:
+		return "compressed_" + inputName, ext, "application/pdf"
+	}
 }
 
 func (h *InstructionHandler) ListInstructions(c *fiber.Ctx) error {
@@ -227,7 +340,7 @@ func (h *InstructionHandler) ListInstructions(c *fiber.Ctx) error {
 		limit = 10
 	}
 
-	instructions, err := h.instrRepo.ListLatest(userID, limit)
+	instructions, err := h.instrRepo.ListLatest(userID, c.Get("x-org-id"), limit)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to fetch instructions",
@@ -263,8 +376,7 @@ func (h *InstructionHandler) GetInstructionByID(c *fiber.Ctx) error {
 		})
 	}
 
-	localUserID := c.Locals("userId").(string)
-	if instruction.UserID != localUserID {
+	if !canAccess(c, instruction) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"message": "Access denied",
 			"errors":  nil,
@@ -296,10 +408,239 @@ func (h *InstructionHandler) ListUncleanedFiles(c *fiber.Ctx) error {
 	})
 }
 
-// Minimal implementation for other methods to compile
 func (h *InstructionHandler) RunInstructionMessage(data []byte) {
-	// TODO: Implement PDF processing logic
-	log.Printf("Received message: %s", string(data))
+	inputIDHex := strings.TrimSpace(string(data))
+	inputID, err := primitive.ObjectIDFromHex(inputIDHex)
+	if err != nil {
+		log.Printf("RunInstructionMessage: invalid file id %q: %v", inputIDHex, err)
+		return
+	}
+
+	// 1. Find input and output details
+	input, err := h.detailRepo.GetByID(inputID)
+	if err != nil || input == nil || input.OutputID == nil {
+		log.Printf("RunInstructionMessage: input file not found: %s", inputIDHex)
+		return
+	}
+
+	output, err := h.detailRepo.GetByID(*input.OutputID)
+	if err != nil || output == nil {
+		log.Printf("RunInstructionMessage: output file not found for input %s", inputIDHex)
+		return
+	}
+
+	// 2. Find instruction and product
+	instruction, err := h.instrRepo.GetByID(input.InstructionID)
+	if err != nil || instruction == nil {
+		log.Printf("RunInstructionMessage: instruction not found: %s", input.InstructionID.Hex())
+		_ = h.detailRepo.UpdateStatus(output.ID, FileStatusFailed)
+		return
+	}
+
+	product, err := h.productRepo.FindByID(instruction.ProductID, "pdf")
+	if err != nil || product == nil {
+		log.Printf("RunInstructionMessage: product not found: %s", instruction.ProductID.Hex())
+		h.failOutput(instruction, output)
+		return
+	}
+
+	// 3. Collect all inputs of the output, in upload order
+	inputs := []InstructionDetail{*input}
+	if len(output.InputIDs) > 0 {
+		inputs, err = h.detailRepo.ListByIDs(output.InputIDs)
+		if err != nil || len(inputs) != len(output.InputIDs) {
+			log.Printf("RunInstructionMessage: inputs missing for output %s", output.ID.Hex())
+			h.failOutput(instruction, output)
+			return
+		}
+	}
+
+	_ = h.detailRepo.UpdateStatus(output.ID, FileStatusProcessing)
+	h.publishFileNotification(instruction, output, FileStatusProcessing)
+
+	// 4. Process based on product key
+	outputBytes, err := h.process(product.Key, instruction, inputs, output)
+	if err != nil {
+		log.Printf("RunInstructionMessage: %s failed for output %s: %v", product.Key, output.ID.Hex(), err)
+		h.failOutput(instruction, output)
+		return
+	}
+
+	// 5. Upload output to S3
+	if err := h.s3.Put(output.FilePath, outputBytes); err != nil {
+		log.Printf("RunInstructionMessage: failed to upload output to S3: %v", err)
+		h.failOutput(instruction, output)
+		return
+	}
+
+	if output.Report != nil {
+		_ = h.detailRepo.UpdateReport(output.ID, output.Report)
+	}
+	_ = h.detailRepo.UpdateStatusAndSize(output.ID, FileStatusDone, int64(len(outputBytes)))
+	h.publishFileNotification(instruction, output, FileStatusDone)
+}
+
+// process runs the product on the inputs. Products that report on their work attach it to output.
+func (h *InstructionHandler) process(productKey string, instruction *Instruction, inputs []InstructionDetail, output *InstructionDetail) ([]byte, error) {
+	switch productKey {
+	case ProductKeyCompress:
+		var opts CompressOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+		file, err := h.loadInput(inputs[0])
+		if err != nil {
+			return nil, err
+		}
+		compressed, report, err := h.pdfSvc.Compress(file, opts)
+		if err != nil {
+			return nil, err
+		}
+		output.Report = report
+		return compressed, nil
+
+	case ProductKeyImagesToPDF:
+		var opts ImagesToPDFOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+		if err := orderInputs(inputs, opts.Order); err != nil {
+			return nil, err
+		}
+		images := make([][]byte, 0, len(inputs))
+		for _, in := range inputs {
+			file, err := h.loadInput(in)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, file)
+		}
+		return h.pdfSvc.ImagesToPDF(images, opts)
+
+	case ProductKeyPDFToImages:
+		var opts PDFToImagesOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+		file, err := h.loadInput(inputs[0])
+		if err != nil {
+			return nil, err
+		}
+		return h.pdfSvc.PDFToImages(file, opts)
+
+	case ProductKeyEditMetadata:
+		var opts EditMetadataOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+		file, err := h.loadInput(inputs[0])
+		if err != nil {
+			return nil, err
+		}
+		return h.pdfSvc.EditMetadata(file, opts)
+
+	case ProductKeyFillForm:
+		var opts FillFormOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+		file, err := h.loadInput(inputs[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(inputs) > 1 {
+			data, err := h.loadInput(inputs[1])
+			if err != nil {
+				return nil, err
+			}
+			return h.pdfSvc.FillFormCSV(file, data, opts.Flatten)
+		}
+		return h.pdfSvc.FillForm(file, opts)
+
+	case ProductKeyNUp:
+		var opts NUpOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+		file, err := h.loadInput(inputs[0])
+		if err != nil {
+			return nil, err
+		}
+		return h.pdfSvc.NUp(file, opts)
+
+	case ProductKeyBooklet:
+		var opts BookletOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+		file, err := h.loadInput(inputs[0])
+		if err != nil {
+			return nil, err
+		}
+		return h.pdfSvc.Booklet(file, opts)
+
+	case ProductKeyResize:
+		var opts ResizeOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+		file, err := h.loadInput(inputs[0])
+		if err != nil {
+			return nil, err
+		}
+		return h.pdfSvc.Resize(file, opts)
+
+	default:
+		return nil, fmt.Errorf("unsupported product key: %s", productKey)
+	}
+}
+
+func (h *InstructionHandler) loadInput(input InstructionDetail) ([]byte, error) {
+	b := h.s3.Get(input.FilePath)
+	if b == nil {
+		return nil, fmt.Errorf("input file missing on S3: %s", input.FilePath)
+	}
+	return b, nil
+}
+
+// orderInputs sorts inputs in place according to the requested page order
+func orderInputs(inputs []InstructionDetail, order string) error {
+	switch order {
+	case "", "upload":
+	case "name":
+		sort.SliceStable(inputs, func(i, j int) bool { return inputs[i].FileName < inputs[j].FileName })
+	case "reverse":
+		for i, j := 0, len(inputs)-1; i < j; i, j = i+1, j-1 {
+			inputs[i], inputs[j] = inputs[j], inputs[i]
+		}
+	default:
+		return fmt.Errorf("unsupported order %q", order)
+	}
+	return nil
+}
+
+func (h *InstructionHandler) failOutput(instruction *Instruction, output *InstructionDetail) {
+	_ = h.detailRepo.UpdateStatus(output.ID, FileStatusFailed)
+	h.publishFileNotification(instruction, output, FileStatusFailed)
+}
+
+func (h *InstructionHandler) publishFileNotification(instruction *Instruction, detail *InstructionDetail, status FileStatus) {
+	n := InstructionNotification{
+		UserID:              instruction.UserID,
+		InstructionID:       instruction.ID,
+		InstructionDetailID: detail.ID,
+		Status:              status,
+		Type:                detail.Type,
+		CreatedAt:           time.Now().UTC(),
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		log.Printf("publishFileNotification: marshal error: %v", err)
+		return
+	}
+	if err := h.nats.Conn.Publish(h.cfg.NatsSubjectNotificationsSSE, b); err != nil {
+		log.Printf("publishFileNotification: publish error: %v", err)
+	}
 }
 
 func (h *InstructionHandler) CleanInstruction() error {
@@ -307,14 +648,118 @@ func (h *InstructionHandler) CleanInstruction() error {
 	return nil
 }
 
+// canAccess checks the instruction against the user and the organization the gateway forwards in x-org-id
+func canAccess(c *fiber.Ctx, instruction *Instruction) bool {
+	localUserID, _ := c.Locals("userId").(string)
+	return instruction.AccessibleBy(localUserID, c.Get("x-org-id"))
+}
+
+// ownedInstruction loads the instruction from the :id param and checks the caller may use it
+func (h *InstructionHandler) ownedInstruction(c *fiber.Ctx) (*Instruction, int, string) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, fiber.StatusBadRequest, "Invalid instruction ID"
+	}
+
+	instruction, err := h.instrRepo.GetByID(id)
+	if err != nil || instruction == nil {
+		return nil, fiber.StatusNotFound, "Instruction not found"
+	}
+
+	if !canAccess(c, instruction) {
+		return nil, fiber.StatusForbidden, "Access denied"
+	}
+
+	return instruction, fiber.StatusOK, ""
+}
+
+// ownedDetail loads the detail from the :detailId param and checks it belongs to the caller's instruction
+func (h *InstructionHandler) ownedDetail(c *fiber.Ctx) (*InstructionDetail, int, string) {
+	instruction, status, message := h.ownedInstruction(c)
+	if instruction == nil {
+		return nil, status, message
+	}
+
+	detailID, err := primitive.ObjectIDFromHex(c.Params("detailId"))
+	if err != nil {
+		return nil, fiber.StatusBadRequest, "Invalid detail ID"
+	}
+
+	detail, err := h.detailRepo.GetByID(detailID)
+	if err != nil || detail == nil || detail.InstructionID != instruction.ID {
+		return nil, fiber.StatusNotFound, "Instruction detail not found"
+	}
+
+	return detail, fiber.StatusOK, ""
+}
+
 func (h *InstructionHandler) GetInstructionDetails(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{"message": "Not implemented yet"})
+	instruction, status, message := h.ownedInstruction(c)
+	if instruction == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"message": message,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	details, err := h.detailRepo.ListByInstruction(instruction.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch instruction details",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"errors":  nil,
+		"data":    details,
+	})
 }
 
 func (h *InstructionHandler) GetInstructionDetail(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{"message": "Not implemented yet"})
+	detail, status, message := h.ownedDetail(c)
+	if detail == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"message": message,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"errors":  nil,
+		"data":    detail,
+	})
 }
 
 func (h *InstructionHandler) GetInstructionDetailFile(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{"message": "Not implemented yet"})
+	detail, status, message := h.ownedDetail(c)
+	if detail == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"message": message,
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	b := h.s3.Get(detail.FilePath)
+	if b == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "File not found",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	contentType := detail.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Attachment(detail.FileName)
+	c.Set("content-type", contentType)
+	return c.Status(fiber.StatusOK).Send(b)
 }
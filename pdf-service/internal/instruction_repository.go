@@ -56,7 +56,8 @@ func (r *InstructionRepository) GetByID(id primitive.ObjectID) (*Instruction, er
 	return &instruction, nil
 }
 
-func (r *InstructionRepository) ListLatest(userID string, limit int64) ([]Instruction, error) {
+// ListLatest lists the latest instructions of an organization, or the personal ones of the user when orgID is empty
+func (r *InstructionRepository) ListLatest(userID string, orgID string, limit int64) ([]Instruction, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -64,7 +65,11 @@ func (r *InstructionRepository) ListLatest(userID string, limit int64) ([]Instru
 	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}})
 	findOptions.SetLimit(limit)
 
-	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID}, findOptions)
+	filter := personalInstructions(userID)
+	if orgID != "" {
+		filter = bson.M{"orgId": orgID}
+	}
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
 	if err != nil {
 		log.Printf("Failed to list instructions for user %s: %v", userID, err)
 		return nil, err
@@ -79,3 +84,43 @@ func (r *InstructionRepository) ListLatest(userID string, limit int64) ([]Instru
 
 	return instructions, nil
 }
+
+// ListByUser lists the personal instructions of a user. Instructions created in an organization belong to it.
+func (r *InstructionRepository) ListByUser(userID string) ([]Instruction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := r.collection.Find(ctx, personalInstructions(userID), findOptions)
+	if err != nil {
+		log.Printf("Failed to list instructions for user %s: %v", userID, err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	instructions := []Instruction{}
+	if err := cursor.All(ctx, &instructions); err != nil {
+		log.Printf("Failed to decode instructions: %v", err)
+		return nil, err
+	}
+
+	return instructions, nil
+}
+
+// DeleteByUser deletes the personal instructions of a user
+func (r *InstructionRepository) DeleteByUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteMany(ctx, personalInstructions(userID))
+	if err != nil {
+		log.Printf("Failed to delete instructions for user %s: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+func personalInstructions(userID string) bson.M {
+	return bson.M{"userId": userID, "orgId": bson.M{"$exists": false}}
+}
@@ -0,0 +1,20 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstruction_AccessibleBy(t *testing.T) {
+	personal := &Instruction{UserID: "owner"}
+	assert.True(t, personal.AccessibleBy("owner", ""))
+	assert.False(t, personal.AccessibleBy("teammate", ""))
+	assert.False(t, personal.AccessibleBy("owner", "org-1"), "personal instructions stay out of organization workspaces")
+
+	shared := &Instruction{UserID: "owner", OrgID: "org-1"}
+	assert.True(t, shared.AccessibleBy("owner", "org-1"))
+	assert.True(t, shared.AccessibleBy("teammate", "org-1"))
+	assert.False(t, shared.AccessibleBy("teammate", "org-2"))
+	assert.False(t, shared.AccessibleBy("owner", ""), "organization instructions are not listed as personal ones")
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// ValidateOptions checks the options of an instruction for the product before it is created, so bad
+// options are rejected up front instead of failing every file uploaded to the instruction
+func ValidateOptions(productKey string, options map[string]interface{}) error {
+	instruction := &Instruction{Options: options}
+
+	switch productKey {
+	case ProductKeyCompress:
+		var opts CompressOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return err
+		}
+		if _, err := compressLevel(opts); err != nil {
+			return err
+		}
+		if opts.MaxImageSize < 0 {
+			return fmt.Errorf("maxImageSize must not be negative")
+		}
+		if opts.JPEGQuality < 0 || opts.JPEGQuality > 100 {
+			return fmt.Errorf("jpegQuality must be between 1 and 100")
+		}
+		return nil
+
+	case ProductKeyImagesToPDF:
+		var opts ImagesToPDFOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return err
+		}
+		if _, err := importConfig(opts); err != nil {
+			return err
+		}
+		return orderInputs(nil, opts.Order)
+
+	case ProductKeyPDFToImages:
+		var opts PDFToImagesOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return err
+		}
+		return validatePages(opts.Pages)
+
+	case ProductKeyEditMetadata:
+		var opts EditMetadataOptions
+		return instruction.DecodeOptions(&opts)
+
+	case ProductKeyFillForm:
+		var opts FillFormOptions
+		return instruction.DecodeOptions(&opts)
+
+	case ProductKeyNUp:
+		var opts NUpOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return err
+		}
+		if _, err := nUpConfig(opts); err != nil {
+			return err
+		}
+		return validatePages(opts.Pages)
+
+	case ProductKeyBooklet:
+		var opts BookletOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return err
+		}
+		if _, err := bookletConfig(opts); err != nil {
+			return err
+		}
+		return validatePages(opts.Pages)
+
+	case ProductKeyResize:
+		var opts ResizeOptions
+		if err := instruction.DecodeOptions(&opts); err != nil {
+			return err
+		}
+		if _, err := resizeConfig(opts); err != nil {
+			return err
+		}
+		return validatePages(opts.Pages)
+	}
+
+	return nil
+}
+
+// validatePages checks the syntax of a pdfcpu page selection
+func validatePages(pages []string) error {
+	if _, err := api.ParsePageSelection(strings.Join(pages, ",")); err != nil {
+		return fmt.Errorf("invalid page selection %q", strings.Join(pages, ","))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOptions(t *testing.T) {
+	valid := map[string]map[string]interface{}{
+		ProductKeyCompress:    {"level": "aggressive", "jpegQuality": 80},
+		ProductKeyImagesToPDF: {"pageSize": "Letter", "margin": 36, "fit": "fill", "order": "name"},
+		ProductKeyPDFToImages: {"pages": []interface{}{"1-3", "5"}},
+		ProductKeyNUp:         {"n": 9},
+		ProductKeyBooklet:     {"n": 4, "binding": "short"},
+		ProductKeyResize:      {"scale": 0.5},
+	}
+	for key, options := range valid {
+		assert.NoError(t, ValidateOptions(key, options), key)
+	}
+	assert.NoError(t, ValidateOptions(ProductKeyImagesToPDF, nil), "defaults apply without options")
+
+	invalid := map[string]map[string]interface{}{
+		"unknown level":     {"level": "extreme"},
+		"bad page size":     {"pageSize": "Napkin"},
+		"oversized margin":  {"margin": 500},
+		"negative margin":   {"margin": -1},
+		"unknown fit":       {"fit": "stretch"},
+		"unknown order":     {"order": "random"},
+		"wrong option type": {"margin": "wide"},
+	}
+	for name, options := range invalid {
+		key := ProductKeyImagesToPDF
+		if name == "unknown level" {
+			key = ProductKeyCompress
+		}
+		assert.Error(t, ValidateOptions(key, options), name)
+	}
+
+	assert.Error(t, ValidateOptions(ProductKeyPDFToImages, map[string]interface{}{"pages": []interface{}{"first"}}))
+	assert.Error(t, ValidateOptions(ProductKeyNUp, map[string]interface{}{"n": 3}))
+	assert.Error(t, ValidateOptions(ProductKeyResize, map[string]interface{}{}))
+}
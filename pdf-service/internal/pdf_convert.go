@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// ImagesToPDFOptions controls how uploaded images are laid out as PDF pages
+type ImagesToPDFOptions struct {
+	PageSize string  `json:"pageSize"` // A4 (default), Letter, Legal, A3, A5, ...
+	Margin   float64 `json:"margin"`   // Margin in points kept free on every side
+	Fit      string  `json:"fit"`      // "contain" (default), "fill" or "original"
+	Order    string  `json:"order"`    // "upload" (default), "name" or "reverse"
+}
+
+// PDFToImagesOptions controls which images are taken out of a PDF
+type PDFToImagesOptions struct {
+	Pages []string `json:"pages"` // pdfcpu page selection, e.g. ["1-3", "5"]; all pages when empty
+}
+
+// IsSupportedImage reports whether the file is an image that can be placed on a PDF page
+func IsSupportedImage(file []byte) bool {
+	switch http.DetectContentType(file) {
+	case "image/jpeg", "image/png":
+		return true
+	}
+	return false
+}
+
+// ImagesToPDF places every image on its own page, in the given order, and returns a single PDF
+func (s *PDFService) ImagesToPDF(images [][]byte, opts ImagesToPDFOptions) ([]byte, error) {
+	if len(images) == 0 {
+		return nil, errors.New("no images to convert")
+	}
+
+	imp, err := importConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make([]io.Reader, 0, len(images))
+	for i, img := range images {
+		if !IsSupportedImage(img) {
+			return nil, fmt.Errorf("image %d is not a JPEG or PNG file", i+1)
+		}
+		readers = append(readers, bytes.NewReader(img))
+	}
+
+	var buf bytes.Buffer
+	if err := api.ImportImages(nil, &buf, readers, imp, nil); err != nil {
+		return nil, fmt.Errorf("failed to convert images to PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// PDFToImages extracts the embedded images of a PDF into a ZIP archive
+func (s *PDFService) PDFToImages(file []byte, opts PDFToImagesOptions) ([]byte, error) {
+	if err := s.Validate(file); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	count := 0
+
+	digest := func(img model.Image, _ bool, maxPageDigits int) error {
+		name := fmt.Sprintf("page_%0*d_%s.%s", maxPageDigits, img.PageNr, img.Name, img.FileType)
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, img); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+
+	if err := api.ExtractImages(bytes.NewReader(file), opts.Pages, digest, nil); err != nil {
+		return nil, fmt.Errorf("failed to extract images: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if count == 0 {
+		return nil, errors.New("PDF does not contain any embedded images")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func importConfig(opts ImagesToPDFOptions) (*pdfcpu.Import, error) {
+	pageSize := opts.PageSize
+	if pageSize == "" {
+		pageSize = "A4"
+	}
+
+	dim, ok := types.PaperSize[pageSize]
+	if !ok {
+		return nil, fmt.Errorf("unsupported page size %q", pageSize)
+	}
+
+	shortSide := dim.Width
+	if dim.Height < shortSide {
+		shortSide = dim.Height
+	}
+	if opts.Margin < 0 || opts.Margin*2 >= shortSide {
+		return nil, fmt.Errorf("margin %.1f does not fit on page size %s", opts.Margin, pageSize)
+	}
+
+	imp := pdfcpu.DefaultImportConfig()
+	imp.PageSize = pageSize
+	imp.PageDim = dim
+	imp.UserDim = true
+
+	switch strings.ToLower(opts.Fit) {
+	case "", "contain":
+		imp.Pos = types.Center
+		imp.Scale = (shortSide - 2*opts.Margin) / shortSide
+	case "fill":
+		imp.Pos = types.Full
+	case "original":
+		imp.Pos = types.Center
+		imp.Scale = 1
+		imp.ScaleAbs = true
+	default:
+		return nil, fmt.Errorf("unsupported fit mode %q", opts.Fit)
+	}
+
+	return imp, nil
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestPDFService_ImagesToPDF(t *testing.T) {
+	service := NewPDFService()
+	images := [][]byte{testPNG(t, 40, 20), testPNG(t, 20, 40)}
+
+	t.Run("Default options", func(t *testing.T) {
+		out, err := service.ImagesToPDF(images, ImagesToPDFOptions{})
+		require.NoError(t, err)
+		assert.NoError(t, service.Validate(out))
+	})
+
+	t.Run("Letter with margin", func(t *testing.T) {
+		out, err := service.ImagesToPDF(images, ImagesToPDFOptions{PageSize: "Letter", Margin: 36, Fit: "contain"})
+		require.NoError(t, err)
+		assert.NoError(t, service.Validate(out))
+	})
+
+	t.Run("No images", func(t *testing.T) {
+		_, err := service.ImagesToPDF(nil, ImagesToPDFOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Not an image", func(t *testing.T) {
+		_, err := service.ImagesToPDF([][]byte{[]byte("not an image")}, ImagesToPDFOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		_, err := service.ImagesToPDF(images, ImagesToPDFOptions{PageSize: "B99"})
+		assert.Error(t, err)
+
+		_, err = service.ImagesToPDF(images, ImagesToPDFOptions{Margin: 400})
+		assert.Error(t, err)
+
+		_, err = service.ImagesToPDF(images, ImagesToPDFOptions{Fit: "stretch"})
+		assert.Error(t, err)
+	})
+}
+
+func TestPDFService_PDFToImages(t *testing.T) {
+	service := NewPDFService()
+
+	pdf, err := service.ImagesToPDF([][]byte{testPNG(t, 40, 20), testPNG(t, 20, 40)}, ImagesToPDFOptions{})
+	require.NoError(t, err)
+
+	t.Run("Extract all pages", func(t *testing.T) {
+		out, err := service.PDFToImages(pdf, PDFToImagesOptions{})
+		require.NoError(t, err)
+
+		zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+		require.NoError(t, err)
+		assert.Len(t, zr.File, 2)
+	})
+
+	t.Run("Extract selected pages", func(t *testing.T) {
+		out, err := service.PDFToImages(pdf, PDFToImagesOptions{Pages: []string{"2"}})
+		require.NoError(t, err)
+
+		zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+		require.NoError(t, err)
+		assert.Len(t, zr.File, 1)
+	})
+}
+
+func TestOrderInputs(t *testing.T) {
+	inputs := func() []InstructionDetail {
+		return []InstructionDetail{{FileName: "b.png"}, {FileName: "c.png"}, {FileName: "a.png"}}
+	}
+	names := func(details []InstructionDetail) []string {
+		out := make([]string, 0, len(details))
+		for _, d := range details {
+			out = append(out, d.FileName)
+		}
+		return out
+	}
+
+	upload := inputs()
+	assert.NoError(t, orderInputs(upload, ""))
+	assert.Equal(t, []string{"b.png", "c.png", "a.png"}, names(upload))
+
+	byName := inputs()
+	assert.NoError(t, orderInputs(byName, "name"))
+	assert.Equal(t, []string{"a.png", "b.png", "c.png"}, names(byName))
+
+	reverse := inputs()
+	assert.NoError(t, orderInputs(reverse, "reverse"))
+	assert.Equal(t, []string{"a.png", "c.png", "b.png"}, names(reverse))
+
+	assert.Error(t, orderInputs(inputs(), "random"))
+}
@@ -0,0 +1,540 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// FormSchema describes the fillable fields of a PDF as a JSON schema
+type FormSchema struct {
+	Schema     string                     `json:"$schema"`
+	Type       string                     `json:"type"`
+	Properties map[string]FormFieldSchema `json:"properties"`
+}
+
+// FormFieldSchema describes a single form field. Non-standard x- keywords carry PDF specifics.
+type FormFieldSchema struct {
+	Type      string           `json:"type"`
+	Format    string           `json:"format,omitempty"`
+	Enum      []string         `json:"enum,omitempty"`
+	Items     *FormFieldSchema `json:"items,omitempty"`
+	Default   interface{}      `json:"default,omitempty"`
+	ReadOnly  bool             `json:"readOnly,omitempty"`
+	FieldID   string           `json:"x-fieldId"`
+	FieldType string           `json:"x-fieldType"` // text, date, checkbox, combobox, listbox or radio
+	Pages     []int            `json:"x-pages"`
+}
+
+// FillFormOptions controls the fill-form product. Values are used unless a CSV data file is uploaded.
+type FillFormOptions struct {
+	Values  map[string]interface{} `json:"values"`
+	Flatten bool                   `json:"flatten"`
+}
+
+var ErrNoFormFields = errors.New("PDF does not contain any form fields")
+
+// FormFields lists the form fields of a PDF as a JSON schema
+func (s *PDFService) FormFields(file []byte) (*FormSchema, error) {
+	fields, err := s.formFields(file)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &FormSchema{
+		Schema:     "https://json-schema.org/draft/2020-12/schema",
+		Type:       "object",
+		Properties: map[string]FormFieldSchema{},
+	}
+	for _, f := range fields {
+		schema.Properties[fieldKey(f)] = fieldSchema(f)
+	}
+
+	return schema, nil
+}
+
+// FillForm fills the form fields of a PDF with the given values, keyed by field name or ID
+func (s *PDFService) FillForm(file []byte, opts FillFormOptions) ([]byte, error) {
+	fields, err := s.formFields(file)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]form.CSVFieldAttributes, len(opts.Values))
+	for key, v := range opts.Values {
+		f, ok := findField(fields, key)
+		if !ok {
+			return nil, fmt.Errorf("unknown form field %q", key)
+		}
+		values[key] = form.CSVFieldAttributes{Values: fieldValues(f, v)}
+	}
+
+	return fillForm(file, values, opts.Flatten)
+}
+
+// FillFormCSV fills the form once per CSV row and returns the filled PDFs in a ZIP archive.
+// The first row holds the field names or IDs.
+func (s *PDFService) FillFormCSV(file []byte, data []byte, flatten bool) ([]byte, error) {
+	fields, err := s.formFields(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV data: %w", err)
+	}
+	if len(rows) < 2 {
+		return nil, errors.New("CSV data needs a header row and at least one data row")
+	}
+
+	header := rows[0]
+	headerFields := make([]form.Field, 0, len(header))
+	for _, key := range header {
+		f, ok := findField(fields, key)
+		if !ok {
+			return nil, fmt.Errorf("unknown form field %q", key)
+		}
+		headerFields = append(headerFields, f)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	digits := len(fmt.Sprint(len(rows) - 1))
+
+	for i, row := range rows[1:] {
+		values := make(map[string]form.CSVFieldAttributes, len(header))
+		for j, key := range header {
+			values[key] = form.CSVFieldAttributes{Values: fieldValues(headerFields[j], row[j])}
+		}
+
+		filled, err := fillForm(file, values, flatten)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+
+		w, err := zw.Create(fmt.Sprintf("form_%0*d.pdf", digits, i+1))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(filled); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *PDFService) formFields(file []byte) ([]form.Field, error) {
+	if err := s.Validate(file); err != nil {
+		return nil, err
+	}
+
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.LISTFORMFIELDS
+
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(file), conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	if ctx.Form == nil {
+		return nil, ErrNoFormFields
+	}
+
+	fields, _, err := form.FormFields(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read form fields: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrNoFormFields
+	}
+
+	return fields, nil
+}
+
+func fillForm(file []byte, values map[string]form.CSVFieldAttributes, flatten bool) ([]byte, error) {
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.FILLFORMFIELDS
+
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(file), conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	ctx.RemoveSignature()
+
+	ok, _, err := form.FillForm(ctx, form.FillDetails(nil, values), nil, form.CSV)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fill form: %w", err)
+	}
+	if !ok {
+		return nil, api.ErrNoFormFieldsAffected
+	}
+
+	if flatten {
+		if err := flattenForm(ctx); err != nil {
+			return nil, fmt.Errorf("failed to flatten form: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := api.WriteContext(ctx, &buf); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// flattenForm draws the appearance of every visible widget into its page content
+// and drops the widgets and the AcroForm, so the result can no longer be edited
+func flattenForm(ctx *model.Context) error {
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		pageDict, _, inhAttrs, err := ctx.PageDict(pageNr, false)
+		if err != nil {
+			return err
+		}
+
+		annots, err := ctx.DereferenceArray(pageDict["Annots"])
+		if err != nil || annots == nil {
+			continue
+		}
+
+		var keep types.Array
+		var ops bytes.Buffer
+		xObjects := types.Dict{}
+
+		for _, o := range annots {
+			annot, err := ctx.DereferenceDict(o)
+			if err != nil || annot == nil || annot.Subtype() == nil || *annot.Subtype() != "Widget" {
+				keep = append(keep, o)
+				continue
+			}
+
+			ap, rect, ok, err := widgetAppearance(ctx, annot)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			name := fmt.Sprintf("Flat%d", len(xObjects))
+			xObjects[name] = ap
+			ops.WriteString(fmt.Sprintf("q %.4f 0 0 %.4f %.4f %.4f cm /%s Do Q\n", rect[0], rect[1], rect[2], rect[3], name))
+		}
+
+		if len(keep) == 0 {
+			pageDict.Delete("Annots")
+		} else {
+			pageDict["Annots"] = keep
+		}
+
+		if len(xObjects) == 0 {
+			continue
+		}
+
+		if err := addPageXObjects(ctx, pageDict, inhAttrs, xObjects); err != nil {
+			return err
+		}
+		if err := wrapPageContent(ctx, pageDict, ops.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	rootDict.Delete("AcroForm")
+	ctx.Form = nil
+
+	return nil
+}
+
+// widgetAppearance returns the normal appearance stream of a visible widget and the
+// scale and offset (sx, sy, tx, ty) that map its bounding box onto the widget rectangle
+func widgetAppearance(ctx *model.Context, annot types.Dict) (types.IndirectRef, [4]float64, bool, error) {
+	var m [4]float64
+
+	// Skip hidden (bit 2) and no-view (bit 6) widgets
+	if f := annot.IntEntry("F"); f != nil && *f&(1<<1|1<<5) != 0 {
+		return types.IndirectRef{}, m, false, nil
+	}
+
+	apDict := annot.DictEntry("AP")
+	if apDict == nil {
+		return types.IndirectRef{}, m, false, nil
+	}
+
+	n, found := apDict.Find("N")
+	if !found {
+		return types.IndirectRef{}, m, false, nil
+	}
+
+	indRef, _ := n.(types.IndirectRef)
+	o, err := ctx.Dereference(n)
+	if err != nil {
+		return types.IndirectRef{}, m, false, err
+	}
+
+	// Checkboxes and radio buttons keep one appearance per state, selected by AS
+	if states, ok := o.(types.Dict); ok {
+		as := annot.NameEntry("AS")
+		if as == nil {
+			return types.IndirectRef{}, m, false, nil
+		}
+		stateRef, ok := states[*as].(types.IndirectRef)
+		if !ok {
+			return types.IndirectRef{}, m, false, nil
+		}
+		indRef = stateRef
+		if o, err = ctx.Dereference(indRef); err != nil {
+			return types.IndirectRef{}, m, false, err
+		}
+	}
+
+	sd, ok := o.(types.StreamDict)
+	if !ok || indRef.ObjectNumber == 0 {
+		return types.IndirectRef{}, m, false, nil
+	}
+
+	rect, err := ctx.RectForArray(annot.ArrayEntry("Rect"))
+	if err != nil || rect == nil {
+		return types.IndirectRef{}, m, false, err
+	}
+	bbox, err := ctx.RectForArray(sd.ArrayEntry("BBox"))
+	if err != nil || bbox == nil {
+		return types.IndirectRef{}, m, false, err
+	}
+
+	// Transform the bounding box by the form matrix (PDF 32000-1, 12.5.5)
+	matrix := [6]float64{1, 0, 0, 1, 0, 0}
+	if a := sd.ArrayEntry("Matrix"); len(a) == 6 {
+		for i, v := range a {
+			if f, err := ctx.DereferenceNumber(v); err == nil {
+				matrix[i] = f
+			}
+		}
+	}
+	llx, lly, urx, ury := transformedBounds(bbox, matrix)
+	if urx-llx == 0 || ury-lly == 0 {
+		return types.IndirectRef{}, m, false, nil
+	}
+
+	sx := rect.Width() / (urx - llx)
+	sy := rect.Height() / (ury - lly)
+	m = [4]float64{sx, sy, rect.LL.X - llx*sx, rect.LL.Y - lly*sy}
+
+	return indRef, m, true, nil
+}
+
+func transformedBounds(r *types.Rectangle, m [6]float64) (float64, float64, float64, float64) {
+	xs := make([]float64, 0, 4)
+	ys := make([]float64, 0, 4)
+	for _, p := range [][2]float64{{r.LL.X, r.LL.Y}, {r.UR.X, r.LL.Y}, {r.LL.X, r.UR.Y}, {r.UR.X, r.UR.Y}} {
+		xs = append(xs, m[0]*p[0]+m[2]*p[1]+m[4])
+		ys = append(ys, m[1]*p[0]+m[3]*p[1]+m[5])
+	}
+
+	minMax := func(vv []float64) (float64, float64) {
+		lo, hi := vv[0], vv[0]
+		for _, v := range vv[1:] {
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		return lo, hi
+	}
+
+	llx, urx := minMax(xs)
+	lly, ury := minMax(ys)
+	return llx, lly, urx, ury
+}
+
+// addPageXObjects registers xObjects in the page's own resources, copying inherited resources first
+func addPageXObjects(ctx *model.Context, pageDict types.Dict, inhAttrs *model.InheritedPageAttrs, xObjects types.Dict) error {
+	res, err := ctx.DereferenceDict(pageDict["Resources"])
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		res = types.Dict{}
+		if inhAttrs != nil && inhAttrs.Resources != nil {
+			res = inhAttrs.Resources.Clone().(types.Dict)
+		}
+		pageDict["Resources"] = res
+	}
+
+	xo, err := ctx.DereferenceDict(res["XObject"])
+	if err != nil {
+		return err
+	}
+	if xo == nil {
+		xo = types.Dict{}
+		res["XObject"] = xo
+	}
+
+	for name, ref := range xObjects {
+		xo[name] = ref
+	}
+
+	return nil
+}
+
+// wrapPageContent isolates the existing page content in its own graphics state and appends ops
+func wrapPageContent(ctx *model.Context, pageDict types.Dict, ops []byte) error {
+	newStream := func(b []byte) (types.IndirectRef, error) {
+		sd, err := ctx.NewStreamDictForBuf(b)
+		if err != nil {
+			return types.IndirectRef{}, err
+		}
+		if err := sd.Encode(); err != nil {
+			return types.IndirectRef{}, err
+		}
+		ref, err := ctx.IndRefForNewObject(*sd)
+		if err != nil {
+			return types.IndirectRef{}, err
+		}
+		return *ref, nil
+	}
+
+	pre, err := newStream([]byte("q\n"))
+	if err != nil {
+		return err
+	}
+	post, err := newStream(append([]byte("\nQ\n"), ops...))
+	if err != nil {
+		return err
+	}
+
+	contents := types.Array{pre}
+	switch c := pageDict["Contents"].(type) {
+	case types.IndirectRef:
+		o, err := ctx.Dereference(c)
+		if err != nil {
+			return err
+		}
+		if a, ok := o.(types.Array); ok {
+			contents = append(contents, a...)
+		} else {
+			contents = append(contents, c)
+		}
+	case types.Array:
+		contents = append(contents, c...)
+	}
+	pageDict["Contents"] = append(contents, post)
+
+	return nil
+}
+
+func findField(fields []form.Field, key string) (form.Field, bool) {
+	for _, f := range fields {
+		if f.Name == key || f.ID == key {
+			return f, true
+		}
+	}
+	return form.Field{}, false
+}
+
+// fieldValues converts a JSON or CSV value into the string values pdfcpu fills in
+func fieldValues(f form.Field, v interface{}) []string {
+	switch val := v.(type) {
+	case bool:
+		if val {
+			return []string{"t"}
+		}
+		return []string{"f"}
+	case []interface{}:
+		values := make([]string, 0, len(val))
+		for _, item := range val {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case string:
+		if f.Typ == form.FTListBox {
+			return splitOptions(val)
+		}
+		if f.Typ == form.FTCheckBox {
+			switch strings.ToLower(strings.TrimSpace(val)) {
+			case "t", "true", "yes", "y", "1", "x", "on":
+				return []string{"t"}
+			}
+			return []string{"f"}
+		}
+		return []string{val}
+	case nil:
+		return []string{""}
+	default:
+		return []string{fmt.Sprint(val)}
+	}
+}
+
+func fieldKey(f form.Field) string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return f.ID
+}
+
+func fieldSchema(f form.Field) FormFieldSchema {
+	fs := FormFieldSchema{
+		Type:     "string",
+		ReadOnly: f.Locked,
+		FieldID:  f.ID,
+		Pages:    f.Pages,
+	}
+	if f.Dv != "" {
+		fs.Default = f.Dv
+	}
+
+	switch f.Typ {
+	case form.FTText:
+		fs.FieldType = "text"
+	case form.FTDate:
+		fs.FieldType = "date"
+		fs.Format = "date"
+	case form.FTCheckBox:
+		fs.FieldType = "checkbox"
+		fs.Type = "boolean"
+		fs.Default = nil
+		if f.Dv != "" {
+			fs.Default = f.Dv == "Yes" || f.Dv == "On" || strings.HasPrefix(strings.ToLower(f.Dv), "t")
+		}
+	case form.FTComboBox:
+		fs.FieldType = "combobox"
+		fs.Enum = splitOptions(f.Opts)
+	case form.FTRadioButtonGroup:
+		fs.FieldType = "radio"
+		fs.Enum = splitOptions(f.Opts)
+	case form.FTListBox:
+		fs.FieldType = "listbox"
+		fs.Type = "array"
+		fs.Items = &FormFieldSchema{Type: "string", Enum: splitOptions(f.Opts)}
+		if f.Dv != "" {
+			fs.Default = splitOptions(f.Dv)
+		}
+	}
+
+	return fs
+}
+
+func splitOptions(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
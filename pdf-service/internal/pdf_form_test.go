@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFormJSON = `{
+	"paper": "A4P",
+	"origin": "LowerLeft",
+	"fonts": {
+		"input": {"name": "Helvetica", "size": 12}
+	},
+	"pages": {
+		"1": {
+			"content": {
+				"textfield": [
+					{"id": "firstName", "value": "", "pos": [100, 700], "width": 150, "font": {"name": "$input"}},
+					{"id": "lastName", "value": "", "pos": [100, 670], "width": 150, "font": {"name": "$input"}}
+				],
+				"checkbox": [
+					{"id": "agree", "value": false, "pos": [100, 640], "width": 12}
+				]
+			}
+		}
+	}
+}`
+
+func testFormPDF(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, api.Create(nil, strings.NewReader(testFormJSON), &buf, nil))
+	return buf.Bytes()
+}
+
+func TestPDFService_FormFields(t *testing.T) {
+	service := NewPDFService()
+
+	schema, err := service.FormFields(testFormPDF(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, "object", schema.Type)
+	require.Contains(t, schema.Properties, "firstName")
+	assert.Equal(t, "string", schema.Properties["firstName"].Type)
+	assert.Equal(t, "text", schema.Properties["firstName"].FieldType)
+	assert.Equal(t, []int{1}, schema.Properties["firstName"].Pages)
+	require.Contains(t, schema.Properties, "agree")
+	assert.Equal(t, "boolean", schema.Properties["agree"].Type)
+
+	pdf, err := service.ImagesToPDF([][]byte{testPNG(t, 20, 20)}, ImagesToPDFOptions{})
+	require.NoError(t, err)
+	_, err = service.FormFields(pdf)
+	assert.ErrorIs(t, err, ErrNoFormFields)
+}
+
+func TestPDFService_FillForm(t *testing.T) {
+	service := NewPDFService()
+	file := testFormPDF(t)
+
+	t.Run("JSON values", func(t *testing.T) {
+		out, err := service.FillForm(file, FillFormOptions{
+			Values: map[string]interface{}{"firstName": "Jane", "lastName": "Doe", "agree": true},
+		})
+		require.NoError(t, err)
+
+		fields, err := service.formFields(out)
+		require.NoError(t, err)
+		values := map[string]string{}
+		for _, f := range fields {
+			values[fieldKey(f)] = f.V
+		}
+		assert.Equal(t, "Jane", values["firstName"])
+		assert.Equal(t, "Doe", values["lastName"])
+	})
+
+	t.Run("Flatten", func(t *testing.T) {
+		out, err := service.FillForm(file, FillFormOptions{
+			Values:  map[string]interface{}{"firstName": "Jane"},
+			Flatten: true,
+		})
+		require.NoError(t, err)
+		require.NoError(t, service.Validate(out))
+
+		_, err = service.FormFields(out)
+		assert.ErrorIs(t, err, ErrNoFormFields)
+	})
+
+	t.Run("Unknown field", func(t *testing.T) {
+		_, err := service.FillForm(file, FillFormOptions{Values: map[string]interface{}{"middleName": "X"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestPDFService_FillFormCSV(t *testing.T) {
+	service := NewPDFService()
+	file := testFormPDF(t)
+
+	data := "firstName,lastName,agree\nJane,\"Doe, Jr.\",yes\nJohn,Smith,no\n"
+
+	out, err := service.FillFormCSV(file, []byte(data), false)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+
+	rc, err := zr.File[0].Open()
+	require.NoError(t, err)
+	first, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	_ = rc.Close()
+
+	fields, err := service.formFields(first)
+	require.NoError(t, err)
+	for _, f := range fields {
+		if fieldKey(f) == "lastName" {
+			assert.Equal(t, "Doe, Jr.", f.V)
+		}
+	}
+
+	_, err = service.FillFormCSV(file, []byte("firstName\n"), false)
+	assert.Error(t, err)
+
+	_, err = service.FillFormCSV(file, []byte("@img\nlogo.png\n"), false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// NUpOptions controls how many source pages are placed on each output sheet
+type NUpOptions struct {
+	N           int      `json:"n"`           // 2, 4 (default), 8, 9 or 16 pages per sheet
+	PageSize    string   `json:"pageSize"`    // Sheet size, A4 (default), Letter, ...; append L for landscape
+	Orientation string   `json:"orientation"` // Grid order: rd (default), dr, ld or dl
+	Margin      float64  `json:"margin"`      // Margin in points around every page
+	Border      bool     `json:"border"`      // Draw a border around every page
+	Pages       []string `json:"pages"`       // pdfcpu page selection; all pages when empty
+}
+
+// BookletOptions controls booklet imposition for printing and folding
+type BookletOptions struct {
+	N        int      `json:"n"`        // Pages per sheet side: 2 (default), 4, 6 or 8
+	PageSize string   `json:"pageSize"` // Sheet size, A4 (default), Letter, ...
+	Binding  string   `json:"binding"`  // "long" (default) or "short" edge binding
+	Type     string   `json:"type"`     // "booklet" (default) or "perfectbound"
+	Guides   bool     `json:"guides"`   // Draw folding and cutting lines
+	Pages    []string `json:"pages"`    // pdfcpu page selection; all pages when empty
+}
+
+// ResizeOptions controls page normalization. Either PageSize or Scale is required.
+type ResizeOptions struct {
+	PageSize string   `json:"pageSize"` // Target size, e.g. A4 or Letter; append L or P to force orientation
+	Scale    float64  `json:"scale"`    // Scale factor, > 1 enlarges and < 1 shrinks
+	Pages    []string `json:"pages"`    // pdfcpu page selection; all pages when empty
+}
+
+var nUpValues = []int{2, 4, 8, 9, 16}
+
+// NUp places several pages on each sheet
+func (s *PDFService) NUp(file []byte, opts NUpOptions) ([]byte, error) {
+	if err := s.Validate(file); err != nil {
+		return nil, err
+	}
+
+	nup, err := nUpConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := api.NUp(bytes.NewReader(file), &buf, nil, opts.Pages, nup, nil); err != nil {
+		return nil, fmt.Errorf("failed to create n-up PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Booklet imposes pages so that printed sheets can be folded into a booklet
+func (s *PDFService) Booklet(file []byte, opts BookletOptions) ([]byte, error) {
+	if err := s.Validate(file); err != nil {
+		return nil, err
+	}
+
+	nup, err := bookletConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := api.Booklet(bytes.NewReader(file), &buf, nil, opts.Pages, nup, nil); err != nil {
+		return nil, fmt.Errorf("failed to create booklet: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Resize scales pages by a factor or fits them onto a common paper size
+func (s *PDFService) Resize(file []byte, opts ResizeOptions) ([]byte, error) {
+	if err := s.Validate(file); err != nil {
+		return nil, err
+	}
+
+	res, err := resizeConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := api.Resize(bytes.NewReader(file), &buf, opts.Pages, res, nil); err != nil {
+		return nil, fmt.Errorf("failed to resize PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func nUpConfig(opts NUpOptions) (*model.NUp, error) {
+	n := opts.N
+	if n == 0 {
+		n = 4
+	}
+	if !types.IntMemberOf(n, nUpValues) {
+		return nil, fmt.Errorf("n must be one of 2, 4, 8, 9 or 16")
+	}
+	if opts.Margin < 0 {
+		return nil, fmt.Errorf("margin must not be negative")
+	}
+
+	desc := []string{"formsize:" + defaultString(opts.PageSize, "A4")}
+	if opts.Orientation != "" {
+		desc = append(desc, "orientation:"+opts.Orientation)
+	}
+
+	nup, err := api.PDFNUpConfig(n, strings.Join(desc, ", "), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid n-up options: %w", err)
+	}
+	nup.Margin = opts.Margin
+	nup.Border = opts.Border
+	return nup, nil
+}
+
+func bookletConfig(opts BookletOptions) (*model.NUp, error) {
+	n := opts.N
+	if n == 0 {
+		n = 2
+	}
+
+	desc := []string{
+		"formsize:" + defaultString(opts.PageSize, "A4"),
+		"binding:" + defaultString(opts.Binding, "long"),
+		"btype:" + defaultString(opts.Type, "booklet"),
+	}
+
+	nup, err := api.PDFBookletConfig(n, strings.Join(desc, ", "), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid booklet options: %w", err)
+	}
+	nup.BookletGuides = opts.Guides
+	return nup, nil
+}
+
+func resizeConfig(opts ResizeOptions) (*model.Resize, error) {
+	var desc string
+	switch {
+	case opts.PageSize != "" && opts.Scale != 0:
+		return nil, fmt.Errorf("either pageSize or scale must be set, not both")
+	case opts.PageSize != "":
+		desc = "formsize:" + opts.PageSize
+	case opts.Scale > 0:
+		desc = fmt.Sprintf("scalefactor:%g", opts.Scale)
+	default:
+		return nil, fmt.Errorf("pageSize or a positive scale is required")
+	}
+
+	res, err := pdfcpu.ParseResizeConfig(desc, types.POINTS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resize options: %w", err)
+	}
+	return res, nil
+}
+
+func defaultString(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
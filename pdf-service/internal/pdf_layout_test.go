@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPages(t *testing.T, n int, pageSize string) []byte {
+	t.Helper()
+	images := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		images = append(images, testPNG(t, 30, 40))
+	}
+	pdf, err := NewPDFService().ImagesToPDF(images, ImagesToPDFOptions{PageSize: pageSize})
+	require.NoError(t, err)
+	return pdf
+}
+
+func TestPDFService_NUp(t *testing.T) {
+	service := NewPDFService()
+	pdf := testPages(t, 8, "A4")
+
+	t.Run("Default 4-up", func(t *testing.T) {
+		out, err := service.NUp(pdf, NUpOptions{})
+		require.NoError(t, err)
+
+		info, err := service.Inspect(out)
+		require.NoError(t, err)
+		assert.Equal(t, 2, info.PageCount)
+	})
+
+	t.Run("2-up landscape with border", func(t *testing.T) {
+		out, err := service.NUp(pdf, NUpOptions{N: 2, PageSize: "A4L", Border: true, Margin: 10})
+		require.NoError(t, err)
+
+		info, err := service.Inspect(out)
+		require.NoError(t, err)
+		assert.Equal(t, 4, info.PageCount)
+		assert.Greater(t, info.PageSizes[0].Width, info.PageSizes[0].Height)
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		_, err := service.NUp(pdf, NUpOptions{N: 3})
+		assert.Error(t, err)
+
+		_, err = service.NUp(pdf, NUpOptions{Orientation: "up"})
+		assert.Error(t, err)
+
+		_, err = service.NUp(pdf, NUpOptions{Margin: -1})
+		assert.Error(t, err)
+	})
+}
+
+func TestPDFService_Booklet(t *testing.T) {
+	service := NewPDFService()
+	pdf := testPages(t, 8, "A4")
+
+	out, err := service.Booklet(pdf, BookletOptions{Guides: true})
+	require.NoError(t, err)
+
+	info, err := service.Inspect(out)
+	require.NoError(t, err)
+	assert.Equal(t, 4, info.PageCount)
+
+	_, err = service.Booklet(pdf, BookletOptions{N: 16})
+	assert.Error(t, err)
+
+	_, err = service.Booklet(pdf, BookletOptions{Binding: "spiral"})
+	assert.Error(t, err)
+}
+
+func TestPDFService_Resize(t *testing.T) {
+	service := NewPDFService()
+	pdf := testPages(t, 2, "Letter")
+
+	t.Run("To A4", func(t *testing.T) {
+		out, err := service.Resize(pdf, ResizeOptions{PageSize: "A4"})
+		require.NoError(t, err)
+
+		info, err := service.Inspect(out)
+		require.NoError(t, err)
+		require.Len(t, info.PageSizes, 2)
+		assert.InDelta(t, 595.28, info.PageSizes[0].Width, 0.5)
+		assert.InDelta(t, 841.89, info.PageSizes[0].Height, 0.5)
+	})
+
+	t.Run("Scale", func(t *testing.T) {
+		out, err := service.Resize(pdf, ResizeOptions{Scale: 0.5})
+		require.NoError(t, err)
+
+		info, err := service.Inspect(out)
+		require.NoError(t, err)
+		assert.InDelta(t, 306, info.PageSizes[0].Width, 0.5)
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		_, err := service.Resize(pdf, ResizeOptions{})
+		assert.Error(t, err)
+
+		_, err = service.Resize(pdf, ResizeOptions{PageSize: "A4", Scale: 2})
+		assert.Error(t, err)
+
+		_, err = service.Resize(pdf, ResizeOptions{PageSize: "Napkin"})
+		assert.Error(t, err)
+	})
+}
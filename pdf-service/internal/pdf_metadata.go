@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// PDFProperties holds the standard document information entries users can edit
+type PDFProperties struct {
+	Title    string `json:"title"`
+	Author   string `json:"author"`
+	Subject  string `json:"subject"`
+	Keywords string `json:"keywords"`
+	Creator  string `json:"creator"`
+}
+
+// PDFPageSize is the media box of a single page in points
+type PDFPageSize struct {
+	Page   int     `json:"page"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// PDFInspection summarises a PDF so users can preview it before choosing a product
+type PDFInspection struct {
+	Version    string            `json:"version"`
+	PageCount  int               `json:"pageCount"`
+	PageSizes  []PDFPageSize     `json:"pageSizes"`
+	Encrypted  bool              `json:"encrypted"`
+	Linearized bool              `json:"linearized"`
+	Fonts      []string          `json:"fonts"`
+	Properties PDFProperties     `json:"properties"`
+	Bookmarks  []pdfcpu.Bookmark `json:"bookmarks"`
+}
+
+// PropertyChanges lists the document properties to change. Omitted properties are left
+// untouched and properties set to an empty string are removed.
+type PropertyChanges struct {
+	Title    *string `json:"title"`
+	Author   *string `json:"author"`
+	Subject  *string `json:"subject"`
+	Keywords *string `json:"keywords"`
+	Creator  *string `json:"creator"`
+}
+
+// EditMetadataOptions describes the changes applied by the edit-metadata product.
+// Bookmarks replace the existing outline when present; an empty list removes it.
+type EditMetadataOptions struct {
+	Properties PropertyChanges   `json:"properties"`
+	Bookmarks  []pdfcpu.Bookmark `json:"bookmarks"`
+}
+
+// Inspect reads document properties, outline and layout information from a PDF
+func (s *PDFService) Inspect(file []byte) (*PDFInspection, error) {
+	if err := s.Validate(file); err != nil {
+		return nil, err
+	}
+
+	// EXTRACTFONTS makes pdfcpu optimize the context, which collects the font objects
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.EXTRACTFONTS
+
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(file), conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	info, err := pdfcpu.Info(ctx, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF info: %w", err)
+	}
+
+	dims, err := ctx.PageDims()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page sizes: %w", err)
+	}
+	sizes := make([]PDFPageSize, 0, len(dims))
+	for i, d := range dims {
+		sizes = append(sizes, PDFPageSize{Page: i + 1, Width: d.Width, Height: d.Height})
+	}
+
+	bookmarks, err := pdfcpu.Bookmarks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bookmarks: %w", err)
+	}
+	if bookmarks == nil {
+		bookmarks = []pdfcpu.Bookmark{}
+	}
+
+	return &PDFInspection{
+		Version:    info.Version,
+		PageCount:  info.PageCount,
+		PageSizes:  sizes,
+		Encrypted:  info.Encrypted,
+		Linearized: info.Linearized,
+		Fonts:      fontNames(ctx),
+		Properties: PDFProperties{
+			Title:    ctx.Title,
+			Author:   ctx.Author,
+			Subject:  ctx.Subject,
+			Keywords: ctx.Keywords,
+			Creator:  ctx.Creator,
+		},
+		Bookmarks: bookmarks,
+	}, nil
+}
+
+// EditMetadata updates document properties and replaces the outline in a single pass
+func (s *PDFService) EditMetadata(file []byte, opts EditMetadataOptions) ([]byte, error) {
+	if err := s.Validate(file); err != nil {
+		return nil, err
+	}
+
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.ADDPROPERTIES
+
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(file), conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	set, remove := opts.Properties.infoDict()
+	if len(set) > 0 {
+		if err := pdfcpu.PropertiesAdd(ctx, set); err != nil {
+			return nil, fmt.Errorf("failed to set properties: %w", err)
+		}
+	}
+	// PropertiesRemove stops after the first key it finds, so keys are removed one at a time
+	for _, key := range remove {
+		if _, err := pdfcpu.PropertiesRemove(ctx, []string{key}); err != nil {
+			return nil, fmt.Errorf("failed to remove properties: %w", err)
+		}
+	}
+
+	if opts.Bookmarks != nil {
+		if err := validateBookmarks(opts.Bookmarks, ctx.PageCount); err != nil {
+			return nil, err
+		}
+		if len(opts.Bookmarks) == 0 {
+			_, err = pdfcpu.RemoveBookmarks(ctx)
+		} else {
+			err = pdfcpu.AddBookmarks(ctx, opts.Bookmarks, true)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write bookmarks: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := api.WriteContext(ctx, &buf); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// infoDict maps the changes to document information dictionary keys, split into the
+// properties to set and the ones to remove
+func (p PropertyChanges) infoDict() (map[string]string, []string) {
+	set := map[string]string{}
+	var remove []string
+	for key, value := range map[string]*string{
+		"Title":    p.Title,
+		"Author":   p.Author,
+		"Subject":  p.Subject,
+		"Keywords": p.Keywords,
+		"Creator":  p.Creator,
+	} {
+		switch {
+		case value == nil:
+		case *value == "":
+			remove = append(remove, key)
+		default:
+			set[key] = *value
+		}
+	}
+	sort.Strings(remove)
+	return set, remove
+}
+
+func validateBookmarks(bookmarks []pdfcpu.Bookmark, pageCount int) error {
+	for _, bm := range bookmarks {
+		if bm.Title == "" {
+			return fmt.Errorf("bookmark title is required")
+		}
+		if bm.PageFrom < 1 || bm.PageFrom > pageCount {
+			return fmt.Errorf("bookmark %q points to page %d, document has %d pages", bm.Title, bm.PageFrom, pageCount)
+		}
+		if err := validateBookmarks(bm.Kids, pageCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fontNames(ctx *model.Context) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, fo := range ctx.Optimize.FontObjects {
+		if fo.FontName == "" || seen[fo.FontName] {
+			continue
+		}
+		seen[fo.FontName] = true
+		names = append(names, fo.FontName)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPDFService_Inspect(t *testing.T) {
+	service := NewPDFService()
+
+	pdf, err := service.ImagesToPDF([][]byte{testPNG(t, 40, 20), testPNG(t, 20, 40)}, ImagesToPDFOptions{PageSize: "Letter"})
+	require.NoError(t, err)
+
+	info, err := service.Inspect(pdf)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, info.PageCount)
+	assert.NotEmpty(t, info.Version)
+	assert.False(t, info.Encrypted)
+	require.Len(t, info.PageSizes, 2)
+	assert.Equal(t, 1, info.PageSizes[0].Page)
+	assert.InDelta(t, 612, info.PageSizes[0].Width, 0.5)
+	assert.InDelta(t, 792, info.PageSizes[0].Height, 0.5)
+	assert.Empty(t, info.Bookmarks)
+
+	_, err = service.Inspect([]byte("not a pdf"))
+	assert.Error(t, err)
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestPDFService_EditMetadata(t *testing.T) {
+	service := NewPDFService()
+
+	pdf, err := service.ImagesToPDF([][]byte{testPNG(t, 40, 20), testPNG(t, 20, 40)}, ImagesToPDFOptions{})
+	require.NoError(t, err)
+
+	t.Run("Properties and bookmarks", func(t *testing.T) {
+		out, err := service.EditMetadata(pdf, EditMetadataOptions{
+			Properties: PropertyChanges{Title: ptr("Annual Report"), Author: ptr("Jane Doe"), Keywords: ptr("report, 2025")},
+			Bookmarks: []pdfcpu.Bookmark{
+				{Title: "Intro", PageFrom: 1, Kids: []pdfcpu.Bookmark{{Title: "Scope", PageFrom: 1}}},
+				{Title: "Results", PageFrom: 2},
+			},
+		})
+		require.NoError(t, err)
+
+		info, err := service.Inspect(out)
+		require.NoError(t, err)
+		assert.Equal(t, "Annual Report", info.Properties.Title)
+		assert.Equal(t, "Jane Doe", info.Properties.Author)
+		assert.Equal(t, "report, 2025", info.Properties.Keywords)
+		require.Len(t, info.Bookmarks, 2)
+		assert.Equal(t, "Intro", info.Bookmarks[0].Title)
+		require.Len(t, info.Bookmarks[0].Kids, 1)
+		assert.Equal(t, "Scope", info.Bookmarks[0].Kids[0].Title)
+		assert.Equal(t, 2, info.Bookmarks[1].PageFrom)
+
+		t.Run("Remove bookmarks", func(t *testing.T) {
+			cleared, err := service.EditMetadata(out, EditMetadataOptions{Bookmarks: []pdfcpu.Bookmark{}})
+			require.NoError(t, err)
+
+			info, err := service.Inspect(cleared)
+			require.NoError(t, err)
+			assert.Empty(t, info.Bookmarks)
+			assert.Equal(t, "Annual Report", info.Properties.Title)
+		})
+
+		t.Run("Clear properties", func(t *testing.T) {
+			cleared, err := service.EditMetadata(out, EditMetadataOptions{
+				Properties: PropertyChanges{Title: ptr(""), Keywords: ptr("")},
+			})
+			require.NoError(t, err)
+
+			info, err := service.Inspect(cleared)
+			require.NoError(t, err)
+			assert.Empty(t, info.Properties.Title)
+			assert.Empty(t, info.Properties.Keywords)
+			assert.Equal(t, "Jane Doe", info.Properties.Author, "omitted properties are left untouched")
+		})
+	})
+
+	t.Run("Bookmark outside the document", func(t *testing.T) {
+		_, err := service.EditMetadata(pdf, EditMetadataOptions{
+			Bookmarks: []pdfcpu.Bookmark{{Title: "Missing", PageFrom: 5}},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Bookmark without title", func(t *testing.T) {
+		_, err := service.EditMetadata(pdf, EditMetadataOptions{
+			Bookmarks: []pdfcpu.Bookmark{{PageFrom: 1}},
+		})
+		assert.Error(t, err)
+	})
+}
@@ -3,11 +3,16 @@ package internal
 import (
 	"bytes"
 	"fmt"
-	"os"
-	"path/filepath"
+	"image"
+	"image/draw"
+	"image/jpeg"
 
+	"github.com/disintegration/imaging"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 )
 
 type PDFService struct{}
@@ -16,54 +21,217 @@ func NewPDFService() *PDFService {
 	return &PDFService{}
 }
 
-// Compress processes a PDF file using pdfcpu optimization
-func (s *PDFService) Compress(file []byte) ([]byte, error) {
+// Compression levels accepted by Compress
+const (
+	CompressLevelLossless   = "lossless"   // Rewrite with compressed object and xref streams only
+	CompressLevelDedupe     = "dedupe"     // Also merge duplicate fonts and images
+	CompressLevelAggressive = "aggressive" // Also downsample and re-encode embedded JPEGs
+)
+
+// CompressOptions controls how hard Compress works on a PDF
+type CompressOptions struct {
+	Level        string `json:"level"`        // lossless, dedupe (default) or aggressive
+	MaxImageSize int    `json:"maxImageSize"` // aggressive: longest image side in pixels, default 1600
+	JPEGQuality  int    `json:"jpegQuality"`  // aggressive: JPEG quality 1-100, default 60
+}
+
+// CompressReport describes what a compression job achieved. It is stored on the output detail.
+type CompressReport struct {
+	Level                string           `json:"level" bson:"level"`
+	OriginalSize         int64            `json:"originalSize" bson:"originalSize"`
+	CompressedSize       int64            `json:"compressedSize" bson:"compressedSize"`
+	BytesSaved           int64            `json:"bytesSaved" bson:"bytesSaved"`
+	BytesSavedByCategory map[string]int64 `json:"bytesSavedByCategory" bson:"bytesSavedByCategory"` // images, fonts and other
+	ImagesRecompressed   int              `json:"imagesRecompressed" bson:"imagesRecompressed"`
+	ImagesDeduplicated   int              `json:"imagesDeduplicated" bson:"imagesDeduplicated"`
+	FontsDeduplicated    int              `json:"fontsDeduplicated" bson:"fontsDeduplicated"`
+	KeptOriginal         bool             `json:"keptOriginal" bson:"keptOriginal"` // Output was not smaller, original returned
+}
+
+// Compress optimizes a PDF with pdfcpu at the requested level and reports the savings
+func (s *PDFService) Compress(file []byte, opts CompressOptions) ([]byte, *CompressReport, error) {
 	// Validate the PDF first
 	err := s.Validate(file)
 	if err != nil {
-		return nil, fmt.Errorf("invalid PDF file: %w", err)
+		return nil, nil, fmt.Errorf("invalid PDF file: %w", err)
 	}
 
-	// Create temporary files for pdfcpu processing
-	tempDir := "/tmp"
-	inputFile := filepath.Join(tempDir, "input.pdf")
-	outputFile := filepath.Join(tempDir, "output.pdf")
-
-	// Write input file
-	err = os.WriteFile(inputFile, file, 0644)
+	level, err := compressLevel(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write input file: %w", err)
+		return nil, nil, err
+	}
+
+	report := &CompressReport{
+		Level:                level,
+		OriginalSize:         int64(len(file)),
+		BytesSavedByCategory: map[string]int64{"images": 0, "fonts": 0, "other": 0},
 	}
-	defer os.Remove(inputFile)
-	defer os.Remove(outputFile)
 
-	// Use pdfcpu to optimize/compress the PDF
-	err = api.OptimizeFile(inputFile, outputFile, nil)
+	ctx, err := readForCompression(file, level)
 	if err != nil {
 		log.Errorf("Failed to compress PDF: %v", err)
-		return nil, fmt.Errorf("failed to compress PDF: %w", err)
+		return nil, nil, fmt.Errorf("failed to compress PDF: %w", err)
 	}
 
-	// Read the compressed file
-	compressed, err := os.ReadFile(outputFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read compressed file: %w", err)
+	var imagesSaved int64
+	if level == CompressLevelAggressive {
+		report.ImagesRecompressed, imagesSaved = recompressImages(ctx, opts)
 	}
 
+	var buf bytes.Buffer
+	if err := api.WriteContext(ctx, &buf); err != nil {
+		log.Errorf("Failed to compress PDF: %v", err)
+		return nil, nil, fmt.Errorf("failed to compress PDF: %w", err)
+	}
+	compressed := buf.Bytes()
+
 	// Check if compression actually reduced size
 	if len(compressed) >= len(file) {
-		log.Infof("PDF compression did not reduce size, returning original")
-		return file, nil
+		log.Info("PDF compression did not reduce size, returning original")
+		report.CompressedSize = report.OriginalSize
+		report.KeptOriginal = true
+		report.ImagesRecompressed = 0
+		return file, report, nil
+	}
+
+	if level != CompressLevelLossless {
+		report.ImagesDeduplicated = len(ctx.Optimize.DuplicateImages)
+		report.FontsDeduplicated = len(ctx.Optimize.DuplicateFonts)
+	}
+	report.CompressedSize = int64(len(compressed))
+	report.BytesSaved = report.OriginalSize - report.CompressedSize
+	report.BytesSavedByCategory["images"] = ctx.Read.BinaryImageDuplSize + imagesSaved
+	report.BytesSavedByCategory["fonts"] = ctx.Read.BinaryFontDuplSize
+	if other := report.BytesSaved - report.BytesSavedByCategory["images"] - report.BytesSavedByCategory["fonts"]; other > 0 {
+		report.BytesSavedByCategory["other"] = other
+	}
+
+	log.Infof("PDF compressed successfully (%s): %d bytes -> %d bytes (%.1f%% reduction)",
+		level, len(file), len(compressed), float64(len(file)-len(compressed))/float64(len(file))*100)
+
+	return compressed, report, nil
+}
+
+// compressLevel returns the requested compression level, dedupe when none is set
+func compressLevel(opts CompressOptions) (string, error) {
+	switch opts.Level {
+	case "":
+		return CompressLevelDedupe, nil
+	case CompressLevelLossless, CompressLevelDedupe, CompressLevelAggressive:
+		return opts.Level, nil
+	}
+	return "", fmt.Errorf("unknown compression level %q", opts.Level)
+}
+
+// readForCompression reads the PDF and, above the lossless level, deduplicates fonts and images.
+// Resource dictionary cleanup is retried without when a page references missing resources.
+func readForCompression(file []byte, level string) (*model.Context, error) {
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.OPTIMIZE
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(file), conf)
+	if err != nil || level == CompressLevelLossless {
+		return ctx, err
+	}
+
+	err = api.OptimizeContext(ctx)
+	if err == nil {
+		return ctx, nil
 	}
+	log.Warnf("Optimizing resource dictionaries failed, retrying without: %v", err)
+
+	conf = model.NewDefaultConfiguration()
+	conf.Cmd = model.OPTIMIZE
+	conf.OptimizeResourceDicts = false
 
-	log.Infof("PDF compressed successfully: %d bytes -> %d bytes (%.1f%% reduction)",
-		len(file), len(compressed), float64(len(file)-len(compressed))/float64(len(file))*100)
+	if ctx, err = api.ReadAndValidate(bytes.NewReader(file), conf); err != nil {
+		return nil, err
+	}
+	if err := api.OptimizeContext(ctx); err != nil {
+		return nil, err
+	}
 
-	return compressed, nil
+	return ctx, nil
+}
+
+// recompressImages downsamples and re-encodes embedded RGB and grayscale JPEGs in place.
+// It returns how many images were replaced and how many bytes that saved.
+func recompressImages(ctx *model.Context, opts CompressOptions) (int, int64) {
+	maxSize := opts.MaxImageSize
+	if maxSize <= 0 {
+		maxSize = 1600
+	}
+	quality := opts.JPEGQuality
+	if quality <= 0 || quality > 100 {
+		quality = 60
+	}
+
+	count := 0
+	var saved int64
+	for objNr, imgObj := range ctx.Optimize.ImageObjects {
+		sd := imgObj.ImageDict
+		if sd == nil || len(sd.FilterPipeline) != 1 || sd.FilterPipeline[0].Name != filter.DCT {
+			continue
+		}
+
+		// CMYK, indexed and decode-mapped JPEGs would change colours when re-encoded
+		cs := sd.NameEntry("ColorSpace")
+		if cs == nil || (*cs != "DeviceRGB" && *cs != "DeviceGray") || sd.Dict["Decode"] != nil {
+			continue
+		}
+
+		img, err := jpeg.Decode(bytes.NewReader(sd.Raw))
+		if err != nil {
+			continue
+		}
+
+		b := img.Bounds()
+		if b.Dx() > maxSize || b.Dy() > maxSize {
+			img = imaging.Fit(img, maxSize, maxSize, imaging.Lanczos)
+		}
+		if *cs == "DeviceGray" {
+			img = imaging.Grayscale(img)
+			gray := image.NewGray(img.Bounds())
+			draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+			img = gray
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			continue
+		}
+		if buf.Len() >= len(sd.Raw) {
+			continue
+		}
+
+		entry, found := ctx.FindTableEntryLight(objNr)
+		if !found {
+			continue
+		}
+
+		saved += int64(len(sd.Raw) - buf.Len())
+		count++
+
+		l := int64(buf.Len())
+		sd.Raw = buf.Bytes()
+		sd.Content = nil
+		sd.StreamLength = &l
+		sd.Update("Length", types.Integer(l))
+		sd.Update("Width", types.Integer(img.Bounds().Dx()))
+		sd.Update("Height", types.Integer(img.Bounds().Dy()))
+		sd.Update("BitsPerComponent", types.Integer(8))
+		entry.Object = *sd
+	}
+
+	return count, saved
 }
 
 // Validate checks if the provided data is a valid PDF
 func (s *PDFService) Validate(file []byte) error {
+	if len(file) == 0 {
+		return fmt.Errorf("invalid PDF file: empty input")
+	}
+
 	reader := bytes.NewReader(file)
 
 	// Try to read PDF context to validate
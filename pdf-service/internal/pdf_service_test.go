@@ -1,9 +1,15 @@
 package internal
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestPDFService_Compress tests the PDF compression functionality
@@ -73,13 +79,25 @@ startxref
 		assert.NoError(t, err)
 
 		// Compress the PDF
-		compressed, err := service.Compress(pdfBytes)
+		compressed, report, err := service.Compress(pdfBytes, CompressOptions{})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, compressed)
 
 		// The compressed result should still be a valid PDF
 		err = service.Validate(compressed)
 		assert.NoError(t, err)
+
+		// The report always describes the job
+		if assert.NotNil(t, report) {
+			assert.Equal(t, CompressLevelDedupe, report.Level)
+			assert.Equal(t, int64(len(pdfBytes)), report.OriginalSize)
+			assert.Equal(t, int64(len(compressed)), report.CompressedSize)
+		}
+	})
+
+	t.Run("Unknown level", func(t *testing.T) {
+		_, _, err := service.Compress(pdfBytes, CompressOptions{Level: "maximum"})
+		assert.Error(t, err)
 	})
 
 	t.Run("Invalid PDF", func(t *testing.T) {
@@ -165,3 +183,60 @@ startxref
 		assert.Error(t, err)
 	})
 }
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd := rand.New(rand.NewSource(1))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(rnd.Intn(256)), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	return buf.Bytes()
+}
+
+// TestPDFService_CompressLevels tests the optimization levels and their reports
+func TestPDFService_CompressLevels(t *testing.T) {
+	service := NewPDFService()
+
+	photo := testJPEG(t, 1200, 900)
+	pdf, err := service.ImagesToPDF([][]byte{photo, photo}, ImagesToPDFOptions{})
+	require.NoError(t, err)
+
+	t.Run("Lossless", func(t *testing.T) {
+		out, report, err := service.Compress(pdf, CompressOptions{Level: CompressLevelLossless})
+		require.NoError(t, err)
+		assert.NoError(t, service.Validate(out))
+		assert.Equal(t, CompressLevelLossless, report.Level)
+		assert.Zero(t, report.ImagesRecompressed)
+		assert.Zero(t, report.ImagesDeduplicated)
+	})
+
+	t.Run("Dedupe", func(t *testing.T) {
+		out, report, err := service.Compress(pdf, CompressOptions{Level: CompressLevelDedupe})
+		require.NoError(t, err)
+		assert.NoError(t, service.Validate(out))
+		assert.False(t, report.KeptOriginal)
+		assert.Equal(t, 1, report.ImagesDeduplicated)
+		assert.Greater(t, report.BytesSavedByCategory["images"], int64(0))
+		assert.Equal(t, report.OriginalSize-report.CompressedSize, report.BytesSaved)
+	})
+
+	t.Run("Aggressive", func(t *testing.T) {
+		dedupe, _, err := service.Compress(pdf, CompressOptions{Level: CompressLevelDedupe})
+		require.NoError(t, err)
+
+		out, report, err := service.Compress(pdf, CompressOptions{Level: CompressLevelAggressive, MaxImageSize: 600, JPEGQuality: 50})
+		require.NoError(t, err)
+		assert.NoError(t, service.Validate(out))
+		assert.Equal(t, 1, report.ImagesRecompressed)
+		assert.Less(t, len(out), len(dedupe))
+
+		info, err := service.Inspect(out)
+		require.NoError(t, err)
+		assert.Equal(t, 2, info.PageCount)
+	})
+}
@@ -16,3 +16,15 @@ type Product struct {
 	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
 }
+
+// Product keys handled by the pdf-service processor
+const (
+	ProductKeyCompress     = "pdfs/compress"
+	ProductKeyImagesToPDF  = "pdfs/images-to-pdf"
+	ProductKeyPDFToImages  = "pdfs/pdf-to-images"
+	ProductKeyEditMetadata = "pdfs/edit-metadata"
+	ProductKeyFillForm     = "pdfs/fill-form"
+	ProductKeyNUp          = "pdfs/n-up"
+	ProductKeyBooklet      = "pdfs/booklet"
+	ProductKeyResize       = "pdfs/resize"
+)
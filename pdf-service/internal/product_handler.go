@@ -2,6 +2,8 @@ package internal
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ProductHandler struct {
@@ -30,3 +32,68 @@ func (h *ProductHandler) ListProducts(c *fiber.Ctx) error {
 		"data":    products,
 	})
 }
+
+// UpdateProduct changes a product's name, price or active flag. Admin only.
+func (h *ProductHandler) UpdateProduct(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid product ID",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	var input struct {
+		Name   *string  `json:"name"`
+		Price  *float64 `json:"price"`
+		Active *bool    `json:"active"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+
+	fields := bson.M{}
+	if input.Name != nil {
+		fields["name"] = *input.Name
+	}
+	if input.Price != nil {
+		if *input.Price < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Price cannot be negative",
+				"errors":  nil,
+				"data":    nil,
+			})
+		}
+		fields["price"] = *input.Price
+	}
+	if input.Active != nil {
+		fields["active"] = *input.Active
+	}
+
+	product, err := h.productRepo.Update(id, "pdf", fields)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update product",
+			"errors":  err.Error(),
+			"data":    nil,
+		})
+	}
+	if product == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Product not found",
+			"errors":  nil,
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"errors":  nil,
+		"data":    product,
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProductRepository struct {
@@ -61,3 +62,44 @@ func (r *ProductRepository) FindByID(id primitive.ObjectID, productType string)
 
 	return &product, nil
 }
+
+// FindByKey returns the active product of the type with the given key, or nil if there is none
+func (r *ProductRepository) FindByKey(key string, productType string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"key": key, "type": productType, "active": true}
+
+	var product Product
+	err := r.collection.FindOne(ctx, filter).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Printf("Failed to find product by key %s: %v", key, err)
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// Update applies the given fields to a product of the type and returns the updated product, or nil if it does not exist
+func (r *ProductRepository) Update(id primitive.ObjectID, productType string, fields bson.M) (*Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fields["updatedAt"] = time.Now().UTC()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var product Product
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "type": productType}, bson.M{"$set": fields}, opts).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Printf("Failed to update product %s: %v", id.Hex(), err)
+		return nil, err
+	}
+
+	return &product, nil
+}
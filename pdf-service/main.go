@@ -5,6 +5,8 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
+	"github.com/instrlabs/common/identity"
+	"github.com/instrlabs/common/jwks"
 	initx "github.com/instrlabs/shared/init"
 	natsgo "github.com/nats-io/nats.go"
 
@@ -36,6 +38,7 @@ func main() {
 	initx.SetupLogger(app)
 	initx.SetupServiceSwagger(app, cfg.ApiUrl, "/pdfs")
 	initx.SetupServiceHealth(app)
+	identity.SetupServiceIdentity(app, jwks.New(cfg.JWKSURL, time.Duration(cfg.JWKSCacheMinutes)*time.Minute).Keyfunc, cfg.TrustedServices)
 	initx.SetupAuthenticated(app, []string{
 		"/products",
 	})
@@ -48,10 +51,20 @@ func main() {
 
 	productHandler := internal.NewProductHandler(productRepo)
 	instrHandler := internal.NewInstructionHandler(cfg, s3, nats, instrRepo, detailRepo, productRepo, pdfSvc)
+	inspectHandler := internal.NewInspectHandler(pdfSvc)
 
 	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectPdfRequests, func(m *natsgo.Msg) {
 		instrHandler.RunInstructionMessage(m.Data)
 	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectPdfImages, func(m *natsgo.Msg) {
+		_ = m.Respond(instrHandler.ImagesHandoffMessage(m.Data))
+	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectAccountDeleted, func(m *natsgo.Msg) {
+		instrHandler.AccountDeletionMessage(m.Data)
+	})
+	_, _ = nats.Conn.Subscribe(cfg.NatsSubjectAccountExport, func(m *natsgo.Msg) {
+		_ = m.Respond(instrHandler.AccountExportMessage(m.Data))
+	})
 
 	go func() {
 		ticker := time.NewTicker(30 * time.Minute)
@@ -73,9 +86,15 @@ func main() {
 	app.Get("/instructions/:id", instrHandler.GetInstructionByID)
 	app.Get("/instructions/:id/details", instrHandler.GetInstructionDetails)
 
-	app.Get("/files", instrHandler.ListUncleanedFiles)
+	admin := identity.RequireRole(identity.RoleAdmin)
+
+	app.Get("/files", admin, instrHandler.ListUncleanedFiles)
 
 	app.Get("/products", productHandler.ListProducts)
+	app.Post("/products/:id", admin, productHandler.UpdateProduct)
+
+	app.Post("/inspect", inspectHandler.InspectFile)
+	app.Post("/forms/fields", inspectHandler.ListFormFields)
 
 	log.Fatal(app.Listen(cfg.Port))
 }
@@ -25,10 +25,14 @@ func formatBytes(bytes int) string {
 
 func main() {
 	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run test_compress.go <pdf_file>")
+		log.Fatal("Usage: go run test_compress.go <pdf_file> [lossless|dedupe|aggressive]")
 	}
 
 	pdfPath := os.Args[1]
+	opts := internal.CompressOptions{}
+	if len(os.Args) > 2 {
+		opts.Level = os.Args[2]
+	}
 
 	// Read PDF file
 	originalData, err := ioutil.ReadFile(pdfPath)
@@ -40,7 +44,7 @@ func main() {
 	service := internal.NewPDFService()
 
 	// Compress PDF using the actual service
-	compressedData, err := service.Compress(originalData)
+	compressedData, report, err := service.Compress(originalData, opts)
 	if err != nil {
 		log.Fatalf("PDF compression failed: %v", err)
 	}
@@ -56,6 +60,13 @@ func main() {
 	fmt.Printf("   Original Size:  %s\n", formatBytes(originalSize))
 	fmt.Printf("   Compressed Size: %s\n", formatBytes(compressedSize))
 	fmt.Printf("   Reduction:      %.1f%%\n", reduction)
+	fmt.Printf("   Level:          %s\n", report.Level)
+	fmt.Printf("   Saved:          images %s, fonts %s, other %s\n",
+		formatBytes(int(report.BytesSavedByCategory["images"])),
+		formatBytes(int(report.BytesSavedByCategory["fonts"])),
+		formatBytes(int(report.BytesSavedByCategory["other"])))
+	fmt.Printf("   Recompressed:   %d images, deduplicated %d images and %d fonts\n",
+		report.ImagesRecompressed, report.ImagesDeduplicated, report.FontsDeduplicated)
 
 	if compressedSize < originalSize {
 		fmt.Printf("   Status:         ✅ Compressed successfully\n")